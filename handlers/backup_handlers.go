@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// maxBackupBytes caps the size of an uploaded trip backup
+const maxBackupBytes = 20 << 20
+
+// ExportTripBackupHandler returns a trip with its expenses, payments and participants
+// as a downloadable JSON document that ImportTripBackupHandler can restore
+func ExportTripBackupHandler(c *gin.Context) {
+	var request models.GetTripByCodeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	backup, err := handlerServices.BackupService.ExportTrip(trip)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"trip-%s-backup.json\"", trip.Code))
+	utils.HandleSuccess(c, backup)
+}
+
+// ImportTripBackupHandler recreates a trip from an exported backup under a new code
+func ImportTripBackupHandler(c *gin.Context) {
+	if c.ContentType() != "application/json" {
+		utils.HandleError(c, utils.NewBadRequestError("Backup must be sent as application/json"))
+		return
+	}
+	// Reject a declared oversized body before reading any of it
+	if c.Request.ContentLength > maxBackupBytes {
+		respondBackupTooLarge(c)
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBackupBytes)
+
+	var backup models.TripBackup
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&backup)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after the backup document")
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondBackupTooLarge(c)
+			return
+		}
+		utils.HandleError(c, utils.NewBadRequestError(fmt.Sprintf("Invalid backup document: %v", err)))
+		return
+	}
+
+	trip, err := handlerServices.BackupService.ImportTrip(&backup)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleCreated(c, tripLocation(trip.Code), trip)
+}
+
+// respondBackupTooLarge rejects a backup larger than maxBackupBytes
+func respondBackupTooLarge(c *gin.Context) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error": fmt.Sprintf("Backup is too large. The maximum size is %s.", formatUploadLimit(maxBackupBytes)),
+	})
+}
@@ -1,24 +1,20 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/fadhlanhapp/sharetab-backend/models"
 	"github.com/fadhlanhapp/sharetab-backend/repository"
 	"github.com/fadhlanhapp/sharetab-backend/services"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
 	"github.com/gin-gonic/gin"
 )
 
-// ExportTripToExcel exports a trip's data to Excel format
-func ExportTripToExcel(c *gin.Context) {
-	var request models.GetTripByCodeRequest
-
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-		return
-	}
-
+// newExcelService wires up the services needed for trip exports
+func newExcelService() *services.ExcelService {
 	// Initialize services
 	tripService := services.NewTripService()
 	expenseService := services.NewExpenseService()
@@ -29,10 +25,27 @@ func ExportTripToExcel(c *gin.Context) {
 	paymentService := services.NewPaymentService(paymentRepo, tripRepo)
 	
 	settlementService := services.NewSettlementService(expenseService, paymentService)
-	excelService := services.NewExcelService(tripService, expenseService, settlementService, paymentService)
+	return services.NewExcelService(tripService, expenseService, settlementService, paymentService)
+}
+
+// ExportTripToExcel exports a trip's data to Excel format
+func ExportTripToExcel(c *gin.Context) {
+	var request models.ExportTripRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	excelService := newExcelService()
 
 	// Generate Excel file
-	excelFile, filename, err := excelService.ExportTripToExcel(request.Code)
+	excelFile, filename, err := excelService.ExportTripToExcel(request.Code, request.Participant)
+	var appErr *utils.AppError
+	if errors.As(err, &appErr) {
+		c.JSON(appErr.Code, gin.H{"error": appErr.Message})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export trip: " + err.Error()})
 		return
@@ -48,4 +61,58 @@ func ExportTripToExcel(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write Excel file: " + err.Error()})
 		return
 	}
-}
\ No newline at end of file
+}
+
+// ExportTripToCSV exports a trip's person summary and expense matrix as CSV
+func ExportTripToCSV(c *gin.Context) {
+	var request models.GetTripByCodeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Generate CSV file
+	data, filename, err := newExcelService().ExportTripToCSV(request.Code)
+	if err != nil {
+		respondExportError(c, "export_csv", err)
+		return
+	}
+
+	// Set headers for file download
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
+
+// respondExportError reports AppErrors such as a missing trip as they are, and any
+// other export failure as a 500 without its internal details
+func respondExportError(c *gin.Context, operation string, err error) {
+	var appErr *utils.AppError
+	if errors.As(err, &appErr) {
+		utils.HandleError(c, err)
+		return
+	}
+	slog.Error("Failed to export trip", "operation", operation, "error", err)
+	utils.HandleError(c, utils.NewInternalError("Failed to export trip"))
+}
+
+// ExportTripToPDF exports a trip's net balances and required settlements as a PDF
+func ExportTripToPDF(c *gin.Context) {
+	var request models.GetTripByCodeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Generate PDF file
+	data, filename, err := newExcelService().ExportTripToPDF(request.Code)
+	if err != nil {
+		respondExportError(c, "export_pdf", err)
+		return
+	}
+
+	// Set headers for file download
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Data(http.StatusOK, "application/pdf", data)
+}
@@ -1,7 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 	
 	"github.com/fadhlanhapp/sharetab-backend/models"
 	"github.com/fadhlanhapp/sharetab-backend/services"
@@ -18,6 +24,12 @@ type HandlerServices struct {
 	CalculationService *services.CalculationService
 	SettlementService *services.SettlementService
 	PaymentService    *services.PaymentService
+	SnapshotService   *services.SnapshotService
+	ReportService     *services.ReportService
+	ReceiptService    *services.ReceiptService
+	AttachmentService *services.AttachmentService
+	TemplateService   *services.TemplateService
+	BackupService     *services.BackupService
 }
 
 // NewHandlerServices creates a new handler services instance
@@ -29,6 +41,7 @@ func NewHandlerServices() *HandlerServices {
 	paymentRepo := repository.NewPaymentRepository(repository.GetDB())
 	tripRepo := repository.NewTripRepository()
 	paymentService := services.NewPaymentService(paymentRepo, tripRepo)
+	snapshotService := services.NewSnapshotService(repository.NewSnapshotRepository(repository.GetDB()))
 	
 	return &HandlerServices{
 		TripService:       tripService,
@@ -36,6 +49,12 @@ func NewHandlerServices() *HandlerServices {
 		CalculationService: services.NewCalculationService(),
 		SettlementService: services.NewSettlementService(expenseService, paymentService),
 		PaymentService:    paymentService,
+		SnapshotService:   snapshotService,
+		ReportService:     services.NewReportService(expenseService, paymentService),
+		ReceiptService:    services.NewReceiptService(repository.NewReceiptRepository(repository.GetDB())),
+		AttachmentService: services.NewAttachmentService(repository.NewAttachmentRepository(repository.GetDB())),
+		TemplateService:   services.NewTemplateService(repository.NewTemplateRepository(repository.GetDB()), expenseService),
+		BackupService:     services.NewBackupService(tripService, expenseService, paymentService),
 	}
 }
 
@@ -55,7 +74,7 @@ func CreateTripRefactored(c *gin.Context) {
 		return
 	}
 
-	trip, err := handlerServices.TripService.CreateTrip(request.Name, request.Participant)
+	trip, err := handlerServices.TripService.CreateTrip(request.Name, request.Participant, request.Currency, request.Owner)
 	if err != nil {
 		utils.HandleError(c, err)
 		return
@@ -66,7 +85,7 @@ func CreateTripRefactored(c *gin.Context) {
 		Code:   trip.Code,
 	}
 
-	utils.HandleSuccess(c, response)
+	utils.HandleCreated(c, tripLocation(trip.Code), response)
 }
 
 // GetTripByCodeRefactored handles retrieving a trip by its code
@@ -84,9 +103,205 @@ func GetTripByCodeRefactored(c *gin.Context) {
 		return
 	}
 
+	if err := handlerServices.TripService.LoadActivity(trip); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, trip)
+}
+
+// GetTripHandler retrieves a trip by the code in the URL path
+func GetTripHandler(c *gin.Context) {
+	code := utils.NormalizeTripCode(c.Param("code"))
+
+	trip, err := handlerServices.TripService.GetTripByCode(code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	if err := handlerServices.TripService.LoadActivity(trip); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, trip)
+}
+
+// DeleteTripHandler permanently deletes a trip and all of its data. The code must be
+// repeated in the confirm query parameter to guard against accidental deletion.
+func DeleteTripHandler(c *gin.Context) {
+	code := utils.NormalizeTripCode(c.Param("code"))
+
+	if utils.NormalizeTripCode(c.Query("confirm")) != code {
+		utils.HandleError(c, utils.NewBadRequestError("Repeat the trip code in the confirm query parameter to delete this trip"))
+		return
+	}
+
+	if err := handlerServices.TripService.DeleteTrip(code); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, gin.H{"message": "Trip deleted successfully"})
+}
+
+// ListTripsHandler returns the trips created by an owner, newest first
+func ListTripsHandler(c *gin.Context) {
+	var request models.ListTripsRequest
+
+	if err := c.ShouldBindQuery(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	trips, err := handlerServices.TripService.ListTripsByOwner(request.Owner, request.IncludeArchived)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, trips)
+}
+
+// ArchiveTripHandler archives a trip or restores it to its owner's trip list
+func ArchiveTripHandler(c *gin.Context) {
+	var request models.ArchiveTripRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	if err := handlerServices.TripService.SetArchived(trip.ID, request.Archived); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, gin.H{"message": "Trip updated successfully"})
+}
+
+// SetParticipantGuestHandler flags a participant as a guest excluded from "split among all"
+func SetParticipantGuestHandler(c *gin.Context) {
+	var request models.SetParticipantGuestRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	participant := utils.NameAliases(trip.Aliases).Key(request.Participant)
+	if err := handlerServices.TripService.SetParticipantGuest(trip.ID, participant, request.Guest); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	// Return the updated trip so the client sees the new guest list
+	trip, err = handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, trip)
+}
+
+// SetDefaultConsumersHandler sets who shares added items that name no consumers
+func SetDefaultConsumersHandler(c *gin.Context) {
+	var request models.SetDefaultConsumersRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	if err := handlerServices.TripService.SetDefaultConsumers(trip, request.DefaultConsumers); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	// Return the updated trip so the client sees the new defaults
+	trip, err = handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, trip)
+}
+
+// SetAliasesHandler sets how a trip's participant names are displayed
+func SetAliasesHandler(c *gin.Context) {
+	var request models.SetAliasesRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	if err := handlerServices.TripService.SetAliases(trip, request.Aliases); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	// Return the updated trip so the client sees the new display names
+	trip, err = handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
 	utils.HandleSuccess(c, trip)
 }
 
+// SetWebhookHandler sets or clears the webhook that receives a trip's events
+func SetWebhookHandler(c *gin.Context) {
+	var request models.SetWebhookRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	if err := handlerServices.TripService.SetWebhookURL(trip.ID, request.WebhookURL); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, gin.H{"message": "Webhook updated successfully"})
+}
+
 // CalculateSingleBillRefactored handles single bill calculation
 func CalculateSingleBillRefactored(c *gin.Context) {
 	var request models.CalculateSingleBillRequest
@@ -117,10 +332,15 @@ func AddEqualExpenseRefactored(c *gin.Context) {
 	// Get trip to validate and get trip ID
 	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
 	if err != nil {
-		utils.HandleError(c, utils.NewNotFoundError("Trip"))
+		utils.HandleError(c, err)
 		return
 	}
 
+	// Expand "split among all" into the trip's non-guest participants
+	if request.SplitAmongAll {
+		request.SplitAmong = handlerServices.TripService.ResolveSplitAmongAll(trip, request.SplitAmong)
+	}
+
 	// Create expense
 	expense, err := handlerServices.ExpenseService.CreateEqualExpense(&request)
 	if err != nil {
@@ -130,11 +350,24 @@ func AddEqualExpenseRefactored(c *gin.Context) {
 
 	// Set trip ID
 	expense.TripID = trip.ID
+	handlerServices.ExpenseService.ResolveAliases(trip, expense)
 
-	// Add participants to trip
-	for _, participant := range request.SplitAmong {
+	// In strict mode every name must already belong to the trip
+	if request.StrictParticipants {
+		if err := handlerServices.ExpenseService.ValidateKnownParticipants(trip, expense); err != nil {
+			utils.HandleError(c, err)
+			return
+		}
+	}
+
+	// Add participants to trip, including any joint payers
+	participants := append([]string(nil), expense.SplitAmong...)
+	for payer := range expense.PaidByShares {
+		participants = append(participants, payer)
+	}
+	for _, participant := range participants {
 		if err := handlerServices.TripService.AddParticipant(trip.ID, participant); err != nil {
-			utils.HandleError(c, utils.NewInternalError("Failed to add participant"))
+			utils.HandleError(c, err)
 			return
 		}
 	}
@@ -145,7 +378,7 @@ func AddEqualExpenseRefactored(c *gin.Context) {
 		return
 	}
 
-	utils.HandleSuccess(c, expense)
+	respondWithExpense(c, trip, expense, request.IncludeTrip)
 }
 
 // AddItemsExpenseRefactored adds an item-based expense
@@ -160,10 +393,13 @@ func AddItemsExpenseRefactored(c *gin.Context) {
 	// Get trip to validate and get trip ID
 	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
 	if err != nil {
-		utils.HandleError(c, utils.NewNotFoundError("Trip"))
+		utils.HandleError(c, err)
 		return
 	}
 
+	// Items that name no consumers are shared by the trip's default consumers
+	handlerServices.TripService.ApplyDefaultConsumers(trip, request.Items)
+
 	// Create expense
 	expense, err := handlerServices.ExpenseService.CreateItemsExpense(&request)
 	if err != nil {
@@ -173,16 +409,31 @@ func AddItemsExpenseRefactored(c *gin.Context) {
 
 	// Set trip ID
 	expense.TripID = trip.ID
+	handlerServices.ExpenseService.ResolveAliases(trip, expense)
+
+	// In strict mode every name must already belong to the trip
+	if request.StrictParticipants {
+		if err := handlerServices.ExpenseService.ValidateKnownParticipants(trip, expense); err != nil {
+			utils.HandleError(c, err)
+			return
+		}
+	}
+
+	// Whoever shares the extras must belong to the trip or the expense
+	if err := handlerServices.ExpenseService.ValidateExtrasSplitAmong(trip, expense); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
 
 	// Add participants to trip
 	for _, item := range expense.Items {
 		if err := handlerServices.TripService.AddParticipant(trip.ID, item.PaidBy); err != nil {
-			utils.HandleError(c, utils.NewInternalError("Failed to add participant"))
+			utils.HandleError(c, err)
 			return
 		}
 		for _, consumer := range item.Consumers {
 			if err := handlerServices.TripService.AddParticipant(trip.ID, consumer); err != nil {
-				utils.HandleError(c, utils.NewInternalError("Failed to add participant"))
+				utils.HandleError(c, err)
 				return
 			}
 		}
@@ -194,151 +445,795 @@ func AddItemsExpenseRefactored(c *gin.Context) {
 		return
 	}
 
-	utils.HandleSuccess(c, expense)
+	respondWithExpense(c, trip, expense, request.IncludeTrip)
 }
 
-// RemoveExpenseRefactored removes an expense
-func RemoveExpenseRefactored(c *gin.Context) {
-	var request models.RemoveExpenseRequest
+// tripLocation is the URL of a trip, used as the Location of a created trip
+func tripLocation(code string) string {
+	return "/api/v1/trips/" + url.PathEscape(code)
+}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+// expenseLocation is the URL of an expense, used as the Location of a created expense
+func expenseLocation(code, expenseID string) string {
+	return tripLocation(code) + "/expenses/" + url.PathEscape(expenseID)
+}
+
+// respondWithExpense sends a created expense, or with includeTrip the expense along
+// with the trip's updated expense list and settlements
+func respondWithExpense(c *gin.Context, trip *models.Trip, expense *models.Expense, includeTrip bool) {
+	if !includeTrip {
+		utils.HandleCreated(c, expenseLocation(trip.Code, expense.ID), expense)
 		return
 	}
 
-	// Get trip to validate
-	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	expenses, err := handlerServices.ExpenseService.GetExpenses(trip.ID)
 	if err != nil {
-		utils.HandleError(c, utils.NewNotFoundError("Trip"))
+		utils.HandleError(c, err)
 		return
 	}
 
-	// Remove expense
-	if err := handlerServices.ExpenseService.RemoveExpense(trip.ID, request.ExpenseID); err != nil {
+	settlements, err := handlerServices.SettlementService.CalculateSettlementsWithOptions(trip.ID, services.SettlementOptions{
+		Currency: trip.Currency,
+	})
+	if err != nil {
 		utils.HandleError(c, err)
 		return
 	}
 
-	utils.HandleSuccess(c, true)
+	utils.HandleCreated(c, expenseLocation(trip.Code, expense.ID), models.AddExpenseResponse{
+		Expense:     expense,
+		Expenses:    expenses,
+		Settlements: settlements,
+	})
 }
 
-// ListExpensesRefactored lists all expenses for a trip
-func ListExpensesRefactored(c *gin.Context) {
-	var request models.GetTripByCodeRequest
+// BulkAddExpensesHandler imports several expenses at once; all are stored or none are
+func BulkAddExpensesHandler(c *gin.Context) {
+	var request models.BulkAddExpensesRequest
 
 	if err := c.ShouldBindJSON(&request); err != nil {
 		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
 		return
 	}
 
-	// Get trip to validate
+	// Get trip to validate and get trip ID
 	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
 	if err != nil {
-		utils.HandleError(c, utils.NewNotFoundError("Trip"))
+		utils.HandleError(c, err)
 		return
 	}
 
-	// Get expenses
-	expenses, err := handlerServices.ExpenseService.GetExpenses(trip.ID)
+	ids, err := handlerServices.ExpenseService.BulkStoreExpenses(trip, request.Expenses)
 	if err != nil {
+		var validationErr *services.BulkValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Some expenses are invalid; none were added",
+				"errors": validationErr.Errors,
+			})
+			return
+		}
 		utils.HandleError(c, err)
 		return
 	}
 
-	utils.HandleSuccess(c, expenses)
+	// Several expenses were created, so no single Location identifies them
+	utils.HandleCreated(c, "", models.BulkAddExpensesResponse{ExpenseIDs: ids})
 }
 
-// CalculateSettlementsRefactored calculates settlements for a trip
-func CalculateSettlementsRefactored(c *gin.Context) {
-	var request models.GetTripByCodeRequest
+// DuplicateExpenseHandler copies an existing expense in the same trip
+func DuplicateExpenseHandler(c *gin.Context) {
+	var request models.DuplicateExpenseRequest
 
 	if err := c.ShouldBindJSON(&request); err != nil {
 		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
 		return
 	}
 
-	// Get trip to validate
+	// Get trip to validate and get trip ID
 	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
 	if err != nil {
-		utils.HandleError(c, utils.NewNotFoundError("Trip"))
+		utils.HandleError(c, err)
 		return
 	}
 
-	// Calculate settlements
-	result, err := handlerServices.SettlementService.CalculateSettlements(trip.ID)
+	// A payer override given by a display name such as a nickname means the
+	// participant it belongs to
+	request.PaidBy = utils.NameAliases(trip.Aliases).Key(request.PaidBy)
+
+	expense, err := handlerServices.ExpenseService.DuplicateExpense(trip.ID, &request)
 	if err != nil {
 		utils.HandleError(c, err)
 		return
 	}
 
-	utils.HandleSuccess(c, result)
+	utils.HandleCreated(c, expenseLocation(trip.Code, expense.ID), expense)
 }
 
-// Payment handler functions
-func CreatePaymentHandler(c *gin.Context) {
-	var req models.PaymentRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		fmt.Printf("Payment binding error: %v\n", err)
-		c.JSON(400, gin.H{"error": "Invalid request format: " + err.Error()})
+// CreateExpenseTemplateHandler saves an expense as a template for recurring expenses
+func CreateExpenseTemplateHandler(c *gin.Context) {
+	var request models.CreateExpenseTemplateRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
 		return
 	}
 
-	fmt.Printf("Payment request received: %+v\n", req)
-
-	// Check if payment service is properly initialized
-	if handlerServices.PaymentService == nil {
-		c.JSON(500, gin.H{"error": "Payment service not initialized"})
+	// Get trip to validate and get trip ID
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
 		return
 	}
 
-	payment, err := handlerServices.PaymentService.CreatePayment(&req)
+	template, err := handlerServices.TemplateService.CreateTemplate(trip.ID, &request)
 	if err != nil {
-		fmt.Printf("Payment service error: %v\n", err)
-		c.JSON(400, gin.H{"error": err.Error()})
+		utils.HandleError(c, err)
 		return
 	}
 
-	fmt.Printf("Payment created successfully: %+v\n", payment)
-	c.JSON(201, payment)
+	utils.HandleCreated(c, templateLocation(trip.Code, template.ID), template)
 }
 
-func GetPaymentsByTripHandler(c *gin.Context) {
-	var req struct {
-		Code string `json:"code" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.HandleError(c, utils.NewBadRequestError(err.Error()))
+// templateLocation is the URL of an expense template, used as the Location of a created template
+func templateLocation(code, templateID string) string {
+	return tripLocation(code) + "/templates/" + url.PathEscape(templateID)
+}
+
+// GetExpenseTemplateHandler retrieves one template of the trip whose code is in the URL path
+func GetExpenseTemplateHandler(c *gin.Context) {
+	trip, err := handlerServices.TripService.GetTripByCode(c.Param("code"))
+	if err != nil {
+		utils.HandleError(c, err)
 		return
 	}
 
-	payments, err := handlerServices.PaymentService.GetPaymentsByTripCode(req.Code)
+	template, err := handlerServices.TemplateService.GetTemplate(trip.ID, c.Param("id"))
 	if err != nil {
-		utils.HandleError(c, utils.NewNotFoundError(err.Error()))
+		utils.HandleError(c, err)
 		return
 	}
 
-	utils.HandleSuccess(c, payments)
+	utils.HandleSuccess(c, template)
 }
 
-func DeletePaymentHandler(c *gin.Context) {
-	paymentID := c.Param("id")
-	if paymentID == "" {
-		utils.HandleError(c, utils.NewBadRequestError("Payment ID is required"))
+// ListExpenseTemplatesHandler lists a trip's expense templates
+func ListExpenseTemplatesHandler(c *gin.Context) {
+	var request models.GetTripByCodeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
 		return
 	}
 
-	// Convert to int
-	id := 0
-	if _, err := fmt.Sscanf(paymentID, "%d", &id); err != nil {
-		utils.HandleError(c, utils.NewBadRequestError("Invalid payment ID"))
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
 		return
 	}
 
-	err := handlerServices.PaymentService.DeletePayment(id)
+	templates, err := handlerServices.TemplateService.GetTemplates(trip.ID)
 	if err != nil {
-		utils.HandleError(c, utils.NewNotFoundError(err.Error()))
+		utils.HandleError(c, err)
 		return
 	}
 
-	utils.HandleSuccess(c, gin.H{"message": "Payment deleted successfully"})
-}
\ No newline at end of file
+	utils.HandleSuccess(c, templates)
+}
+
+// DeleteExpenseTemplateHandler removes an expense template
+func DeleteExpenseTemplateHandler(c *gin.Context) {
+	var request models.DeleteExpenseTemplateRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate and get trip ID
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	if err := handlerServices.TemplateService.DeleteTemplate(trip.ID, request.TemplateID); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, true)
+}
+
+// ExpenseFromTemplateHandler adds an expense to a trip from one of its templates
+func ExpenseFromTemplateHandler(c *gin.Context) {
+	var request models.ExpenseFromTemplateRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate and get trip ID
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	expense, err := handlerServices.TemplateService.CreateExpenseFromTemplate(trip, &request)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleCreated(c, expenseLocation(trip.Code, expense.ID), expense)
+}
+
+// RemoveExpenseRefactored removes an expense
+func RemoveExpenseRefactored(c *gin.Context) {
+	var request models.RemoveExpenseRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	// Remove expense
+	if err := handlerServices.ExpenseService.RemoveExpense(trip.ID, request.ExpenseID); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, true)
+}
+
+// GetExpenseHandler retrieves one expense of the trip whose code is in the URL path
+func GetExpenseHandler(c *gin.Context) {
+	trip, err := handlerServices.TripService.GetTripByCode(c.Param("code"))
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	expense, err := handlerServices.ExpenseService.GetExpense(trip.ID, c.Param("id"))
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, expense)
+}
+
+// UpdateExpenseNotesHandler replaces the notes of an expense
+func UpdateExpenseNotesHandler(c *gin.Context) {
+	var request models.UpdateExpenseNotesRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	expense, err := handlerServices.ExpenseService.UpdateExpenseNotes(trip.ID, &request)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, expense)
+}
+
+// ConfirmExpenseHandler marks a pending expense as confirmed by a second participant
+func ConfirmExpenseHandler(c *gin.Context) {
+	var request models.ConfirmExpenseRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	expense, err := handlerServices.ExpenseService.ConfirmExpense(trip, &request)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, expense)
+}
+
+// ListExpensesRefactored lists expenses for a trip, optionally filtered and paged
+// The total number of matching expenses is returned in the X-Total-Count header
+func ListExpensesRefactored(c *gin.Context) {
+	var request models.ListExpensesRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	// Get expenses
+	expenses, total, err := handlerServices.ExpenseService.ListExpenses(trip.ID, &request)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	utils.HandleSuccess(c, expenses)
+}
+
+// CalculateSettlementsRefactored calculates settlements for a trip
+func CalculateSettlementsRefactored(c *gin.Context) {
+	var request models.CalculateSettlementsRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	// Calculate settlements
+	result, err := handlerServices.SettlementService.CalculateSettlementsWithOptions(trip.ID, services.SettlementOptions{
+		MinimizeTransactions: request.MinimizeTransactions,
+		Currency:             trip.Currency,
+		MinSettlementAmount:  request.MinSettlementAmount,
+		FormatCurrency:       request.FormatCurrency,
+		IncludePending:       request.IncludePending,
+		BypassCache:          request.BypassCache,
+		EqualSplitRemainder:  request.EqualSplitRemainder,
+		Verbose:              request.Verbose,
+	})
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	// Optionally keep a snapshot of the result for the audit trail
+	if request.SaveSnapshot {
+		if _, err := handlerServices.SnapshotService.SaveSnapshot(trip.ID, result); err != nil {
+			utils.HandleError(c, err)
+			return
+		}
+	}
+
+	utils.HandleSuccess(c, result)
+}
+
+// PreviewSettlementHandler returns the settlements a trip would have after a
+// hypothetical payment, without recording it
+func PreviewSettlementHandler(c *gin.Context) {
+	var request models.PreviewSettlementRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	result, err := handlerServices.SettlementService.PreviewSettlement(trip, request.From, request.To, request.Amount)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, result)
+}
+
+// SettlementRemindersHandler exports settlements as per-debtor reminders (JSON or iCalendar)
+func SettlementRemindersHandler(c *gin.Context) {
+	var request models.SettlementRemindersRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	if request.Format != "" && request.Format != "json" && request.Format != "ics" {
+		utils.HandleError(c, utils.NewBadRequestError("format must be 'json' or 'ics'"))
+		return
+	}
+	if request.DueInDays < 0 {
+		utils.HandleError(c, utils.NewBadRequestError("dueInDays cannot be negative"))
+		return
+	}
+	dueInDays := request.DueInDays
+	if dueInDays == 0 {
+		dueInDays = services.DefaultReminderDueDays
+	}
+
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	result, err := handlerServices.SettlementService.CalculateSettlementsWithOptions(trip.ID, services.SettlementOptions{
+		Currency: trip.Currency,
+	})
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	now := time.Now()
+	reminders := services.BuildSettlementReminders(result.Settlements, now.AddDate(0, 0, dueInDays))
+
+	if request.Format == "ics" {
+		filename := fmt.Sprintf("%s_Reminders.ics", utils.CleanFileName(trip.Name))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(services.GenerateRemindersICS(trip, reminders, now)))
+		return
+	}
+
+	utils.HandleSuccess(c, reminders)
+}
+
+// ListSettlementSnapshotsHandler lists stored settlement snapshots for a trip
+func ListSettlementSnapshotsHandler(c *gin.Context) {
+	var request models.GetTripByCodeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	snapshots, err := handlerServices.SnapshotService.GetSnapshots(trip.ID)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, snapshots)
+}
+
+// SettlementStatusHandler returns the optimal settlements with how much of each has been paid
+func SettlementStatusHandler(c *gin.Context) {
+	var request models.GetTripByCodeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	status, err := handlerServices.SettlementService.GetSettlementStatus(trip.ID, trip.Currency)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, status)
+}
+
+// TripBalancesHandler returns each person's paid, owed and payment totals before settlement optimization
+func TripBalancesHandler(c *gin.Context) {
+	var request models.GetTripByCodeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	balances, err := handlerServices.SettlementService.GetTripBalances(trip.ID, trip.Currency)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, balances)
+}
+
+// SettlementsForHandler returns the settlements one person has to pay and their total
+func SettlementsForHandler(c *gin.Context) {
+	var request models.SettlementsForRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	settlements, err := handlerServices.SettlementService.GetSettlementsFor(trip, request.Person)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, settlements)
+}
+
+// SearchExpensesHandler searches expense descriptions across all of an owner's trips
+func SearchExpensesHandler(c *gin.Context) {
+	var request models.SearchExpensesRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	matches, err := handlerServices.ReportService.SearchExpenses(request.Owner, request.Query, request.Limit)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, matches)
+}
+
+// TripStatsHandler returns aggregate spending statistics for a trip
+func TripStatsHandler(c *gin.Context) {
+	var request models.GetTripByCodeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	stats, err := handlerServices.ReportService.GetTripStats(trip)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, stats)
+}
+
+// CategoryBreakdownHandler returns a trip's total spend grouped by expense category
+func CategoryBreakdownHandler(c *gin.Context) {
+	var request models.GetTripByCodeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	breakdown, err := handlerServices.ReportService.GetCategoryBreakdown(trip.ID)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, breakdown)
+}
+
+// SpendingTimelineHandler returns a trip's spending per day with per-person running totals
+func SpendingTimelineHandler(c *gin.Context) {
+	var request models.GetTripByCodeRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	// Get trip to validate
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	timeline, err := handlerServices.ReportService.GetSpendingTimeline(trip)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, timeline)
+}
+
+// Payment handler functions
+func CreatePaymentHandler(c *gin.Context) {
+	var req models.PaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Warn("Invalid payment request", "operation", "create_payment", "error", err)
+		c.JSON(400, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	// Check if payment service is properly initialized
+	if handlerServices.PaymentService == nil {
+		c.JSON(500, gin.H{"error": "Payment service not initialized"})
+		return
+	}
+
+	payment, err := handlerServices.PaymentService.CreatePayment(&req)
+	var appErr *utils.AppError
+	if errors.As(err, &appErr) {
+		utils.HandleError(c, err)
+		return
+	}
+	if err != nil {
+		slog.Warn("Failed to create payment", "operation", "create_payment", "tripCode", req.Code, "error", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Debug("Payment created", "operation", "create_payment", "tripCode", req.Code, "paymentId", payment.ID)
+	c.JSON(201, payment)
+}
+
+// BulkCreatePaymentsHandler records several payments at once; all are created or none are
+func BulkCreatePaymentsHandler(c *gin.Context) {
+	var req models.BulkPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	payments, err := handlerServices.PaymentService.BulkCreatePayments(&req)
+	if err != nil {
+		var validationErr *services.BulkPaymentValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Some payments are invalid; none were created",
+				"errors": validationErr.Errors,
+			})
+			return
+		}
+		var appErr *utils.AppError
+		if errors.As(err, &appErr) {
+			utils.HandleError(c, err)
+			return
+		}
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(201, payments)
+}
+
+func GetPaymentsByTripHandler(c *gin.Context) {
+	var req models.PaymentListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(err.Error()))
+		return
+	}
+
+	result, err := handlerServices.PaymentService.ListPayments(req.Code, req.FromDate, req.ToDate)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, result)
+}
+
+func DeletePaymentHandler(c *gin.Context) {
+	paymentID := c.Param("id")
+	if paymentID == "" {
+		utils.HandleError(c, utils.NewBadRequestError("Payment ID is required"))
+		return
+	}
+
+	// Convert to int
+	id := 0
+	if _, err := fmt.Sscanf(paymentID, "%d", &id); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError("Invalid payment ID"))
+		return
+	}
+
+	err := handlerServices.PaymentService.DeletePayment(id)
+	if err != nil {
+		utils.HandleError(c, utils.NewNotFoundError(err.Error()))
+		return
+	}
+
+	utils.HandleSuccess(c, gin.H{"message": "Payment deleted successfully"})
+}
+
+// maxStatementUploadSize caps the size of uploaded bank statements
+const maxStatementUploadSize = 5 << 20 // 5 MB
+
+// ReconcileCSVHandler matches an uploaded bank statement CSV against recorded payments
+func ReconcileCSVHandler(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxStatementUploadSize)
+	if err := c.Request.ParseMultipartForm(maxStatementUploadSize); err != nil {
+		respondUploadError(c, err, maxStatementUploadSize)
+		return
+	}
+
+	code := c.Request.FormValue("code")
+	if code == "" {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrCodeRequired))
+		return
+	}
+
+	if _, err := handlerServices.TripService.GetTripByCode(code); err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	file, _, err := c.Request.FormFile("statement")
+	if err != nil {
+		utils.HandleError(c, utils.NewBadRequestError("No statement file uploaded"))
+		return
+	}
+	defer file.Close()
+
+	result, err := handlerServices.PaymentService.ReconcileBankStatement(code, file)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, result)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMockHandlerServices points the handlers at services backed by a mock database
+func newMockHandlerServices(t *testing.T) sqlmock.Sqlmock {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+
+	previousDB, previousServices := repository.GetDB(), handlerServices
+	repository.SetDB(db)
+	handlerServices = NewHandlerServices()
+	t.Cleanup(func() {
+		repository.SetDB(previousDB)
+		handlerServices = previousServices
+		db.Close()
+	})
+	return mock
+}
+
+// expectTrip expects trip ABC123 ("t1") to be looked up, with alice as its only participant
+func expectTrip(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM trips WHERE code = $1")).WithArgs("ABC123").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "name", "creation_time", "currency", "webhook_url", "owner", "archived"}).
+			AddRow("t1", "ABC123", "Bali", int64(1000), "IDR", "", "", false))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM trip_participants WHERE trip_id = $1")).WithArgs("t1").
+		WillReturnRows(sqlmock.NewRows([]string{"participant", "exclude_from_auto", "default_consumer"}).AddRow("alice", false, false))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM participant_aliases WHERE trip_id = $1")).WithArgs("t1").
+		WillReturnRows(sqlmock.NewRows([]string{"participant", "display_name"}))
+}
+
+func TestAddEqualExpense_ParticipantLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("MAX_PARTICIPANTS", "1")
+	mock := newMockHandlerServices(t)
+
+	expectTrip(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM trips WHERE id = $1 FOR UPDATE")).WithArgs("t1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("t1"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*), COALESCE(BOOL_OR(participant = $2), FALSE)")).WithArgs("t1", "bob").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "exists"}).AddRow(1, false))
+	mock.ExpectRollback()
+
+	router := gin.New()
+	router.POST("/expenses/addEqual", AddEqualExpenseRefactored)
+	body := `{"code":"ABC123","description":"Dinner","subtotal":60,"paidBy":"alice","splitAmong":["bob","alice"]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/expenses/addEqual", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"A trip can have at most 1 participants"}`, w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute labels requests that matched no route, so arbitrary paths
+// can't blow up the metric's cardinality
+const unmatchedRoute = "unmatched"
+
+// RequestMetrics records the count and latency of every request, labeled by the
+// route pattern (e.g. /api/v1/trips/:code) rather than the raw path
+func RequestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		services.ObserveHTTPRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
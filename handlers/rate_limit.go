@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultReceiptRateLimit is how many receipt requests per minute each client may make
+// when RECEIPT_RATE_LIMIT is not set
+const defaultReceiptRateLimit = 10
+
+// ReceiptRateLimit limits each client IP to RECEIPT_RATE_LIMIT receipt requests per
+// minute (default 10), since every processed receipt costs a Claude API call.
+// Setting it to 0 disables the limit. Routes sharing the returned middleware share
+// one allowance per client. Forwarded client IPs are only honoured from the proxies
+// listed in TRUSTED_PROXIES; otherwise the connection's remote address is used.
+func ReceiptRateLimit() gin.HandlerFunc {
+	requests := receiptRateLimit()
+	if requests == 0 {
+		slog.Info("Receipt rate limiting disabled")
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	limiter := utils.NewRateLimiter(requests, time.Minute)
+	return func(c *gin.Context) {
+		allowed, retryAfter := limiter.Allow(c.ClientIP())
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			slog.Warn("Receipt rate limit exceeded", "operation", "rate_limit", "clientIp", c.ClientIP(), "path", c.FullPath())
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": fmt.Sprintf("Too many receipt requests. Please try again in %d seconds.", seconds),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// receiptRateLimit reads RECEIPT_RATE_LIMIT, defaulting to 10 requests per minute
+func receiptRateLimit() int {
+	value := os.Getenv("RECEIPT_RATE_LIMIT")
+	if value == "" {
+		return defaultReceiptRateLimit
+	}
+
+	requests, err := strconv.Atoi(value)
+	if err != nil || requests < 0 {
+		slog.Warn("Invalid RECEIPT_RATE_LIMIT, using default", "value", value, "default", defaultReceiptRateLimit)
+		return defaultReceiptRateLimit
+	}
+	return requests
+}
@@ -2,20 +2,78 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/fadhlanhapp/sharetab-backend/models"
 	"github.com/fadhlanhapp/sharetab-backend/services"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// unsupportedReceiptTypeMessage is returned for uploads that are not a supported receipt type
+const unsupportedReceiptTypeMessage = "Only JPG, JPEG, PNG, HEIC, and PDF files are supported"
+
+// defaultMaxUploadBytes caps receipt uploads when MAX_UPLOAD_BYTES is not set
+const defaultMaxUploadBytes = 10 << 20 // 10 MB
+
+// maxUploadBytes reads the receipt and attachment upload limit from MAX_UPLOAD_BYTES, defaulting to 10 MB
+func maxUploadBytes() int64 {
+	value := os.Getenv("MAX_UPLOAD_BYTES")
+	if value == "" {
+		return defaultMaxUploadBytes
+	}
+
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit <= 0 {
+		slog.Warn("Invalid MAX_UPLOAD_BYTES, using default", "value", value, "default", defaultMaxUploadBytes)
+		return defaultMaxUploadBytes
+	}
+	return limit
+}
+
+// limitUploadSize caps the request body at the configured upload limit and returns it
+func limitUploadSize(c *gin.Context) int64 {
+	limit := maxUploadBytes()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	return limit
+}
+
+// respondUploadError reports a failure to read the multipart upload, with a 413 when
+// the body exceeded the upload limit
+func respondUploadError(c *gin.Context, err error, limit int64) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("Upload is too large. The maximum size is %s.", formatUploadLimit(limit)),
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("No file uploaded or invalid form: %v", err)})
+}
+
+// formatUploadLimit renders a byte count as MB, KB or bytes for error messages
+func formatUploadLimit(limit int64) string {
+	switch {
+	case limit >= 1<<20:
+		return strings.TrimSuffix(strconv.FormatFloat(float64(limit)/(1<<20), 'f', 1, 64), ".0") + " MB"
+	case limit >= 1<<10:
+		return fmt.Sprintf("%d KB", limit>>10)
+	default:
+		return fmt.Sprintf("%d bytes", limit)
+	}
+}
+
 // HandleProcessReceiptV1 processes a receipt image using Claude (v1 API)
 func HandleProcessReceiptV1(c *gin.Context) {
 	handleProcessReceiptImpl(c)
@@ -24,36 +82,44 @@ func HandleProcessReceiptV1(c *gin.Context) {
 
 // handleProcessReceiptImpl implements the receipt processing logic
 func handleProcessReceiptImpl(c *gin.Context) {
+	limit := limitUploadSize(c)
+
 	// 1. Receive the image file
 	file, header, err := c.Request.FormFile("receipt")
 	if err != nil {
-		log.Printf("Error receiving file: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("No file uploaded or invalid form: %v", err)})
+		slog.Warn("Failed to receive receipt upload", "operation", "process_receipt", "error", err)
+		respondUploadError(c, err, limit)
 		return
 	}
 	defer file.Close()
 
-	// Log file info for debugging
-	log.Printf("Received file: %s, Size: %d, Content-Type: %s",
-		header.Filename, header.Size, header.Header.Get("Content-Type"))
+	slog.Debug("Received receipt upload", "operation", "process_receipt",
+		"filename", header.Filename, "size", header.Size, "contentType", header.Header.Get("Content-Type"))
 
 	// Check file type
-	ext := filepath.Ext(header.Filename)
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
-		log.Printf("Invalid file type: %s", ext)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only JPG, JPEG, and PNG files are supported"})
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if !services.IsSupportedReceiptExtension(ext) {
+		slog.Debug("Rejected unsupported receipt file type", "operation", "process_receipt", "extension", ext)
+		c.JSON(http.StatusBadRequest, gin.H{"error": unsupportedReceiptTypeMessage})
 		return
 	}
 
 	// Generate unique filename
 	filename := uuid.New().String() + ext
-	filePath := filepath.Join("uploads", filename)
-	log.Printf("Saving file to: %s", filePath)
+	filePath := filepath.Join(services.ReceiptUploadsDir, filename)
+	slog.Debug("Saving receipt upload", "operation", "process_receipt", "path", filePath)
+
+	// Remove the uploaded file on every path once the request is done
+	defer func() {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to delete receipt upload after processing", "operation", "process_receipt", "path", filePath, "error", err)
+		}
+	}()
 
 	// Create the file
 	out, err := os.Create(filePath)
 	if err != nil {
-		log.Printf("Error creating file: %v", err)
+		slog.Error("Failed to create receipt upload file", "operation", "process_receipt", "path", filePath, "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save file: %v", err)})
 		return
 	}
@@ -62,76 +128,93 @@ func handleProcessReceiptImpl(c *gin.Context) {
 	// Copy the uploaded file to the created file
 	bytesWritten, err := io.Copy(out, file)
 	if err != nil {
-		log.Printf("Error copying file data: %v", err)
+		slog.Error("Failed to save receipt upload", "operation", "process_receipt", "path", filePath, "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save file: %v", err)})
 		return
 	}
-	log.Printf("Successfully saved %d bytes to %s", bytesWritten, filePath)
+	slog.Debug("Saved receipt upload", "operation", "process_receipt", "path", filePath, "size", bytesWritten)
 
 	// Read the file again for base64 encoding
 	fileBytes, err := os.ReadFile(filePath)
 	if err != nil {
-		log.Printf("Error reading saved file: %v", err)
+		slog.Error("Failed to read saved receipt upload", "operation", "process_receipt", "path", filePath, "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read saved file: %v", err)})
 		return
 	}
-	log.Printf("Successfully read %d bytes from file for processing", len(fileBytes))
 
-	// 2. Process the image using Claude API
-	log.Printf("Calling Claude API to process receipt...")
-	processedReceipt, err := services.ProcessReceiptWithClaude(fileBytes, ext[1:], filePath)
+	// 2. Convert HEIC and PDF uploads to an image and process it using Claude API
+	imageBytes, format, err := services.PrepareReceiptImage(fileBytes, ext)
 	if err != nil {
-		log.Printf("Error processing receipt with Claude: %v", err)
-		
-		// Parse error type for better user messaging
-		errorMsg := err.Error()
-		statusCode := http.StatusInternalServerError
-		userFriendlyMsg := "Failed to process receipt"
-		
-		if strings.HasPrefix(errorMsg, "receipt_processing_failed:") {
-			userFriendlyMsg = "Unable to read the receipt. Please ensure the image is clear and shows a complete receipt."
-			statusCode = http.StatusBadRequest
-		} else if strings.HasPrefix(errorMsg, "invalid_receipt:") {
-			userFriendlyMsg = "The uploaded image does not appear to be a valid receipt. Please upload a photo of a receipt."
-			statusCode = http.StatusBadRequest
-		} else if strings.HasPrefix(errorMsg, "receipt_format_error:") {
-			userFriendlyMsg = "Cannot read the receipt format. Please ensure the image is clear and not blurry."
-			statusCode = http.StatusBadRequest
-		} else if strings.HasPrefix(errorMsg, "invalid_receipt_data:") {
-			userFriendlyMsg = "No items or amounts found in the receipt. Please ensure the entire receipt is visible."
-			statusCode = http.StatusBadRequest
-		}
-		
-		c.JSON(statusCode, gin.H{
-			"error": userFriendlyMsg,
-			"details": errorMsg, // Include full error for debugging
-		})
-		
-		// Clean up the image even on error
-		if err := os.Remove(filePath); err != nil {
-			log.Printf("Failed to delete image file after error: %v", err)
-		} else {
-			log.Printf("Deleted image file after processing error: %s", filePath)
-		}
+		slog.Warn("Failed to prepare receipt image", "operation", "process_receipt", "error", err)
+		respondReceiptError(c, err)
 		return
 	}
 
-	log.Printf("Successfully processed receipt. Merchant: %s, Total: %.2f",
-		processedReceipt.Merchant, processedReceipt.Total)
+	slog.Debug("Calling Claude API to process receipt", "operation", "process_receipt", "format", format)
+	processedReceipt, err := services.ProcessReceiptWithClaude(imageBytes, format, filePath)
+	if err != nil {
+		slog.Error("Failed to process receipt with Claude", "operation", "process_receipt", "error", err)
+		respondReceiptError(c, err)
+		return
+	}
 
-	// Delete the image file after successful processing
-	if err := os.Remove(filePath); err != nil {
-		log.Printf("Warning: Failed to delete image file after processing: %v", err)
-	} else {
-		log.Printf("Successfully deleted image file after processing: %s", filePath)
-		// Since the file is deleted, remove the path from the response
-		processedReceipt.ImagePath = ""
+	slog.Info("Processed receipt", "operation", "process_receipt",
+		"merchant", processedReceipt.Merchant, "total", processedReceipt.Total)
+
+	// The uploaded file is deleted once this request finishes
+	processedReceipt.ImagePath = ""
+
+	// Keep the structured receipt so expenses can be created from its ID later
+	if err := handlerServices.ReceiptService.SaveReceipt(processedReceipt); err != nil {
+		slog.Warn("Failed to store processed receipt", "operation", "process_receipt", "error", err)
 	}
 
 	// 3. Return the processed data
 	c.JSON(http.StatusOK, processedReceipt)
 }
 
+// respondReceiptError maps receipt conversion and processing errors to a user-friendly response
+func respondReceiptError(c *gin.Context, err error) {
+	// Parse error type for better user messaging
+	errorMsg := err.Error()
+	statusCode := http.StatusInternalServerError
+	userFriendlyMsg := "Failed to process receipt"
+	
+	if strings.HasPrefix(errorMsg, "receipt_processing_failed:") {
+		userFriendlyMsg = "Unable to read the receipt. Please ensure the image is clear and shows a complete receipt."
+		statusCode = http.StatusBadRequest
+	} else if strings.HasPrefix(errorMsg, "invalid_receipt:") {
+		userFriendlyMsg = "The uploaded image does not appear to be a valid receipt. Please upload a photo of a receipt."
+		statusCode = http.StatusBadRequest
+	} else if strings.HasPrefix(errorMsg, "receipt_format_error:") {
+		userFriendlyMsg = "Cannot read the receipt format. Please ensure the image is clear and not blurry."
+		statusCode = http.StatusBadRequest
+	} else if strings.HasPrefix(errorMsg, "invalid_receipt_data:") {
+		userFriendlyMsg = "No items or amounts found in the receipt. Please ensure the entire receipt is visible."
+		statusCode = http.StatusBadRequest
+	} else if strings.HasPrefix(errorMsg, "corrupt_image:") {
+		userFriendlyMsg = "The uploaded file is damaged or is not a readable image. Please upload it again."
+		statusCode = http.StatusBadRequest
+	} else if strings.HasPrefix(errorMsg, "unsupported_image_type:") {
+		userFriendlyMsg = "The file's contents don't match its extension. Please upload a JPG, PNG, HEIC or PDF receipt."
+		statusCode = http.StatusBadRequest
+	} else if strings.HasPrefix(errorMsg, "invalid_image_dimensions:") {
+		userFriendlyMsg = "The image is too small or too large to read. Please upload a clear photo of the receipt."
+		statusCode = http.StatusBadRequest
+	} else if strings.HasPrefix(errorMsg, "receipt_math_mismatch:") {
+		userFriendlyMsg = "The receipt amounts don't add up. Please review the items and totals."
+		statusCode = http.StatusBadRequest
+	} else if strings.HasPrefix(errorMsg, "claude_unavailable:") {
+		userFriendlyMsg = "Receipt scanning is busy right now. Please try again in a moment."
+		statusCode = http.StatusServiceUnavailable
+	}
+	
+	c.JSON(statusCode, gin.H{
+		"error": userFriendlyMsg,
+		"details": errorMsg, // Include full error for debugging
+	})
+}
+
 // AddExpenseFromReceiptV1 creates an expense from a receipt image (v1 API)
 func AddExpenseFromReceiptV1(c *gin.Context) {
 	addExpenseFromReceiptImpl(c)
@@ -141,8 +224,9 @@ func AddExpenseFromReceiptV1(c *gin.Context) {
 // addExpenseFromReceiptImpl implements the expense from receipt logic
 func addExpenseFromReceiptImpl(c *gin.Context) {
 	// Parse multipart form
-	if err := c.Request.ParseMultipartForm(10 << 20); err != nil { // 10 MB max
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse form: %v", err)})
+	limit := limitUploadSize(c)
+	if err := c.Request.ParseMultipartForm(limit); err != nil {
+		respondUploadError(c, err, limit)
 		return
 	}
 
@@ -196,15 +280,20 @@ func addExpenseFromReceiptImpl(c *gin.Context) {
 	defer file.Close()
 
 	// Check file type
-	ext := filepath.Ext(header.Filename)
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only JPG, JPEG, and PNG files are supported"})
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if !services.IsSupportedReceiptExtension(ext) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": unsupportedReceiptTypeMessage})
 		return
 	}
 
 	// Generate unique filename
 	filename := uuid.New().String() + ext
-	filePath := filepath.Join("uploads", filename)
+	filePath := filepath.Join(services.ReceiptUploadsDir, filename)
+
+	// Retained uploads are moved under the trip when the expense is stored,
+	// so whatever is still at the upload path is removed once the request is done
+	retainImage := c.Request.FormValue("retainImage") != "false"
+	defer os.Remove(filePath)
 
 	// Create the file
 	out, err := os.Create(filePath)
@@ -227,37 +316,18 @@ func addExpenseFromReceiptImpl(c *gin.Context) {
 		return
 	}
 
-	// Process the image using Claude API
-	processedReceipt, err := services.ProcessReceiptWithClaude(fileBytes, ext[1:], filePath)
+	// Convert HEIC and PDF uploads to an image and process it using Claude API
+	imageBytes, format, err := services.PrepareReceiptImage(fileBytes, ext)
 	if err != nil {
-		log.Printf("Error processing receipt with Claude: %v", err)
-		
-		// Parse error type for better user messaging
-		errorMsg := err.Error()
-		statusCode := http.StatusInternalServerError
-		userFriendlyMsg := "Failed to process receipt"
-		
-		if strings.HasPrefix(errorMsg, "receipt_processing_failed:") {
-			userFriendlyMsg = "Unable to read the receipt. Please ensure the image is clear and shows a complete receipt."
-			statusCode = http.StatusBadRequest
-		} else if strings.HasPrefix(errorMsg, "invalid_receipt:") {
-			userFriendlyMsg = "The uploaded image does not appear to be a valid receipt. Please upload a photo of a receipt."
-			statusCode = http.StatusBadRequest
-		} else if strings.HasPrefix(errorMsg, "receipt_format_error:") {
-			userFriendlyMsg = "Cannot read the receipt format. Please ensure the image is clear and not blurry."
-			statusCode = http.StatusBadRequest
-		} else if strings.HasPrefix(errorMsg, "invalid_receipt_data:") {
-			userFriendlyMsg = "No items or amounts found in the receipt. Please ensure the entire receipt is visible."
-			statusCode = http.StatusBadRequest
-		}
-		
-		c.JSON(statusCode, gin.H{
-			"error": userFriendlyMsg,
-			"details": errorMsg, // Include full error for debugging
-		})
-		
-		// Clean up the image on error
-		os.Remove(filePath)
+		slog.Warn("Failed to prepare receipt image", "operation", "add_receipt_expense", "tripCode", tripCode, "error", err)
+		respondReceiptError(c, err)
+		return
+	}
+
+	processedReceipt, err := services.ProcessReceiptWithClaude(imageBytes, format, filePath)
+	if err != nil {
+		slog.Error("Failed to process receipt with Claude", "operation", "add_receipt_expense", "tripCode", tripCode, "error", err)
+		respondReceiptError(c, err)
 		return
 	}
 
@@ -267,20 +337,164 @@ func addExpenseFromReceiptImpl(c *gin.Context) {
 	// Get trip by code
 	trip, err := tripService.GetTripByCode(tripCode)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		// Clean up the image on error
-		os.Remove(filePath)
+		utils.HandleError(c, err)
 		return
 	}
 
 	// Create expense from receipt
-	expense, err := services.CreateExpenseFromReceipt(trip, processedReceipt, paidBy, splitType, splitAmong, defaultConsumers, filename)
+	uploadPath := ""
+	if retainImage {
+		uploadPath = filePath
+	}
+	out.Close() // Close the saved upload before it is moved
+
+	expense, err := services.CreateExpenseFromReceipt(trip, processedReceipt, paidBy, splitType, splitAmong, defaultConsumers, uploadPath)
+	var appErr *utils.AppError
+	if errors.As(err, &appErr) {
+		utils.HandleError(c, err)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create expense: %v", err)})
-		// Clean up the image on error
-		os.Remove(filePath)
 		return
 	}
 
-	c.JSON(http.StatusOK, expense)
+	utils.HandleCreated(c, expenseLocation(trip.Code, expense.ID), expense)
+}
+
+// GetReceiptV1 returns a processed receipt stored by HandleProcessReceiptV1
+func GetReceiptV1(c *gin.Context) {
+	receipt, err := handlerServices.ReceiptService.GetReceipt(c.Param("id"))
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, receipt)
+}
+
+// GetReceiptImageV1 streams the retained receipt image of an expense. The expense's
+// trip code is required in the code query parameter.
+func GetReceiptImageV1(c *gin.Context) {
+	trip, err := handlerServices.TripService.GetTripByCode(c.Query("code"))
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	filePath, contentType, err := handlerServices.ExpenseService.GetReceiptImage(trip.ID, c.Param("expenseId"))
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.File(filePath)
+}
+
+// UploadExpenseAttachmentHandler attaches an uploaded file to an expense. The expense's
+// trip code is required in the code form field.
+func UploadExpenseAttachmentHandler(c *gin.Context) {
+	limit := limitUploadSize(c)
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		slog.Warn("Failed to receive attachment upload", "operation", "add_attachment", "expenseId", c.Param("id"), "error", err)
+		respondUploadError(c, err, limit)
+		return
+	}
+	defer file.Close()
+
+	trip, err := handlerServices.TripService.GetTripByCode(c.PostForm("code"))
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	attachment, err := handlerServices.AttachmentService.AddAttachment(trip.ID, c.Param("id"), header.Filename, file)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleCreated(c, attachmentLocation(trip.Code, attachment), attachment)
+}
+
+// attachmentLocation is the URL of an attachment, used as the Location of an uploaded
+// attachment. It carries the trip code, which reading an attachment requires.
+func attachmentLocation(code string, attachment *models.ExpenseAttachment) string {
+	return "/api/v1/expenses/" + url.PathEscape(attachment.ExpenseID) + "/attachments/" +
+		url.PathEscape(attachment.ID) + "?code=" + url.QueryEscape(code)
+}
+
+// ListExpenseAttachmentsHandler lists the attachments of an expense. The expense's
+// trip code is required in the code query parameter.
+func ListExpenseAttachmentsHandler(c *gin.Context) {
+	trip, err := handlerServices.TripService.GetTripByCode(c.Query("code"))
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	attachments, err := handlerServices.AttachmentService.ListAttachments(trip.ID, c.Param("id"))
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleSuccess(c, attachments)
+}
+
+// GetExpenseAttachmentHandler streams one attachment of an expense. The expense's
+// trip code is required in the code query parameter.
+func GetExpenseAttachmentHandler(c *gin.Context) {
+	trip, err := handlerServices.TripService.GetTripByCode(c.Query("code"))
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	attachment, filePath, err := handlerServices.AttachmentService.GetAttachmentFile(trip.ID, c.Param("id"), c.Param("attachmentId"))
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", attachment.ContentType)
+	c.FileAttachment(filePath, attachment.FileName)
+}
+
+// AddExpenseFromAssignedReceiptV1 creates an item-split expense from a receipt already
+// processed by HandleProcessReceiptV1, with consumers assigned per item
+func AddExpenseFromAssignedReceiptV1(c *gin.Context) {
+	var request models.AddAssignedReceiptExpenseRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.HandleError(c, utils.NewBadRequestError(utils.ErrInvalidRequest))
+		return
+	}
+
+	trip, err := handlerServices.TripService.GetTripByCode(request.Code)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	// Use a stored receipt instead of re-uploading
+	if request.ReceiptID != "" {
+		receipt, err := handlerServices.ReceiptService.GetReceipt(request.ReceiptID)
+		if err != nil {
+			utils.HandleError(c, err)
+			return
+		}
+		request.Receipt = *receipt
+	}
+
+	expense, err := services.CreateExpenseFromAssignedReceipt(trip, &request)
+	if err != nil {
+		utils.HandleError(c, err)
+		return
+	}
+
+	utils.HandleCreated(c, expenseLocation(trip.Code, expense.ID), expense)
 }
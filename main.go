@@ -2,8 +2,14 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -15,12 +21,27 @@ import (
 	"github.com/fadhlanhapp/sharetab-backend/repository"
 	"github.com/fadhlanhapp/sharetab-backend/routes"
 	"github.com/fadhlanhapp/sharetab-backend/services"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// Build metadata, injected at build time with
+// -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD)"
+var (
+	version = "dev"
+	commit  = "unknown"
 )
 
 func main() {
+	// Uptime in the health check counts from here
+	startTime := time.Now()
+
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: .env file not found, using environment variables")
+	envErr := godotenv.Load()
+
+	// Structured logging at the level set by LOG_LEVEL
+	utils.InitLogging()
+	if envErr != nil {
+		slog.Warn(".env file not found, using environment variables")
 	}
 
 	// Initialize New Relic
@@ -30,44 +51,71 @@ func main() {
 		newrelic.ConfigDistributedTracerEnabled(true),
 	)
 	if err != nil {
-		log.Printf("Warning: Failed to initialize New Relic: %v", err)
+		slog.Warn("Failed to initialize New Relic", "error", err)
 	}
 
 	// Initialize database
 	if err := repository.InitDB(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal("Failed to initialize database", err)
 	}
-	defer repository.CloseDB()
 
 	// Initialize services
 	services.InitTripService()
 	services.InitExpenseService()
 
-	// Create uploads directory if it doesn't exist
-	if err := os.MkdirAll("uploads", 0755); err != nil {
-		log.Fatalf("Failed to create uploads directory: %v", err)
+	// Create the uploads directory (UPLOADS_DIR) if it doesn't exist
+	if err := services.InitUploadsDir(); err != nil {
+		fatal("Failed to create uploads directory", err)
 	}
 
+	// Delete retained receipt images once they pass the configured age
+	services.StartReceiptImageCleanup()
+
 	// Set up Gin router
 	router := gin.Default()
 
+	// Only trust X-Forwarded-For from the proxies in TRUSTED_PROXIES, so clients
+	// can't pick their own IP and dodge per-client rate limits
+	trustedProxies, err := parseCommaList(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		fatal("Invalid TRUSTED_PROXIES", err)
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		fatal("Invalid TRUSTED_PROXIES", err)
+	}
+
 	// Add New Relic middleware
 	if app != nil {
 		router.Use(nrgin.Middleware(app))
 	}
 
 	// Configure CORS
+	// Credentials are only allowed for an explicit origin list; "*" with credentials is invalid
+	allowedOrigins, err := parseCommaList(os.Getenv("ALLOWED_ORIGINS"))
+	if err != nil {
+		fatal("Invalid ALLOWED_ORIGINS", err)
+	}
+	allowCredentials := allowedOrigins != nil
+	if allowedOrigins == nil {
+		slog.Warn("ALLOWED_ORIGINS not set, allowing all origins without credentials")
+		allowedOrigins = []string{"*"}
+	}
+
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"}, // Change to your frontend URL in production
+		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
+		ExposeHeaders:    []string{"Content-Length", "X-Total-Count", "Location"},
+		AllowCredentials: allowCredentials,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	// Set up routes
-	routes.SetupRoutes(router)
+	routes.SetupRoutes(router, routes.BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		StartTime: startTime,
+	})
 
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
@@ -75,9 +123,77 @@ func main() {
 		port = "8080"
 	}
 
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+
 	// Start server
-	log.Printf("Server starting on port %s...", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	go func() {
+		slog.Info("Server starting", "port", port, "version", version, "commit", commit)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Failed to start server", err)
+		}
+	}()
+
+	// Wait for a termination signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+
+	// Give in-flight requests (e.g. receipt uploads) time to finish
+	timeout := shutdownTimeout()
+	slog.Info("Shutting down server", "signal", sig.String(), "gracePeriod", timeout.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Server forced to shut down", "error", err)
+	} else {
+		slog.Info("Server stopped accepting requests and drained active connections")
+	}
+
+	repository.CloseDB()
+	slog.Info("Database connection closed, shutdown complete")
+}
+
+// fatal logs a startup error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// parseCommaList splits a comma-separated list such as origins or proxy addresses,
+// returning nil when unset
+func parseCommaList(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return nil, errors.New("entries must not be empty")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// shutdownTimeout reads the grace period from SHUTDOWN_TIMEOUT (e.g. "30s"), defaulting to 30 seconds
+func shutdownTimeout() time.Duration {
+	const defaultTimeout = 30 * time.Second
+
+	value := os.Getenv("SHUTDOWN_TIMEOUT")
+	if value == "" {
+		return defaultTimeout
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		slog.Warn("Invalid SHUTDOWN_TIMEOUT, using default", "value", value, "default", defaultTimeout.String())
+		return defaultTimeout
 	}
+	return timeout
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ExpenseAttachment represents a file attached to an expense besides its receipt image
+type ExpenseAttachment struct {
+	ID          string    `json:"id" db:"id"`
+	ExpenseID   string    `json:"expense_id" db:"expense_id"`
+	FileName    string    `json:"file_name" db:"file_name"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Size        int64     `json:"size" db:"size"`
+	Path        string    `json:"-" db:"path"`                // Relative to the uploads directory
+	CreatedAt   time.Time `json:"created_at" db:"created_at"` // TIMESTAMP
+}
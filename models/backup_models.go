@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// TripBackupVersion is the backup format written by export and accepted by import
+const TripBackupVersion = 1
+
+// TripBackup is a self-contained copy of a trip that can be re-imported under a new
+// code. Names are stored in their normalized (lowercase) form.
+type TripBackup struct {
+	Version    int        `json:"version"`
+	ExportedAt time.Time  `json:"exportedAt"`
+	Trip       BackupTrip `json:"trip"`
+	Expenses   []*Expense `json:"expenses"`
+	Payments   []Payment  `json:"payments"`
+}
+
+// BackupTrip holds the trip settings carried by a backup; its ID and code are not
+// kept, since an import always creates a new trip
+type BackupTrip struct {
+	Name             string            `json:"name"`
+	Currency         string            `json:"currency,omitempty"`
+	Owner            string            `json:"owner,omitempty"`
+	Participants     []string          `json:"participants"`
+	Guests           []string          `json:"guests,omitempty"`
+	DefaultConsumers []string          `json:"defaultConsumers,omitempty"`
+	Aliases          map[string]string `json:"aliases,omitempty"`
+}
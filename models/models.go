@@ -1,17 +1,40 @@
 // models/models.go
 package models
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 // Trip represents a group of people sharing expenses
 type Trip struct {
-	ID           string   `json:"_id"`
-	CreationTime int64    `json:"_creationTime"`
-	Code         string   `json:"code"`
-	Name         string   `json:"name"`
-	Participants []string `json:"participants"`
+	ID               string   `json:"_id"`
+	CreationTime     int64    `json:"_creationTime"`
+	Code             string   `json:"code"`
+	Name             string   `json:"name"`
+	Participants     []string `json:"participants"`
+	Guests           []string `json:"guests,omitempty"`           // Participants excluded from "split among all"
+	DefaultConsumers []string `json:"defaultConsumers,omitempty"` // Charged for added items that name no consumers
+	Currency         string   `json:"currency,omitempty"`         // ISO 4217 base currency; empty rounds to two decimals
+	WebhookURL       string   `json:"-"`                          // Receives expense and payment events; kept private
+	Owner            string   `json:"owner,omitempty"`            // Account that created the trip, used to list its trips
+	Archived         bool     `json:"archived"`                   // Hidden from the owner's default trip list
+
+	// Preferred display name of participants, by stored name, e.g. "mcdonald": "McDonald"
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	// Expense and payment counts, set only when a single trip is looked up
+	*TripActivity
 }
 
+// TripActivity summarizes how much a trip holds and when it last changed
+type TripActivity struct {
+	ExpenseCount     int   `json:"expenseCount"`
+	PaymentCount     int   `json:"paymentCount"`
+	LastActivityTime int64 `json:"lastActivityTime,omitempty"` // Unix millis of the newest expense or payment
+}
+
+
 // Expense represents a shared expense
 type Expense struct {
 	ID            string   `json:"_id"`
@@ -28,24 +51,124 @@ type Expense struct {
 	SplitAmong    []string `json:"splitAmong,omitempty"`
 	Items         []Item   `json:"items,omitempty"`
 	ReceiptImage  string   `json:"receiptImage,omitempty"`
+	Category      string   `json:"category,omitempty"`     // Lowercase free text, e.g. "food"
+	TaxInclusive  bool     `json:"taxInclusive,omitempty"` // Tax is already contained in the subtotal
+	CreatedBy     string   `json:"createdBy,omitempty"`    // Participant who logged the expense, informational only
+	Notes         string   `json:"notes,omitempty"`        // Free-text memo, informational only
+
+	// Tax is also charged on the service charge, so Tax includes the tax on both
+	TaxOnServiceCharge bool `json:"taxOnServiceCharge,omitempty"`
+
+	// How item splits share tax, service charge and discount; empty means proportional
+	ExtrasSplitMode string `json:"extrasSplitMode,omitempty"`
+
+	// Item splits only: when set, tax, service charge and discount are shared evenly
+	// by these people instead of by everyone who consumed something
+	ExtrasSplitAmong []string `json:"extrasSplitAmong,omitempty"`
+
+	// Equal splits paid jointly: what each payer paid, summing to Amount. PaidBy is then
+	// the payer who paid the most. Empty when PaidBy paid the whole amount.
+	PaidByShares map[string]float64 `json:"paidByShares,omitempty"`
+
+	// Pending expenses are left out of settlements until a second participant confirms them
+	Status      string `json:"status,omitempty"`
+	ConfirmedBy string `json:"confirmedBy,omitempty"`
+
+	// Client-supplied key used to deduplicate retried creates within a trip
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+
+	// Display name to stored (normalized) name for every name in the expense, so
+	// clients can edit a name without guessing the normalization rules
+	NameKeys map[string]string `json:"nameKeys,omitempty"`
+
+	// Set when listing expenses: whether Amount matches the total recomputed from
+	// its parts, and by how much it differs when it doesn't. Never stored.
+	Reconciled  *bool   `json:"reconciled,omitempty"`
+	Discrepancy float64 `json:"discrepancy,omitempty"`
+}
+
+// Ways item splits share bill-level tax, service charge and discount
+const (
+	ExtrasSplitProportional = "proportional" // In proportion to what each person consumed
+	ExtrasSplitEqual        = "equal"        // Evenly among everyone who consumed something
+)
+
+// Expense statuses
+const (
+	ExpenseStatusPending   = "pending"
+	ExpenseStatusConfirmed = "confirmed"
+)
+
+// IsConfirmed reports whether the expense counts toward settlements.
+// Expenses without a status predate confirmation and count as confirmed.
+func (e *Expense) IsConfirmed() bool {
+	return e.Status != ExpenseStatusPending
+}
+
+// PayerShares returns what each payer paid toward an equal split: PaidByShares when
+// several people paid, otherwise PaidBy paying the whole amount
+func (e *Expense) PayerShares() map[string]float64 {
+	if len(e.PaidByShares) > 0 {
+		return e.PaidByShares
+	}
+	return map[string]float64{e.PaidBy: e.Amount}
+}
+
+// Payers returns the names in PaidByShares in sorted order, or just PaidBy
+func (e *Expense) Payers() []string {
+	if len(e.PaidByShares) == 0 {
+		return []string{e.PaidBy}
+	}
+	payers := make([]string, 0, len(e.PaidByShares))
+	for payer := range e.PaidByShares {
+		payers = append(payers, payer)
+	}
+	sort.Strings(payers)
+	return payers
 }
 
 // Item represents an individual item in an expense
 type Item struct {
 	Description  string   `json:"description"`
 	UnitPrice    float64  `json:"unitPrice"`
-	Quantity     int      `json:"quantity"`
+	Quantity     float64  `json:"quantity"` // May be fractional for weighed goods, e.g. 0.5 kg
 	Amount       float64  `json:"amount,omitempty"`
 	ItemDiscount float64  `json:"itemDiscount,omitempty"`
 	PaidBy       string   `json:"paidBy"`
 	Consumers    []string `json:"consumers"`
+
+	// ConsumerWeights optionally maps a consumer to their relative share of the item.
+	// Consumers missing from the map default to a weight of 1.
+	ConsumerWeights map[string]float64 `json:"consumerWeights,omitempty"`
+
+	// ConsumerQuantities optionally says how many units each consumer had, e.g. two of
+	// three coffees for Alice, or 0.3 of 0.5 kg of cheese. When set it must cover every
+	// consumer and add up to Quantity.
+	ConsumerQuantities map[string]float64 `json:"consumerQuantities,omitempty"`
+
+	// TaxRate optionally taxes this item directly, as a percentage of its amount.
+	// Items without a rate share the expense-level tax in proportion to their amount.
+	TaxRate *float64 `json:"taxRate,omitempty"`
+}
+
+// RatedTax returns the tax charged at the item's own TaxRate, or 0 when it has none.
+// For tax-inclusive prices the tax is backed out of the amount instead of added to it.
+func (i Item) RatedTax(taxInclusive bool) float64 {
+	if i.TaxRate == nil {
+		return 0
+	}
+	if taxInclusive {
+		return i.Amount * *i.TaxRate / (100 + *i.TaxRate)
+	}
+	return i.Amount * *i.TaxRate / 100
 }
 
 // Settlement represents a payment from one person to another
 type Settlement struct {
-	From   string  `json:"from"`
-	To     string  `json:"to"`
-	Amount float64 `json:"amount"`
+	From            string  `json:"from"`
+	To              string  `json:"to"`
+	Amount          float64 `json:"amount"`
+	FormattedAmount string  `json:"formattedAmount,omitempty"` // Set when formatCurrency is requested
 }
 
 // PersonChargeBreakdown represents a detailed breakdown of a person's charges
@@ -64,14 +187,96 @@ type SingleBillCalculation struct {
 	Tax                float64                          `json:"tax"`
 	ServiceCharge      float64                          `json:"serviceCharge"`
 	TotalDiscount      float64                          `json:"totalDiscount"`
+	Tip                float64                          `json:"tip"`
+	TaxInclusive       bool                             `json:"taxInclusive"` // Subtotal already contains Tax
+	Currency           string                           `json:"currency,omitempty"`
 	PerPersonCharges   map[string]float64               `json:"perPersonCharges"`
 	PerPersonBreakdown map[string]PersonChargeBreakdown `json:"perPersonBreakdown"` // Added this field
+
+	// Display strings, set when formatCurrency is requested
+	FormattedAmount           string            `json:"formattedAmount,omitempty"`
+	FormattedPerPersonCharges map[string]string `json:"formattedPerPersonCharges,omitempty"`
+
+	Warnings []string `json:"warnings,omitempty"` // Problems that were tolerated; strict requests reject them
+}
+
+// PersonSettlementDetail explains how a person's balance was reached
+type PersonSettlementDetail struct {
+	TotalPaid        float64 `json:"totalPaid"`        // Paid towards expenses
+	TotalConsumed    float64 `json:"totalConsumed"`    // Share of expenses consumed
+	PaymentsSent     float64 `json:"paymentsSent"`     // Payments made to others
+	PaymentsReceived float64 `json:"paymentsReceived"` // Payments received from others
+	NetBalance       float64 `json:"netBalance"`       // Positive = should receive, Negative = should pay
+}
+
+// PersonBalance is one person's raw balance components before settlements are optimized
+type PersonBalance struct {
+	Name             string  `json:"name"`
+	AmountPaid       float64 `json:"amountPaid"`       // Paid towards expenses
+	AmountOwed       float64 `json:"amountOwed"`       // Share of expenses consumed
+	PaymentsSent     float64 `json:"paymentsSent"`     // Payments made to others
+	PaymentsReceived float64 `json:"paymentsReceived"` // Payments received from others
+	Net              float64 `json:"net"`              // Positive = should receive, Negative = should pay
+}
+
+// TripBalancesResult lists every person's balance, ordered by name
+type TripBalancesResult struct {
+	Balances []PersonBalance `json:"balances"`
 }
 
 // SettlementResult represents the result of calculating settlements
 type SettlementResult struct {
-	Settlements        []Settlement       `json:"settlements"`
-	IndividualBalances map[string]float64 `json:"individualBalances"`
+	Settlements        []Settlement                      `json:"settlements"`
+	IndividualBalances map[string]float64                `json:"individualBalances"`
+	PersonDetails      map[string]PersonSettlementDetail `json:"personDetails"`
+	FormattedBalances  map[string]string                 `json:"formattedBalances,omitempty"` // Set when formatCurrency is requested
+	Breakdown          []ExpenseAllocation               `json:"breakdown,omitempty"`         // Set when verbose is requested
+	NameKeys           map[string]string                 `json:"nameKeys,omitempty"`          // Display name to stored (normalized) name
+}
+
+// ExpenseAllocation shows what one expense charged each person before balances are aggregated
+type ExpenseAllocation struct {
+	ExpenseID   string             `json:"expenseId"`
+	Description string             `json:"description"`
+	SplitType   string             `json:"splitType"`
+	Items       []ItemAllocation   `json:"items,omitempty"` // Item splits only
+	Totals      map[string]float64 `json:"totals"`          // Including tax, service charge and discount
+}
+
+// ItemAllocation is each consumer's share of one item, before bill-level charges
+type ItemAllocation struct {
+	Description string             `json:"description"`
+	Amount      float64            `json:"amount"`
+	Shares      map[string]float64 `json:"shares"`
+}
+
+// PersonSettlements lists the settlements one person has to pay, with their total
+type PersonSettlements struct {
+	Person      string       `json:"person"`
+	Settlements []Settlement `json:"settlements"`
+	Total       float64      `json:"total"`
+}
+
+// AddExpenseResponse returns a created expense together with the trip's updated
+// expenses and settlements, so clients can refresh without further requests
+type AddExpenseResponse struct {
+	Expense     *Expense          `json:"expense"`
+	Expenses    []*Expense        `json:"expenses"`
+	Settlements *SettlementResult `json:"settlements"`
+}
+
+// SettlementProgress represents an optimal settlement and how much of it has been paid
+type SettlementProgress struct {
+	Settlement
+	PaidAmount      float64 `json:"paidAmount"`
+	RemainingAmount float64 `json:"remainingAmount"`
+	Settled         bool    `json:"settled"`
+}
+
+// SettlementStatusResult represents recorded payments matched against the optimal settlements
+type SettlementStatusResult struct {
+	Settlements  []SettlementProgress `json:"settlements"`
+	Overpayments []Settlement         `json:"overpayments"` // Payments beyond any matching settlement
 }
 
 // ErrorResponse represents an error response
@@ -99,6 +304,7 @@ type ClaudeResponse struct {
 }
 
 type ProcessedReceipt struct {
+	ID        string        `json:"id,omitempty"` // Stored receipt ID, set once the receipt is saved for later review
 	Merchant  string        `json:"merchant"`
 	Date      string        `json:"date"`
 	Items     []ReceiptItem `json:"items"`
@@ -111,16 +317,63 @@ type ProcessedReceipt struct {
 }
 
 type ReceiptItem struct {
+	Index    int     `json:"index"` // Position in ProcessedReceipt.Items, used to assign consumers
 	Name     string  `json:"name"`
 	Price    float64 `json:"price"`
 	Quantity float64 `json:"quantity"`
 	Discount float64 `json:"discount"`
 }
 
+// AddAssignedReceiptExpenseRequest creates an item-split expense from a processed
+// receipt, with consumers chosen per item. The receipt is either sent inline or
+// referenced by the ID returned from the process endpoint.
+type AddAssignedReceiptExpenseRequest struct {
+	Code             string           `json:"code" binding:"required"`
+	PaidBy           string           `json:"paidBy" binding:"required"`
+	ReceiptID        string           `json:"receiptId"` // Stored receipt, used instead of Receipt when set
+	Receipt          ProcessedReceipt `json:"receipt"`
+	Assignments      map[int][]string `json:"assignments"`      // Item index to consumers
+	DefaultConsumers []string         `json:"defaultConsumers"` // For items without an assignment
+	NewParticipants  []string         `json:"newParticipants"`  // Names to add to the trip along with this expense
+}
+
 // CreateTrip request model
 type CreateTripRequest struct {
 	Name        string `json:"name" binding:"required"`
 	Participant string `json:"participant" binding:"required"`
+	Currency    string `json:"currency" binding:"omitempty,len=3,alpha"` // ISO 4217 base currency
+	Owner       string `json:"owner" binding:"max=255"`                  // Optional account identifier
+}
+
+// ListTripsRequest query parameters for listing an owner's trips
+type ListTripsRequest struct {
+	Owner           string `form:"owner" binding:"required,max=255"`
+	IncludeArchived bool   `form:"includeArchived"`
+}
+
+// SearchExpensesRequest request model for searching expense descriptions across an owner's trips
+type SearchExpensesRequest struct {
+	Owner string `json:"owner" binding:"required,max=255"`
+	Query string `json:"query" binding:"required,max=255"`
+	Limit int    `json:"limit" binding:"omitempty,min=1,max=100"` // Defaults to 50
+}
+
+// ExpenseMatch is an expense found by a search across trips, with the trip it belongs to
+type ExpenseMatch struct {
+	ExpenseID    string  `json:"expenseId"`
+	TripCode     string  `json:"tripCode"`
+	TripName     string  `json:"tripName"`
+	Description  string  `json:"description"`
+	Amount       float64 `json:"amount"`
+	PaidBy       string  `json:"paidBy"`
+	Category     string  `json:"category,omitempty"`
+	CreationTime int64   `json:"_creationTime"`
+}
+
+// ArchiveTripRequest request model; Archived false restores the trip
+type ArchiveTripRequest struct {
+	Code     string `json:"code" binding:"required"`
+	Archived bool   `json:"archived"`
 }
 
 // GetTripByCodeRequest request model
@@ -128,6 +381,57 @@ type GetTripByCodeRequest struct {
 	Code string `json:"code" binding:"required"`
 }
 
+// ExportTripRequest asks for a trip export, optionally limited to one participant's statement
+type ExportTripRequest struct {
+	Code        string `json:"code" binding:"required"`
+	Participant string `json:"participant"`
+}
+
+// SettlementsForRequest asks for the settlements a single person has to pay
+type SettlementsForRequest struct {
+	Code   string `json:"code" binding:"required"`
+	Person string `json:"person" binding:"required"`
+}
+
+// ListExpensesRequest request model
+type ListExpensesRequest struct {
+	Code   string `json:"code" binding:"required"`
+	Limit  int    `json:"limit" binding:"min=0"` // 0 returns all expenses
+	Offset int    `json:"offset" binding:"min=0"`
+	Sort   string `json:"sort" binding:"omitempty,oneof=asc desc"` // By creation time, defaults to asc (desc when searching)
+
+	FromDate int64  `json:"fromDate" binding:"min=0"` // Unix millis, inclusive
+	ToDate   int64  `json:"toDate" binding:"min=0"`   // Unix millis, inclusive
+	PaidBy   string `json:"paidBy"`
+	Search   string `json:"search"` // Case-insensitive description substring
+}
+
+// SetParticipantGuestRequest request model
+type SetParticipantGuestRequest struct {
+	Code        string `json:"code" binding:"required"`
+	Participant string `json:"participant" binding:"required"`
+	Guest       bool   `json:"guest"`
+}
+
+// SetDefaultConsumersRequest request model; an empty list clears the defaults
+type SetDefaultConsumersRequest struct {
+	Code             string   `json:"code" binding:"required"`
+	DefaultConsumers []string `json:"defaultConsumers"`
+}
+
+// SetAliasesRequest sets how participants' names are displayed, by participant name.
+// An empty display name removes that participant's alias.
+type SetAliasesRequest struct {
+	Code    string            `json:"code" binding:"required"`
+	Aliases map[string]string `json:"aliases" binding:"required"`
+}
+
+// SetWebhookRequest request model; an empty WebhookURL removes the webhook
+type SetWebhookRequest struct {
+	Code       string `json:"code" binding:"required"`
+	WebhookURL string `json:"webhookUrl" binding:"omitempty,url,max=2048"`
+}
+
 // AddEqualExpenseRequest request model
 type AddEqualExpenseRequest struct {
 	Code          string   `json:"code" binding:"required"`
@@ -136,8 +440,24 @@ type AddEqualExpenseRequest struct {
 	Tax           float64  `json:"tax" binding:"min=0"`
 	ServiceCharge float64  `json:"serviceCharge" binding:"min=0"`
 	TotalDiscount float64  `json:"totalDiscount" binding:"min=0"`
-	PaidBy        string   `json:"paidBy" binding:"required"`
-	SplitAmong    []string `json:"splitAmong" binding:"required,min=1"`
+	PaidBy        string   `json:"paidBy" binding:"required_without=PaidByShares"`
+	SplitAmong    []string `json:"splitAmong" binding:"required_without=SplitAmongAll"`
+	SplitAmongAll bool     `json:"splitAmongAll"` // Split among every non-guest participant (plus any listed in SplitAmong)
+	Category      string   `json:"category" binding:"max=50"`
+	TaxInclusive  bool     `json:"taxInclusive"` // Subtotal already includes Tax
+	CreatedBy     string   `json:"createdBy"`    // Participant logging the expense
+	Notes         string   `json:"notes" binding:"max=1000"`
+
+	// Charge tax on the service charge too, at the rate Tax bears to the subtotal
+	TaxOnServiceCharge bool `json:"taxOnServiceCharge"`
+
+	// Optional amounts paid by each of several payers, summing to the expense total.
+	// PaidBy may be omitted and defaults to whoever paid the most.
+	PaidByShares map[string]float64 `json:"paidByShares"`
+
+	IdempotencyKey     string `json:"idempotencyKey" binding:"max=255"` // Optional, deduplicates retried requests
+	StrictParticipants bool   `json:"strictParticipants"`               // Reject names that are not already trip participants
+	IncludeTrip        bool   `json:"includeTrip"`                      // Respond with AddExpenseResponse instead of just the expense
 }
 
 // AddItemsExpenseRequest request model
@@ -148,6 +468,68 @@ type AddItemsExpenseRequest struct {
 	ServiceCharge float64 `json:"serviceCharge" binding:"min=0"`
 	TotalDiscount float64 `json:"totalDiscount" binding:"min=0"`
 	Items         []Item  `json:"items" binding:"required,min=1"`
+	Category      string  `json:"category" binding:"max=50"`
+	TaxInclusive  bool    `json:"taxInclusive"` // Item prices already include Tax
+	CreatedBy     string  `json:"createdBy"`    // Participant logging the expense
+	Notes         string  `json:"notes" binding:"max=1000"`
+
+	// Charge tax on the service charge too, at the rate Tax bears to the taxed item subtotal
+	TaxOnServiceCharge bool `json:"taxOnServiceCharge"`
+
+	ExtrasSplitMode  string   `json:"extrasSplitMode" binding:"omitempty,oneof=proportional equal"` // Defaults to proportional
+	ExtrasSplitAmong []string `json:"extrasSplitAmong"`                                              // Trip participants who share the extras evenly; overrides extrasSplitMode
+
+	IdempotencyKey     string `json:"idempotencyKey" binding:"max=255"` // Optional, deduplicates retried requests
+	StrictParticipants bool   `json:"strictParticipants"`               // Reject names that are not already trip participants
+	IncludeTrip        bool   `json:"includeTrip"`                      // Respond with AddExpenseResponse instead of just the expense
+}
+
+// BulkExpensePayload is one expense in a bulk import; SplitType selects which fields apply.
+// Fields mean the same as in AddEqualExpenseRequest and AddItemsExpenseRequest.
+type BulkExpensePayload struct {
+	SplitType          string             `json:"splitType"` // "equal" or "items"
+	Description        string             `json:"description"`
+	Subtotal           float64            `json:"subtotal"` // Equal splits only
+	Tax                float64            `json:"tax"`
+	ServiceCharge      float64            `json:"serviceCharge"`
+	TotalDiscount      float64            `json:"totalDiscount"`
+	TaxOnServiceCharge bool               `json:"taxOnServiceCharge"`
+	PaidBy             string             `json:"paidBy"`           // Equal splits only
+	PaidByShares       map[string]float64 `json:"paidByShares"`     // Equal splits only
+	SplitAmong         []string           `json:"splitAmong"`       // Equal splits only
+	Items              []Item             `json:"items"`            // Item splits only; items without consumers use the trip's default consumers
+	ExtrasSplitMode    string             `json:"extrasSplitMode"`  // Item splits only
+	ExtrasSplitAmong   []string           `json:"extrasSplitAmong"` // Item splits only
+	Category           string             `json:"category"`
+	TaxInclusive       bool               `json:"taxInclusive"`
+	CreatedBy          string             `json:"createdBy"`
+	Notes              string             `json:"notes"`
+	IdempotencyKey     string             `json:"idempotencyKey"` // Optional; an expense already stored with this key is returned instead
+}
+
+// BulkAddExpensesRequest request model
+type BulkAddExpensesRequest struct {
+	Code     string               `json:"code" binding:"required"`
+	Expenses []BulkExpensePayload `json:"expenses" binding:"required,min=1,max=500"`
+}
+
+// BulkExpenseError reports why the expense at Index in a bulk import was rejected
+type BulkExpenseError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// BulkAddExpensesResponse response model
+type BulkAddExpensesResponse struct {
+	ExpenseIDs []string `json:"expenseIds"` // In request order
+}
+
+// DuplicateExpenseRequest request model
+type DuplicateExpenseRequest struct {
+	Code        string `json:"code" binding:"required"`
+	ExpenseID   string `json:"expenseId" binding:"required"`
+	Description string `json:"description"` // Optional override
+	PaidBy      string `json:"paidBy"`      // Optional override, applied to every item for item splits
 }
 
 // RemoveExpenseRequest request model
@@ -156,12 +538,36 @@ type RemoveExpenseRequest struct {
 	ExpenseID string `json:"expenseId" binding:"required"`
 }
 
+// UpdateExpenseNotesRequest replaces the notes of an expense; empty notes clear them
+type UpdateExpenseNotesRequest struct {
+	Code      string `json:"code" binding:"required"`
+	ExpenseID string `json:"expenseId" binding:"required"`
+	Notes     string `json:"notes" binding:"max=1000"`
+}
+
+// ConfirmExpenseRequest marks a pending expense as confirmed by a second participant
+type ConfirmExpenseRequest struct {
+	Code        string `json:"code" binding:"required"`
+	ExpenseID   string `json:"expenseId" binding:"required"`
+	ConfirmedBy string `json:"confirmedBy" binding:"required"`
+}
+
 // CalculateSingleBillRequest request model
 type CalculateSingleBillRequest struct {
-	Items         []Item  `json:"items" binding:"required,min=1"`
-	Tax           float64 `json:"tax" binding:"min=0"`
-	ServiceCharge float64 `json:"serviceCharge" binding:"min=0"`
-	TotalDiscount float64 `json:"totalDiscount" binding:"min=0"`
+	Items          []Item  `json:"items" binding:"required,min=1"`
+	Tax            float64 `json:"tax" binding:"min=0"`
+	ServiceCharge  float64 `json:"serviceCharge" binding:"min=0"`
+	TotalDiscount  float64 `json:"totalDiscount" binding:"min=0"`
+	TipPercent     float64 `json:"tipPercent" binding:"min=0,max=100"`       // Percentage of subtotal, added to service charge
+	TaxInclusive   bool    `json:"taxInclusive"`                             // Item prices already include Tax
+	Currency       string  `json:"currency" binding:"omitempty,len=3,alpha"` // ISO 4217 code used for rounding
+	FormatCurrency bool    `json:"formatCurrency"`                           // Add display strings for amounts in Currency
+	Strict         bool    `json:"strict"`                                   // Reject the bill instead of returning warnings
+
+	ExtrasSplitMode string `json:"extrasSplitMode" binding:"omitempty,oneof=proportional equal"` // Defaults to proportional
+
+	// Charge tax on the service charge (and tip) too, at the rate Tax bears to the taxed item subtotal
+	TaxOnServiceCharge bool `json:"taxOnServiceCharge"`
 }
 
 // CreateTripResponse response model
@@ -171,16 +577,41 @@ type CreateTripResponse struct {
 }
 
 // NewTrip creates a new Trip instance
-func NewTrip(id, code, name string, participant string) *Trip {
+func NewTrip(id, code, name string, participant string, currency string) *Trip {
 	return &Trip{
 		ID:           id,
 		CreationTime: time.Now().UnixMilli(),
 		Code:         code,
 		Name:         name,
 		Participants: []string{participant},
+		Currency:     currency,
 	}
 }
 
+// ExtraCharges returns the charges applied on top of the subtotal
+// Tax-inclusive expenses already carry their tax inside the subtotal
+func (e *Expense) ExtraCharges() float64 {
+	extra := e.ServiceCharge - e.TotalDiscount
+	if !e.TaxInclusive {
+		extra += e.Tax + e.ItemTax()
+	}
+	return extra
+}
+
+// ExpectedAmount recomputes the expense total from its subtotal and extra charges
+func (e *Expense) ExpectedAmount() float64 {
+	return e.Subtotal + e.ExtraCharges()
+}
+
+// ItemTax returns the total tax charged by items with their own TaxRate
+func (e *Expense) ItemTax() float64 {
+	var tax float64
+	for _, item := range e.Items {
+		tax += item.RatedTax(e.TaxInclusive)
+	}
+	return tax
+}
+
 // NewExpense creates a new Expense instance for equal splits
 func NewEqualExpense(id, tripID, description string, subtotal, tax, serviceCharge, totalDiscount float64, paidBy string, splitAmong []string) *Expense {
 	totalAmount := subtotal + tax + serviceCharge - totalDiscount
@@ -220,3 +651,78 @@ func NewItemExpense(id, tripID, description string, subtotal, tax, serviceCharge
 		Items:         items,
 	}
 }
+
+// ReminderPayment represents a single amount a debtor should pay
+type ReminderPayment struct {
+	To     string  `json:"to"`
+	Amount float64 `json:"amount"`
+}
+
+// SettlementReminder represents everything one person still has to pay
+type SettlementReminder struct {
+	Debtor   string            `json:"debtor"`
+	TotalDue float64           `json:"totalDue"`
+	Payments []ReminderPayment `json:"payments"`
+	DueDate  string            `json:"dueDate"` // YYYY-MM-DD
+}
+
+// SettlementRemindersRequest request model
+type SettlementRemindersRequest struct {
+	Code      string `json:"code" binding:"required"`
+	Format    string `json:"format"`    // "json" (default) or "ics"
+	DueInDays int    `json:"dueInDays"` // Days from now until payment is due, defaults to 7
+}
+
+// CategoryTotal represents the total spend for one expense category
+type CategoryTotal struct {
+	Category string  `json:"category"`
+	Total    float64 `json:"total"`
+	Count    int     `json:"count"`
+}
+
+// CategoryBreakdownResult represents a trip's spend grouped by category
+type CategoryBreakdownResult struct {
+	Categories []CategoryTotal `json:"categories"`
+	GrandTotal float64         `json:"grandTotal"`
+}
+
+// ExpenseHighlight identifies a single notable expense in trip statistics
+type ExpenseHighlight struct {
+	ID          string  `json:"id"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+	PaidBy      string  `json:"paidBy"`
+}
+
+// PersonStats represents how much one person paid and consumed over a trip
+type PersonStats struct {
+	Name       string  `json:"name"`
+	TotalSpent float64 `json:"totalSpent"` // Paid towards expenses
+	TotalOwed  float64 `json:"totalOwed"`  // Share of expenses consumed
+	NetBalance float64 `json:"netBalance"` // Positive = should receive
+}
+
+// SpendingTimelineDay represents one day of spending and the running totals up to it
+type SpendingTimelineDay struct {
+	Date       string             `json:"date"`       // YYYY-MM-DD, same as the Excel export
+	TotalSpent float64            `json:"totalSpent"` // Sum of expenses created that day
+	Cumulative map[string]float64 `json:"cumulative"` // Each person's share of expenses so far
+}
+
+// SpendingTimeline represents a trip's spending bucketed by day, oldest first
+// Days without expenses are left out
+type SpendingTimeline struct {
+	Days []SpendingTimelineDay `json:"days"`
+}
+
+// TripStats represents aggregate spending statistics for a trip
+type TripStats struct {
+	TotalSpent           float64          `json:"totalSpent"`
+	ExpenseCount         int              `json:"expenseCount"`
+	AverageExpense       float64          `json:"averageExpense"`
+	BiggestExpense       ExpenseHighlight `json:"biggestExpense"`
+	MostActivePayer      string           `json:"mostActivePayer"`      // Paid for the most expenses
+	MostActivePayerCount int              `json:"mostActivePayerCount"` // Number of expenses they paid for
+	People               []PersonStats    `json:"people"`
+	InactiveParticipants []string         `json:"inactiveParticipants"` // Never paid, consumed or settled anything
+}
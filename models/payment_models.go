@@ -23,4 +23,78 @@ type PaymentRequest struct {
 	ToPerson    string  `json:"to_person" binding:"required"`
 	Amount      float64 `json:"amount" binding:"required"`
 	Description string  `json:"description"`
-}
\ No newline at end of file
+	AllowNew    bool    `json:"allow_new"` // Add unknown people to the trip instead of rejecting them
+}
+
+// PreviewSettlementRequest represents the request body for previewing settlements after
+// a hypothetical payment, which is never stored
+type PreviewSettlementRequest struct {
+	Code   string  `json:"code" binding:"required"`
+	From   string  `json:"from" binding:"required"`
+	To     string  `json:"to" binding:"required"`
+	Amount float64 `json:"amount" binding:"required"`
+}
+
+// PaymentListRequest represents the request body for listing a trip's payments
+// Dates are YYYY-MM-DD and inclusive; either may be left empty for an open range
+type PaymentListRequest struct {
+	Code     string `json:"code" binding:"required"`
+	FromDate string `json:"from_date"`
+	ToDate   string `json:"to_date"`
+}
+
+// PersonPaymentTotal represents how much one person has sent and received in payments
+type PersonPaymentTotal struct {
+	Person        string  `json:"person"`
+	TotalSent     float64 `json:"total_sent"`
+	TotalReceived float64 `json:"total_received"`
+}
+
+// PaymentListResult represents a trip's payments with per-person totals over the same range
+type PaymentListResult struct {
+	Payments []Payment            `json:"payments"`
+	Totals   []PersonPaymentTotal `json:"totals"` // Sorted by person
+}
+
+// BulkPaymentItem is one payment in a bulk creation request
+type BulkPaymentItem struct {
+	FromPerson  string  `json:"from_person"`
+	ToPerson    string  `json:"to_person"`
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description"`
+}
+
+// BulkPaymentRequest represents the request body for creating several payments at once
+type BulkPaymentRequest struct {
+	Code     string            `json:"code" binding:"required"`
+	Payments []BulkPaymentItem `json:"payments" binding:"required,min=1,max=100"`
+	AllowNew bool              `json:"allow_new"` // Add unknown people to the trip instead of rejecting them
+}
+
+// BulkPaymentError reports why the payment at Index in a bulk request was rejected
+type BulkPaymentError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// BankTransaction represents a single row from an exported bank statement
+type BankTransaction struct {
+	Row          int       `json:"row"` // 1-based line number in the CSV
+	Date         time.Time `json:"date"`
+	Amount       float64   `json:"amount"` // Absolute value of the transfer
+	Counterparty string    `json:"counterparty"`
+}
+
+// ReconcileMatch pairs a bank transaction with the recorded payment it matched
+type ReconcileMatch struct {
+	Transaction BankTransaction `json:"transaction"`
+	Payment     Payment         `json:"payment"`
+	DaysApart   int             `json:"days_apart"`
+}
+
+// ReconcileResult represents the outcome of matching a bank statement against payments
+type ReconcileResult struct {
+	Matched               []ReconcileMatch  `json:"matched"`
+	UnmatchedTransactions []BankTransaction `json:"unmatched_transactions"`
+	UnmatchedPayments     []Payment         `json:"unmatched_payments"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SettlementSnapshot represents a stored settlement result at a point in time
+type SettlementSnapshot struct {
+	ID        int             `json:"id" db:"id"`
+	TripID    string          `json:"trip_id" db:"trip_id"`
+	Result    json.RawMessage `json:"result" db:"result"`         // Serialized SettlementResult
+	CreatedAt time.Time       `json:"created_at" db:"created_at"` // TIMESTAMP
+}
+
+// CalculateSettlementsRequest represents the request body for calculating settlements
+type CalculateSettlementsRequest struct {
+	Code         string `json:"code" binding:"required"`
+	SaveSnapshot bool   `json:"saveSnapshot"`
+
+	MinimizeTransactions bool    `json:"minimizeTransactions"`                                           // Fewest transfers; exhaustive below 12 people
+	MinSettlementAmount  float64 `json:"minSettlementAmount" binding:"omitempty,min=0"`                  // Smallest transfer to keep; defaults to 0.01
+	FormatCurrency       bool    `json:"formatCurrency"`                                                 // Add display strings in the trip currency
+	IncludePending       bool    `json:"includePending"`                                                 // Also count expenses not yet confirmed
+	BypassCache          bool    `json:"bypassCache"`                                                    // Recompute instead of using a cached result
+	EqualSplitRemainder  string  `json:"equalSplitRemainder" binding:"omitempty,oneof=roundRobin payer"` // Who absorbs leftover cents of equal splits
+	Verbose              bool    `json:"verbose"`                                                        // Add a per-expense, per-item breakdown
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// ExpenseTemplate is a saved expense that can be re-added to its trip, e.g. monthly rent
+type ExpenseTemplate struct {
+	ID        string    `json:"id" db:"id"`
+	TripID    string    `json:"trip_id" db:"trip_id"`
+	Name      string    `json:"name" db:"name"`
+	Expense   *Expense  `json:"expense" db:"expense"`       // Split type, participants and default amounts
+	CreatedAt time.Time `json:"created_at" db:"created_at"` // TIMESTAMP
+}
+
+// CreateExpenseTemplateRequest saves one of the trip's expenses as a template
+type CreateExpenseTemplateRequest struct {
+	Code      string `json:"code" binding:"required"`
+	ExpenseID string `json:"expenseId" binding:"required"`
+	Name      string `json:"name" binding:"required"`
+}
+
+// DeleteExpenseTemplateRequest removes a template from a trip
+type DeleteExpenseTemplateRequest struct {
+	Code       string `json:"code" binding:"required"`
+	TemplateID string `json:"templateId" binding:"required"`
+}
+
+// ExpenseFromTemplateRequest adds a new expense to a trip from one of its templates
+type ExpenseFromTemplateRequest struct {
+	Code       string  `json:"code" binding:"required"`
+	TemplateID string  `json:"templateId" binding:"required"`
+	Amount     float64 `json:"amount" binding:"omitempty,gt=0"` // Optional override, equal splits only
+}
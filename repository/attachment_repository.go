@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+)
+
+// AttachmentRepository handles expense attachment data operations
+type AttachmentRepository struct {
+	db *sql.DB
+}
+
+// NewAttachmentRepository creates a new attachment repository
+func NewAttachmentRepository(db *sql.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+// GetExpenseTripID returns the trip an expense belongs to, or an empty string
+// when the expense does not exist
+func (r *AttachmentRepository) GetExpenseTripID(expenseID string) (string, error) {
+	var tripID string
+	err := r.db.QueryRow("SELECT trip_id FROM expenses WHERE id = $1", expenseID).Scan(&tripID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return tripID, nil
+}
+
+// CreateAttachment stores an attachment record and sets its creation time
+func (r *AttachmentRepository) CreateAttachment(attachment *models.ExpenseAttachment) error {
+	query := `
+		INSERT INTO expense_attachments (id, expense_id, file_name, content_type, size, path)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`
+	return r.db.QueryRow(query,
+		attachment.ID, attachment.ExpenseID, attachment.FileName,
+		attachment.ContentType, attachment.Size, attachment.Path,
+	).Scan(&attachment.CreatedAt)
+}
+
+// GetAttachments retrieves all attachments of an expense, oldest first
+func (r *AttachmentRepository) GetAttachments(expenseID string) ([]models.ExpenseAttachment, error) {
+	query := `
+		SELECT id, expense_id, file_name, content_type, size, path, created_at
+		FROM expense_attachments
+		WHERE expense_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err := r.db.Query(query, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []models.ExpenseAttachment{}
+	for rows.Next() {
+		var attachment models.ExpenseAttachment
+		if err := rows.Scan(
+			&attachment.ID, &attachment.ExpenseID, &attachment.FileName,
+			&attachment.ContentType, &attachment.Size, &attachment.Path, &attachment.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// GetAttachment retrieves one attachment of an expense, returning nil when it does not exist
+func (r *AttachmentRepository) GetAttachment(expenseID, attachmentID string) (*models.ExpenseAttachment, error) {
+	query := `
+		SELECT id, expense_id, file_name, content_type, size, path, created_at
+		FROM expense_attachments
+		WHERE id = $1 AND expense_id = $2
+	`
+	var attachment models.ExpenseAttachment
+	err := r.db.QueryRow(query, attachmentID, expenseID).Scan(
+		&attachment.ID, &attachment.ExpenseID, &attachment.FileName,
+		&attachment.ContentType, &attachment.Size, &attachment.Path, &attachment.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
@@ -4,7 +4,7 @@ package repository
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
 	_ "github.com/lib/pq"
@@ -38,7 +38,12 @@ func InitDB() error {
 		return fmt.Errorf("failed to ping database: %v", err)
 	}
 
-	log.Println("Successfully connected to the database")
+	slog.Info("Successfully connected to the database")
+
+	// Bring the schema up to date before serving requests
+	if err := ApplyMigrations(db); err != nil {
+		return fmt.Errorf("failed to apply migrations: %v", err)
+	}
 	return nil
 }
 
@@ -49,6 +54,12 @@ func CloseDB() {
 	}
 }
 
+// SetDB replaces the database instance, for connections opened outside InitDB such
+// as test doubles
+func SetDB(conn *sql.DB) {
+	db = conn
+}
+
 // GetDB returns the database instance
 func GetDB() *sql.DB {
 	return db
@@ -3,11 +3,23 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/lib/pq"
 )
 
+// foreignKeyViolation is the PostgreSQL error code for a missing referenced row
+const foreignKeyViolation = "23503"
+
+// isForeignKeyViolation reports whether err is a PostgreSQL foreign key violation
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation
+}
+
 // ExpenseRepository handles database operations for expenses
 type ExpenseRepository struct {
 	DB *sql.DB
@@ -28,70 +40,342 @@ func (r *ExpenseRepository) StoreExpense(expense *models.Expense) error {
 	}
 	defer tx.Rollback()
 
-	// Insert expense
-	_, err = tx.Exec(
+	if err := insertExpense(tx, expense); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// BulkStoreExpenses adds the participants to the trip and saves all expenses in a
+// single transaction, so either every expense is stored or none are. When limit is
+// positive, new participants that would take the trip past it fail the whole batch
+// with ErrTooManyParticipants.
+func (r *ExpenseRepository) BulkStoreExpenses(tripID string, participants []string, expenses []*models.Expense, limit int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := addTripParticipants(tx, tripID, participants, limit); err != nil {
+		return err
+	}
+
+	for _, expense := range expenses {
+		if err := insertExpense(tx, expense); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insertExpense inserts an expense with its participants or items within a transaction
+func insertExpense(tx *sql.Tx, expense *models.Expense) error {
+	// Insert expense (an empty idempotency key is stored as NULL so it never conflicts)
+	idempotencyKey := sql.NullString{String: expense.IdempotencyKey, Valid: expense.IdempotencyKey != ""}
+	notes := sql.NullString{String: expense.Notes, Valid: expense.Notes != ""}
+	// New expenses wait for confirmation unless a status was given
+	if expense.Status == "" {
+		expense.Status = models.ExpenseStatusPending
+	}
+	if expense.SplitType == "items" && expense.ExtrasSplitMode == "" {
+		expense.ExtrasSplitMode = models.ExtrasSplitProportional
+	}
+	_, err := tx.Exec(
 		`INSERT INTO expenses 
          (id, trip_id, description, amount, subtotal, tax, service_charge, total_discount, 
-          paid_by, split_type, creation_time, receipt_image) 
-         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+          paid_by, split_type, creation_time, receipt_image, idempotency_key, category,
+          tax_inclusive, created_by, status, confirmed_by, notes, extras_split_mode, tax_on_service_charge) 
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)`,
 		expense.ID, expense.TripID, expense.Description, expense.Amount, expense.Subtotal,
 		expense.Tax, expense.ServiceCharge, expense.TotalDiscount, expense.PaidBy,
-		expense.SplitType, expense.CreationTime, expense.ReceiptImage,
+		expense.SplitType, expense.CreationTime, expense.ReceiptImage, idempotencyKey,
+		expense.Category, expense.TaxInclusive, expense.CreatedBy, expense.Status, expense.ConfirmedBy,
+		notes, expense.ExtrasSplitMode, expense.TaxOnServiceCharge,
 	)
+	// expenses.trip_id references trips.id, so an unknown trip fails the insert
+	if isForeignKeyViolation(err) {
+		return ErrTripNotFound
+	}
 	if err != nil {
 		return fmt.Errorf("failed to insert expense: %v", err)
 	}
 
 	// Insert participants or items based on split type
 	if expense.SplitType == "equal" {
-		for _, participant := range expense.SplitAmong {
+		for i, participant := range expense.SplitAmong {
 			_, err = tx.Exec(
-				"INSERT INTO expense_participants (expense_id, participant) VALUES ($1, $2)",
-				expense.ID, participant,
+				"INSERT INTO expense_participants (expense_id, participant, ordinal) VALUES ($1, $2, $3)",
+				expense.ID, participant, i,
 			)
 			if err != nil {
 				return fmt.Errorf("failed to insert expense participant: %v", err)
 			}
 		}
+
+		// Jointly paid expenses record what each payer paid
+		for payer, amount := range expense.PaidByShares {
+			_, err = tx.Exec(
+				"INSERT INTO expense_payers (expense_id, payer, amount) VALUES ($1, $2, $3)",
+				expense.ID, payer, amount,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to insert expense payer: %v", err)
+			}
+		}
 	} else if expense.SplitType == "items" {
-		for _, item := range expense.Items {
+		for i, item := range expense.Items {
 			var itemID int
 			err = tx.QueryRow(
 				`INSERT INTO expenses_items 
-                 (expense_id, description, unit_price, quantity, amount, item_discount, paid_by) 
-                 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+                 (expense_id, description, unit_price, quantity, amount, item_discount, paid_by, tax_rate, ordinal) 
+                 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
 				expense.ID, item.Description, item.UnitPrice, item.Quantity, item.Amount,
-				item.ItemDiscount, item.PaidBy,
+				item.ItemDiscount, item.PaidBy, item.TaxRate, i,
 			).Scan(&itemID)
 			if err != nil {
 				return fmt.Errorf("failed to insert expense item: %v", err)
 			}
 
 			// Insert consumers for the item
-			for _, consumer := range item.Consumers {
+			for j, consumer := range item.Consumers {
+				weight := 1.0
+				if w, exists := item.ConsumerWeights[consumer]; exists {
+					weight = w
+				}
+				var quantity sql.NullFloat64
+				if q, exists := item.ConsumerQuantities[consumer]; exists {
+					quantity = sql.NullFloat64{Float64: q, Valid: true}
+				}
 				_, err = tx.Exec(
-					"INSERT INTO item_consumers (item_id, consumer) VALUES ($1, $2)",
-					itemID, consumer,
+					"INSERT INTO item_consumers (item_id, consumer, weight, quantity, ordinal) VALUES ($1, $2, $3, $4, $5)",
+					itemID, consumer, weight, quantity, j,
 				)
 				if err != nil {
 					return fmt.Errorf("failed to insert item consumer: %v", err)
 				}
 			}
 		}
+
+		// People sharing the extras when the split names a subset
+		for i, participant := range expense.ExtrasSplitAmong {
+			_, err = tx.Exec(
+				"INSERT INTO expense_extras_participants (expense_id, participant, ordinal) VALUES ($1, $2, $3)",
+				expense.ID, participant, i,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to insert extras participant: %v", err)
+			}
+		}
 	}
 
-	return tx.Commit()
+	return nil
 }
 
-// GetExpenses retrieves all expenses for a trip
-func (r *ExpenseRepository) GetExpenses(tripID string) ([]*models.Expense, error) {
-	// Query expenses
+// expenseColumns lists the expense columns in the order queryExpenses scans them
+const expenseColumns = `id, trip_id, description, amount, subtotal, tax, service_charge, 
+          total_discount, paid_by, split_type, creation_time, receipt_image, idempotency_key, category,
+          tax_inclusive, created_by, status, confirmed_by, notes, extras_split_mode, tax_on_service_charge`
+
+// ExpenseListOptions controls filtering, paging and ordering when listing expenses
+// The zero value returns every expense in ascending creation order
+type ExpenseListOptions struct {
+	Limit      int    // Maximum number of expenses to return, 0 for no limit
+	Offset     int    // Number of expenses to skip
+	Descending bool   // Newest expenses first
+	FromDate   int64  // Earliest creation time in unix millis, 0 for no lower bound
+	ToDate     int64  // Latest creation time in unix millis, 0 for no upper bound
+	PaidBy     string // Normalized payer name, empty for any payer
+	Search     string // Case-insensitive description substring, empty for no search
+}
+
+// expenseFilter builds the WHERE clause shared by GetExpenses and CountExpenses
+func expenseFilter(tripID string, opts ExpenseListOptions) (string, []interface{}) {
+	where := " WHERE trip_id = $1"
+	args := []interface{}{tripID}
+
+	if opts.FromDate > 0 {
+		args = append(args, opts.FromDate)
+		where += fmt.Sprintf(" AND creation_time >= $%d", len(args))
+	}
+	if opts.ToDate > 0 {
+		args = append(args, opts.ToDate)
+		where += fmt.Sprintf(" AND creation_time <= $%d", len(args))
+	}
+	if opts.PaidBy != "" {
+		args = append(args, opts.PaidBy)
+		where += fmt.Sprintf(" AND paid_by = $%d", len(args))
+	}
+	if opts.Search != "" {
+		args = append(args, "%"+escapeLikePattern(opts.Search)+"%")
+		where += fmt.Sprintf(" AND description ILIKE $%d", len(args))
+	}
+
+	return where, args
+}
+
+// escapeLikePattern escapes LIKE wildcards so user input matches literally
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetExpenses retrieves expenses for a trip according to the given options
+func (r *ExpenseRepository) GetExpenses(tripID string, opts ExpenseListOptions) ([]*models.Expense, error) {
+	where, args := expenseFilter(tripID, opts)
+	query := `SELECT ` + expenseColumns + ` 
+         FROM expenses` + where
+
+	if opts.Descending {
+		query += " ORDER BY creation_time DESC, id DESC"
+	} else {
+		query += " ORDER BY creation_time ASC, id ASC"
+	}
+
+	if opts.Limit > 0 {
+		args = append(args, opts.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if opts.Offset > 0 {
+		args = append(args, opts.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	return r.queryExpenses(query, args...)
+}
+
+// SearchOwnerExpenses finds expenses in any of an owner's trips whose description
+// contains search, ignoring case, newest first
+func (r *ExpenseRepository) SearchOwnerExpenses(owner string, search string, limit int) ([]models.ExpenseMatch, error) {
 	rows, err := r.DB.Query(
-		`SELECT id, trip_id, description, amount, subtotal, tax, service_charge, 
-          total_discount, paid_by, split_type, creation_time, receipt_image 
-         FROM expenses WHERE trip_id = $1 ORDER BY creation_time ASC`,
-		tripID,
+		`SELECT e.id, t.code, t.name, e.description, e.amount, e.paid_by, e.category, e.creation_time
+         FROM expenses e JOIN trips t ON t.id = e.trip_id
+         WHERE t.owner = $1 AND e.description ILIKE $2
+         ORDER BY e.creation_time DESC, e.id DESC
+         LIMIT $3`,
+		owner, "%"+escapeLikePattern(search)+"%", limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search expenses: %v", err)
+	}
+	defer rows.Close()
+
+	matches := []models.ExpenseMatch{}
+	for rows.Next() {
+		var match models.ExpenseMatch
+		if err := rows.Scan(&match.ExpenseID, &match.TripCode, &match.TripName, &match.Description,
+			&match.Amount, &match.PaidBy, &match.Category, &match.CreationTime); err != nil {
+			return nil, fmt.Errorf("failed to scan expense match: %v", err)
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
+}
+
+// CountExpenses returns the number of expenses in a trip matching the filters, ignoring paging
+func (r *ExpenseRepository) CountExpenses(tripID string, opts ExpenseListOptions) (int, error) {
+	where, args := expenseFilter(tripID, opts)
+
+	var count int
+	err := r.DB.QueryRow("SELECT COUNT(*) FROM expenses"+where, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count expenses: %v", err)
+	}
+	return count, nil
+}
+
+// GetExpenseByIdempotencyKey retrieves the expense stored under a client-supplied key,
+// returning nil when no expense in the trip uses that key
+func (r *ExpenseRepository) GetExpenseByIdempotencyKey(tripID string, key string) (*models.Expense, error) {
+	expenses, err := r.queryExpenses(
+		`SELECT `+expenseColumns+` 
+         FROM expenses WHERE trip_id = $1 AND idempotency_key = $2`,
+		tripID, key,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(expenses) == 0 {
+		return nil, nil
+	}
+	return expenses[0], nil
+}
+
+// GetExpense retrieves one expense of a trip, returning nil when it does not exist
+func (r *ExpenseRepository) GetExpense(tripID string, expenseID string) (*models.Expense, error) {
+	expenses, err := r.queryExpenses(
+		`SELECT `+expenseColumns+` 
+         FROM expenses WHERE trip_id = $1 AND id = $2`,
+		tripID, expenseID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(expenses) == 0 {
+		return nil, nil
+	}
+	return expenses[0], nil
+}
+
+// ConfirmExpense marks an expense of a trip as confirmed by the given participant,
+// reporting whether the expense was found
+func (r *ExpenseRepository) ConfirmExpense(tripID string, expenseID string, confirmedBy string) (bool, error) {
+	result, err := r.DB.Exec(
+		"UPDATE expenses SET status = $1, confirmed_by = $2 WHERE id = $3 AND trip_id = $4",
+		models.ExpenseStatusConfirmed, confirmedBy, expenseID, tripID,
 	)
+	if err != nil {
+		return false, fmt.Errorf("failed to confirm expense: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to confirm expense: %v", err)
+	}
+	return rows > 0, nil
+}
+
+// UpdateNotes replaces the notes of an expense of a trip, storing empty notes as NULL,
+// and reports whether the expense was found
+func (r *ExpenseRepository) UpdateNotes(tripID string, expenseID string, notes string) (bool, error) {
+	result, err := r.DB.Exec(
+		"UPDATE expenses SET notes = $1 WHERE id = $2 AND trip_id = $3",
+		sql.NullString{String: notes, Valid: notes != ""}, expenseID, tripID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update expense notes: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update expense notes: %v", err)
+	}
+	return rows > 0, nil
+}
+
+// GetReceiptImage returns the stored receipt image path of an expense of a trip,
+// or an empty string when the expense does not exist or has no receipt image
+func (r *ExpenseRepository) GetReceiptImage(tripID string, expenseID string) (string, error) {
+	var receiptImage sql.NullString
+	err := r.DB.QueryRow(
+		"SELECT receipt_image FROM expenses WHERE trip_id = $1 AND id = $2",
+		tripID, expenseID,
+	).Scan(&receiptImage)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get receipt image: %v", err)
+	}
+	return receiptImage.String, nil
+}
+
+// queryExpenses runs an expense query and loads each expense's participants or items
+func (r *ExpenseRepository) queryExpenses(query string, args ...interface{}) ([]*models.Expense, error) {
+	rows, err := r.DB.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get expenses: %v", err)
 	}
@@ -101,11 +385,16 @@ func (r *ExpenseRepository) GetExpenses(tripID string) ([]*models.Expense, error
 	for rows.Next() {
 		var expense models.Expense
 		var receiptImage sql.NullString
+		var idempotencyKey sql.NullString
+		var notes sql.NullString
 
 		err = rows.Scan(
 			&expense.ID, &expense.TripID, &expense.Description, &expense.Amount,
 			&expense.Subtotal, &expense.Tax, &expense.ServiceCharge, &expense.TotalDiscount,
 			&expense.PaidBy, &expense.SplitType, &expense.CreationTime, &receiptImage,
+			&idempotencyKey, &expense.Category, &expense.TaxInclusive,
+			&expense.CreatedBy, &expense.Status, &expense.ConfirmedBy, &notes,
+			&expense.ExtrasSplitMode, &expense.TaxOnServiceCharge,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan expense: %v", err)
@@ -114,72 +403,148 @@ func (r *ExpenseRepository) GetExpenses(tripID string) ([]*models.Expense, error
 		if receiptImage.Valid {
 			expense.ReceiptImage = receiptImage.String
 		}
+		if idempotencyKey.Valid {
+			expense.IdempotencyKey = idempotencyKey.String
+		}
+		expense.Notes = notes.String
 
-		// Load participants or items based on split type
-		if expense.SplitType == "equal" {
-			// Get participants
-			pRows, err := r.DB.Query(
-				"SELECT participant FROM expense_participants WHERE expense_id = $1",
-				expense.ID,
-			)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get expense participants: %v", err)
+		if err := r.loadExpenseDetails(&expense); err != nil {
+			return nil, err
+		}
+
+		expenses = append(expenses, &expense)
+	}
+
+	return expenses, nil
+}
+
+// loadExpenseDetails loads participants or items based on split type
+func (r *ExpenseRepository) loadExpenseDetails(expense *models.Expense) error {
+	if expense.SplitType == "equal" {
+		// Get participants
+		pRows, err := r.DB.Query(
+			"SELECT participant FROM expense_participants WHERE expense_id = $1 ORDER BY ordinal, participant",
+			expense.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to get expense participants: %v", err)
+		}
+		defer pRows.Close()
+
+		for pRows.Next() {
+			var participant string
+			if err := pRows.Scan(&participant); err != nil {
+				return fmt.Errorf("failed to scan participant: %v", err)
 			}
-			defer pRows.Close()
+			expense.SplitAmong = append(expense.SplitAmong, participant)
+		}
 
-			for pRows.Next() {
-				var participant string
-				if err := pRows.Scan(&participant); err != nil {
-					return nil, fmt.Errorf("failed to scan participant: %v", err)
-				}
-				expense.SplitAmong = append(expense.SplitAmong, participant)
+		// Get payer shares, present only when several people paid
+		payerRows, err := r.DB.Query(
+			"SELECT payer, amount FROM expense_payers WHERE expense_id = $1",
+			expense.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to get expense payers: %v", err)
+		}
+		defer payerRows.Close()
+
+		for payerRows.Next() {
+			var payer string
+			var amount float64
+			if err := payerRows.Scan(&payer, &amount); err != nil {
+				return fmt.Errorf("failed to scan payer: %v", err)
+			}
+			if expense.PaidByShares == nil {
+				expense.PaidByShares = make(map[string]float64)
+			}
+			expense.PaidByShares[payer] = amount
+		}
+	} else if expense.SplitType == "items" {
+		// Get items
+		iRows, err := r.DB.Query(
+			`SELECT id, description, unit_price, quantity, amount, item_discount, paid_by, tax_rate
+             FROM expenses_items WHERE expense_id = $1 ORDER BY ordinal, id`,
+			expense.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to get expense items: %v", err)
+		}
+		defer iRows.Close()
+
+		for iRows.Next() {
+			var item models.Item
+			var itemID int
+			var taxRate sql.NullFloat64
+			if err := iRows.Scan(&itemID, &item.Description, &item.UnitPrice, &item.Quantity,
+				&item.Amount, &item.ItemDiscount, &item.PaidBy, &taxRate); err != nil {
+				return fmt.Errorf("failed to scan item: %v", err)
 			}
-		} else if expense.SplitType == "items" {
-			// Get items
-			iRows, err := r.DB.Query(
-				`SELECT id, description, unit_price, quantity, amount, item_discount, paid_by
-                 FROM expenses_items WHERE expense_id = $1`,
-				expense.ID,
+			if taxRate.Valid {
+				item.TaxRate = &taxRate.Float64
+			}
+
+			// Get consumers for this item
+			cRows, err := r.DB.Query(
+				"SELECT consumer, weight, quantity FROM item_consumers WHERE item_id = $1 ORDER BY ordinal, consumer",
+				itemID,
 			)
 			if err != nil {
-				return nil, fmt.Errorf("failed to get expense items: %v", err)
+				return fmt.Errorf("failed to get item consumers: %v", err)
 			}
-			defer iRows.Close()
-
-			for iRows.Next() {
-				var item models.Item
-				var itemID int
-				if err := iRows.Scan(&itemID, &item.Description, &item.UnitPrice, &item.Quantity,
-					&item.Amount, &item.ItemDiscount, &item.PaidBy); err != nil {
-					return nil, fmt.Errorf("failed to scan item: %v", err)
-				}
+			defer cRows.Close()
 
-				// Get consumers for this item
-				cRows, err := r.DB.Query(
-					"SELECT consumer FROM item_consumers WHERE item_id = $1",
-					itemID,
-				)
-				if err != nil {
-					return nil, fmt.Errorf("failed to get item consumers: %v", err)
+			weights := make(map[string]float64)
+			quantities := make(map[string]float64)
+			weighted := false
+			for cRows.Next() {
+				var consumer string
+				var weight float64
+				var quantity sql.NullFloat64
+				if err := cRows.Scan(&consumer, &weight, &quantity); err != nil {
+					return fmt.Errorf("failed to scan consumer: %v", err)
 				}
-				defer cRows.Close()
-
-				for cRows.Next() {
-					var consumer string
-					if err := cRows.Scan(&consumer); err != nil {
-						return nil, fmt.Errorf("failed to scan consumer: %v", err)
-					}
-					item.Consumers = append(item.Consumers, consumer)
+				item.Consumers = append(item.Consumers, consumer)
+				weights[consumer] = weight
+				if weight != 1 {
+					weighted = true
 				}
+				if quantity.Valid {
+					quantities[consumer] = quantity.Float64
+				}
+			}
 
-				expense.Items = append(expense.Items, item)
+			// Only expose weights when the item isn't an equal split
+			if weighted {
+				item.ConsumerWeights = weights
 			}
+			if len(quantities) > 0 {
+				item.ConsumerQuantities = quantities
+			}
+
+			expense.Items = append(expense.Items, item)
 		}
 
-		expenses = append(expenses, &expense)
+		// Get the people sharing the extras, present only when a subset was chosen
+		eRows, err := r.DB.Query(
+			"SELECT participant FROM expense_extras_participants WHERE expense_id = $1 ORDER BY ordinal, participant",
+			expense.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to get extras participants: %v", err)
+		}
+		defer eRows.Close()
+
+		for eRows.Next() {
+			var participant string
+			if err := eRows.Scan(&participant); err != nil {
+				return fmt.Errorf("failed to scan extras participant: %v", err)
+			}
+			expense.ExtrasSplitAmong = append(expense.ExtrasSplitAmong, participant)
+		}
 	}
 
-	return expenses, nil
+	return nil
 }
 
 // RemoveExpense removes an expense
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles holds the numbered schema migrations, e.g. 0002_trip_settings.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey identifies the advisory lock that serializes migrations when
+// several instances start at once
+const migrationLockKey = 7303841
+
+// migration is one numbered schema change
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// ApplyMigrations brings the schema up to date by running, in order, every embedded
+// migration not yet recorded in schema_migrations. Each migration runs in its own
+// transaction together with its bookkeeping row, so a failed step leaves nothing
+// half-applied and running it again only picks up where it stopped.
+func ApplyMigrations(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return err
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		ran, err := applyMigration(db, m)
+		if err != nil {
+			return err
+		}
+		if ran {
+			applied++
+			slog.Info("Applied database migration", "version", m.version, "name", m.name)
+		}
+	}
+
+	slog.Info("Database schema is up to date", "applied", applied, "migrations", len(migrations))
+	return nil
+}
+
+// applyMigration runs a migration unless it was already applied, reporting whether it ran
+func applyMigration(db *sql.DB, m migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin migration %d: %v", m.version, err)
+	}
+	defer tx.Rollback()
+
+	// Held until commit, so concurrent instances apply each migration once
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockKey); err != nil {
+		return false, fmt.Errorf("failed to lock migrations: %v", err)
+	}
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", m.version).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check migration %d: %v", m.version, err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(m.sql); err != nil {
+		return false, fmt.Errorf("migration %d (%s) failed: %v", m.version, m.name, err)
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.version, m.name); err != nil {
+		return false, fmt.Errorf("failed to record migration %d: %v", m.version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit migration %d: %v", m.version, err)
+	}
+	return true, nil
+}
+
+// loadMigrations reads the migration files, ordered by version. File names must
+// start with a unique version number followed by an underscore.
+func loadMigrations(files fs.FS) ([]migration, error) {
+	paths, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %v", err)
+	}
+
+	migrations := make([]migration, 0, len(paths))
+	seen := make(map[int]string)
+	for _, file := range paths {
+		name := strings.TrimSuffix(path.Base(file), ".sql")
+		number, _, found := strings.Cut(name, "_")
+		version, err := strconv.Atoi(number)
+		if !found || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must be named <version>_<name>.sql", file)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, file, version)
+		}
+		seen[version] = file
+
+		data, err := fs.ReadFile(files, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", file, err)
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
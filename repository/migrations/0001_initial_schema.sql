@@ -1,14 +1,7 @@
--- migrations/schema.sql
-
--- Drop tables if they exist (for clean setup)
-DROP TABLE IF EXISTS expenses_items;
-DROP TABLE IF EXISTS expense_participants;
-DROP TABLE IF EXISTS expenses;
-DROP TABLE IF EXISTS trip_participants;
-DROP TABLE IF EXISTS trips;
+-- Baseline schema: trips, expenses with their splits, and payments
 
 -- Create trips table
-CREATE TABLE trips (
+CREATE TABLE IF NOT EXISTS trips (
     id VARCHAR(36) PRIMARY KEY,
     code VARCHAR(10) UNIQUE NOT NULL,
     name VARCHAR(255) NOT NULL,
@@ -16,14 +9,14 @@ CREATE TABLE trips (
 );
 
 -- Create trip_participants table
-CREATE TABLE trip_participants (
+CREATE TABLE IF NOT EXISTS trip_participants (
     trip_id VARCHAR(36) REFERENCES trips(id) ON DELETE CASCADE,
     participant VARCHAR(255) NOT NULL,
     PRIMARY KEY (trip_id, participant)
 );
 
 -- Create expenses table
-CREATE TABLE expenses (
+CREATE TABLE IF NOT EXISTS expenses (
     id VARCHAR(36) PRIMARY KEY,
     trip_id VARCHAR(36) REFERENCES trips(id) ON DELETE CASCADE,
     description VARCHAR(255) NOT NULL,
@@ -39,14 +32,14 @@ CREATE TABLE expenses (
 );
 
 -- Create expense_participants table (for equal splits)
-CREATE TABLE expense_participants (
+CREATE TABLE IF NOT EXISTS expense_participants (
     expense_id VARCHAR(36) REFERENCES expenses(id) ON DELETE CASCADE,
     participant VARCHAR(255) NOT NULL,
     PRIMARY KEY (expense_id, participant)
 );
 
 -- Create expenses_items table (for item-based splits)
-CREATE TABLE expenses_items (
+CREATE TABLE IF NOT EXISTS expenses_items (
     id SERIAL PRIMARY KEY,
     expense_id VARCHAR(36) REFERENCES expenses(id) ON DELETE CASCADE,
     description VARCHAR(255) NOT NULL,
@@ -58,14 +51,14 @@ CREATE TABLE expenses_items (
 );
 
 -- Create item_consumers table
-CREATE TABLE item_consumers (
+CREATE TABLE IF NOT EXISTS item_consumers (
     item_id INT REFERENCES expenses_items(id) ON DELETE CASCADE,
     consumer VARCHAR(255) NOT NULL,
     PRIMARY KEY (item_id, consumer)
 );
 
 -- Create payments table
-CREATE TABLE payments (
+CREATE TABLE IF NOT EXISTS payments (
     id SERIAL PRIMARY KEY,
     trip_id VARCHAR(36) NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
     from_person VARCHAR(255) NOT NULL,
@@ -77,11 +70,11 @@ CREATE TABLE payments (
 );
 
 -- Create indexes for faster queries
-CREATE INDEX idx_trips_code ON trips(code);
-CREATE INDEX idx_expenses_trip_id ON expenses(trip_id);
-CREATE INDEX idx_expense_participants_expense_id ON expense_participants(expense_id);
-CREATE INDEX idx_expenses_items_expense_id ON expenses_items(expense_id);
-CREATE INDEX idx_item_consumers_item_id ON item_consumers(item_id);
-CREATE INDEX idx_payments_trip_id ON payments(trip_id);
-CREATE INDEX idx_payments_from_person ON payments(from_person);
-CREATE INDEX idx_payments_to_person ON payments(to_person);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_trips_code ON trips(code);
+CREATE INDEX IF NOT EXISTS idx_expenses_trip_id ON expenses(trip_id);
+CREATE INDEX IF NOT EXISTS idx_expense_participants_expense_id ON expense_participants(expense_id);
+CREATE INDEX IF NOT EXISTS idx_expenses_items_expense_id ON expenses_items(expense_id);
+CREATE INDEX IF NOT EXISTS idx_item_consumers_item_id ON item_consumers(item_id);
+CREATE INDEX IF NOT EXISTS idx_payments_trip_id ON payments(trip_id);
+CREATE INDEX IF NOT EXISTS idx_payments_from_person ON payments(from_person);
+CREATE INDEX IF NOT EXISTS idx_payments_to_person ON payments(to_person);
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- Trip currency, webhook, owner and archiving; guests and default consumers
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT '';
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS webhook_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS owner VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE trip_participants ADD COLUMN IF NOT EXISTS exclude_from_auto BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE trip_participants ADD COLUMN IF NOT EXISTS default_consumer BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_trips_owner ON trips(owner, creation_time);
@@ -0,0 +1,32 @@
+-- Expense categories, notes, confirmation, idempotency keys and item split options
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS category VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS created_by VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS notes TEXT;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS extras_split_mode VARCHAR(20) NOT NULL DEFAULT ''; -- Item splits: 'proportional' or 'equal'
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS confirmed_by VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+
+-- Expenses stored before confirmation existed count as confirmed
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'confirmed';
+ALTER TABLE expenses ALTER COLUMN status SET DEFAULT 'pending'; -- 'pending' until a second participant confirms it
+
+-- Same name PostgreSQL gives the UNIQUE (trip_id, idempotency_key) table constraint
+CREATE UNIQUE INDEX IF NOT EXISTS expenses_trip_id_idempotency_key_key ON expenses(trip_id, idempotency_key);
+
+-- Expenses without a trip appear nowhere, but they are still someone's data: stop
+-- and let an operator assign or remove them rather than deleting them here
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM expenses WHERE trip_id IS NULL) THEN
+        RAISE EXCEPTION '% expenses have no trip; assign them to a trip or delete them before expenses.trip_id can be made NOT NULL',
+            (SELECT COUNT(*) FROM expenses WHERE trip_id IS NULL)
+            USING HINT = 'List them with: SELECT id, description, creation_time FROM expenses WHERE trip_id IS NULL';
+    END IF;
+END $$;
+ALTER TABLE expenses ALTER COLUMN trip_id SET NOT NULL;
+
+ALTER TABLE expenses_items ADD COLUMN IF NOT EXISTS tax_rate DECIMAL(6, 3); -- Percentage; NULL means the item shares the expense-level tax
+
+ALTER TABLE item_consumers ADD COLUMN IF NOT EXISTS weight DECIMAL(10, 4) NOT NULL DEFAULT 1;
+ALTER TABLE item_consumers ADD COLUMN IF NOT EXISTS quantity INT; -- Units this consumer had; NULL when the item is split by weight
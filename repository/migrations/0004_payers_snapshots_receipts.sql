@@ -0,0 +1,49 @@
+-- Joint payers, settlement snapshots, stored receipts, attachments and expense templates
+
+-- Create expense_payers table (equal splits paid jointly by several people)
+CREATE TABLE IF NOT EXISTS expense_payers (
+    expense_id VARCHAR(36) REFERENCES expenses(id) ON DELETE CASCADE,
+    payer VARCHAR(255) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    PRIMARY KEY (expense_id, payer)
+);
+
+-- Create settlement_snapshots table (audit trail of settlement results)
+CREATE TABLE IF NOT EXISTS settlement_snapshots (
+    id SERIAL PRIMARY KEY,
+    trip_id VARCHAR(36) NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    result JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create receipts table (processed receipts kept for later review and re-splitting)
+CREATE TABLE IF NOT EXISTS receipts (
+    id VARCHAR(36) PRIMARY KEY,
+    data JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create expense_attachments table (files attached to an expense besides its receipt image)
+CREATE TABLE IF NOT EXISTS expense_attachments (
+    id VARCHAR(36) PRIMARY KEY,
+    expense_id VARCHAR(36) NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    path TEXT NOT NULL, -- Relative to the uploads directory
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create expense_templates table (saved expenses re-added each month, e.g. rent)
+CREATE TABLE IF NOT EXISTS expense_templates (
+    id VARCHAR(36) PRIMARY KEY,
+    trip_id VARCHAR(36) NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    expense JSONB NOT NULL, -- Split type, participants and default amounts
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_expense_payers_expense_id ON expense_payers(expense_id);
+CREATE INDEX IF NOT EXISTS idx_expense_attachments_expense_id ON expense_attachments(expense_id);
+CREATE INDEX IF NOT EXISTS idx_settlement_snapshots_trip_id ON settlement_snapshots(trip_id);
+CREATE INDEX IF NOT EXISTS idx_expense_templates_trip_id ON expense_templates(trip_id);
@@ -0,0 +1,9 @@
+-- Create expense_extras_participants table (item splits whose tax, service charge
+-- and discount are shared evenly by a chosen subset of people)
+CREATE TABLE IF NOT EXISTS expense_extras_participants (
+    expense_id VARCHAR(36) REFERENCES expenses(id) ON DELETE CASCADE,
+    participant VARCHAR(255) NOT NULL,
+    PRIMARY KEY (expense_id, participant)
+);
+
+CREATE INDEX IF NOT EXISTS idx_expense_extras_participants_expense_id ON expense_extras_participants(expense_id);
@@ -0,0 +1,2 @@
+-- Expenses whose tax is also charged on the service charge, not just the subtotal
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS tax_on_service_charge BOOLEAN NOT NULL DEFAULT FALSE;
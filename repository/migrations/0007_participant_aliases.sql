@@ -0,0 +1,8 @@
+-- Create participant_aliases table (preferred display names for a trip's participants,
+-- for names title casing gets wrong such as "McDonald", or nicknames)
+CREATE TABLE IF NOT EXISTS participant_aliases (
+    trip_id VARCHAR(36) REFERENCES trips(id) ON DELETE CASCADE,
+    participant VARCHAR(255) NOT NULL,
+    display_name VARCHAR(255) NOT NULL,
+    PRIMARY KEY (trip_id, participant)
+);
@@ -0,0 +1,2 @@
+-- Item quantities may be fractional for weighed goods, e.g. 0.5 kg or 1.25 L
+ALTER TABLE expenses_items ALTER COLUMN quantity TYPE DECIMAL(10, 3);
@@ -0,0 +1,15 @@
+-- Split members, items and consumers keep the order they were entered in, so
+-- largest-remainder rounding and receipt item indexes are stable across reads.
+-- Rows stored before this migration all get ordinal 0 and fall back to name order.
+ALTER TABLE expense_participants ADD COLUMN IF NOT EXISTS ordinal INT NOT NULL DEFAULT 0;
+ALTER TABLE expense_extras_participants ADD COLUMN IF NOT EXISTS ordinal INT NOT NULL DEFAULT 0;
+ALTER TABLE item_consumers ADD COLUMN IF NOT EXISTS ordinal INT NOT NULL DEFAULT 0;
+ALTER TABLE expenses_items ADD COLUMN IF NOT EXISTS ordinal INT NOT NULL DEFAULT 0;
+
+-- Item ids are serial, so existing items can recover their entry order
+UPDATE expenses_items SET ordinal = numbered.ordinal
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY expense_id ORDER BY id) - 1 AS ordinal
+    FROM expenses_items
+) AS numbered
+WHERE expenses_items.id = numbered.id;
@@ -0,0 +1,2 @@
+-- Consumers may share fractional quantities of weighed goods, e.g. 0.3 of 0.5 kg
+ALTER TABLE item_consumers ALTER COLUMN quantity TYPE DECIMAL(10, 3);
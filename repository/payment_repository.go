@@ -2,7 +2,9 @@ package repository
 
 import (
 	"database/sql"
+	"fmt"
 	"github.com/fadhlanhapp/sharetab-backend/models"
+	"time"
 )
 
 // PaymentRepository handles payment data operations
@@ -31,15 +33,61 @@ func (r *PaymentRepository) CreatePayment(payment *models.Payment) error {
 	return nil
 }
 
+// CreatePayments adds the participants to the trip and inserts several payments in a
+// single transaction, so either all are stored or none are. Each payment's ID is set
+// from the inserted row. When limit is positive, new participants that would take the
+// trip past it fail the whole batch with ErrTooManyParticipants.
+func (r *PaymentRepository) CreatePayments(tripID string, participants []string, payments []*models.Payment, limit int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := addTripParticipants(tx, tripID, participants, limit); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO payments (trip_id, from_person, to_person, amount, description, payment_date)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	for _, payment := range payments {
+		err := tx.QueryRow(query, payment.TripID, payment.FromPerson, payment.ToPerson,
+			payment.Amount, payment.Description, payment.PaymentDate).Scan(&payment.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert payment: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
 // GetPaymentsByTripID retrieves all payments for a specific trip
 func (r *PaymentRepository) GetPaymentsByTripID(tripID string) ([]models.Payment, error) {
+	return r.GetPaymentsByTripIDInRange(tripID, time.Time{}, time.Time{})
+}
+
+// GetPaymentsByTripIDInRange retrieves a trip's payments dated on or after from and
+// before to. A zero time leaves that side of the range open.
+func (r *PaymentRepository) GetPaymentsByTripIDInRange(tripID string, from, to time.Time) ([]models.Payment, error) {
 	query := `
 		SELECT id, trip_id, from_person, to_person, amount, description, payment_date, created_at
 		FROM payments
-		WHERE trip_id = $1
-		ORDER BY payment_date DESC
-	`
-	rows, err := r.db.Query(query, tripID)
+		WHERE trip_id = $1`
+	args := []interface{}{tripID}
+	if !from.IsZero() {
+		args = append(args, from)
+		query += fmt.Sprintf(" AND payment_date >= $%d", len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to)
+		query += fmt.Sprintf(" AND payment_date < $%d", len(args))
+	}
+	query += " ORDER BY payment_date DESC"
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"database/sql"
+)
+
+// ReceiptRepository handles processed receipt data operations
+type ReceiptRepository struct {
+	db *sql.DB
+}
+
+// NewReceiptRepository creates a new receipt repository
+func NewReceiptRepository(db *sql.DB) *ReceiptRepository {
+	return &ReceiptRepository{db: db}
+}
+
+// CreateReceipt stores a serialized processed receipt under the given ID
+func (r *ReceiptRepository) CreateReceipt(id string, data []byte) error {
+	query := `
+		INSERT INTO receipts (id, data)
+		VALUES ($1, $2)
+	`
+	_, err := r.db.Exec(query, id, data)
+	return err
+}
+
+// GetReceipt retrieves a serialized processed receipt, returning nil when it does not exist
+func (r *ReceiptRepository) GetReceipt(id string) ([]byte, error) {
+	var data []byte
+	err := r.db.QueryRow("SELECT data FROM receipts WHERE id = $1", id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+)
+
+// SnapshotRepository handles settlement snapshot data operations
+type SnapshotRepository struct {
+	db *sql.DB
+}
+
+// NewSnapshotRepository creates a new snapshot repository
+func NewSnapshotRepository(db *sql.DB) *SnapshotRepository {
+	return &SnapshotRepository{db: db}
+}
+
+// CreateSnapshot stores a serialized settlement result for a trip
+func (r *SnapshotRepository) CreateSnapshot(snapshot *models.SettlementSnapshot) error {
+	query := `
+		INSERT INTO settlement_snapshots (trip_id, result)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRow(query, snapshot.TripID, []byte(snapshot.Result)).Scan(&snapshot.ID, &snapshot.CreatedAt)
+}
+
+// GetSnapshotsByTripID retrieves all settlement snapshots for a trip, newest first
+func (r *SnapshotRepository) GetSnapshotsByTripID(tripID string) ([]models.SettlementSnapshot, error) {
+	query := `
+		SELECT id, trip_id, result, created_at
+		FROM settlement_snapshots
+		WHERE trip_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+	rows, err := r.db.Query(query, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []models.SettlementSnapshot{}
+	for rows.Next() {
+		var snapshot models.SettlementSnapshot
+		var result []byte
+		if err := rows.Scan(&snapshot.ID, &snapshot.TripID, &result, &snapshot.CreatedAt); err != nil {
+			return nil, err
+		}
+		snapshot.Result = result
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+)
+
+// TemplateRepository handles expense template data operations
+type TemplateRepository struct {
+	db *sql.DB
+}
+
+// NewTemplateRepository creates a new template repository
+func NewTemplateRepository(db *sql.DB) *TemplateRepository {
+	return &TemplateRepository{db: db}
+}
+
+// CreateTemplate stores a template and sets its creation time
+func (r *TemplateRepository) CreateTemplate(template *models.ExpenseTemplate) error {
+	data, err := json.Marshal(template.Expense)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO expense_templates (id, trip_id, name, expense)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+	return r.db.QueryRow(query, template.ID, template.TripID, template.Name, data).Scan(&template.CreatedAt)
+}
+
+// GetTemplates retrieves all templates of a trip, ordered by name
+func (r *TemplateRepository) GetTemplates(tripID string) ([]models.ExpenseTemplate, error) {
+	query := `
+		SELECT id, trip_id, name, expense, created_at
+		FROM expense_templates
+		WHERE trip_id = $1
+		ORDER BY name, id
+	`
+	rows, err := r.db.Query(query, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []models.ExpenseTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *template)
+	}
+	return templates, rows.Err()
+}
+
+// GetTemplate retrieves one template of a trip, returning nil when it does not exist
+func (r *TemplateRepository) GetTemplate(tripID, templateID string) (*models.ExpenseTemplate, error) {
+	query := `
+		SELECT id, trip_id, name, expense, created_at
+		FROM expense_templates
+		WHERE id = $1 AND trip_id = $2
+	`
+	template, err := scanTemplate(r.db.QueryRow(query, templateID, tripID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return template, err
+}
+
+// DeleteTemplate removes a template from a trip, reporting whether it existed
+func (r *TemplateRepository) DeleteTemplate(tripID, templateID string) (bool, error) {
+	result, err := r.db.Exec("DELETE FROM expense_templates WHERE id = $1 AND trip_id = $2", templateID, tripID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// scanTemplate reads a template row, decoding its stored expense
+func scanTemplate(row interface{ Scan(...interface{}) error }) (*models.ExpenseTemplate, error) {
+	var template models.ExpenseTemplate
+	var data []byte
+	if err := row.Scan(&template.ID, &template.TripID, &template.Name, &data, &template.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &template.Expense); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
@@ -3,11 +3,20 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/fadhlanhapp/sharetab-backend/models"
 )
 
+// ErrTripNotFound is returned when no trip has the requested code, or when expenses
+// are stored for a trip that does not exist
+var ErrTripNotFound = errors.New("trip not found")
+
+// ErrTooManyParticipants is returned when adding someone new to a trip that already
+// has the maximum number of participants
+var ErrTooManyParticipants = errors.New("trip has too many participants")
+
 // TripRepository handles database operations for trips
 type TripRepository struct {
 	DB *sql.DB
@@ -30,8 +39,8 @@ func (r *TripRepository) StoreTrip(trip *models.Trip) error {
 
 	// Insert trip
 	_, err = tx.Exec(
-		"INSERT INTO trips (id, code, name, creation_time) VALUES ($1, $2, $3, $4)",
-		trip.ID, trip.Code, trip.Name, trip.CreationTime,
+		"INSERT INTO trips (id, code, name, creation_time, currency, owner) VALUES ($1, $2, $3, $4, $5, $6)",
+		trip.ID, trip.Code, trip.Name, trip.CreationTime, trip.Currency, trip.Owner,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert trip: %v", err)
@@ -51,25 +60,36 @@ func (r *TripRepository) StoreTrip(trip *models.Trip) error {
 	return tx.Commit()
 }
 
-// GetTripByCode retrieves a trip by its code
+// CodeExists reports whether a trip already uses the given code
+func (r *TripRepository) CodeExists(code string) (bool, error) {
+	var exists bool
+	err := r.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM trips WHERE code = $1)", code).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check trip code: %v", err)
+	}
+	return exists, nil
+}
+
+// GetTripByCode retrieves a trip by its code, returning ErrTripNotFound when no trip has it
 func (r *TripRepository) GetTripByCode(code string) (*models.Trip, error) {
 	// Query trip
 	var trip models.Trip
 	err := r.DB.QueryRow(
-		"SELECT id, code, name, creation_time FROM trips WHERE code = $1",
+		"SELECT id, code, name, creation_time, currency, webhook_url, owner, archived FROM trips WHERE code = $1",
 		code,
-	).Scan(&trip.ID, &trip.Code, &trip.Name, &trip.CreationTime)
+	).Scan(&trip.ID, &trip.Code, &trip.Name, &trip.CreationTime, &trip.Currency, &trip.WebhookURL,
+		&trip.Owner, &trip.Archived)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("trip not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTripNotFound
 		}
 		return nil, fmt.Errorf("failed to get trip: %v", err)
 	}
 
 	// Query participants
 	rows, err := r.DB.Query(
-		"SELECT participant FROM trip_participants WHERE trip_id = $1",
+		"SELECT participant, exclude_from_auto, default_consumer FROM trip_participants WHERE trip_id = $1",
 		trip.ID,
 	)
 	if err != nil {
@@ -79,41 +99,298 @@ func (r *TripRepository) GetTripByCode(code string) (*models.Trip, error) {
 
 	for rows.Next() {
 		var participant string
-		if err := rows.Scan(&participant); err != nil {
+		var excludeFromAuto, defaultConsumer bool
+		if err := rows.Scan(&participant, &excludeFromAuto, &defaultConsumer); err != nil {
 			return nil, fmt.Errorf("failed to scan participant: %v", err)
 		}
 		trip.Participants = append(trip.Participants, participant)
+		if excludeFromAuto {
+			trip.Guests = append(trip.Guests, participant)
+		}
+		if defaultConsumer {
+			trip.DefaultConsumers = append(trip.DefaultConsumers, participant)
+		}
+	}
+
+	trip.Aliases, err = r.GetAliases(trip.ID)
+	if err != nil {
+		return nil, err
 	}
 
 	return &trip, nil
 }
 
-// AddParticipant adds a participant to a trip
-func (r *TripRepository) AddParticipant(tripID string, participant string) error {
-	// Check if participant already exists
-	var count int
+// GetTripActivity counts a trip's expenses and payments and finds when the newest of
+// them was created, without loading any of them
+func (r *TripRepository) GetTripActivity(tripID string) (*models.TripActivity, error) {
+	var activity models.TripActivity
 	err := r.DB.QueryRow(
-		"SELECT COUNT(*) FROM trip_participants WHERE trip_id = $1 AND participant = $2",
-		tripID, participant,
-	).Scan(&count)
+		`SELECT
+             (SELECT COUNT(*) FROM expenses WHERE trip_id = $1),
+             (SELECT COUNT(*) FROM payments WHERE trip_id = $1),
+             GREATEST(
+                 COALESCE((SELECT MAX(creation_time) FROM expenses WHERE trip_id = $1), 0),
+                 COALESCE((SELECT (EXTRACT(EPOCH FROM MAX(created_at)) * 1000)::BIGINT FROM payments WHERE trip_id = $1), 0)
+             )`,
+		tripID,
+	).Scan(&activity.ExpenseCount, &activity.PaymentCount, &activity.LastActivityTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip activity: %v", err)
+	}
+
+	return &activity, nil
+}
+
+// AddParticipant adds a participant to a trip
+// Existing participants are left untouched, so concurrent adds of the same name are safe.
+// When limit is positive, a new participant is refused with ErrTooManyParticipants once
+// the trip has that many.
+func (r *TripRepository) AddParticipant(tripID string, participant string, limit int) error {
+	if limit <= 0 {
+		return insertTripParticipant(r.DB, tripID, participant)
+	}
 
+	tx, err := r.DB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to check participant: %v", err)
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := addTripParticipants(tx, tripID, []string{participant}, limit); err != nil {
+		return err
 	}
+	return tx.Commit()
+}
 
-	if count > 0 {
-		// Participant already exists
+// addTripParticipants adds participants to a trip within tx, leaving existing ones
+// untouched. When limit is positive the trip row is locked first, so concurrent adds
+// of different people are serialized and can't take the trip past limit participants;
+// ErrTooManyParticipants is returned once a new participant doesn't fit.
+func addTripParticipants(tx *sql.Tx, tripID string, participants []string, limit int) error {
+	if len(participants) == 0 {
 		return nil
 	}
 
-	// Add participant
-	_, err = r.DB.Exec(
-		"INSERT INTO trip_participants (trip_id, participant) VALUES ($1, $2)",
+	if limit > 0 {
+		var id string
+		err := tx.QueryRow("SELECT id FROM trips WHERE id = $1 FOR UPDATE", tripID).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTripNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock trip: %v", err)
+		}
+	}
+
+	for _, participant := range participants {
+		if limit > 0 {
+			var count int
+			var exists bool
+			err := tx.QueryRow(
+				`SELECT COUNT(*), COALESCE(BOOL_OR(participant = $2), FALSE)
+                 FROM trip_participants WHERE trip_id = $1`,
+				tripID, participant,
+			).Scan(&count, &exists)
+			if err != nil {
+				return fmt.Errorf("failed to count participants: %v", err)
+			}
+			if !exists && count >= limit {
+				return ErrTooManyParticipants
+			}
+		}
+
+		if err := insertTripParticipant(tx, tripID, participant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// participantExecer is implemented by both *sql.DB and *sql.Tx
+type participantExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertTripParticipant adds a participant to a trip unless they are already in it
+func insertTripParticipant(db participantExecer, tripID, participant string) error {
+	_, err := db.Exec(
+		`INSERT INTO trip_participants (trip_id, participant) VALUES ($1, $2)
+         ON CONFLICT (trip_id, participant) DO NOTHING`,
 		tripID, participant,
 	)
+	// trip_participants.trip_id references trips.id, so an unknown trip fails the insert
+	if isForeignKeyViolation(err) {
+		return ErrTripNotFound
+	}
 	if err != nil {
 		return fmt.Errorf("failed to insert participant: %v", err)
 	}
+	return nil
+}
 
+// GetTripsByOwner retrieves an owner's trips, newest first, skipping archived trips
+// unless includeArchived is set. Participants are not loaded.
+func (r *TripRepository) GetTripsByOwner(owner string, includeArchived bool) ([]*models.Trip, error) {
+	rows, err := r.DB.Query(
+		`SELECT id, code, name, creation_time, currency, owner, archived
+         FROM trips WHERE owner = $1 AND (archived = FALSE OR $2)
+         ORDER BY creation_time DESC`,
+		owner, includeArchived,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trips: %v", err)
+	}
+	defer rows.Close()
+
+	trips := []*models.Trip{}
+	for rows.Next() {
+		var trip models.Trip
+		if err := rows.Scan(&trip.ID, &trip.Code, &trip.Name, &trip.CreationTime, &trip.Currency,
+			&trip.Owner, &trip.Archived); err != nil {
+			return nil, fmt.Errorf("failed to scan trip: %v", err)
+		}
+		trips = append(trips, &trip)
+	}
+
+	return trips, rows.Err()
+}
+
+// SetArchived archives or restores a trip
+func (r *TripRepository) SetArchived(tripID string, archived bool) error {
+	_, err := r.DB.Exec("UPDATE trips SET archived = $1 WHERE id = $2", archived, tripID)
+	if err != nil {
+		return fmt.Errorf("failed to update trip: %v", err)
+	}
 	return nil
 }
+
+// DeleteTrip deletes a trip. Its participants, expenses with their items and consumers,
+// payments and snapshots go with it through ON DELETE CASCADE in the same statement.
+// It returns false when no trip has the ID.
+func (r *TripRepository) DeleteTrip(tripID string) (bool, error) {
+	result, err := r.DB.Exec("DELETE FROM trips WHERE id = $1", tripID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete trip: %v", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete trip: %v", err)
+	}
+	return deleted > 0, nil
+}
+
+// SetWebhookURL sets or clears the URL that receives a trip's events
+func (r *TripRepository) SetWebhookURL(tripID string, webhookURL string) error {
+	_, err := r.DB.Exec("UPDATE trips SET webhook_url = $1 WHERE id = $2", webhookURL, tripID)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %v", err)
+	}
+	return nil
+}
+
+// GetTripWebhook retrieves the code, currency and webhook URL of a trip by ID
+// Participants are not loaded
+func (r *TripRepository) GetTripWebhook(tripID string) (*models.Trip, error) {
+	trip := models.Trip{ID: tripID}
+	err := r.DB.QueryRow(
+		"SELECT code, currency, webhook_url FROM trips WHERE id = $1",
+		tripID,
+	).Scan(&trip.Code, &trip.Currency, &trip.WebhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip webhook: %v", err)
+	}
+	return &trip, nil
+}
+
+// SetParticipantGuest flags or unflags a participant as a guest excluded from automatic splits
+func (r *TripRepository) SetParticipantGuest(tripID string, participant string, guest bool) (bool, error) {
+	result, err := r.DB.Exec(
+		"UPDATE trip_participants SET exclude_from_auto = $1 WHERE trip_id = $2 AND participant = $3",
+		guest, tripID, participant,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update participant: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update participant: %v", err)
+	}
+
+	return affected > 0, nil
+}
+
+// SetDefaultConsumers replaces the participants charged for items that name no consumers
+func (r *TripRepository) SetDefaultConsumers(tripID string, consumers []string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE trip_participants SET default_consumer = FALSE WHERE trip_id = $1", tripID); err != nil {
+		return fmt.Errorf("failed to clear default consumers: %v", err)
+	}
+
+	for _, consumer := range consumers {
+		_, err = tx.Exec(
+			"UPDATE trip_participants SET default_consumer = TRUE WHERE trip_id = $1 AND participant = $2",
+			tripID, consumer,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to set default consumer: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetAliases returns a trip's participant display names by stored name, or nil when
+// none are set
+func (r *TripRepository) GetAliases(tripID string) (map[string]string, error) {
+	rows, err := r.DB.Query("SELECT participant, display_name FROM participant_aliases WHERE trip_id = $1", tripID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get participant aliases: %v", err)
+	}
+	defer rows.Close()
+
+	var aliases map[string]string
+	for rows.Next() {
+		var participant, displayName string
+		if err := rows.Scan(&participant, &displayName); err != nil {
+			return nil, fmt.Errorf("failed to scan participant alias: %v", err)
+		}
+		if aliases == nil {
+			aliases = make(map[string]string)
+		}
+		aliases[participant] = displayName
+	}
+	return aliases, rows.Err()
+}
+
+// SetAliases sets or, for an empty display name, removes participants' aliases in a
+// single transaction
+func (r *TripRepository) SetAliases(tripID string, aliases map[string]string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for participant, displayName := range aliases {
+		if displayName == "" {
+			_, err = tx.Exec("DELETE FROM participant_aliases WHERE trip_id = $1 AND participant = $2", tripID, participant)
+		} else {
+			_, err = tx.Exec(
+				`INSERT INTO participant_aliases (trip_id, participant, display_name) VALUES ($1, $2, $3)
+             ON CONFLICT (trip_id, participant) DO UPDATE SET display_name = EXCLUDED.display_name`,
+				tripID, participant, displayName,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set participant alias: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -1,54 +1,136 @@
 package routes
 
 import (
-	"os"
+	"context"
+	"net/http"
+	"time"
 
 	"github.com/fadhlanhapp/sharetab-backend/handlers"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SetupRoutes configures all API routes for the application
-func SetupRoutes(router *gin.Engine) {
-	// Create uploads directory if not exists
-	os.MkdirAll("uploads", os.ModePerm)
+// healthCheckTimeout bounds how long the health check waits for a database ping
+const healthCheckTimeout = 2 * time.Second
+
+// BuildInfo identifies the running deploy in health check responses
+type BuildInfo struct {
+	Version   string    // Release version, injected at build time
+	Commit    string    // Git commit the binary was built from
+	StartTime time.Time // When the process started, for reporting uptime
+}
 
+// SetupRoutes configures all API routes for the application
+func SetupRoutes(router *gin.Engine, build BuildInfo) {
 	// Initialize refactored handlers
 	handlers.InitHandlers()
 
+	// Prometheus metrics, opt-in via METRICS_ENABLED. The middleware must be added
+	// before the routes below so it wraps them.
+	if services.MetricsEnabled() {
+		router.Use(handlers.RequestMetrics())
+		router.GET("/metrics", gin.WrapH(services.MetricsHandler()))
+	}
+
 	// API v1 routes (refactored)
 	v1 := router.Group("/api/v1")
 	{
 		// Trip endpoints
 		v1.POST("/trips/create", handlers.CreateTripRefactored)
 		v1.POST("/trips/getByCode", handlers.GetTripByCodeRefactored)
+		v1.GET("/trips", handlers.ListTripsHandler)
+		v1.GET("/trips/:code", handlers.GetTripHandler)
+		v1.DELETE("/trips/:code", handlers.DeleteTripHandler)
+		v1.GET("/trips/:code/expenses/:id", handlers.GetExpenseHandler)
+		v1.GET("/trips/:code/templates/:id", handlers.GetExpenseTemplateHandler)
+		v1.POST("/trips/archive", handlers.ArchiveTripHandler)
+		v1.POST("/trips/setGuest", handlers.SetParticipantGuestHandler)
+		v1.POST("/trips/setWebhook", handlers.SetWebhookHandler)
+		v1.POST("/trips/setDefaultConsumers", handlers.SetDefaultConsumersHandler)
+		v1.POST("/trips/setAliases", handlers.SetAliasesHandler)
+		v1.POST("/trips/categoryBreakdown", handlers.CategoryBreakdownHandler)
+		v1.POST("/trips/stats", handlers.TripStatsHandler)
+		v1.POST("/trips/timeline", handlers.SpendingTimelineHandler)
+		v1.POST("/trips/balances", handlers.TripBalancesHandler)
+		v1.POST("/trips/settlementsFor", handlers.SettlementsForHandler)
+		v1.POST("/trips/previewSettlement", handlers.PreviewSettlementHandler)
 
 		// Expense endpoints
 		v1.POST("/expenses/calculateSingleBill", handlers.CalculateSingleBillRefactored)
 		v1.POST("/expenses/addEqual", handlers.AddEqualExpenseRefactored)
 		v1.POST("/expenses/addItems", handlers.AddItemsExpenseRefactored)
+		v1.POST("/expenses/bulkAdd", handlers.BulkAddExpensesHandler)
+		v1.POST("/expenses/duplicate", handlers.DuplicateExpenseHandler)
+		v1.POST("/expenses/fromTemplate", handlers.ExpenseFromTemplateHandler)
+		v1.POST("/expenses/templates/create", handlers.CreateExpenseTemplateHandler)
+		v1.POST("/expenses/templates/list", handlers.ListExpenseTemplatesHandler)
+		v1.POST("/expenses/templates/delete", handlers.DeleteExpenseTemplateHandler)
 		v1.POST("/expenses/remove", handlers.RemoveExpenseRefactored)
+		v1.POST("/expenses/confirm", handlers.ConfirmExpenseHandler)
+		v1.POST("/expenses/updateNotes", handlers.UpdateExpenseNotesHandler)
 		v1.POST("/expenses/list", handlers.ListExpensesRefactored)
+		v1.POST("/expenses/searchAll", handlers.SearchExpensesHandler)
 		v1.POST("/expenses/calculateSettlements", handlers.CalculateSettlementsRefactored)
+		v1.POST("/expenses/:id/attachments", handlers.UploadExpenseAttachmentHandler)
+		v1.GET("/expenses/:id/attachments", handlers.ListExpenseAttachmentsHandler)
+		v1.GET("/expenses/:id/attachments/:attachmentId", handlers.GetExpenseAttachmentHandler)
 
 		// Payment endpoints
 		v1.POST("/payments/create", handlers.CreatePaymentHandler)
+		v1.POST("/payments/bulkCreate", handlers.BulkCreatePaymentsHandler)
 		v1.POST("/payments/getByTrip", handlers.GetPaymentsByTripHandler)
 		v1.DELETE("/payments/:id", handlers.DeletePaymentHandler)
+		v1.POST("/payments/reconcileCSV", handlers.ReconcileCSVHandler)
+
+		// Settlement endpoints
+		v1.POST("/settlements/snapshots", handlers.ListSettlementSnapshotsHandler)
+		v1.POST("/settlements/reminders", handlers.SettlementRemindersHandler)
+		v1.POST("/settlements/status", handlers.SettlementStatusHandler)
 
 		// Receipt processing endpoints
-		v1.POST("/receipts/process", handlers.HandleProcessReceiptV1)
-		v1.POST("/receipts/addExpense", handlers.AddExpenseFromReceiptV1)
+		receiptRateLimit := handlers.ReceiptRateLimit()
+		v1.POST("/receipts/process", receiptRateLimit, handlers.HandleProcessReceiptV1)
+		v1.POST("/receipts/addExpense", receiptRateLimit, handlers.AddExpenseFromReceiptV1)
+		v1.POST("/receipts/addExpenseAssigned", handlers.AddExpenseFromAssignedReceiptV1)
+		v1.GET("/receipts/image/:expenseId", handlers.GetReceiptImageV1)
+		v1.GET("/receipts/:id", handlers.GetReceiptV1)
 
 		// Export endpoints
 		v1.POST("/trips/exportToExcel", handlers.ExportTripToExcel)
+		v1.POST("/trips/exportToCSV", handlers.ExportTripToCSV)
+		v1.POST("/trips/exportToPDF", handlers.ExportTripToPDF)
+		v1.POST("/trips/export", handlers.ExportTripBackupHandler)
+		v1.POST("/trips/import", handlers.ImportTripBackupHandler)
 	}
 
-	// Health check endpoint
+	// Health check endpoint, reports unhealthy when the database can't be reached
 	router.GET("/health", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+		defer cancel()
+
+		db := repository.GetDB()
+		uptime := time.Since(build.StartTime).Truncate(time.Second)
+		if db == nil || db.PingContext(ctx) != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":        "unhealthy",
+				"database":      "unreachable",
+				"version":       build.Version,
+				"commit":        build.Commit,
+				"uptime":        uptime.String(),
+				"uptimeSeconds": int64(uptime.Seconds()),
+			})
+			return
+		}
+
 		c.JSON(200, gin.H{
-			"status": "healthy",
-			"service": "sharetab-api",
+			"status":        "healthy",
+			"service":       "sharetab-api",
+			"version":       build.Version,
+			"commit":        build.Commit,
+			"uptime":        uptime.String(),
+			"uptimeSeconds": int64(uptime.Seconds()),
 		})
 	})
 }
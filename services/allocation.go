@@ -0,0 +1,324 @@
+package services
+
+import (
+	"math"
+	"sort"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// PersonAllocation is one person's share of an item-split bill
+type PersonAllocation struct {
+	Subtotal      float64 // Share of item amounts, net of embedded tax when tax-inclusive
+	Tax           float64
+	ServiceCharge float64
+	Discount      float64
+	Total         float64 // Subtotal + Tax + ServiceCharge - Discount
+}
+
+// BillCharges are the bill-level amounts distributed in proportion to item consumption
+type BillCharges struct {
+	Tax           float64
+	ServiceCharge float64
+	Discount      float64
+	TaxInclusive  bool     // Tax is already contained in the item amounts
+	Currency      string   // Shares are rounded to this currency's minor unit
+	SplitEqually  bool     // Share the charges evenly instead of by consumption
+	SplitAmong    []string // Share the charges evenly among only these people
+
+	// Tax includes tax on the service charge, which is shared like the service charge
+	TaxOnServiceCharge bool
+}
+
+// allocateItemSplit is the canonical per-person allocation for item-split bills,
+// shared by single bill calculation, settlements and exports.
+//
+// Each item's Amount is split among its consumers (by weight when given) and
+// rounded per person to the minor unit of charges.Currency. Tax, service charge and discount are then each split in
+// proportion to a person's item subtotal; see distributeCharge for how rounding
+// leftovers are shared. If the items add up to zero, the charges are split
+// equally instead.
+//
+// Items with a TaxRate are taxed directly and the tax is split like the item.
+// The bill-level Tax is shared only by items without a rate, or by all items
+// when every item has one.
+//
+// With SplitEqually, tax, service charge and discount are shared evenly by everyone
+// with an item share instead; taxes from item rates still follow their items.
+// SplitAmong narrows that to the listed people, who need not have consumed
+// anything. Tax already included in the item prices stays with the items.
+//
+// With TaxOnServiceCharge, the part of Tax charged on the service charge is shared
+// like the service charge, so each person pays tax on their own service share.
+//
+// When TaxInclusive is set, a person's embedded tax is backed out of their
+// Subtotal and shown as Tax, so Total = item share + service charge - discount.
+func allocateItemSplit(items []models.Item, charges BillCharges) map[string]PersonAllocation {
+	round := func(num float64) float64 {
+		return utils.RoundForCurrency(num, charges.Currency)
+	}
+
+	itemShares := make(map[string]float64)
+	unratedShares := make(map[string]float64)
+	ratedTax := make(map[string]float64)
+	hasUnrated := false
+	for _, item := range items {
+		shares := roundedItemShares(item, charges.Currency)
+		for i, consumer := range item.Consumers {
+			itemShares[consumer] += shares[i]
+			if item.TaxRate == nil {
+				unratedShares[consumer] += shares[i]
+			}
+		}
+
+		if item.TaxRate == nil {
+			hasUnrated = true
+			continue
+		}
+		itemTax := distributeCharge(round(item.RatedTax(charges.TaxInclusive)), splitItemAmount(item, 1), charges.Currency)
+		for i, consumer := range item.Consumers {
+			ratedTax[consumer] += itemTax[i]
+		}
+	}
+
+	people := make([]string, 0, len(itemShares))
+	for person := range itemShares {
+		people = append(people, person)
+	}
+	for _, person := range charges.SplitAmong {
+		if _, ok := itemShares[person]; !ok {
+			itemShares[person] = 0
+			people = append(people, person)
+		}
+	}
+	sort.Strings(people)
+
+	weights := shareWeights(people, itemShares)
+	taxWeights := weights
+	if hasUnrated {
+		taxWeights = shareWeights(people, unratedShares)
+	}
+	if len(charges.SplitAmong) > 0 {
+		// Only the chosen people share the charges, evenly
+		chosen := make(map[string]float64, len(charges.SplitAmong))
+		for _, person := range charges.SplitAmong {
+			chosen[person] = 1
+		}
+		weights = shareWeights(people, chosen)
+		if !charges.TaxInclusive {
+			taxWeights = weights
+		}
+	} else if charges.SplitEqually {
+		// No shares means equal weights
+		weights = shareWeights(people, nil)
+		taxWeights = weights
+	}
+
+	billTax := charges.Tax
+	var serviceTaxShares []float64
+	if charges.TaxOnServiceCharge && !charges.TaxInclusive {
+		// Tax is split between subtotal and service charge at the same rate
+		taxed := taxedSubtotal(items)
+		if taxed+charges.ServiceCharge > 0 {
+			serviceTax := round(billTax * charges.ServiceCharge / (taxed + charges.ServiceCharge))
+			serviceTaxShares = distributeCharge(serviceTax, weights, charges.Currency)
+			billTax -= serviceTax
+		}
+	}
+
+	taxShares := distributeCharge(billTax, taxWeights, charges.Currency)
+	for i := range serviceTaxShares {
+		taxShares[i] += serviceTaxShares[i]
+	}
+	serviceShares := distributeCharge(charges.ServiceCharge, weights, charges.Currency)
+	discountShares := distributeCharge(charges.Discount, weights, charges.Currency)
+
+	allocations := make(map[string]PersonAllocation, len(people))
+	for i, person := range people {
+		tax := round(taxShares[i] + ratedTax[person])
+		subtotal := itemShares[person]
+		if charges.TaxInclusive {
+			subtotal -= tax
+		}
+
+		allocations[person] = PersonAllocation{
+			Subtotal:      round(subtotal),
+			Tax:           tax,
+			ServiceCharge: serviceShares[i],
+			Discount:      discountShares[i],
+			Total:         round(subtotal + tax + serviceShares[i] - discountShares[i]),
+		}
+	}
+
+	return allocations
+}
+
+// taxedSubtotal adds up the item amounts that bear the bill-level tax: items without
+// their own TaxRate, or every item when all of them have one
+func taxedSubtotal(items []models.Item) float64 {
+	var unrated, all float64
+	hasUnrated := false
+	for _, item := range items {
+		all += item.Amount
+		if item.TaxRate == nil {
+			unrated += item.Amount
+			hasUnrated = true
+		}
+	}
+	if hasUnrated {
+		return unrated
+	}
+	return all
+}
+
+// serviceChargeTax returns the tax on a service charge when tax is charged on the
+// subtotal plus service charge. The rate is what tax bears to the taxed subtotal;
+// without a positive subtotal there is no rate and nothing is added.
+func serviceChargeTax(tax, serviceCharge, subtotal float64) float64 {
+	if subtotal <= 0 {
+		return 0
+	}
+	return tax * serviceCharge / subtotal
+}
+
+// shareWeights returns each person's fraction of the total shares, or equal
+// weights when the shares add up to zero
+func shareWeights(people []string, shares map[string]float64) []float64 {
+	var total float64
+	for _, person := range people {
+		total += shares[person]
+	}
+
+	weights := make([]float64, len(people))
+	for i, person := range people {
+		if total != 0 {
+			weights[i] = shares[person] / total
+		} else {
+			weights[i] = 1 / float64(len(people))
+		}
+	}
+	return weights
+}
+
+// expenseCharges returns the bill-level charges of a stored expense, with shares
+// rounded to the minor unit of the trip's currency
+func expenseCharges(expense *models.Expense, currency string) BillCharges {
+	return BillCharges{
+		Tax:           expense.Tax,
+		ServiceCharge: expense.ServiceCharge,
+		Discount:      expense.TotalDiscount,
+		TaxInclusive:  expense.TaxInclusive,
+		Currency:      currency,
+		SplitEqually:  expense.ExtrasSplitMode == models.ExtrasSplitEqual,
+		SplitAmong:    expense.ExtrasSplitAmong,
+
+		TaxOnServiceCharge: expense.TaxOnServiceCharge,
+	}
+}
+
+// distributeCharge splits a charge by the given weights into shares rounded to the
+// currency's minor unit that sum to the charge exactly. Each share starts at its
+// rounded-down exact value; the leftover units are handed out one at a time to the
+// largest fractional remainders, then the largest weights, then earliest position,
+// so the result never depends on map iteration order.
+func distributeCharge(charge float64, weights []float64, currency string) []float64 {
+	shares := make([]float64, len(weights))
+	if charge == 0 || len(weights) == 0 {
+		return shares
+	}
+
+	sign := 1.0
+	if charge < 0 {
+		sign, charge = -1, -charge
+	}
+
+	precision := math.Pow10(utils.CurrencyDecimals(currency))
+	totalUnits := int64(math.Round(charge * precision))
+
+	units := make([]int64, len(weights))
+	remainders := make([]float64, len(weights))
+	var allocated int64
+	for i, weight := range weights {
+		exact := float64(totalUnits) * weight
+		units[i] = int64(math.Floor(exact))
+		remainders[i] = exact - float64(units[i])
+		allocated += units[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		if remainders[i] != remainders[j] {
+			return remainders[i] > remainders[j]
+		}
+		return weights[i] > weights[j]
+	})
+
+	for k := 0; allocated < totalUnits; k++ {
+		units[order[k%len(order)]]++
+		allocated++
+	}
+
+	for i := range shares {
+		shares[i] = sign * float64(units[i]) / precision
+	}
+	return shares
+}
+
+// roundedItemShares splits an item's amount among its consumers into shares rounded
+// to the currency's minor unit that add up to the amount, as distributeCharge does.
+// Shares are parallel to item.Consumers.
+func roundedItemShares(item models.Item, currency string) []float64 {
+	return distributeCharge(utils.RoundForCurrency(item.Amount, currency), splitItemAmount(item, 1), currency)
+}
+
+// splitItemAmount divides an item amount among its consumers. Shares follow
+// ConsumerQuantities or ConsumerWeights when present and are equal otherwise. The
+// returned shares are unrounded and parallel to item.Consumers.
+func splitItemAmount(item models.Item, amount float64) []float64 {
+	shares := make([]float64, len(item.Consumers))
+	if len(item.Consumers) == 0 {
+		return shares
+	}
+
+	// Units each consumer had take precedence over relative weights
+	if len(item.ConsumerQuantities) > 0 {
+		var totalUnits float64
+		for _, consumer := range item.Consumers {
+			totalUnits += item.ConsumerQuantities[consumer]
+		}
+		if totalUnits > 0 {
+			for i, consumer := range item.Consumers {
+				shares[i] = amount * item.ConsumerQuantities[consumer] / totalUnits
+			}
+			return shares
+		}
+	}
+
+	if len(item.ConsumerWeights) == 0 {
+		for i := range shares {
+			shares[i] = amount / float64(len(item.Consumers))
+		}
+		return shares
+	}
+
+	weights := make([]float64, len(item.Consumers))
+	var totalWeight float64
+	for i, consumer := range item.Consumers {
+		weight, exists := item.ConsumerWeights[consumer]
+		if !exists {
+			weight = 1
+		}
+		weights[i] = weight
+		totalWeight += weight
+	}
+
+	for i, weight := range weights {
+		shares[i] = amount * weight / totalWeight
+	}
+	return shares
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllocateItemSplit_ChargesSumExactly(t *testing.T) {
+	items := []models.Item{
+		{Amount: 100, PaidBy: "alice", Consumers: []string{"alice", "bob", "carol"}},
+	}
+
+	allocations := allocateItemSplit(items, BillCharges{Tax: 10, ServiceCharge: 5, Discount: 1})
+
+	var tax, service, discount float64
+	for _, allocation := range allocations {
+		tax += allocation.Tax
+		service += allocation.ServiceCharge
+		discount += allocation.Discount
+	}
+	assert.Equal(t, float64(10), utils.Round(tax))
+	assert.Equal(t, float64(5), utils.Round(service))
+	assert.Equal(t, float64(1), utils.Round(discount))
+}
+
+func TestAllocateItemSplit_ZeroSubtotalSplitsChargesEqually(t *testing.T) {
+	items := []models.Item{
+		{Amount: 10, PaidBy: "alice", Consumers: []string{"alice"}},
+		{Amount: -10, PaidBy: "alice", Consumers: []string{"bob"}},
+	}
+
+	allocations := allocateItemSplit(items, BillCharges{ServiceCharge: 6})
+
+	assert.Equal(t, float64(3), allocations["alice"].ServiceCharge)
+	assert.Equal(t, float64(3), allocations["bob"].ServiceCharge)
+}
+
+// The same bill must produce identical per-person amounts wherever it is priced:
+// single bill calculation, settlement balances, export summaries and the matrix
+func TestAllocateItemSplit_CallSitesAgree(t *testing.T) {
+	for _, taxInclusive := range []bool{false, true} {
+		request := &models.CalculateSingleBillRequest{
+			Items: []models.Item{
+				{Description: "Platter", UnitPrice: 100, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice", "bob", "carol"}},
+				{Description: "Steak", UnitPrice: 25, Quantity: 2, PaidBy: "bob", Consumers: []string{"bob"}},
+				{Description: "Wine", UnitPrice: 40, Quantity: 1, ItemDiscount: 2.5, PaidBy: "alice", Consumers: []string{"carol", "alice"}, ConsumerWeights: map[string]float64{"carol": 2}},
+			},
+			Tax:           11.11,
+			ServiceCharge: 7.77,
+			TotalDiscount: 5.55,
+			TaxInclusive:  taxInclusive,
+		}
+
+		calculation, err := NewCalculationService().CalculateSingleBill(request)
+		assert.NoError(t, err)
+
+		// Store the same bill the way the expense service does
+		expense := &models.Expense{
+			SplitType:     utils.SplitTypeItems,
+			PaidBy:        "alice",
+			Tax:           request.Tax,
+			ServiceCharge: request.ServiceCharge,
+			TotalDiscount: request.TotalDiscount,
+			TaxInclusive:  taxInclusive,
+		}
+		for _, item := range request.Items {
+			item.Amount = utils.Round(item.UnitPrice*float64(item.Quantity) - item.ItemDiscount)
+			expense.Items = append(expense.Items, item)
+		}
+
+		ledger := (&SettlementService{}).calculateLedger([]*models.Expense{expense})
+
+		owed := make(map[string]float64)
+		for _, summary := range calculatePersonSummaries([]*models.Expense{expense}, "") {
+			owed[summary.Name] = summary.TotalOwed
+		}
+
+		row := &ExpenseMatrixRow{PersonAmounts: make(map[string]float64)}
+		(&ExcelService{}).calculateItemSplitMatrix(expense, row, "")
+
+		assert.Len(t, calculation.PerPersonCharges, 3)
+		for name, charge := range calculation.PerPersonCharges {
+			person := utils.NormalizeName(name)
+			assert.Equal(t, charge, utils.Round(ledger.consumed[person]), "ledger for %s (taxInclusive=%v)", name, taxInclusive)
+			assert.Equal(t, charge, utils.Round(owed[name]), "summary for %s (taxInclusive=%v)", name, taxInclusive)
+			assert.Equal(t, charge, row.PersonAmounts[name], "matrix for %s (taxInclusive=%v)", name, taxInclusive)
+		}
+	}
+}
+
+func TestDistributeCharge_LeftoverFollowsRemainders(t *testing.T) {
+	// 0.05 over three equal consumers is 1.67 cents each: two people get the extra cent
+	assert.Equal(t, []float64{0.02, 0.02, 0.01}, distributeCharge(0.05, []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}, ""))
+
+	// One cent goes to the largest consumer, not whoever sorts last
+	assert.Equal(t, []float64{0, 0.01, 0}, distributeCharge(0.01, []float64{0.3, 0.4, 0.3}, ""))
+
+	// Whole-unit currencies hand out whole units
+	assert.Equal(t, []float64{34, 33, 33}, distributeCharge(100, []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}, "IDR"))
+}
+
+func TestAllocateItemSplit_ItemTaxRates(t *testing.T) {
+	alcoholRate, exemptRate := 20.0, 0.0
+	items := []models.Item{
+		{Description: "Beer", UnitPrice: 50, Quantity: 1, PaidBy: "alice", Consumers: []string{"bob"}, TaxRate: &alcoholRate},
+		{Description: "Food", UnitPrice: 100, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+		{Description: "Water", UnitPrice: 10, Quantity: 1, PaidBy: "alice", Consumers: []string{"carol"}, TaxRate: &exemptRate},
+	}
+
+	// The bill-level tax only falls on the food; beer is taxed at its own rate and water not at all
+	calculation, err := NewCalculationService().CalculateSingleBill(&models.CalculateSingleBillRequest{
+		Items: items,
+		Tax:   10,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 180.0, calculation.Amount)
+	assert.Equal(t, 20.0, calculation.Tax)
+	assert.Equal(t, map[string]float64{"Alice": 55, "Bob": 115, "Carol": 10}, calculation.PerPersonCharges)
+	assert.Equal(t, 15.0, calculation.PerPersonBreakdown["Bob"].Tax)
+
+	// Stored expenses carry the item tax in their amount and settle the same way
+	expense, err := (&ExpenseService{}).CreateItemsExpense(&models.AddItemsExpenseRequest{
+		Code:        "ABC123",
+		Description: "Dinner",
+		Tax:         10,
+		Items:       items,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 180.0, expense.Amount)
+
+	balances := (&SettlementService{}).calculateLedger([]*models.Expense{expense}).balances()
+	assert.Equal(t, 125.0, balances["alice"])
+	assert.Equal(t, -115.0, balances["bob"])
+	assert.Equal(t, -10.0, balances["carol"])
+}
+
+func TestAllocateItemSplit_ConsumerQuantities(t *testing.T) {
+	items := []models.Item{
+		{
+			Description:        "Coffee",
+			UnitPrice:          30,
+			Quantity:           3,
+			Amount:             90,
+			Consumers:          []string{"alice", "bob"},
+			ConsumerQuantities: map[string]float64{"alice": 2, "bob": 1},
+		},
+	}
+
+	allocations := allocateItemSplit(items, BillCharges{ServiceCharge: 9})
+
+	assert.Equal(t, float64(60), allocations["alice"].Subtotal)
+	assert.Equal(t, float64(66), allocations["alice"].Total)
+	assert.Equal(t, float64(30), allocations["bob"].Subtotal)
+	assert.Equal(t, float64(33), allocations["bob"].Total)
+}
+
+func TestAllocateItemSplit_FractionalConsumerQuantities(t *testing.T) {
+	items := []models.Item{
+		{
+			Description:        "Cheese",
+			UnitPrice:          200,
+			Quantity:           0.5,
+			Amount:             100,
+			Consumers:          []string{"alice", "bob"},
+			ConsumerQuantities: map[string]float64{"alice": 0.3, "bob": 0.2},
+		},
+	}
+
+	assert.NoError(t, utils.ValidateConsumerQuantities(items[0].ConsumerQuantities, items[0].Consumers, items[0].Quantity))
+
+	allocations := allocateItemSplit(items, BillCharges{})
+
+	assert.InDelta(t, 60, allocations["alice"].Subtotal, 0.001)
+	assert.InDelta(t, 40, allocations["bob"].Subtotal, 0.001)
+}
+
+func TestAllocateItemSplit_TaxOnServiceChargeFollowsServiceShares(t *testing.T) {
+	rate := 20.0
+	items := []models.Item{
+		{Amount: 50, PaidBy: "alice", Consumers: []string{"alice"}, TaxRate: &rate},
+		{Amount: 50, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+	}
+
+	// Tax 6 is 5 on the 50 of unrated items plus 1 on the service charge of 10
+	allocations := allocateItemSplit(items, BillCharges{Tax: 6, ServiceCharge: 10, TaxOnServiceCharge: true})
+
+	// The subtotal tax follows the unrated items, the service tax follows the service charge
+	assert.Equal(t, 13.25, allocations["alice"].Tax) // 2.50 + 0.75 + 10 item tax
+	assert.Equal(t, 2.75, allocations["bob"].Tax)    // 2.50 + 0.25
+	assert.Equal(t, 7.5, allocations["alice"].ServiceCharge)
+	assert.Equal(t, 2.5, allocations["bob"].ServiceCharge)
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// attachmentsDirName is the subdirectory of an expense's uploads directory holding its attachments.
+// Receipt image retention leaves these directories alone.
+const attachmentsDirName = "attachments"
+
+// attachmentContentTypes maps accepted attachment extensions to their content type
+var attachmentContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".pdf":  "application/pdf",
+	".txt":  "text/plain; charset=utf-8",
+}
+
+// AttachmentService manages files attached to expenses besides their receipt image
+type AttachmentService struct {
+	repo *repository.AttachmentRepository
+}
+
+// NewAttachmentService creates a new attachment service
+func NewAttachmentService(repo *repository.AttachmentRepository) *AttachmentService {
+	return &AttachmentService{
+		repo: repo,
+	}
+}
+
+// IsSupportedAttachmentExtension reports whether files with the given lowercase extension can be attached
+func IsSupportedAttachmentExtension(ext string) bool {
+	_, ok := attachmentContentTypes[ext]
+	return ok
+}
+
+// AddAttachment writes an uploaded file under the expense's uploads directory and records it
+func (s *AttachmentService) AddAttachment(tripID, expenseID, fileName string, content io.Reader) (*models.ExpenseAttachment, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	contentType, ok := attachmentContentTypes[ext]
+	if !ok {
+		return nil, utils.NewValidationError("Only JPG, JPEG, PNG, HEIC, PDF, and TXT files can be attached")
+	}
+
+	if err := s.checkExpenseTrip(tripID, expenseID); err != nil {
+		return nil, err
+	}
+
+	attachment := &models.ExpenseAttachment{
+		ID:          utils.GenerateID(),
+		ExpenseID:   expenseID,
+		FileName:    filepath.Base(fileName),
+		ContentType: contentType,
+	}
+	relativePath := filepath.Join(tripID, expenseID, attachmentsDirName, attachment.ID+ext)
+	attachment.Path = filepath.ToSlash(relativePath)
+
+	size, err := writeAttachmentFile(filepath.Join(ReceiptUploadsDir, relativePath), content)
+	if err != nil {
+		slog.Error("Failed to store attachment", "operation", "add_attachment", "expenseId", expenseID, "error", err)
+		return nil, utils.NewInternalError("Failed to store attachment")
+	}
+	attachment.Size = size
+
+	if err := s.repo.CreateAttachment(attachment); err != nil {
+		os.Remove(filepath.Join(ReceiptUploadsDir, relativePath))
+		return nil, utils.NewInternalError("Failed to save attachment")
+	}
+	return attachment, nil
+}
+
+// ListAttachments returns the attachments of an expense, oldest first
+func (s *AttachmentService) ListAttachments(tripID, expenseID string) ([]models.ExpenseAttachment, error) {
+	if err := s.checkExpenseTrip(tripID, expenseID); err != nil {
+		return nil, err
+	}
+
+	attachments, err := s.repo.GetAttachments(expenseID)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to list attachments")
+	}
+	return attachments, nil
+}
+
+// GetAttachmentFile returns an attachment record together with the path of its stored file
+func (s *AttachmentService) GetAttachmentFile(tripID, expenseID, attachmentID string) (*models.ExpenseAttachment, string, error) {
+	if err := s.checkExpenseTrip(tripID, expenseID); err != nil {
+		return nil, "", err
+	}
+
+	attachment, err := s.repo.GetAttachment(expenseID, attachmentID)
+	if err != nil {
+		return nil, "", utils.NewInternalError("Failed to get attachment")
+	}
+	if attachment == nil {
+		return nil, "", utils.NewNotFoundError("Attachment")
+	}
+
+	filePath, ok := resolveReceiptImagePath(attachment.Path)
+	if !ok {
+		return nil, "", utils.NewNotFoundError("Attachment")
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		return nil, "", utils.NewNotFoundError("Attachment")
+	}
+	return attachment, filePath, nil
+}
+
+// checkExpenseTrip reports a missing expense unless it belongs to the given trip, so
+// attachments can't be reached with an expense ID alone
+func (s *AttachmentService) checkExpenseTrip(tripID, expenseID string) error {
+	expenseTripID, err := s.repo.GetExpenseTripID(expenseID)
+	if err != nil {
+		return utils.NewInternalError("Failed to get expense")
+	}
+	if expenseTripID == "" || expenseTripID != tripID {
+		return utils.NewNotFoundError("Expense")
+	}
+	return nil
+}
+
+// RemoveExpenseAttachments deletes the stored attachment files of an expense
+func RemoveExpenseAttachments(tripID, expenseID string) error {
+	for _, id := range []string{tripID, expenseID} {
+		if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+			return fmt.Errorf("invalid ID %q", id)
+		}
+	}
+
+	expenseDir := filepath.Join(ReceiptUploadsDir, tripID, expenseID)
+	if err := os.RemoveAll(filepath.Join(expenseDir, attachmentsDirName)); err != nil {
+		return err
+	}
+	os.Remove(expenseDir) // Only succeeds once the expense directory is empty
+	return nil
+}
+
+// writeAttachmentFile copies content to path, creating its directory, and returns the bytes written
+func writeAttachmentFile(path string, content io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create attachment directory: %v", err)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(out, content)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockAttachmentService(t *testing.T) (*AttachmentService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return NewAttachmentService(repository.NewAttachmentRepository(db)), mock
+}
+
+// inTempDir runs the rest of the test with a temporary working directory
+func inTempDir(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestAttachmentService_AddAttachment(t *testing.T) {
+	dir := inTempDir(t)
+	service, mock := newMockAttachmentService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT trip_id FROM expenses WHERE id = $1")).WithArgs("exp1").
+		WillReturnRows(sqlmock.NewRows([]string{"trip_id"}).AddRow("trip1"))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO expense_attachments")).
+		WithArgs(sqlmock.AnyArg(), "exp1", "note.TXT", "text/plain; charset=utf-8", int64(5), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+
+	attachment, err := service.AddAttachment("trip1", "exp1", "note.TXT", strings.NewReader("hello"))
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "note.TXT", attachment.FileName)
+	assert.Equal(t, "trip1/exp1/attachments/"+attachment.ID+".txt", attachment.Path)
+
+	content, err := os.ReadFile(filepath.Join(dir, ReceiptUploadsDir, filepath.FromSlash(attachment.Path)))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	assert.NoError(t, RemoveExpenseAttachments("trip1", "exp1"))
+	assert.NoDirExists(t, filepath.Join(dir, ReceiptUploadsDir, "trip1", "exp1"))
+}
+
+func TestAttachmentService_AddAttachment_RejectsUnsupportedType(t *testing.T) {
+	service, mock := newMockAttachmentService(t)
+
+	_, err := service.AddAttachment("trip1", "exp1", "script.sh", strings.NewReader("#!/bin/sh"))
+
+	assert.Equal(t, utils.NewValidationError("Only JPG, JPEG, PNG, HEIC, PDF, and TXT files can be attached"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAttachmentService_AddAttachment_UnknownExpense(t *testing.T) {
+	service, mock := newMockAttachmentService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT trip_id FROM expenses WHERE id = $1")).WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"trip_id"}))
+
+	_, err := service.AddAttachment("trip1", "missing", "photo.jpg", strings.NewReader("image"))
+
+	assert.Equal(t, utils.NewNotFoundError("Expense"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAttachmentService_GetAttachmentFile_UnknownAttachment(t *testing.T) {
+	service, mock := newMockAttachmentService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT trip_id FROM expenses WHERE id = $1")).WithArgs("exp1").
+		WillReturnRows(sqlmock.NewRows([]string{"trip_id"}).AddRow("trip1"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expense_attachments")).WithArgs("att1", "exp1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "expense_id", "file_name", "content_type", "size", "path", "created_at"}))
+
+	_, _, err := service.GetAttachmentFile("trip1", "exp1", "att1")
+
+	assert.Equal(t, utils.NewNotFoundError("Attachment"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAttachmentService_GetAttachmentFile_OtherTrip(t *testing.T) {
+	service, mock := newMockAttachmentService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT trip_id FROM expenses WHERE id = $1")).WithArgs("exp1").
+		WillReturnRows(sqlmock.NewRows([]string{"trip_id"}).AddRow("trip1"))
+
+	_, _, err := service.GetAttachmentFile("trip2", "exp1", "att1")
+
+	assert.Equal(t, utils.NewNotFoundError("Expense"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRemoveExpenseAttachments_RejectsPathSegments(t *testing.T) {
+	assert.Error(t, RemoveExpenseAttachments("trip1", ".."))
+	assert.Error(t, RemoveExpenseAttachments("../trip1", "exp1"))
+}
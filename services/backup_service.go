@@ -0,0 +1,263 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// Limits on what a single backup may hold, so an import can't flood the database
+const (
+	MaxBackupExpenses = 5000
+	MaxBackupPayments = 5000
+	MaxBackupItems    = 500 // Per expense
+)
+
+// BackupService exports trips as self-contained JSON documents and imports them
+// back as new trips
+type BackupService struct {
+	trips    *TripService
+	expenses *ExpenseService
+	payments *PaymentService
+}
+
+// NewBackupService creates a new backup service
+func NewBackupService(trips *TripService, expenses *ExpenseService, payments *PaymentService) *BackupService {
+	return &BackupService{
+		trips:    trips,
+		expenses: expenses,
+		payments: payments,
+	}
+}
+
+// ExportTrip collects a trip's settings, participants, expenses and payments into a
+// backup. Names are kept in their stored form so an import restores them exactly.
+func (s *BackupService) ExportTrip(trip *models.Trip) (*models.TripBackup, error) {
+	expenses, err := s.expenses.repo.GetExpenses(trip.ID, repository.ExpenseListOptions{})
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve expenses")
+	}
+	payments, err := s.payments.paymentRepo.GetPaymentsByTripID(trip.ID)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve payments")
+	}
+
+	for _, expense := range expenses {
+		expense.TripID = ""
+		expense.ReceiptImage = ""
+		expense.IdempotencyKey = ""
+	}
+	for i := range payments {
+		payments[i].ID = 0
+		payments[i].TripID = ""
+	}
+
+	// The trip's names may be formatted with its aliases, so map them back with Key
+	aliases := utils.NameAliases(trip.Aliases)
+	return &models.TripBackup{
+		Version:    models.TripBackupVersion,
+		ExportedAt: time.Now().UTC(),
+		Trip: models.BackupTrip{
+			Name:             trip.Name,
+			Currency:         trip.Currency,
+			Owner:            trip.Owner,
+			Participants:     aliases.Keys(trip.Participants),
+			Guests:           aliases.Keys(trip.Guests),
+			DefaultConsumers: aliases.Keys(trip.DefaultConsumers),
+			Aliases:          trip.Aliases,
+		},
+		Expenses: expenses,
+		Payments: payments,
+	}, nil
+}
+
+// ImportTrip recreates a backed-up trip under a new code, with fresh expense and
+// payment IDs but the original amounts, splits and dates. The backup is validated
+// first; if storing any part of it fails, the partly imported trip is removed.
+func (s *BackupService) ImportTrip(backup *models.TripBackup) (*models.Trip, error) {
+	if err := validateBackup(backup); err != nil {
+		return nil, err
+	}
+
+	code, err := s.trips.uniqueTripCode()
+	if err != nil {
+		return nil, err
+	}
+
+	participants := utils.NormalizeNames(backup.Trip.Participants)
+	trip := models.NewTrip(utils.GenerateID(), code, strings.TrimSpace(backup.Trip.Name), participants[0], utils.NormalizeCurrency(backup.Trip.Currency))
+	trip.Participants = participants
+	trip.Owner = strings.TrimSpace(backup.Trip.Owner)
+	if err := s.trips.repo.StoreTrip(trip); err != nil {
+		return nil, utils.NewInternalError("Failed to create trip")
+	}
+
+	if err := s.importTripData(trip, backup); err != nil {
+		if _, deleteErr := s.trips.repo.DeleteTrip(trip.ID); deleteErr != nil {
+			slog.Error("Failed to remove partly imported trip", "operation", "import_trip", "tripCode", trip.Code, "error", deleteErr)
+		}
+		return nil, err
+	}
+
+	return s.trips.GetTripByCode(trip.Code)
+}
+
+// importTripData stores the backup's participant settings, expenses and payments in
+// a newly created trip
+func (s *BackupService) importTripData(trip *models.Trip, backup *models.TripBackup) error {
+	for _, guest := range utils.NormalizeNames(backup.Trip.Guests) {
+		if _, err := s.trips.repo.SetParticipantGuest(trip.ID, guest, true); err != nil {
+			return utils.NewInternalError("Failed to update participant")
+		}
+	}
+	if len(backup.Trip.DefaultConsumers) > 0 {
+		if err := s.trips.repo.SetDefaultConsumers(trip.ID, utils.NormalizeNames(backup.Trip.DefaultConsumers)); err != nil {
+			return utils.NewInternalError("Failed to update default consumers")
+		}
+	}
+
+	if len(backup.Trip.Aliases) > 0 {
+		if err := s.trips.repo.SetAliases(trip.ID, utils.NormalizeNameMapKeys(backup.Trip.Aliases)); err != nil {
+			return utils.NewInternalError("Failed to update display names")
+		}
+	}
+
+	expenses := make([]*models.Expense, len(backup.Expenses))
+	for i, source := range backup.Expenses {
+		expense := cloneExpense(source)
+		expense.ID = utils.GenerateID()
+		expense.TripID = trip.ID
+		expense.ReceiptImage = ""
+		expense.IdempotencyKey = ""
+		expense.NameKeys = nil
+		expense.Reconciled = nil
+		if expense.CreationTime == 0 {
+			expense.CreationTime = time.Now().UnixMilli()
+		}
+		expenses[i] = expense
+	}
+	if err := s.expenses.repo.BulkStoreExpenses(trip.ID, nil, expenses, 0); err != nil {
+		return utils.NewInternalError("Failed to import expenses")
+	}
+
+	payments := make([]*models.Payment, len(backup.Payments))
+	for i := range backup.Payments {
+		payment := backup.Payments[i]
+		payment.ID = 0
+		payment.TripID = trip.ID
+		if payment.PaymentDate.IsZero() {
+			payment.PaymentDate = time.Now()
+		}
+		payments[i] = &payment
+	}
+	if err := s.payments.paymentRepo.CreatePayments(trip.ID, nil, payments, 0); err != nil {
+		return utils.NewInternalError("Failed to import payments")
+	}
+
+	return nil
+}
+
+// validateBackup checks a backup's version and structure, and that every name it
+// mentions is one of its participants
+func validateBackup(backup *models.TripBackup) error {
+	if backup.Version != models.TripBackupVersion {
+		return utils.NewValidationError(fmt.Sprintf("Unsupported backup version %d, expected %d", backup.Version, models.TripBackupVersion))
+	}
+	if err := utils.ValidateRequired(backup.Trip.Name, "trip name"); err != nil {
+		return err
+	}
+	if len(backup.Trip.Participants) == 0 {
+		return utils.NewValidationError("Backup must list at least one participant")
+	}
+	if limit := maxParticipants(); len(backup.Trip.Participants) > limit {
+		return tooManyParticipantsError(limit)
+	}
+	if len(backup.Expenses) > MaxBackupExpenses {
+		return utils.NewValidationError(fmt.Sprintf("Backup holds more than %d expenses", MaxBackupExpenses))
+	}
+	if len(backup.Payments) > MaxBackupPayments {
+		return utils.NewValidationError(fmt.Sprintf("Backup holds more than %d payments", MaxBackupPayments))
+	}
+
+	known := make(map[string]bool, len(backup.Trip.Participants))
+	for _, participant := range backup.Trip.Participants {
+		if strings.TrimSpace(participant) == "" {
+			return utils.NewValidationError("Participant names must not be empty")
+		}
+		known[utils.NormalizeName(participant)] = true
+	}
+	checkNames := func(where string, names ...string) error {
+		for _, name := range names {
+			if name != "" && !known[name] {
+				return utils.NewValidationError(fmt.Sprintf("%s names %s, who is not a participant", where, utils.FormatNameForDisplay(name)))
+			}
+		}
+		return nil
+	}
+
+	if err := checkNames("Guest list", utils.NormalizeNames(backup.Trip.Guests)...); err != nil {
+		return err
+	}
+	if err := checkNames("Default consumers", utils.NormalizeNames(backup.Trip.DefaultConsumers)...); err != nil {
+		return err
+	}
+	for participant, displayName := range backup.Trip.Aliases {
+		if err := checkNames("Aliases", utils.NormalizeName(participant)); err != nil {
+			return err
+		}
+		if strings.TrimSpace(displayName) == "" {
+			return utils.NewValidationError("Display names must not be empty")
+		}
+	}
+	if err := validateAliases(known, utils.NormalizeNameMapKeys(backup.Trip.Aliases)); err != nil {
+		return err
+	}
+
+	for i, expense := range backup.Expenses {
+		where := fmt.Sprintf("Expense %d", i+1)
+		if expense == nil {
+			return utils.NewValidationError(where + " is empty")
+		}
+		if expense.SplitType != "equal" && expense.SplitType != "items" {
+			return utils.NewValidationError(fmt.Sprintf("%s has unknown split type %q", where, expense.SplitType))
+		}
+		if expense.Amount < 0 {
+			return utils.NewValidationError(where + " has a negative amount")
+		}
+		if expense.SplitType == "equal" && len(expense.SplitAmong) == 0 {
+			return utils.NewValidationError(where + " is split among nobody")
+		}
+		if expense.SplitType == "items" && len(expense.Items) == 0 {
+			return utils.NewValidationError(where + " has no items")
+		}
+		if len(expense.Items) > MaxBackupItems {
+			return utils.NewValidationError(fmt.Sprintf("%s has more than %d items", where, MaxBackupItems))
+		}
+		if expense.Status != "" && expense.Status != models.ExpenseStatusPending && expense.Status != models.ExpenseStatusConfirmed {
+			return utils.NewValidationError(fmt.Sprintf("%s has unknown status %q", where, expense.Status))
+		}
+		if err := checkNames(where, expenseNames(expense)...); err != nil {
+			return err
+		}
+	}
+
+	for i, payment := range backup.Payments {
+		where := fmt.Sprintf("Payment %d", i+1)
+		if payment.Amount <= 0 {
+			return utils.NewValidationError(where + " must have a positive amount")
+		}
+		if payment.FromPerson == "" || payment.ToPerson == "" {
+			return utils.NewValidationError(where + " must name who paid and who was paid")
+		}
+		if err := checkNames(where, payment.FromPerson, payment.ToPerson); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
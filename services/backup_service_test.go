@@ -0,0 +1,87 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// sampleBackup is a valid backup of a two-person trip with one expense and payment
+func sampleBackup() *models.TripBackup {
+	return &models.TripBackup{
+		Version: models.TripBackupVersion,
+		Trip:    models.BackupTrip{Name: "Bali", Currency: "IDR", Participants: []string{"alice", "bob"}},
+		Expenses: []*models.Expense{{
+			ID: "old1", Description: "Dinner", Amount: 100, Subtotal: 100, PaidBy: "alice",
+			SplitType: "equal", SplitAmong: []string{"alice", "bob"}, CreationTime: 1700000000000,
+		}},
+		Payments: []models.Payment{{FromPerson: "bob", ToPerson: "alice", Amount: 50}},
+	}
+}
+
+func TestValidateBackup(t *testing.T) {
+	assert.NoError(t, validateBackup(sampleBackup()))
+
+	wrongVersion := sampleBackup()
+	wrongVersion.Version = 2
+	err := validateBackup(wrongVersion)
+	var appErr *utils.AppError
+	assert.True(t, errors.As(err, &appErr))
+	assert.Equal(t, "Unsupported backup version 2, expected 1", appErr.Message)
+
+	unknownConsumer := sampleBackup()
+	unknownConsumer.Expenses[0].SplitAmong = []string{"alice", "carol"}
+	assert.EqualError(t, validateBackup(unknownConsumer), "Expense 1 names Carol, who is not a participant")
+
+	badPayment := sampleBackup()
+	badPayment.Payments[0].Amount = 0
+	assert.EqualError(t, validateBackup(badPayment), "Payment 1 must have a positive amount")
+
+	nickname := sampleBackup()
+	nickname.Trip.Aliases = map[string]string{"alice": "Ally"}
+	assert.NoError(t, validateBackup(nickname))
+
+	renamed := sampleBackup()
+	renamed.Trip.Aliases = map[string]string{"alice": "Bob"}
+	assert.EqualError(t, validateBackup(renamed), `Display name "Bob" is already the name of another participant`)
+}
+
+func TestBackupService_ImportTrip_RemovesTripWhenExpensesFail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	trips := &TripService{repo: &repository.TripRepository{DB: db}, generateCode: stubCodes("NEW123")}
+	expenses := &ExpenseService{repo: &repository.ExpenseRepository{DB: db}}
+	payments := NewPaymentService(repository.NewPaymentRepository(db), trips.repo)
+	service := NewBackupService(trips, expenses, payments)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM trips WHERE code = $1)")).WithArgs("NEW123").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO trips")).
+		WithArgs(sqlmock.AnyArg(), "NEW123", "Bali", sqlmock.AnyArg(), "IDR", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO trip_participants")).WithArgs(sqlmock.AnyArg(), "alice").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO trip_participants")).WithArgs(sqlmock.AnyArg(), "bob").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expenses")).WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM trips WHERE id = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	trip, err := service.ImportTrip(sampleBackup())
+
+	assert.Nil(t, trip)
+	assert.EqualError(t, err, "Failed to import expenses")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// balanceLedger tracks, per person, what they paid for and what they consumed
+// across expenses, plus payments sent and received between people. People are keyed
+// by normalized name, so display-formatted expenses and stored payments line up.
+type balanceLedger struct {
+	paid     map[string]float64
+	consumed map[string]float64
+	sent     map[string]float64
+	received map[string]float64
+
+	currency  string            // Balances and details are rounded to this currency
+	remainder string            // Equal-split remainder policy, see EqualSplitRemainderRoundRobin
+	aliases   utils.NameAliases // Display names preferred by the trip
+}
+
+// newBalanceLedger creates an empty ledger
+func newBalanceLedger() *balanceLedger {
+	return &balanceLedger{
+		paid:     make(map[string]float64),
+		consumed: make(map[string]float64),
+		sent:     make(map[string]float64),
+		received: make(map[string]float64),
+	}
+}
+
+// credit records that a person paid an amount on behalf of the group
+func (l *balanceLedger) credit(person string, amount float64) {
+	l.paid[utils.NormalizeName(person)] += amount
+}
+
+// debit records that a person consumed an amount
+func (l *balanceLedger) debit(person string, amount float64) {
+	l.consumed[utils.NormalizeName(person)] += amount
+}
+
+// recordPayment records a payment from one person to another
+func (l *balanceLedger) recordPayment(from, to string, amount float64) {
+	l.sent[utils.NormalizeName(from)] += amount
+	l.received[utils.NormalizeName(to)] += amount
+}
+
+// people returns everyone who appears anywhere in the ledger
+func (l *balanceLedger) people() map[string]bool {
+	people := make(map[string]bool)
+	for _, m := range []map[string]float64{l.paid, l.consumed, l.sent, l.received} {
+		for person := range m {
+			people[person] = true
+		}
+	}
+	return people
+}
+
+// balances returns each person's rounded expense balance (paid - consumed),
+// not including payments
+func (l *balanceLedger) balances() map[string]float64 {
+	balances := make(map[string]float64)
+	for person := range l.paid {
+		balances[person] = 0
+	}
+	for person := range l.consumed {
+		balances[person] = 0
+	}
+
+	for person := range balances {
+		balances[person] = l.round(l.paid[person] - l.consumed[person])
+	}
+	return balances
+}
+
+// details returns the per-person breakdown, using the given final balances as net
+func (l *balanceLedger) details(netBalances map[string]float64) map[string]models.PersonSettlementDetail {
+	details := make(map[string]models.PersonSettlementDetail)
+	for person := range l.people() {
+		details[person] = models.PersonSettlementDetail{
+			TotalPaid:        l.round(l.paid[person]),
+			TotalConsumed:    l.round(l.consumed[person]),
+			PaymentsSent:     l.round(l.sent[person]),
+			PaymentsReceived: l.round(l.received[person]),
+			NetBalance:       l.round(netBalances[person]),
+		}
+	}
+	return details
+}
+
+// personBalances returns each person's balance components, ordered by name.
+// Net includes payments: paid - consumed + sent - received.
+func (l *balanceLedger) personBalances() []models.PersonBalance {
+	var people []string
+	for person := range l.people() {
+		people = append(people, person)
+	}
+	sort.Strings(people)
+
+	balances := make([]models.PersonBalance, len(people))
+	for i, person := range people {
+		balances[i] = models.PersonBalance{
+			Name:             l.aliases.Format(person),
+			AmountPaid:       l.round(l.paid[person]),
+			AmountOwed:       l.round(l.consumed[person]),
+			PaymentsSent:     l.round(l.sent[person]),
+			PaymentsReceived: l.round(l.received[person]),
+			Net:              l.round(l.paid[person] - l.consumed[person] + l.sent[person] - l.received[person]),
+		}
+	}
+	return balances
+}
+
+// round rounds an amount to the ledger's currency
+func (l *balanceLedger) round(amount float64) float64 {
+	return utils.RoundForCurrency(amount, l.currency)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/fadhlanhapp/sharetab-backend/models"
 	"github.com/fadhlanhapp/sharetab-backend/utils"
@@ -22,38 +23,95 @@ func (s *CalculationService) CalculateSingleBill(request *models.CalculateSingle
 		return nil, err
 	}
 
+	// Problems that still leave something to calculate are warnings, unless strict
+	warnings := s.calculationWarnings(request)
+	if request.Strict && len(warnings) > 0 {
+		return nil, utils.NewValidationError(strings.Join(warnings, "; "))
+	}
+
 	// Normalize names in items
 	normalizedItems := s.normalizeItemNames(request.Items)
 	
 	// Extract participants
 	participants := s.extractParticipants(normalizedItems)
 
+	// Items nobody consumed can't be split; they still count towards the bill total
+	splitItems := make([]models.Item, 0, len(normalizedItems))
+	for _, item := range normalizedItems {
+		if len(item.Consumers) > 0 {
+			splitItems = append(splitItems, item)
+		}
+	}
+
+	// Amounts are rounded to the currency's minor unit; unknown currencies use two decimals
+	currency := utils.NormalizeCurrency(request.Currency)
+	round := func(num float64) float64 {
+		return utils.RoundForCurrency(num, currency)
+	}
+
+	// Tip is a percentage of the subtotal, distributed like the service charge
+	subtotal := s.calculateSubtotal(normalizedItems)
+	tip := round(request.TipPercent / 100 * subtotal)
+
+	// Tax charged on the service charge (tip included) adds to the bill-level tax
+	tax := request.Tax
+	if request.TaxOnServiceCharge {
+		priced := make([]models.Item, len(normalizedItems))
+		for i, item := range normalizedItems {
+			item.Amount = round(item.UnitPrice*item.Quantity - item.ItemDiscount)
+			priced[i] = item
+		}
+		tax = round(tax + serviceChargeTax(tax, request.ServiceCharge+tip, taxedSubtotal(priced)))
+	}
+
 	// Calculate personal charges
 	perPersonCharges, perPersonBreakdown := s.calculatePersonalCharges(
-		normalizedItems,
-		request.Tax,
-		request.ServiceCharge,
+		splitItems,
+		tax,
+		request.ServiceCharge+tip,
 		request.TotalDiscount,
 		participants,
+		request.TaxInclusive,
+		request.ExtrasSplitMode == models.ExtrasSplitEqual,
+		request.TaxOnServiceCharge,
+		currency,
 	)
 
-	// Calculate totals
-	subtotal := s.calculateSubtotal(normalizedItems)
-	total := subtotal + request.Tax + request.ServiceCharge - request.TotalDiscount
+	// Items with their own tax rate are taxed directly on top of the bill-level tax
+	var itemTax float64
+	for _, item := range normalizedItems {
+		item.Amount = round(item.UnitPrice*item.Quantity - item.ItemDiscount)
+		itemTax += round(item.RatedTax(request.TaxInclusive))
+	}
+
+	// Calculate totals; tax-inclusive prices already contain the tax
+	total := subtotal + request.ServiceCharge + tip - request.TotalDiscount
+	if !request.TaxInclusive {
+		total += tax + itemTax
+	}
 
 	// Format names for display
 	formattedCharges := utils.FormatNameMapKeys(perPersonCharges)
 	formattedBreakdown := utils.FormatNameMapKeys(perPersonBreakdown)
 
-	return &models.SingleBillCalculation{
-		Amount:             utils.Round(total),
-		Subtotal:           utils.Round(subtotal),
-		Tax:                utils.Round(request.Tax),
-		ServiceCharge:      utils.Round(request.ServiceCharge),
-		TotalDiscount:      utils.Round(request.TotalDiscount),
+	result := &models.SingleBillCalculation{
+		Amount:             round(total),
+		Subtotal:           round(subtotal),
+		Tax:                round(tax + itemTax),
+		ServiceCharge:      round(request.ServiceCharge),
+		TotalDiscount:      round(request.TotalDiscount),
+		Tip:                tip,
+		TaxInclusive:       request.TaxInclusive,
+		Currency:           currency,
 		PerPersonCharges:   formattedCharges,
 		PerPersonBreakdown: formattedBreakdown,
-	}, nil
+		Warnings:           warnings,
+	}
+	if request.FormatCurrency {
+		result.FormattedAmount = utils.FormatCurrency(result.Amount, currency)
+		result.FormattedPerPersonCharges = utils.FormatCurrencyMap(result.PerPersonCharges, currency)
+	}
+	return result, nil
 }
 
 // validateCalculationRequest validates the calculation request
@@ -70,6 +128,12 @@ func (s *CalculationService) validateCalculationRequest(request *models.Calculat
 	if err := utils.ValidateNonNegative(request.TotalDiscount, "discount"); err != nil {
 		return err
 	}
+	if request.TipPercent < 0 || request.TipPercent > 100 {
+		return utils.NewValidationError("tip percent must be between 0 and 100")
+	}
+	if err := utils.ValidateTaxOnServiceCharge(request.TaxOnServiceCharge, request.TaxInclusive); err != nil {
+		return err
+	}
 
 	// Validate each item
 	for i, item := range request.Items {
@@ -79,17 +143,53 @@ func (s *CalculationService) validateCalculationRequest(request *models.Calculat
 		if err := utils.ValidateRequired(item.PaidBy, "item paidBy"); err != nil {
 			return utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
 		}
-		if err := utils.ValidateNotEmpty(item.Consumers, "item consumers"); err != nil {
+		if err := utils.ValidateParticipantNames(item.Consumers); err != nil {
 			return utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
 		}
-		if err := utils.ValidateParticipantNames(item.Consumers); err != nil {
+		if err := utils.ValidateConsumerWeights(item.ConsumerWeights, item.Consumers); err != nil {
+			return utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
+		}
+		if err := utils.ValidateConsumerQuantities(item.ConsumerQuantities, item.Consumers, item.Quantity); err != nil {
+			return utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
+		}
+		if err := utils.ValidateTaxRate(item.TaxRate); err != nil {
 			return utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
 		}
+		if err := utils.ValidateItemDiscount(item.ItemDiscount, item.UnitPrice, item.Quantity); err != nil {
+			return utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
+		}
+	}
+
+	// Negative lines (refunds, coupons) are allowed as long as the bill stays positive
+	subtotal := s.calculateSubtotal(request.Items)
+	if err := utils.ValidateItemsSubtotal(subtotal); err != nil {
+		return err
+	}
+	if request.TaxInclusive && request.Tax > subtotal {
+		return utils.NewValidationError("included tax cannot exceed the subtotal")
+	}
+
+	// The tip is charged on top of the service charge
+	tip := request.TipPercent / 100 * subtotal
+	if err := utils.ValidateTotalDiscount(request.TotalDiscount, subtotal, request.Tax, request.ServiceCharge+tip, request.TaxInclusive); err != nil {
+		return err
 	}
 
 	return nil
 }
 
+// calculationWarnings lists problems in a request that don't stop a calculation
+// but would likely make the result wrong. Strict requests reject them instead.
+func (s *CalculationService) calculationWarnings(request *models.CalculateSingleBillRequest) []string {
+	var warnings []string
+	for i, item := range request.Items {
+		if len(item.Consumers) == 0 {
+			warnings = append(warnings, fmt.Sprintf("Item %d has no consumers and was left out of the split", i+1))
+		}
+	}
+	return warnings
+}
+
 // normalizeItemNames normalizes all names in items
 func (s *CalculationService) normalizeItemNames(items []models.Item) []models.Item {
 	normalized := make([]models.Item, len(items))
@@ -97,6 +197,8 @@ func (s *CalculationService) normalizeItemNames(items []models.Item) []models.It
 		normalized[i] = item
 		normalized[i].PaidBy = utils.NormalizeName(item.PaidBy)
 		normalized[i].Consumers = utils.NormalizeNames(item.Consumers)
+		normalized[i].ConsumerWeights = utils.NormalizeNameMapKeys(item.ConsumerWeights)
+		normalized[i].ConsumerQuantities = utils.NormalizeNameMapKeys(item.ConsumerQuantities)
 	}
 	return normalized
 }
@@ -121,113 +223,64 @@ func (s *CalculationService) extractParticipants(items []models.Item) []string {
 func (s *CalculationService) calculateSubtotal(items []models.Item) float64 {
 	var subtotal float64
 	for _, item := range items {
-		itemAmount := item.UnitPrice*float64(item.Quantity) - item.ItemDiscount
+		itemAmount := item.UnitPrice*item.Quantity - item.ItemDiscount
 		subtotal += itemAmount
 	}
 	return subtotal
 }
 
-// calculatePersonalCharges calculates how much each person owes
+// calculatePersonalCharges calculates how much each person owes using the shared
+// item-split allocation, so single bills match settlements and exports.
+// When taxInclusive is set, item prices already contain the tax; splitEqually shares
+// the extras evenly instead of by consumption, and taxOnServiceCharge means tax includes
+// tax on the service charge. Amounts are rounded to the minor unit of currency.
 func (s *CalculationService) calculatePersonalCharges(
 	items []models.Item,
 	tax float64,
 	serviceCharge float64,
 	totalDiscount float64,
 	participants []string,
+	taxInclusive bool,
+	splitEqually bool,
+	taxOnServiceCharge bool,
+	currency string,
 ) (map[string]float64, map[string]models.PersonChargeBreakdown) {
-	
 	charges := make(map[string]float64)
 	breakdown := make(map[string]models.PersonChargeBreakdown)
 
 	// Initialize each participant's breakdown
 	for _, participant := range participants {
 		charges[participant] = 0
-		breakdown[participant] = models.PersonChargeBreakdown{
-			Subtotal:      0,
-			Tax:           0,
-			ServiceCharge: 0,
-			Discount:      0,
-			Total:         0,
-		}
+		breakdown[participant] = models.PersonChargeBreakdown{}
 	}
 
-	// Calculate each person's share of items (subtotal)
-	for _, item := range items {
-		itemAmount := item.UnitPrice*float64(item.Quantity) - item.ItemDiscount
-		itemAmount = utils.Round(itemAmount)
-
-		if len(item.Consumers) > 0 {
-			sharePerPerson := itemAmount / float64(len(item.Consumers))
-			sharePerPerson = utils.Round(sharePerPerson)
-
-			for _, consumer := range item.Consumers {
-				currentBreakdown := breakdown[consumer]
-				breakdown[consumer] = models.PersonChargeBreakdown{
-					Subtotal:      currentBreakdown.Subtotal + sharePerPerson,
-					Tax:           currentBreakdown.Tax,
-					ServiceCharge: currentBreakdown.ServiceCharge,
-					Discount:      currentBreakdown.Discount,
-					Total:         currentBreakdown.Total, // Total will be calculated after all extras are added
-				}
-			}
-		}
-	}
-
-	// Calculate total subtotal for proportion calculation
-	var totalSubtotal float64
-	for _, person := range participants {
-		totalSubtotal += breakdown[person].Subtotal
+	// Price each item before allocating; items are copies so the request is untouched
+	priced := make([]models.Item, len(items))
+	for i, item := range items {
+		item.Amount = utils.RoundForCurrency(item.UnitPrice*item.Quantity-item.ItemDiscount, currency)
+		priced[i] = item
 	}
 
-	// Calculate extras (tax, service charge, discount)
-	if totalSubtotal > 0 && len(participants) > 0 {
-		for _, person := range participants {
-			proportion := breakdown[person].Subtotal / totalSubtotal
-			personTax := tax * proportion
-			personService := serviceCharge * proportion
-			personDiscount := totalDiscount * proportion
-
-			breakdown[person] = models.PersonChargeBreakdown{
-				Subtotal:      breakdown[person].Subtotal,
-				Tax:           utils.Round(personTax),
-				ServiceCharge: utils.Round(personService),
-				Discount:      utils.Round(personDiscount),
-				Total:         utils.Round(breakdown[person].Subtotal + personTax + personService - personDiscount),
-			}
+	allocations := allocateItemSplit(priced, BillCharges{
+		Tax:           tax,
+		ServiceCharge: serviceCharge,
+		Discount:      totalDiscount,
+		TaxInclusive:  taxInclusive,
+		Currency:      currency,
+		SplitEqually:  splitEqually,
 
-			charges[person] = breakdown[person].Total
-		}
-	} else if totalSubtotal == 0 && len(participants) > 0 {
-		// If subtotal is 0 but we have extras, divide them equally
-		extraCharges := tax + serviceCharge - totalDiscount
-		extraPerPerson := extraCharges / float64(len(participants))
-		extraPerPerson = utils.Round(extraPerPerson)
-
-		for _, person := range participants {
-			personTax := tax / float64(len(participants))
-			personService := serviceCharge / float64(len(participants))
-
-			breakdown[person] = models.PersonChargeBreakdown{
-				Subtotal:      0,
-				Tax:           utils.Round(personTax),
-				ServiceCharge: utils.Round(personService),
-				Discount:      utils.Round(totalDiscount / float64(len(participants))),
-				Total:         utils.Round(extraPerPerson),
-			}
-
-			charges[person] = extraPerPerson
-		}
-	}
+		TaxOnServiceCharge: taxOnServiceCharge,
+	})
 
-	// Round all values in the breakdown
-	for person := range breakdown {
+	for person, allocation := range allocations {
 		breakdown[person] = models.PersonChargeBreakdown{
-			Subtotal:      utils.Round(breakdown[person].Subtotal),
-			Tax:           utils.Round(breakdown[person].Tax),
-			ServiceCharge: utils.Round(breakdown[person].ServiceCharge),
-			Discount:      utils.Round(breakdown[person].Discount),
-			Total:         utils.Round(breakdown[person].Total),
+			Subtotal:      allocation.Subtotal,
+			Tax:           allocation.Tax,
+			ServiceCharge: allocation.ServiceCharge,
+			Discount:      allocation.Discount,
+			Total:         allocation.Total,
 		}
+		charges[person] = allocation.Total
 	}
 
 	return charges, breakdown
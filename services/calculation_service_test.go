@@ -1,6 +1,7 @@
 package services
 
 import (
+	"math"
 	"testing"
 
 	"github.com/fadhlanhapp/sharetab-backend/models"
@@ -161,6 +162,30 @@ func TestCalculationService_CalculateSingleBill_SimpleSharedItem(t *testing.T) {
 	}
 }
 
+func TestCalculationService_CalculateSingleBill_FractionalQuantity(t *testing.T) {
+	service := NewCalculationService()
+
+	// Half a kilo of cheese priced per kilo, shared by two people
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{
+				Description: "Cheese (kg)",
+				UnitPrice:   120000,
+				Quantity:    0.5,
+				PaidBy:      "alice",
+				Consumers:   []string{"alice", "bob"},
+			},
+		},
+	}
+
+	result, err := service.CalculateSingleBill(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 60000.0, result.Subtotal)
+	assert.Equal(t, 30000.0, result.PerPersonBreakdown["Alice"].Total)
+	assert.Equal(t, 30000.0, result.PerPersonBreakdown["Bob"].Total)
+}
+
 func TestCalculationService_CalculateSingleBill_WithTaxAndService(t *testing.T) {
 	service := NewCalculationService()
 
@@ -198,4 +223,456 @@ func TestCalculationService_CalculateSingleBill_WithTaxAndService(t *testing.T)
 		assert.Equal(t, float64(2.5), breakdown.ServiceCharge)
 		assert.Equal(t, float64(57.5), breakdown.Total)
 	}
-}
\ No newline at end of file
+}
+func TestCalculationService_CalculateSingleBill_WeightedConsumers(t *testing.T) {
+	service := NewCalculationService()
+
+	// Alice eats twice as much pizza as Bob and Carol
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{
+				Description:     "Pizza",
+				UnitPrice:       90,
+				Quantity:        1,
+				PaidBy:          "alice",
+				Consumers:       []string{"alice", "bob", "carol"},
+				ConsumerWeights: map[string]float64{"Alice": 2},
+			},
+		},
+		Tax: 9,
+	}
+
+	result, err := service.CalculateSingleBill(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, float64(45), result.PerPersonBreakdown["Alice"].Subtotal)
+	assert.Equal(t, float64(4.5), result.PerPersonBreakdown["Alice"].Tax)
+	assert.Equal(t, float64(22.5), result.PerPersonBreakdown["Bob"].Subtotal)
+	assert.Equal(t, float64(22.5), result.PerPersonBreakdown["Carol"].Subtotal)
+	assert.Equal(t, float64(24.75), result.PerPersonBreakdown["Carol"].Total)
+}
+
+func TestCalculationService_CalculateSingleBill_InvalidWeights(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{
+				Description:     "Pizza",
+				UnitPrice:       90,
+				Quantity:        1,
+				PaidBy:          "alice",
+				Consumers:       []string{"alice", "bob"},
+				ConsumerWeights: map[string]float64{"bob": 0},
+			},
+		},
+	}
+
+	_, err := service.CalculateSingleBill(request)
+	assert.Error(t, err)
+
+	request.Items[0].ConsumerWeights = map[string]float64{"dave": 1}
+	_, err = service.CalculateSingleBill(request)
+	assert.Error(t, err)
+}
+
+func TestCalculationService_CalculateSingleBill_WithTipPercent(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{
+				Description: "Meal",
+				UnitPrice:   100,
+				Quantity:    1,
+				PaidBy:      "alice",
+				Consumers:   []string{"alice", "bob"},
+			},
+		},
+		ServiceCharge: 5,
+		TipPercent:    10, // 10% of 100 = 10, on top of the explicit service charge
+	}
+
+	result, err := service.CalculateSingleBill(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, float64(10), result.Tip)
+	assert.Equal(t, float64(5), result.ServiceCharge)
+	assert.Equal(t, float64(115), result.Amount) // 100 + 5 + 10
+
+	// Tip is folded into each person's service charge share
+	for _, person := range []string{"Alice", "Bob"} {
+		breakdown := result.PerPersonBreakdown[person]
+		assert.Equal(t, float64(7.5), breakdown.ServiceCharge)
+		assert.Equal(t, float64(57.5), breakdown.Total)
+	}
+}
+
+func TestCalculationService_CalculateSingleBill_InvalidTipPercent(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{Description: "Meal", UnitPrice: 100, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice"}},
+		},
+		TipPercent: 120,
+	}
+
+	_, err := service.CalculateSingleBill(request)
+	assert.Error(t, err)
+}
+
+func TestCalculationService_CalculateSingleBill_NegativePromoLine(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{Description: "Pizza", UnitPrice: 100, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+			{Description: "Beer", UnitPrice: 60, Quantity: 1, PaidBy: "alice", Consumers: []string{"bob"}},
+			{Description: "Promo", UnitPrice: -20, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+		},
+		Tax: 14,
+	}
+
+	result, err := service.CalculateSingleBill(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, float64(140), result.Subtotal)
+	assert.Equal(t, float64(154), result.Amount)
+
+	// Alice: 50 - 10 = 40 subtotal, 4 tax; Bob: 50 + 60 - 10 = 100 subtotal, 10 tax
+	assert.Equal(t, float64(40), result.PerPersonBreakdown["Alice"].Subtotal)
+	assert.Equal(t, float64(4), result.PerPersonBreakdown["Alice"].Tax)
+	assert.Equal(t, float64(44), result.PerPersonCharges["Alice"])
+	assert.Equal(t, float64(100), result.PerPersonBreakdown["Bob"].Subtotal)
+	assert.Equal(t, float64(110), result.PerPersonCharges["Bob"])
+}
+
+func TestCalculationService_CalculateSingleBill_RejectsNonPositiveTotal(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{Description: "Pizza", UnitPrice: 20, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice"}},
+			{Description: "Voucher", UnitPrice: -50, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice"}},
+		},
+	}
+
+	_, err := service.CalculateSingleBill(request)
+	assert.Error(t, err)
+}
+
+func TestCalculationService_CalculateSingleBill_RejectsZeroPrice(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{Description: "Water", UnitPrice: 0, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice"}},
+		},
+	}
+
+	_, err := service.CalculateSingleBill(request)
+	assert.Error(t, err)
+}
+
+func TestCalculationService_CalculateSingleBill_TaxInclusive(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{Description: "Meal", UnitPrice: 110, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+		},
+		Tax:          10, // Already contained in the 110 menu price
+		TaxInclusive: true,
+	}
+
+	result, err := service.CalculateSingleBill(request)
+
+	assert.NoError(t, err)
+	assert.True(t, result.TaxInclusive)
+	assert.Equal(t, float64(110), result.Subtotal)
+	assert.Equal(t, float64(110), result.Amount) // Not 120
+
+	// Each person's 55 share contains 5 of tax
+	for _, person := range []string{"Alice", "Bob"} {
+		breakdown := result.PerPersonBreakdown[person]
+		assert.Equal(t, float64(50), breakdown.Subtotal)
+		assert.Equal(t, float64(5), breakdown.Tax)
+		assert.Equal(t, float64(55), breakdown.Total)
+		assert.Equal(t, float64(55), result.PerPersonCharges[person])
+	}
+}
+
+func TestCalculationService_CalculateSingleBill_TaxInclusiveTaxExceedsSubtotal(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{Description: "Meal", UnitPrice: 10, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice"}},
+		},
+		Tax:          20,
+		TaxInclusive: true,
+	}
+
+	_, err := service.CalculateSingleBill(request)
+	assert.Error(t, err)
+}
+
+func TestCalculationService_CalculateSingleBill_RoundsToCurrency(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{Description: "Nasi Goreng", UnitPrice: 100000, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice", "bob", "carol"}},
+		},
+		Tax:      11000,
+		Currency: "idr",
+	}
+
+	result, err := service.CalculateSingleBill(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "IDR", result.Currency)
+	for person, charge := range result.PerPersonCharges {
+		assert.Equal(t, math.Round(charge), charge, "charge for %s has minor units", person)
+		breakdown := result.PerPersonBreakdown[person]
+		assert.Equal(t, math.Round(breakdown.Tax), breakdown.Tax, "tax for %s has minor units", person)
+	}
+	// The leftover rupiah of the item goes to the first consumer
+	assert.Equal(t, float64(37001), result.PerPersonCharges["Alice"])
+	assert.Equal(t, float64(111000), result.PerPersonCharges["Alice"]+result.PerPersonCharges["Bob"]+result.PerPersonCharges["Carol"])
+}
+
+func TestCalculationService_CalculateSingleBill_FormatCurrency(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{Description: "Nasi Goreng", UnitPrice: 115000, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+		},
+		Currency:       "IDR",
+		FormatCurrency: true,
+	}
+
+	result, err := service.CalculateSingleBill(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, float64(115000), result.Amount)
+	assert.Equal(t, "Rp 115.000", result.FormattedAmount)
+	assert.Equal(t, map[string]string{"Alice": "Rp 57.500", "Bob": "Rp 57.500"}, result.FormattedPerPersonCharges)
+
+	request.FormatCurrency = false
+	result, err = service.CalculateSingleBill(request)
+
+	assert.NoError(t, err)
+	assert.Empty(t, result.FormattedAmount)
+	assert.Nil(t, result.FormattedPerPersonCharges)
+}
+
+func TestCalculationService_CalculateSingleBill_WarnsInsteadOfFailing(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{Description: "Pizza", UnitPrice: 100, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+			{Description: "Wine", UnitPrice: 60, Quantity: 1, PaidBy: "alice"},
+		},
+	}
+
+	result, err := service.CalculateSingleBill(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Item 2 has no consumers and was left out of the split"}, result.Warnings)
+	assert.Equal(t, float64(160), result.Amount)
+	assert.Equal(t, map[string]float64{"Alice": 50, "Bob": 50}, result.PerPersonCharges)
+}
+
+func TestCalculationService_CalculateSingleBill_StrictRejectsWarnings(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{Description: "Wine", UnitPrice: 60, Quantity: 1, PaidBy: "alice"},
+			{Description: "Pizza", UnitPrice: 100, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice"}},
+			{Description: "Beer", UnitPrice: 30, Quantity: 1, PaidBy: "alice"},
+		},
+		Strict: true,
+	}
+
+	_, err := service.CalculateSingleBill(request)
+
+	assert.EqualError(t, err, "Item 1 has no consumers and was left out of the split; Item 3 has no consumers and was left out of the split")
+}
+
+func TestCalculationService_CalculateSingleBill_NoWarningsForCleanBill(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{Description: "Pizza", UnitPrice: 100, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+		},
+		Strict: true,
+	}
+
+	result, err := service.CalculateSingleBill(request)
+
+	assert.NoError(t, err)
+	assert.Nil(t, result.Warnings)
+}
+
+func TestCalculationService_CalculateSingleBill_DiscountLimit(t *testing.T) {
+	service := NewCalculationService()
+	request := func(discount float64) *models.CalculateSingleBillRequest {
+		return &models.CalculateSingleBillRequest{
+			Items: []models.Item{
+				{Description: "Pizza", UnitPrice: 100, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+			},
+			Tax:           10,
+			ServiceCharge: 5,
+			TotalDiscount: discount,
+		}
+	}
+
+	// A discount covering the whole bill is allowed
+	result, err := service.CalculateSingleBill(request(115))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), result.Amount)
+
+	_, err = service.CalculateSingleBill(request(115.01))
+	assert.EqualError(t, err, "discount 115.01 cannot exceed the subtotal plus tax and service charge (115)")
+}
+
+func TestCalculationService_CalculateSingleBill_ItemDiscountLimit(t *testing.T) {
+	service := NewCalculationService()
+	request := func(itemDiscount float64) *models.CalculateSingleBillRequest {
+		return &models.CalculateSingleBillRequest{
+			Items: []models.Item{
+				{Description: "Pizza", UnitPrice: 100, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice"}},
+				{Description: "Beer", UnitPrice: 20, Quantity: 2, ItemDiscount: itemDiscount, PaidBy: "alice", Consumers: []string{"bob"}},
+			},
+		}
+	}
+
+	// A fully discounted item is allowed
+	result, err := service.CalculateSingleBill(request(40))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(100), result.Amount)
+
+	_, err = service.CalculateSingleBill(request(40.5))
+	assert.EqualError(t, err, "Item 2: item discount 40.5 cannot exceed the item total 40")
+}
+
+func TestCalculationService_CalculateSingleBill_ConsumerQuantities(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{
+				Description:        "Coffee",
+				UnitPrice:          25000,
+				Quantity:           3,
+				PaidBy:             "alice",
+				Consumers:          []string{"Alice", "Bob"},
+				ConsumerQuantities: map[string]float64{"ALICE": 2, "bob": 1},
+			},
+		},
+		Currency: "IDR",
+	}
+
+	result, err := service.CalculateSingleBill(request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Alice": 50000, "Bob": 25000}, result.PerPersonCharges)
+}
+
+func TestCalculationService_CalculateSingleBill_ConsumerQuantitiesMustMatchQuantity(t *testing.T) {
+	service := NewCalculationService()
+
+	request := &models.CalculateSingleBillRequest{
+		Items: []models.Item{
+			{
+				Description:        "Coffee",
+				UnitPrice:          25000,
+				Quantity:           3,
+				PaidBy:             "alice",
+				Consumers:          []string{"alice", "bob"},
+				ConsumerQuantities: map[string]float64{"alice": 1, "bob": 1},
+			},
+		},
+	}
+
+	_, err := service.CalculateSingleBill(request)
+
+	assert.EqualError(t, err, "Item 1: consumer quantities add up to 2 but the item quantity is 3")
+}
+
+func TestCalculationService_CalculateSingleBill_ExtrasSplitModes(t *testing.T) {
+	service := NewCalculationService()
+	request := func(mode string) *models.CalculateSingleBillRequest {
+		return &models.CalculateSingleBillRequest{
+			Items: []models.Item{
+				{Description: "Steak", UnitPrice: 60, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice"}},
+				{Description: "Salad", UnitPrice: 20, Quantity: 1, PaidBy: "alice", Consumers: []string{"bob"}},
+			},
+			Tax:             8,
+			ServiceCharge:   4,
+			TotalDiscount:   2,
+			ExtrasSplitMode: mode,
+		}
+	}
+
+	// Proportional: Alice ate 3/4 of the food, so she bears 3/4 of the extras
+	proportional, err := service.CalculateSingleBill(request(""))
+	assert.NoError(t, err)
+	assert.Equal(t, models.PersonChargeBreakdown{Subtotal: 60, Tax: 6, ServiceCharge: 3, Discount: 1.5, Total: 67.5}, proportional.PerPersonBreakdown["Alice"])
+	assert.Equal(t, models.PersonChargeBreakdown{Subtotal: 20, Tax: 2, ServiceCharge: 1, Discount: 0.5, Total: 22.5}, proportional.PerPersonBreakdown["Bob"])
+
+	explicit, err := service.CalculateSingleBill(request(models.ExtrasSplitProportional))
+	assert.NoError(t, err)
+	assert.Equal(t, proportional.PerPersonBreakdown, explicit.PerPersonBreakdown)
+
+	// Equal: the extras are halved whatever each person ordered
+	equal, err := service.CalculateSingleBill(request(models.ExtrasSplitEqual))
+	assert.NoError(t, err)
+	assert.Equal(t, models.PersonChargeBreakdown{Subtotal: 60, Tax: 4, ServiceCharge: 2, Discount: 1, Total: 65}, equal.PerPersonBreakdown["Alice"])
+	assert.Equal(t, models.PersonChargeBreakdown{Subtotal: 20, Tax: 4, ServiceCharge: 2, Discount: 1, Total: 25}, equal.PerPersonBreakdown["Bob"])
+
+	// The bill total is the same either way
+	assert.Equal(t, proportional.Amount, equal.Amount)
+}
+
+func TestCalculationService_CalculateSingleBill_TaxOnServiceCharge(t *testing.T) {
+	service := NewCalculationService()
+	request := func(taxOnServiceCharge bool) *models.CalculateSingleBillRequest {
+		return &models.CalculateSingleBillRequest{
+			Items: []models.Item{
+				{Description: "Steak", UnitPrice: 60, Quantity: 1, PaidBy: "alice", Consumers: []string{"alice"}},
+				{Description: "Salad", UnitPrice: 40, Quantity: 1, PaidBy: "alice", Consumers: []string{"bob"}},
+			},
+			Tax:                10,
+			ServiceCharge:      5,
+			TaxOnServiceCharge: taxOnServiceCharge,
+		}
+	}
+
+	// Tax on the subtotal only: 10% of 100
+	separate, err := service.CalculateSingleBill(request(false))
+	assert.NoError(t, err)
+	assert.Equal(t, 115.0, separate.Amount)
+	assert.Equal(t, 10.0, separate.Tax)
+	assert.Equal(t, models.PersonChargeBreakdown{Subtotal: 60, Tax: 6, ServiceCharge: 3, Total: 69}, separate.PerPersonBreakdown["Alice"])
+	assert.Equal(t, models.PersonChargeBreakdown{Subtotal: 40, Tax: 4, ServiceCharge: 2, Total: 46}, separate.PerPersonBreakdown["Bob"])
+
+	// Tax on subtotal plus service: 10% of 105
+	compounded, err := service.CalculateSingleBill(request(true))
+	assert.NoError(t, err)
+	assert.Equal(t, 115.5, compounded.Amount)
+	assert.Equal(t, 10.5, compounded.Tax)
+	assert.Equal(t, models.PersonChargeBreakdown{Subtotal: 60, Tax: 6.3, ServiceCharge: 3, Total: 69.3}, compounded.PerPersonBreakdown["Alice"])
+	assert.Equal(t, models.PersonChargeBreakdown{Subtotal: 40, Tax: 4.2, ServiceCharge: 2, Total: 46.2}, compounded.PerPersonBreakdown["Bob"])
+
+	inclusive := request(true)
+	inclusive.TaxInclusive = true
+	_, err = service.CalculateSingleBill(inclusive)
+	assert.EqualError(t, err, "taxOnServiceCharge cannot be combined with taxInclusive")
+}
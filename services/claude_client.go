@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Claude API retry settings
+const (
+	claudeMaxAttempts    = 3
+	claudeRetryBaseDelay = time.Second
+	claudeMaxRetryDelay  = 30 * time.Second
+)
+
+// isRetryableClaudeStatus reports whether a Claude API status is a transient
+// rate limit or server error worth retrying
+func isRetryableClaudeStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		529: // Anthropic overloaded
+		return true
+	}
+	return false
+}
+
+// sendClaudeRequest posts a request body to the Claude API, retrying transient
+// failures with exponential backoff. A Retry-After header overrides the backoff.
+// Other non-200 responses fail immediately. When every attempt fails the error is
+// prefixed with claude_unavailable so callers can ask the user to retry shortly.
+func sendClaudeRequest(client *http.Client, url, apiKey string, body []byte, baseDelay time.Duration) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Claude API request: %v", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-api-key", apiKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		claudeAPILatency.Set(time.Since(start).Seconds())
+		if err != nil {
+			return nil, fmt.Errorf("failed to send request to Claude API: %v", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if !isRetryableClaudeStatus(resp.StatusCode) {
+			return nil, fmt.Errorf("Claude API returned non-200 status: %d - %s", resp.StatusCode, string(bodyBytes))
+		}
+		if attempt >= claudeMaxAttempts {
+			return nil, fmt.Errorf("claude_unavailable: Claude API still failing after %d attempts: %d - %s", attempt, resp.StatusCode, string(bodyBytes))
+		}
+
+		delay := retryAfterDelay(resp.Header.Get("Retry-After"), baseDelay<<(attempt-1))
+		slog.Warn("Claude API unavailable, retrying", "operation", "process_receipt", "status", resp.StatusCode, "delay", delay.String(), "attempt", attempt+1, "maxAttempts", claudeMaxAttempts)
+		time.Sleep(delay)
+	}
+}
+
+// retryAfterDelay parses a Retry-After header given in seconds or as an HTTP date,
+// returning the fallback when it is missing or invalid. Delays are capped so a
+// misbehaving header cannot stall the upload indefinitely.
+func retryAfterDelay(header string, fallback time.Duration) time.Duration {
+	delay := fallback
+	if header != "" {
+		if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(header); err == nil {
+			delay = time.Until(at)
+		}
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > claudeMaxRetryDelay {
+		delay = claudeMaxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendClaudeRequest_RetriesTransientStatus(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(529)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := sendClaudeRequest(server.Client(), server.URL, "key", []byte("{}"), time.Millisecond)
+
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestSendClaudeRequest_ExhaustedRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, err := sendClaudeRequest(server.Client(), server.URL, "key", []byte("{}"), time.Millisecond)
+
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "claude_unavailable:"))
+	assert.Equal(t, int32(claudeMaxAttempts), atomic.LoadInt32(&calls))
+}
+
+func TestSendClaudeRequest_ClientErrorFailsFast(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	_, err := sendClaudeRequest(server.Client(), server.URL, "key", []byte("{}"), time.Millisecond)
+
+	assert.Error(t, err)
+	assert.False(t, strings.HasPrefix(err.Error(), "claude_unavailable:"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	assert.Equal(t, 2*time.Second, retryAfterDelay("", 2*time.Second))
+	assert.Equal(t, 5*time.Second, retryAfterDelay("5", time.Second))
+	assert.Equal(t, claudeMaxRetryDelay, retryAfterDelay("3600", time.Second))
+	assert.Equal(t, time.Second, retryAfterDelay("soon", time.Second))
+	assert.Equal(t, time.Duration(0), retryAfterDelay(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), time.Second))
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Receipt extraction defaults, used when the matching environment variable is unset
+const (
+	defaultClaudeModel     = "claude-3-5-sonnet-20241022"
+	defaultClaudeMaxTokens = 4000
+	defaultClaudeTimeout   = 60 * time.Second
+)
+
+// defaultReceiptPrompt is the optimized prompt for receipt extraction
+const defaultReceiptPrompt = `Extract receipt data in this JSON format:
+
+Note: Some receipts show quantity on separate lines:
+- "3 @ 36.000" (quantity @ unit_price)
+- "Item Name" (on next line)
+Match quantity lines with item names below them. Use unit_price, not total.
+
+{
+  "merchant": "store name",
+  "date": "YYYY-MM-DD",
+  "items": [
+    {
+      "name": "item name",
+      "price": unit_price_per_item,
+      "quantity": number,
+      "discount": number
+    }
+  ],
+  "subtotal": number,
+  "tax": number,
+  "service": number,
+  "discount": number,
+  "total": number
+}
+
+Return only valid JSON. No explanations.`
+
+// ClaudeConfig holds the model settings used for receipt extraction
+type ClaudeConfig struct {
+	Model     string        // CLAUDE_MODEL
+	Prompt    string        // CLAUDE_RECEIPT_PROMPT
+	MaxTokens int           // CLAUDE_MAX_TOKENS
+	Timeout   time.Duration // CLAUDE_TIMEOUT (e.g. "90s")
+}
+
+// loadClaudeConfig reads the receipt extraction settings from the environment,
+// falling back to the defaults for unset or invalid values
+func loadClaudeConfig() ClaudeConfig {
+	config := ClaudeConfig{
+		Model:     defaultClaudeModel,
+		Prompt:    defaultReceiptPrompt,
+		MaxTokens: defaultClaudeMaxTokens,
+		Timeout:   defaultClaudeTimeout,
+	}
+
+	if model := os.Getenv("CLAUDE_MODEL"); model != "" {
+		config.Model = model
+	}
+	if prompt := os.Getenv("CLAUDE_RECEIPT_PROMPT"); prompt != "" {
+		config.Prompt = prompt
+	}
+
+	if value := os.Getenv("CLAUDE_MAX_TOKENS"); value != "" {
+		maxTokens, err := strconv.Atoi(value)
+		if err != nil || maxTokens <= 0 {
+			slog.Warn("Invalid CLAUDE_MAX_TOKENS, using default", "value", value, "default", defaultClaudeMaxTokens)
+		} else {
+			config.MaxTokens = maxTokens
+		}
+	}
+
+	if value := os.Getenv("CLAUDE_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			slog.Warn("Invalid CLAUDE_TIMEOUT, using default", "value", value, "default", defaultClaudeTimeout.String())
+		} else {
+			config.Timeout = timeout
+		}
+	}
+
+	return config
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadClaudeConfig_Defaults(t *testing.T) {
+	t.Setenv("CLAUDE_MODEL", "")
+	t.Setenv("CLAUDE_RECEIPT_PROMPT", "")
+	t.Setenv("CLAUDE_MAX_TOKENS", "")
+	t.Setenv("CLAUDE_TIMEOUT", "")
+
+	config := loadClaudeConfig()
+
+	assert.Equal(t, defaultClaudeModel, config.Model)
+	assert.Equal(t, defaultReceiptPrompt, config.Prompt)
+	assert.Equal(t, defaultClaudeMaxTokens, config.MaxTokens)
+	assert.Equal(t, defaultClaudeTimeout, config.Timeout)
+}
+
+func TestLoadClaudeConfig_FromEnvironment(t *testing.T) {
+	t.Setenv("CLAUDE_MODEL", "claude-sonnet-4-20250514")
+	t.Setenv("CLAUDE_RECEIPT_PROMPT", "Return the receipt as JSON.")
+	t.Setenv("CLAUDE_MAX_TOKENS", "8000")
+	t.Setenv("CLAUDE_TIMEOUT", "90s")
+
+	config := loadClaudeConfig()
+
+	assert.Equal(t, "claude-sonnet-4-20250514", config.Model)
+	assert.Equal(t, "Return the receipt as JSON.", config.Prompt)
+	assert.Equal(t, 8000, config.MaxTokens)
+	assert.Equal(t, 90*time.Second, config.Timeout)
+}
+
+func TestLoadClaudeConfig_InvalidValuesFallBack(t *testing.T) {
+	t.Setenv("CLAUDE_MAX_TOKENS", "lots")
+	t.Setenv("CLAUDE_TIMEOUT", "-5s")
+
+	config := loadClaudeConfig()
+
+	assert.Equal(t, defaultClaudeMaxTokens, config.MaxTokens)
+	assert.Equal(t, defaultClaudeTimeout, config.Timeout)
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// ExportTripToCSV generates a CSV export of a trip's person summary and expense matrix
+func (s *ExcelService) ExportTripToCSV(tripCode string) ([]byte, string, error) {
+	// Get trip data
+	trip, err := s.tripService.GetTripByCode(tripCode)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Get all expenses
+	expenses, err := s.expenseService.GetExpenses(trip.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	if err := s.writeTripCSV(&buf, expenses, trip.Currency); err != nil {
+		return nil, "", fmt.Errorf("failed to write CSV: %v", err)
+	}
+
+	filename := fmt.Sprintf("%s_Export_%s.csv",
+		utils.CleanFileName(trip.Name),
+		time.Now().Format("2006-01-02"))
+
+	return buf.Bytes(), filename, nil
+}
+
+// writeTripCSV writes the person summary section, a blank line, then the expense matrix section
+func (s *ExcelService) writeTripCSV(out io.Writer, expenses []*models.Expense, currency string) error {
+	w := csv.NewWriter(out)
+
+	// Person summary section
+	w.Write([]string{"Person", "Total Spent", "Total Owed", "Net Balance"})
+	for _, summary := range sortedPersonSummaries(expenses, currency) {
+		w.Write([]string{
+			summary.Name,
+			formatExportAmount(summary.TotalSpent),
+			formatExportAmount(summary.TotalOwed),
+			formatExportAmount(summary.NetBalance),
+		})
+	}
+
+	w.Write([]string{})
+
+	// Expense matrix section
+	participants := matrixParticipants(expenses)
+	headers := append([]string{"Date", "Bill Name", "Paid By", "Total Amount"}, participants...)
+	w.Write(headers)
+	for _, row := range s.sortedExpenseMatrix(expenses, participants, currency) {
+		record := []string{row.Date, row.BillName, row.PaidBy, formatExportAmount(row.TotalAmount)}
+		for _, participant := range participants {
+			record = append(record, formatExportAmount(row.PersonAmounts[participant]))
+		}
+		w.Write(record)
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// formatExportAmount formats a monetary amount with two decimals for file exports
+func formatExportAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", utils.Round(amount))
+}
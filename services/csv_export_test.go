@@ -0,0 +1,59 @@
+package services
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTripCSV(t *testing.T) {
+	created := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC).UnixMilli()
+	expenses := []*models.Expense{
+		{
+			CreationTime: created,
+			Description:  "Dinner",
+			Amount:       100,
+			PaidBy:       "alice",
+			SplitType:    "equal",
+			SplitAmong:   []string{"alice", "bob", "carol"},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := (&ExcelService{}).writeTripCSV(&buf, expenses, "")
+	assert.NoError(t, err)
+
+	date := time.UnixMilli(created).Format("2006-01-02")
+	expected := "Person,Total Spent,Total Owed,Net Balance\n" +
+		"Alice,100.00,33.33,66.67\n" +
+		"Bob,0.00,33.33,-33.33\n" +
+		"Carol,0.00,33.33,-33.33\n" +
+		"\n" +
+		"Date,Bill Name,Paid By,Total Amount,Alice,Bob,Carol\n" +
+		date + ",Dinner,Alice,100.00,33.33,33.33,33.33\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestExportTripToCSV_UnknownTrip(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM trips WHERE code = $1")).WithArgs("ABC123").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	service := NewExcelService(&TripService{repo: &repository.TripRepository{DB: db}}, nil, nil, nil)
+
+	_, _, err = service.ExportTripToCSV("ABC123")
+	assert.Equal(t, utils.NewNotFoundError("Trip"), err)
+
+	_, _, err = service.ExportTripToCSV("not a code")
+	assert.Equal(t, utils.NewValidationError("Invalid trip code"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -28,25 +28,30 @@ func NewExcelService(tripService *TripService, expenseService *ExpenseService, s
 	}
 }
 
-// PersonSummary represents a person's spending summary
-type PersonSummary struct {
-	Name         string
-	TotalSpent   float64 // How much they paid out
-	TotalOwed    float64 // How much they consumed
-	NetBalance   float64 // Positive = should receive, Negative = should pay
-}
-
 // ExpenseMatrixRow represents a row in the expense matrix
 type ExpenseMatrixRow struct {
 	Date        string
 	BillName    string
 	PaidBy      string
+	AddedBy     string // Participant who logged the expense
+	Notes       string
 	TotalAmount float64
 	PersonAmounts map[string]float64 // person name -> amount they owe for this expense
 }
 
-// ExportTripToExcel generates an Excel file for a trip
-func (s *ExcelService) ExportTripToExcel(tripCode string) (*excelize.File, string, error) {
+// StatementRow is one expense on a single person's statement
+type StatementRow struct {
+	Date        string
+	BillName    string
+	PaidBy      string
+	TotalAmount float64
+	Share       float64 // What the person owes for this expense
+	Paid        float64 // What the person paid toward this expense
+}
+
+// ExportTripToExcel generates an Excel file for a trip. When participant is set, the
+// workbook is instead a single statement sheet covering only that person.
+func (s *ExcelService) ExportTripToExcel(tripCode string, participant string) (*excelize.File, string, error) {
 	// Get trip data
 	trip, err := s.tripService.GetTripByCode(tripCode)
 	if err != nil {
@@ -59,8 +64,12 @@ func (s *ExcelService) ExportTripToExcel(tripCode string) (*excelize.File, strin
 		return nil, "", fmt.Errorf("failed to get expenses: %v", err)
 	}
 
+	if participant != "" {
+		return s.exportStatement(trip, expenses, participant)
+	}
+
 	// Get settlements
-	settlementResult, err := s.settlementService.CalculateSettlements(trip.ID)
+	settlementResult, err := s.settlementService.CalculateSettlementsWithOptions(trip.ID, SettlementOptions{Currency: trip.Currency})
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to calculate settlements: %v", err)
 	}
@@ -101,6 +110,136 @@ func (s *ExcelService) ExportTripToExcel(tripCode string) (*excelize.File, strin
 	return f, filename, nil
 }
 
+// exportStatement generates a workbook with a single statement sheet for one participant
+func (s *ExcelService) exportStatement(trip *models.Trip, expenses []*models.Expense, participant string) (*excelize.File, string, error) {
+	name := utils.NormalizeName(participant)
+	known := false
+	for _, p := range trip.Participants {
+		if utils.NormalizeName(p) == name {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil, "", utils.NewValidationError(fmt.Sprintf("%s is not a participant in this trip", utils.FormatNameForDisplay(name)))
+	}
+
+	f := excelize.NewFile()
+	if err := s.createStatementSheet(f, expenses, name, trip.Currency); err != nil {
+		return nil, "", fmt.Errorf("failed to create statement sheet: %v", err)
+	}
+	f.DeleteSheet("Sheet1")
+
+	filename := fmt.Sprintf("%s_%s_Statement_%s.xlsx",
+		utils.CleanFileName(trip.Name),
+		utils.CleanFileName(utils.FormatNameForDisplay(name)),
+		time.Now().Format("2006-01-02"))
+
+	return f, filename, nil
+}
+
+// createStatementSheet creates the single-person statement: every expense the person
+// shared in or paid toward, with their share, what they paid and their net
+func (s *ExcelService) createStatementSheet(f *excelize.File, expenses []*models.Expense, person string, currency string) error {
+	sheetName := "Statement"
+	f.NewSheet(sheetName)
+	sheetIndex, _ := f.GetSheetIndex(sheetName)
+	f.SetActiveSheet(sheetIndex)
+
+	boldStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+	})
+	f.SetCellValue(sheetName, "A1", "Statement for")
+	f.SetCellValue(sheetName, "B1", utils.FormatNameForDisplay(person))
+	f.SetCellStyle(sheetName, "A1", "B1", boldStyle)
+
+	// Set headers
+	headers := []string{"Date", "Bill Name", "Paid By", "Total Amount", "Share", "Paid"}
+	for i, header := range headers {
+		cell := cellName(i+1, 3)
+		f.SetCellValue(sheetName, cell, header)
+	}
+
+	// Style headers
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Color: []string{"E6F3FF"}, Pattern: 1},
+	})
+	f.SetCellStyle(sheetName, "A3", "F3", headerStyle)
+
+	// Add statement rows
+	rows := s.calculateStatement(expenses, person, currency)
+	var totalShare, totalPaid float64
+	for i, row := range rows {
+		excelRow := i + 4
+		f.SetCellValue(sheetName, fmt.Sprintf("A%d", excelRow), row.Date)
+		f.SetCellValue(sheetName, fmt.Sprintf("B%d", excelRow), row.BillName)
+		f.SetCellValue(sheetName, fmt.Sprintf("C%d", excelRow), row.PaidBy)
+		f.SetCellValue(sheetName, fmt.Sprintf("D%d", excelRow), row.TotalAmount)
+		f.SetCellValue(sheetName, fmt.Sprintf("E%d", excelRow), row.Share)
+		f.SetCellValue(sheetName, fmt.Sprintf("F%d", excelRow), row.Paid)
+		totalShare += row.Share
+		totalPaid += row.Paid
+	}
+
+	// Add totals and net
+	totalRow := len(rows) + 4
+	f.SetCellValue(sheetName, fmt.Sprintf("A%d", totalRow), "Total")
+	f.SetCellValue(sheetName, fmt.Sprintf("E%d", totalRow), utils.Round(totalShare))
+	f.SetCellValue(sheetName, fmt.Sprintf("F%d", totalRow), utils.Round(totalPaid))
+	f.SetCellValue(sheetName, fmt.Sprintf("A%d", totalRow+1), "Net Balance")
+	f.SetCellValue(sheetName, fmt.Sprintf("F%d", totalRow+1), utils.Round(totalPaid-totalShare))
+	f.SetCellStyle(sheetName, fmt.Sprintf("A%d", totalRow), fmt.Sprintf("F%d", totalRow+1), boldStyle)
+
+	// Auto-fit columns
+	f.SetColWidth(sheetName, "A", "F", 12)
+	f.SetColWidth(sheetName, "B", "B", 20) // Bill name column wider
+
+	return nil
+}
+
+// calculateStatement projects the expense matrix onto one normalized name, keeping the
+// expenses the person shared in or paid toward, sorted by date
+func (s *ExcelService) calculateStatement(expenses []*models.Expense, person string, currency string) []StatementRow {
+	displayName := utils.FormatNameForDisplay(person)
+	matrixRows := s.calculateExpenseMatrix(expenses, []string{displayName}, currency)
+
+	var rows []StatementRow
+	for i, expense := range expenses {
+		var paid float64
+		for _, summary := range calculatePersonSummaries([]*models.Expense{expense}, currency) {
+			if summary.Name == displayName {
+				paid = summary.TotalSpent
+			}
+		}
+
+		share := matrixRows[i].PersonAmounts[displayName]
+		involved := paid != 0
+		for _, name := range expenseParticipants([]*models.Expense{expense}) {
+			if utils.NormalizeName(name) == person {
+				involved = true
+			}
+		}
+		if !involved {
+			continue
+		}
+
+		rows = append(rows, StatementRow{
+			Date:        matrixRows[i].Date,
+			BillName:    matrixRows[i].BillName,
+			PaidBy:      matrixRows[i].PaidBy,
+			TotalAmount: matrixRows[i].TotalAmount,
+			Share:       utils.Round(share),
+			Paid:        utils.Round(paid),
+		})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Date < rows[j].Date
+	})
+	return rows
+}
+
 // createSummarySheet creates Sheet 1: Summary
 func (s *ExcelService) createSummarySheet(f *excelize.File, trip *models.Trip, expenses []*models.Expense, settlementResult *models.SettlementResult) error {
 	sheetName := "Summary"
@@ -109,17 +248,12 @@ func (s *ExcelService) createSummarySheet(f *excelize.File, trip *models.Trip, e
 	f.SetActiveSheet(sheetIndex)
 
 	// Calculate person summaries
-	summaries := s.calculatePersonSummaries(expenses)
-
-	// Sort summaries by name for consistent output
-	sort.Slice(summaries, func(i, j int) bool {
-		return summaries[i].Name < summaries[j].Name
-	})
+	summaries := sortedPersonSummaries(expenses, trip.Currency)
 
 	// Set headers
 	headers := []string{"Person", "Total Spent", "Total Owed", "Net Balance"}
 	for i, header := range headers {
-		cell := fmt.Sprintf("%s1", string(rune('A'+i)))
+		cell := cellName(i+1, 1)
 		f.SetCellValue(sheetName, cell, header)
 	}
 
@@ -128,7 +262,7 @@ func (s *ExcelService) createSummarySheet(f *excelize.File, trip *models.Trip, e
 		Font: &excelize.Font{Bold: true},
 		Fill: excelize.Fill{Type: "pattern", Color: []string{"E6F3FF"}, Pattern: 1},
 	})
-	f.SetCellStyle(sheetName, "A1", fmt.Sprintf("%s1", string(rune('A'+len(headers)-1))), headerStyle)
+	f.SetCellStyle(sheetName, "A1", cellName(len(headers), 1), headerStyle)
 
 	// Add summary data
 	for i, summary := range summaries {
@@ -152,7 +286,7 @@ func (s *ExcelService) createSummarySheet(f *excelize.File, trip *models.Trip, e
 	settlementsStartRow++
 	settlementHeaders := []string{"From", "To", "Amount"}
 	for i, header := range settlementHeaders {
-		cell := fmt.Sprintf("%s%d", string(rune('A'+i)), settlementsStartRow)
+		cell := cellName(i+1, settlementsStartRow)
 		f.SetCellValue(sheetName, cell, header)
 	}
 	f.SetCellStyle(sheetName, fmt.Sprintf("A%d", settlementsStartRow), fmt.Sprintf("C%d", settlementsStartRow), headerStyle)
@@ -165,6 +299,28 @@ func (s *ExcelService) createSummarySheet(f *excelize.File, trip *models.Trip, e
 		f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), settlement.Amount)
 	}
 
+	// Add category totals section
+	categoriesStartRow := settlementsStartRow + len(settlementResult.Settlements) + 2
+	f.SetCellValue(sheetName, fmt.Sprintf("A%d", categoriesStartRow), "Spend by Category:")
+	f.SetCellStyle(sheetName, fmt.Sprintf("A%d", categoriesStartRow), fmt.Sprintf("A%d", categoriesStartRow), settlementHeaderStyle)
+
+	// Category headers
+	categoriesStartRow++
+	categoryHeaders := []string{"Category", "Expenses", "Total"}
+	for i, header := range categoryHeaders {
+		cell := cellName(i+1, categoriesStartRow)
+		f.SetCellValue(sheetName, cell, header)
+	}
+	f.SetCellStyle(sheetName, fmt.Sprintf("A%d", categoriesStartRow), fmt.Sprintf("C%d", categoriesStartRow), headerStyle)
+
+	// Category data
+	for i, category := range summarizeCategories(expenses) {
+		row := categoriesStartRow + 1 + i
+		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), utils.FormatNameForDisplay(category.Category))
+		f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), category.Count)
+		f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), category.Total)
+	}
+
 	// Auto-fit columns
 	f.SetColWidth(sheetName, "A", "D", 15)
 
@@ -177,34 +333,16 @@ func (s *ExcelService) createExpenseMatrixSheet(f *excelize.File, trip *models.T
 	f.NewSheet(sheetName)
 
 	// Get all participants
-	participantSet := make(map[string]bool)
-	for _, expense := range expenses {
-		if expense.SplitType == utils.SplitTypeEqual {
-			for _, person := range expense.SplitAmong {
-				participantSet[utils.FormatNameForDisplay(person)] = true
-			}
-		} else {
-			for _, item := range expense.Items {
-				for _, consumer := range item.Consumers {
-					participantSet[utils.FormatNameForDisplay(consumer)] = true
-				}
-			}
-		}
-	}
-
-	// Convert to sorted slice
-	var participants []string
-	for participant := range participantSet {
-		participants = append(participants, participant)
-	}
-	sort.Strings(participants)
+	participants := matrixParticipants(expenses)
 
 	// Set headers
-	headers := []string{"Date", "Bill Name", "Paid By", "Total Amount"}
+	headers := []string{"Date", "Bill Name", "Paid By", "Added By", "Total Amount"}
 	headers = append(headers, participants...)
+	headers = append(headers, "Notes")
+	notesCol := columnName(len(headers))
 
 	for i, header := range headers {
-		cell := fmt.Sprintf("%s1", string(rune('A'+i)))
+		cell := cellName(i+1, 1)
 		f.SetCellValue(sheetName, cell, header)
 	}
 
@@ -213,16 +351,11 @@ func (s *ExcelService) createExpenseMatrixSheet(f *excelize.File, trip *models.T
 		Font: &excelize.Font{Bold: true},
 		Fill: excelize.Fill{Type: "pattern", Color: []string{"E6F3FF"}, Pattern: 1},
 	})
-	lastCol := string(rune('A' + len(headers) - 1))
+	lastCol := columnName(len(headers))
 	f.SetCellStyle(sheetName, "A1", fmt.Sprintf("%s1", lastCol), headerStyle)
 
 	// Calculate expense matrix
-	matrixRows := s.calculateExpenseMatrix(expenses, participants)
-
-	// Sort by date
-	sort.Slice(matrixRows, func(i, j int) bool {
-		return matrixRows[i].Date < matrixRows[j].Date
-	})
+	matrixRows := s.sortedExpenseMatrix(expenses, participants, trip.Currency)
 
 	// Add expense data
 	for i, row := range matrixRows {
@@ -230,23 +363,26 @@ func (s *ExcelService) createExpenseMatrixSheet(f *excelize.File, trip *models.T
 		f.SetCellValue(sheetName, fmt.Sprintf("A%d", excelRow), row.Date)
 		f.SetCellValue(sheetName, fmt.Sprintf("B%d", excelRow), row.BillName)
 		f.SetCellValue(sheetName, fmt.Sprintf("C%d", excelRow), row.PaidBy)
-		f.SetCellValue(sheetName, fmt.Sprintf("D%d", excelRow), row.TotalAmount)
+		f.SetCellValue(sheetName, fmt.Sprintf("D%d", excelRow), row.AddedBy)
+		f.SetCellValue(sheetName, fmt.Sprintf("E%d", excelRow), row.TotalAmount)
 
 		// Add person amounts
 		for j, participant := range participants {
-			col := string(rune('E' + j))
+			cell := cellName(6+j, excelRow) // After the five fixed columns A-E
 			amount := row.PersonAmounts[participant]
 			if amount > 0 {
-				f.SetCellValue(sheetName, fmt.Sprintf("%s%d", col, excelRow), amount)
+				f.SetCellValue(sheetName, cell, amount)
 			} else {
-				f.SetCellValue(sheetName, fmt.Sprintf("%s%d", col, excelRow), 0)
+				f.SetCellValue(sheetName, cell, 0)
 			}
 		}
+		f.SetCellValue(sheetName, fmt.Sprintf("%s%d", notesCol, excelRow), row.Notes)
 	}
 
 	// Auto-fit columns
 	f.SetColWidth(sheetName, "A", lastCol, 12)
 	f.SetColWidth(sheetName, "B", "B", 20) // Bill name column wider
+	f.SetColWidth(sheetName, notesCol, notesCol, 40)
 
 	return nil
 }
@@ -259,7 +395,7 @@ func (s *ExcelService) createPaymentSheet(f *excelize.File, payments []models.Pa
 	// Set headers
 	headers := []string{"From", "To", "Amount"}
 	for i, header := range headers {
-		cell := fmt.Sprintf("%s1", string(rune('A'+i)))
+		cell := cellName(i+1, 1)
 		f.SetCellValue(sheetName, cell, header)
 	}
 
@@ -284,155 +420,57 @@ func (s *ExcelService) createPaymentSheet(f *excelize.File, payments []models.Pa
 	return nil
 }
 
-// calculatePersonSummaries calculates spending summary for each person
-func (s *ExcelService) calculatePersonSummaries(expenses []*models.Expense) []PersonSummary {
-	summaryMap := make(map[string]*PersonSummary)
-
+// matrixParticipants returns the sorted display names of everyone sharing in the expenses
+func matrixParticipants(expenses []*models.Expense) []string {
+	participantSet := make(map[string]bool)
 	for _, expense := range expenses {
 		if expense.SplitType == utils.SplitTypeEqual {
-			s.processEqualExpenseForSummary(expense, summaryMap)
-		} else {
-			s.processItemExpenseForSummary(expense, summaryMap)
-		}
-	}
-
-	// Convert map to slice
-	var summaries []PersonSummary
-	for _, summary := range summaryMap {
-		summary.NetBalance = summary.TotalSpent - summary.TotalOwed
-		summaries = append(summaries, *summary)
-	}
-
-	return summaries
-}
-
-// processEqualExpenseForSummary processes equal split expense for summary
-func (s *ExcelService) processEqualExpenseForSummary(expense *models.Expense, summaryMap map[string]*PersonSummary) {
-	paidBy := utils.FormatNameForDisplay(expense.PaidBy)
-	
-	// Initialize payer if not exists
-	if _, exists := summaryMap[paidBy]; !exists {
-		summaryMap[paidBy] = &PersonSummary{Name: paidBy}
-	}
-	
-	// Add to total spent
-	summaryMap[paidBy].TotalSpent += expense.Amount
-
-	// Calculate share per person
-	sharePerPerson := expense.Amount / float64(len(expense.SplitAmong))
-
-	// Add to each person's owed amount
-	for _, person := range expense.SplitAmong {
-		formattedName := utils.FormatNameForDisplay(person)
-		if _, exists := summaryMap[formattedName]; !exists {
-			summaryMap[formattedName] = &PersonSummary{Name: formattedName}
-		}
-		summaryMap[formattedName].TotalOwed += sharePerPerson
-	}
-}
-
-// processItemExpenseForSummary processes item-based expense for summary
-func (s *ExcelService) processItemExpenseForSummary(expense *models.Expense, summaryMap map[string]*PersonSummary) {
-	// Process each item
-	for _, item := range expense.Items {
-		paidBy := utils.FormatNameForDisplay(item.PaidBy)
-		
-		// Initialize payer if not exists
-		if _, exists := summaryMap[paidBy]; !exists {
-			summaryMap[paidBy] = &PersonSummary{Name: paidBy}
-		}
-		
-		// Add to total spent
-		summaryMap[paidBy].TotalSpent += item.Amount
-
-		// Calculate share per consumer
-		sharePerPerson := item.Amount / float64(len(item.Consumers))
-
-		// Add to each consumer's owed amount
-		for _, consumer := range item.Consumers {
-			formattedName := utils.FormatNameForDisplay(consumer)
-			if _, exists := summaryMap[formattedName]; !exists {
-				summaryMap[formattedName] = &PersonSummary{Name: formattedName}
-			}
-			summaryMap[formattedName].TotalOwed += sharePerPerson
-		}
-	}
-
-	// Handle extra charges (tax, service, discount)
-	extraCharges := expense.Tax + expense.ServiceCharge - expense.TotalDiscount
-	if extraCharges != 0 {
-		// Find primary payer
-		primaryPayer := s.findPrimaryPayerForSummary(expense)
-		formattedPayer := utils.FormatNameForDisplay(primaryPayer)
-		
-		if _, exists := summaryMap[formattedPayer]; !exists {
-			summaryMap[formattedPayer] = &PersonSummary{Name: formattedPayer}
-		}
-		
-		// Add extra charges to spending
-		summaryMap[formattedPayer].TotalSpent += extraCharges
-
-		// Distribute extra charges proportionally
-		personItemTotals := make(map[string]float64)
-		var totalItemAmount float64
-
-		// Calculate each person's item consumption
-		for _, item := range expense.Items {
-			sharePerPerson := item.Amount / float64(len(item.Consumers))
-			for _, consumer := range item.Consumers {
-				formattedName := utils.FormatNameForDisplay(consumer)
-				personItemTotals[formattedName] += sharePerPerson
+			for _, person := range expense.SplitAmong {
+				participantSet[utils.FormatNameForDisplay(person)] = true
 			}
-			totalItemAmount += item.Amount
-		}
-
-		// Distribute extra charges proportionally
-		if totalItemAmount > 0 {
-			for person, itemTotal := range personItemTotals {
-				proportion := itemTotal / totalItemAmount
-				extraChargeShare := extraCharges * proportion
-				
-				if _, exists := summaryMap[person]; !exists {
-					summaryMap[person] = &PersonSummary{Name: person}
+		} else {
+			for _, item := range expense.Items {
+				for _, consumer := range item.Consumers {
+					participantSet[utils.FormatNameForDisplay(consumer)] = true
 				}
-				summaryMap[person].TotalOwed += extraChargeShare
 			}
 		}
 	}
-}
 
-// findPrimaryPayerForSummary finds the primary payer for an expense
-func (s *ExcelService) findPrimaryPayerForSummary(expense *models.Expense) string {
-	payerAmounts := make(map[string]float64)
-	for _, item := range expense.Items {
-		payerAmounts[item.PaidBy] += item.Amount
+	var participants []string
+	for participant := range participantSet {
+		participants = append(participants, participant)
 	}
+	sort.Strings(participants)
 
-	var primaryPayer string
-	var maxAmount float64
-	for payer, amount := range payerAmounts {
-		if amount > maxAmount {
-			maxAmount = amount
-			primaryPayer = payer
-		}
-	}
+	return participants
+}
 
-	if primaryPayer == "" {
-		primaryPayer = expense.PaidBy
-	}
+// sortedExpenseMatrix calculates the expense matrix sorted by date
+func (s *ExcelService) sortedExpenseMatrix(expenses []*models.Expense, participants []string, currency string) []ExpenseMatrixRow {
+	matrixRows := s.calculateExpenseMatrix(expenses, participants, currency)
+	sort.SliceStable(matrixRows, func(i, j int) bool {
+		return matrixRows[i].Date < matrixRows[j].Date
+	})
+	return matrixRows
+}
 
-	return primaryPayer
+// formatExpenseDate formats an expense creation time (Unix milliseconds) as a calendar date
+func formatExpenseDate(creationTime int64) string {
+	return time.Unix(creationTime/1000, 0).Format("2006-01-02")
 }
 
-// calculateExpenseMatrix calculates the expense matrix data
-func (s *ExcelService) calculateExpenseMatrix(expenses []*models.Expense, participants []string) []ExpenseMatrixRow {
+// calculateExpenseMatrix calculates the expense matrix data in the trip currency
+func (s *ExcelService) calculateExpenseMatrix(expenses []*models.Expense, participants []string, currency string) []ExpenseMatrixRow {
 	var rows []ExpenseMatrixRow
 
 	for _, expense := range expenses {
 		row := ExpenseMatrixRow{
-			Date:          time.Unix(expense.CreationTime/1000, 0).Format("2006-01-02"),
+			Date:          formatExpenseDate(expense.CreationTime),
 			BillName:      expense.Description,
 			PaidBy:        utils.FormatNameForDisplay(expense.PaidBy),
+			AddedBy:       utils.FormatNameForDisplay(expense.CreatedBy),
+			Notes:         expense.Notes,
 			TotalAmount:   expense.Amount,
 			PersonAmounts: make(map[string]float64),
 		}
@@ -445,7 +483,7 @@ func (s *ExcelService) calculateExpenseMatrix(expenses []*models.Expense, partic
 		if expense.SplitType == utils.SplitTypeEqual {
 			s.calculateEqualSplitMatrix(expense, &row)
 		} else {
-			s.calculateItemSplitMatrix(expense, &row)
+			s.calculateItemSplitMatrix(expense, &row, currency)
 		}
 
 		rows = append(rows, row)
@@ -465,44 +503,22 @@ func (s *ExcelService) calculateEqualSplitMatrix(expense *models.Expense, row *E
 }
 
 // calculateItemSplitMatrix calculates matrix for item-based split expense
-func (s *ExcelService) calculateItemSplitMatrix(expense *models.Expense, row *ExpenseMatrixRow) {
-	// Calculate item amounts per person
-	for _, item := range expense.Items {
-		sharePerPerson := item.Amount / float64(len(item.Consumers))
-		for _, consumer := range item.Consumers {
-			formattedName := utils.FormatNameForDisplay(consumer)
-			row.PersonAmounts[formattedName] += sharePerPerson
-		}
+func (s *ExcelService) calculateItemSplitMatrix(expense *models.Expense, row *ExpenseMatrixRow, currency string) {
+	for consumer, allocation := range allocateItemSplit(expense.Items, expenseCharges(expense, currency)) {
+		formattedName := utils.FormatNameForDisplay(consumer)
+		row.PersonAmounts[formattedName] = utils.RoundForCurrency(row.PersonAmounts[formattedName]+allocation.Total, currency)
 	}
+}
 
-	// Handle extra charges proportionally
-	extraCharges := expense.Tax + expense.ServiceCharge - expense.TotalDiscount
-	if extraCharges != 0 {
-		// Calculate each person's proportion of items
-		personItemTotals := make(map[string]float64)
-		var totalItemAmount float64
-
-		for _, item := range expense.Items {
-			sharePerPerson := item.Amount / float64(len(item.Consumers))
-			for _, consumer := range item.Consumers {
-				formattedName := utils.FormatNameForDisplay(consumer)
-				personItemTotals[formattedName] += sharePerPerson
-			}
-			totalItemAmount += item.Amount
-		}
-
-		// Distribute extra charges proportionally
-		if totalItemAmount > 0 {
-			for person, itemTotal := range personItemTotals {
-				proportion := itemTotal / totalItemAmount
-				extraChargeShare := extraCharges * proportion
-				row.PersonAmounts[person] += extraChargeShare
-			}
-		}
-	}
+// cellName returns the A1-style reference of a 1-based column and row, continuing
+// past column Z as AA, AB and so on
+func cellName(col, row int) string {
+	name, _ := excelize.CoordinatesToCellName(col, row)
+	return name
+}
 
-	// Round all amounts
-	for person, amount := range row.PersonAmounts {
-		row.PersonAmounts[person] = utils.Round(amount)
-	}
-}
\ No newline at end of file
+// columnName returns the letters of a 1-based column, e.g. 28 is "AB"
+func columnName(col int) string {
+	name, _ := excelize.ColumnNumberToName(col)
+	return name
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestExcelService_CalculateStatement(t *testing.T) {
+	day1 := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC).UnixMilli()
+	day2 := time.Date(2024, 3, 11, 12, 0, 0, 0, time.UTC).UnixMilli()
+	expenses := []*models.Expense{
+		{CreationTime: day2, Description: "Taxi", Amount: 40, PaidBy: "Bob", SplitType: "equal", SplitAmong: []string{"Alice", "Bob"}},
+		{CreationTime: day1, Description: "Dinner", Amount: 90, PaidBy: "Alice", SplitType: "equal", SplitAmong: []string{"Alice", "Bob", "Carol"}},
+		{CreationTime: day1, Description: "Museum", Amount: 30, PaidBy: "Carol", SplitType: "equal", SplitAmong: []string{"Carol"}},
+		{CreationTime: day2, Description: "Gift for Carol", Amount: 20, PaidBy: "Alice", SplitType: "equal", SplitAmong: []string{"Bob"}},
+	}
+
+	rows := (&ExcelService{}).calculateStatement(expenses, "alice", "")
+
+	assert.Equal(t, []StatementRow{
+		{Date: formatExpenseDate(day1), BillName: "Dinner", PaidBy: "Alice", TotalAmount: 90, Share: 30, Paid: 90},
+		{Date: formatExpenseDate(day2), BillName: "Taxi", PaidBy: "Bob", TotalAmount: 40, Share: 20, Paid: 0},
+		{Date: formatExpenseDate(day2), BillName: "Gift for Carol", PaidBy: "Alice", TotalAmount: 20, Share: 0, Paid: 20},
+	}, rows)
+}
+
+func TestExcelService_CreateStatementSheet(t *testing.T) {
+	expenses := []*models.Expense{
+		{CreationTime: 1, Description: "Dinner", Amount: 90, PaidBy: "Alice", SplitType: "equal", SplitAmong: []string{"Alice", "Bob", "Carol"}},
+	}
+
+	f, filename, err := (&ExcelService{}).exportStatement(&models.Trip{Name: "Bali Trip", Participants: []string{"alice", "bob", "carol"}}, expenses, "Bob")
+
+	assert.NoError(t, err)
+	assert.Contains(t, filename, "Bali_Trip_Bob_Statement_")
+	assert.Equal(t, []string{"Statement"}, f.GetSheetList())
+	net, _ := f.GetCellValue("Statement", "F6")
+	assert.Equal(t, "-30", net)
+}
+
+func TestExcelService_CreateExpenseMatrixSheet_ManyParticipants(t *testing.T) {
+	participants := make([]string, 30)
+	for i := range participants {
+		participants[i] = fmt.Sprintf("person %02d", i+1)
+	}
+	expenses := []*models.Expense{
+		{CreationTime: 1, Description: "Villa", Amount: 3000, PaidBy: "person 01", SplitType: "equal", SplitAmong: participants, Notes: "Deposit paid"},
+	}
+
+	f := excelize.NewFile()
+	err := (&ExcelService{}).createExpenseMatrixSheet(f, &models.Trip{Participants: participants}, expenses)
+	assert.NoError(t, err)
+
+	// Five fixed columns, then participants from F through AI and notes in AJ
+	header, _ := f.GetCellValue("Expense Matrix", "Z1")
+	assert.Equal(t, "Person 21", header)
+	header, _ = f.GetCellValue("Expense Matrix", "AI1")
+	assert.Equal(t, "Person 30", header)
+	share, _ := f.GetCellValue("Expense Matrix", "AI2")
+	assert.Equal(t, "100", share)
+	notes, _ := f.GetCellValue("Expense Matrix", "AJ2")
+	assert.Equal(t, "Deposit paid", notes)
+}
@@ -1,7 +1,12 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/fadhlanhapp/sharetab-backend/models"
 	"github.com/fadhlanhapp/sharetab-backend/repository"
@@ -17,40 +22,451 @@ func InitExpenseService() {
 
 // ExpenseService handles expense-related business logic
 type ExpenseService struct {
-	repo *repository.ExpenseRepository
+	repo        *repository.ExpenseRepository
+	tripRepo    *repository.TripRepository
+	webhooks    *WebhookNotifier
+	settlements *settlementCache // Invalidated when a trip's expenses change
 }
 
 // NewExpenseService creates a new expense service instance
 func NewExpenseService() *ExpenseService {
 	return &ExpenseService{
-		repo: repository.NewExpenseRepository(),
+		repo:        repository.NewExpenseRepository(),
+		tripRepo:    repository.NewTripRepository(),
+		webhooks:    NewWebhookNotifier(),
+		settlements: sharedSettlementCache,
 	}
 }
 
 // GetExpenses returns all expenses for a trip with formatted names
 func (s *ExpenseService) GetExpenses(tripID string) ([]*models.Expense, error) {
-	expenses, err := s.repo.GetExpenses(tripID)
+	expenses, err := s.repo.GetExpenses(tripID, repository.ExpenseListOptions{})
 	if err != nil {
 		return nil, utils.NewInternalError("Failed to retrieve expenses")
 	}
 
-	// Format names for display
+	return s.formatExpensesForDisplay(expenses), nil
+}
+
+// ListExpenses returns a page of a trip's expenses matching the request filters
+// with formatted names, along with the total number of matching expenses
+func (s *ExpenseService) ListExpenses(tripID string, request *models.ListExpensesRequest) ([]*models.Expense, int, error) {
+	if request.FromDate > 0 && request.ToDate > 0 && request.FromDate > request.ToDate {
+		return nil, 0, utils.NewValidationError("fromDate must not be after toDate")
+	}
+
+	// Searches surface recent matches first unless a sort order was requested
+	search := strings.ToLower(strings.TrimSpace(request.Search))
+	descending := request.Sort == "desc" || (request.Sort == "" && search != "")
+
+	opts := repository.ExpenseListOptions{
+		Limit:      request.Limit,
+		Offset:     request.Offset,
+		Descending: descending,
+		FromDate:   request.FromDate,
+		ToDate:     request.ToDate,
+		PaidBy:     utils.NormalizeName(request.PaidBy),
+		Search:     search,
+	}
+
+	expenses, err := s.repo.GetExpenses(tripID, opts)
+	if err != nil {
+		return nil, 0, utils.NewInternalError("Failed to retrieve expenses")
+	}
+
+	total, err := s.repo.CountExpenses(tripID, opts)
+	if err != nil {
+		return nil, 0, utils.NewInternalError("Failed to retrieve expenses")
+	}
+
+	formatted := s.formatExpensesForDisplay(expenses)
+	for _, expense := range formatted {
+		reconcileExpenseAmount(expense)
+	}
+
+	return formatted, total, nil
+}
+
+// expenseReconcileTolerance is how far a stored amount may drift from its recomputed
+// total, from rounding, before the expense is reported as not reconciled
+const expenseReconcileTolerance = 0.01
+
+// reconcileExpenseAmount compares an expense's stored amount with the total recomputed
+// from its parts and records the result on the expense. Stored data is untouched.
+func reconcileExpenseAmount(expense *models.Expense) {
+	discrepancy := utils.Round(expense.Amount - expense.ExpectedAmount())
+	reconciled := math.Abs(discrepancy) <= expenseReconcileTolerance
+	expense.Reconciled = &reconciled
+	if !reconciled {
+		expense.Discrepancy = discrepancy
+	}
+}
+
+// formatExpensesForDisplay formats names for display in a list of expenses
+func (s *ExpenseService) formatExpensesForDisplay(expenses []*models.Expense) []*models.Expense {
+	// Expenses are listed per trip, so the trip's aliases are looked up once
+	var aliases utils.NameAliases
+	if len(expenses) > 0 {
+		aliases = tripAliases(s.tripRepo, expenses[0].TripID)
+	}
+
 	formattedExpenses := make([]*models.Expense, len(expenses))
 	for i, expense := range expenses {
-		formattedExpenses[i] = s.formatExpenseForDisplay(expense)
+		formattedExpenses[i] = formatExpenseWithAliases(expense, aliases)
 	}
-
-	return formattedExpenses, nil
+	return formattedExpenses
 }
 
 // StoreExpense stores an expense for a trip
+// If the expense carries an idempotency key already used in its trip, the
+// previously stored expense is copied into expense instead of inserting again
 func (s *ExpenseService) StoreExpense(expense *models.Expense) error {
+	if expense.IdempotencyKey != "" {
+		existing, err := s.repo.GetExpenseByIdempotencyKey(expense.TripID, expense.IdempotencyKey)
+		if err != nil {
+			return utils.NewInternalError("Failed to store expense")
+		}
+		if existing != nil {
+			*expense = *existing
+			return nil
+		}
+	}
+
 	if err := s.repo.StoreExpense(expense); err != nil {
+		if errors.Is(err, repository.ErrTripNotFound) {
+			return utils.NewNotFoundError("Trip")
+		}
+		// A concurrent retry may have stored the same key between the lookup and the insert
+		if expense.IdempotencyKey != "" {
+			existing, lookupErr := s.repo.GetExpenseByIdempotencyKey(expense.TripID, expense.IdempotencyKey)
+			if lookupErr == nil && existing != nil {
+				*expense = *existing
+				return nil
+			}
+		}
 		return utils.NewInternalError("Failed to store expense")
 	}
+
+	s.settlements.invalidate(expense.TripID)
+	s.notifyExpenseAdded(expense)
+	return nil
+}
+
+// notifyExpenseAdded posts an expense.added event to the trip's webhook, if it has one
+// The trip lookup and delivery run in the background
+func (s *ExpenseService) notifyExpenseAdded(expense *models.Expense) {
+	if s.webhooks == nil || s.tripRepo == nil {
+		return
+	}
+
+	tripID := expense.TripID
+	payer := utils.FormatNameForDisplay(expense.PaidBy)
+	if expense.CreatedBy != "" {
+		payer = utils.FormatNameForDisplay(expense.CreatedBy)
+	}
+	description := expense.Description
+	amount := expense.Amount
+
+	go func() {
+		trip, err := s.tripRepo.GetTripWebhook(tripID)
+		if err != nil {
+			slog.Error("Webhook lookup failed", "operation", "notify_expense_added", "tripId", tripID, "error", err)
+			return
+		}
+
+		summary := fmt.Sprintf("%s added %q for %s", payer, description, utils.FormatAmountForCurrency(amount, trip.Currency))
+		s.webhooks.Notify(trip.WebhookURL, NewWebhookEvent(WebhookEventExpenseAdded, trip.Code, summary))
+	}()
+}
+
+// BulkValidationError lists every expense in a bulk import that failed validation
+type BulkValidationError struct {
+	Errors []models.BulkExpenseError
+}
+
+func (e *BulkValidationError) Error() string {
+	return fmt.Sprintf("%d of the expenses are invalid", len(e.Errors))
+}
+
+// BulkStoreExpenses validates every payload up front and then stores all of them,
+// along with any new participants, in a single transaction. It returns the new
+// expense IDs in request order, or a *BulkValidationError if any payload is invalid.
+func (s *ExpenseService) BulkStoreExpenses(trip *models.Trip, payloads []models.BulkExpensePayload) ([]string, error) {
+	expenses := make([]*models.Expense, 0, len(payloads))
+	var validationErrors []models.BulkExpenseError
+
+	keys := make(map[string]bool)
+	for i, payload := range payloads {
+		// Items that name no consumers are shared by the trip's default consumers
+		applyDefaultConsumers(trip, payload.Items)
+		expense, err := s.createBulkExpense(trip.Code, payload)
+		if err == nil {
+			expense.TripID = trip.ID
+			resolveExpenseAliases(expense, trip.Aliases)
+			err = s.ValidateExtrasSplitAmong(trip, expense)
+		}
+		if err == nil && expense.IdempotencyKey != "" {
+			if keys[expense.IdempotencyKey] {
+				err = utils.NewValidationError("idempotencyKey is used by another expense in this import")
+			}
+			keys[expense.IdempotencyKey] = true
+		}
+		if err != nil {
+			validationErrors = append(validationErrors, models.BulkExpenseError{Index: i, Error: err.Error()})
+			continue
+		}
+		expenses = append(expenses, expense)
+	}
+
+	if len(validationErrors) > 0 {
+		return nil, &BulkValidationError{Errors: validationErrors}
+	}
+
+	// Expenses already stored under their idempotency key, by an earlier attempt at
+	// this import, are returned instead of being stored again
+	ids := make([]string, len(expenses))
+	var pending []*models.Expense
+	for i, expense := range expenses {
+		if expense.IdempotencyKey != "" {
+			existing, err := s.repo.GetExpenseByIdempotencyKey(trip.ID, expense.IdempotencyKey)
+			if err != nil {
+				return nil, utils.NewInternalError("Failed to store expenses")
+			}
+			if existing != nil {
+				ids[i] = existing.ID
+				continue
+			}
+		}
+		ids[i] = expense.ID
+		pending = append(pending, expense)
+	}
+	if len(pending) == 0 {
+		return ids, nil
+	}
+	expenses = pending
+
+	limit := maxParticipants()
+	if err := s.repo.BulkStoreExpenses(trip.ID, expenseParticipants(expenses), expenses, limit); err != nil {
+		if errors.Is(err, repository.ErrTripNotFound) {
+			return nil, utils.NewNotFoundError("Trip")
+		}
+		if errors.Is(err, repository.ErrTooManyParticipants) {
+			return nil, tooManyParticipantsError(limit)
+		}
+		return nil, utils.NewInternalError("Failed to store expenses")
+	}
+	s.settlements.invalidate(trip.ID)
+
+	for _, expense := range expenses {
+		s.notifyExpenseAdded(expense)
+	}
+	return ids, nil
+}
+
+// createBulkExpense builds and validates an expense from a bulk import payload
+func (s *ExpenseService) createBulkExpense(code string, payload models.BulkExpensePayload) (*models.Expense, error) {
+	switch payload.SplitType {
+	case utils.SplitTypeEqual:
+		return s.CreateEqualExpense(&models.AddEqualExpenseRequest{
+			Code:          code,
+			Description:   payload.Description,
+			Subtotal:      payload.Subtotal,
+			Tax:           payload.Tax,
+			ServiceCharge: payload.ServiceCharge,
+			TotalDiscount: payload.TotalDiscount,
+			PaidBy:        payload.PaidBy,
+			SplitAmong:    payload.SplitAmong,
+			Category:      payload.Category,
+			TaxInclusive:  payload.TaxInclusive,
+			CreatedBy:     payload.CreatedBy,
+			Notes:         payload.Notes,
+
+			TaxOnServiceCharge: payload.TaxOnServiceCharge,
+			PaidByShares:       payload.PaidByShares,
+			IdempotencyKey:     payload.IdempotencyKey,
+		})
+	case utils.SplitTypeItems:
+		return s.CreateItemsExpense(&models.AddItemsExpenseRequest{
+			Code:          code,
+			Description:   payload.Description,
+			Tax:           payload.Tax,
+			ServiceCharge: payload.ServiceCharge,
+			TotalDiscount: payload.TotalDiscount,
+			Items:         payload.Items,
+			Category:      payload.Category,
+			TaxInclusive:  payload.TaxInclusive,
+			CreatedBy:     payload.CreatedBy,
+			Notes:         payload.Notes,
+
+			TaxOnServiceCharge: payload.TaxOnServiceCharge,
+			ExtrasSplitMode:    payload.ExtrasSplitMode,
+			ExtrasSplitAmong:   payload.ExtrasSplitAmong,
+			IdempotencyKey:     payload.IdempotencyKey,
+		})
+	default:
+		return nil, utils.NewValidationError("splitType must be \"equal\" or \"items\"")
+	}
+}
+
+// ValidateKnownParticipants rejects an expense naming anyone, as payer or consumer,
+// who is not already a participant of the trip. The error lists the unknown names.
+func (s *ExpenseService) ValidateKnownParticipants(trip *models.Trip, expense *models.Expense) error {
+	known := participantKeys(trip)
+
+	var unknown []string
+	for _, name := range expenseParticipants([]*models.Expense{expense}) {
+		if !known[name] {
+			unknown = append(unknown, utils.FormatNameForDisplay(name))
+		}
+	}
+
+	if len(unknown) > 0 {
+		return utils.NewValidationError(fmt.Sprintf("Unknown participants: %s", strings.Join(unknown, ", ")))
+	}
+	return nil
+}
+
+// ValidateExtrasSplitAmong checks that everyone chosen to share an item split's extras
+// is a trip participant or takes part in the expense itself
+func (s *ExpenseService) ValidateExtrasSplitAmong(trip *models.Trip, expense *models.Expense) error {
+	known := participantKeys(trip)
+	for _, name := range expenseParticipants([]*models.Expense{expense}) {
+		known[name] = true
+	}
+
+	var unknown []string
+	for _, name := range expense.ExtrasSplitAmong {
+		if !known[name] {
+			unknown = append(unknown, utils.FormatNameForDisplay(name))
+		}
+	}
+	if len(unknown) > 0 {
+		return utils.NewValidationError(fmt.Sprintf("extrasSplitAmong must name trip participants, unknown: %s", strings.Join(unknown, ", ")))
+	}
 	return nil
 }
 
+// uniqueNames drops empty and repeated names, keeping the first occurrence; nil when none remain
+func uniqueNames(names []string) []string {
+	var unique []string
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		unique = append(unique, name)
+	}
+	return unique
+}
+
+// expenseParticipants returns every normalized name that pays or shares in the expenses
+func expenseParticipants(expenses []*models.Expense) []string {
+	seen := make(map[string]bool)
+	var participants []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			participants = append(participants, name)
+		}
+	}
+
+	for _, expense := range expenses {
+		for _, payer := range expense.Payers() {
+			add(payer)
+		}
+		for _, person := range expense.SplitAmong {
+			add(person)
+		}
+		for _, item := range expense.Items {
+			add(item.PaidBy)
+			for _, consumer := range item.Consumers {
+				add(consumer)
+			}
+		}
+	}
+
+	return participants
+}
+
+// DuplicateExpense stores a copy of one of the trip's expenses under a fresh ID and
+// creation time, optionally overriding the description and payer. A new payer joins
+// the trip once the source expense has been found.
+func (s *ExpenseService) DuplicateExpense(tripID string, request *models.DuplicateExpenseRequest) (*models.Expense, error) {
+	source, err := s.GetExpense(tripID, request.ExpenseID)
+	if err != nil {
+		return nil, err
+	}
+
+	duplicate := cloneExpense(source)
+	duplicate.ID = utils.GenerateID()
+	duplicate.CreationTime = time.Now().UnixMilli()
+	duplicate.IdempotencyKey = ""
+	duplicate.Status = ""
+	duplicate.ConfirmedBy = ""
+
+	if description := strings.TrimSpace(request.Description); description != "" {
+		duplicate.Description = description
+	}
+	if paidBy := utils.NormalizeName(request.PaidBy); paidBy != "" {
+		if err := addTripParticipant(s.tripRepo, tripID, paidBy); err != nil {
+			return nil, err
+		}
+		duplicate.PaidBy = paidBy
+		duplicate.PaidByShares = nil
+		for i := range duplicate.Items {
+			duplicate.Items[i].PaidBy = paidBy
+		}
+	}
+
+	if err := s.StoreExpense(duplicate); err != nil {
+		return nil, err
+	}
+
+	return s.formatExpenseForDisplay(duplicate), nil
+}
+
+// cloneExpense deep-copies an expense so the copy shares no slices or maps with the original
+func cloneExpense(expense *models.Expense) *models.Expense {
+	clone := *expense
+
+	if expense.SplitAmong != nil {
+		clone.SplitAmong = append([]string(nil), expense.SplitAmong...)
+	}
+	if expense.ExtrasSplitAmong != nil {
+		clone.ExtrasSplitAmong = append([]string(nil), expense.ExtrasSplitAmong...)
+	}
+
+	if expense.PaidByShares != nil {
+		clone.PaidByShares = make(map[string]float64, len(expense.PaidByShares))
+		for payer, share := range expense.PaidByShares {
+			clone.PaidByShares[payer] = share
+		}
+	}
+
+	if expense.Items != nil {
+		clone.Items = make([]models.Item, len(expense.Items))
+		for i, item := range expense.Items {
+			clone.Items[i] = item
+			clone.Items[i].Consumers = append([]string(nil), item.Consumers...)
+			if item.ConsumerWeights != nil {
+				clone.Items[i].ConsumerWeights = make(map[string]float64, len(item.ConsumerWeights))
+				for consumer, weight := range item.ConsumerWeights {
+					clone.Items[i].ConsumerWeights[consumer] = weight
+				}
+			}
+			if item.ConsumerQuantities != nil {
+				clone.Items[i].ConsumerQuantities = make(map[string]float64, len(item.ConsumerQuantities))
+				for consumer, quantity := range item.ConsumerQuantities {
+					clone.Items[i].ConsumerQuantities[consumer] = quantity
+				}
+			}
+		}
+	}
+
+	return &clone
+}
+
 // RemoveExpense removes an expense from a trip
 func (s *ExpenseService) RemoveExpense(tripID, expenseID string) error {
 	found, err := s.repo.RemoveExpense(tripID, expenseID)
@@ -60,9 +476,88 @@ func (s *ExpenseService) RemoveExpense(tripID, expenseID string) error {
 	if !found {
 		return utils.NewNotFoundError("Expense")
 	}
+	s.settlements.invalidate(tripID)
+
+	if err := RemoveExpenseAttachments(tripID, expenseID); err != nil {
+		slog.Warn("Failed to delete expense attachments", "operation", "remove_expense",
+			"tripId", tripID, "expenseId", expenseID, "error", err)
+	}
 	return nil
 }
 
+// GetExpense returns one of the trip's stored expenses, with names as stored
+func (s *ExpenseService) GetExpense(tripID, expenseID string) (*models.Expense, error) {
+	expense, err := s.repo.GetExpense(tripID, expenseID)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve expense")
+	}
+	if expense == nil {
+		return nil, utils.NewNotFoundError("Expense")
+	}
+	return expense, nil
+}
+
+// UpdateExpenseNotes replaces an expense's notes and returns the updated expense.
+// Notes are informational and leave settlements unchanged.
+func (s *ExpenseService) UpdateExpenseNotes(tripID string, request *models.UpdateExpenseNotesRequest) (*models.Expense, error) {
+	notes := strings.TrimSpace(request.Notes)
+	found, err := s.repo.UpdateNotes(tripID, request.ExpenseID, notes)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to update expense notes")
+	}
+	if !found {
+		return nil, utils.NewNotFoundError("Expense")
+	}
+
+	expense, err := s.repo.GetExpense(tripID, request.ExpenseID)
+	if err != nil || expense == nil {
+		return nil, utils.NewInternalError("Failed to retrieve expense")
+	}
+	return s.formatExpenseForDisplay(expense), nil
+}
+
+// ConfirmExpense marks a pending expense as confirmed so it counts toward settlements.
+// The confirming participant must belong to the trip and cannot be the person who
+// added the expense (its creator, or its payer when no creator was recorded).
+func (s *ExpenseService) ConfirmExpense(trip *models.Trip, request *models.ConfirmExpenseRequest) (*models.Expense, error) {
+	confirmedBy := utils.NameAliases(trip.Aliases).Key(request.ConfirmedBy)
+	if !participantKeys(trip)[confirmedBy] {
+		return nil, utils.NewValidationError(fmt.Sprintf("%s is not a participant in this trip", utils.FormatNameForDisplay(confirmedBy)))
+	}
+
+	expense, err := s.repo.GetExpense(trip.ID, request.ExpenseID)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve expense")
+	}
+	if expense == nil {
+		return nil, utils.NewNotFoundError("Expense")
+	}
+	if expense.Status == models.ExpenseStatusConfirmed {
+		return s.formatExpenseForDisplay(expense), nil
+	}
+
+	addedBy := expense.CreatedBy
+	if addedBy == "" {
+		addedBy = expense.PaidBy
+	}
+	if confirmedBy == addedBy {
+		return nil, utils.NewValidationError("Expense must be confirmed by someone other than the person who added it")
+	}
+
+	found, err := s.repo.ConfirmExpense(trip.ID, expense.ID, confirmedBy)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to confirm expense")
+	}
+	if !found {
+		return nil, utils.NewNotFoundError("Expense")
+	}
+	s.settlements.invalidate(trip.ID)
+
+	expense.Status = models.ExpenseStatusConfirmed
+	expense.ConfirmedBy = confirmedBy
+	return s.formatExpenseForDisplay(expense), nil
+}
+
 // CreateEqualExpense creates an equal split expense with validation
 func (s *ExpenseService) CreateEqualExpense(request *models.AddEqualExpenseRequest) (*models.Expense, error) {
 	if err := s.validateEqualExpenseRequest(request); err != nil {
@@ -86,10 +581,54 @@ func (s *ExpenseService) CreateEqualExpense(request *models.AddEqualExpenseReque
 		normalizedPaidBy,
 		normalizedSplitAmong,
 	)
+	if request.TaxInclusive {
+		expense.TaxInclusive = true
+		expense.Amount = expense.Subtotal + expense.ExtraCharges()
+	}
+	if request.TaxOnServiceCharge {
+		// Tax is then charged on the service charge at the same rate as on the subtotal
+		expense.TaxOnServiceCharge = true
+		expense.Tax = utils.Round(expense.Tax + serviceChargeTax(expense.Tax, expense.ServiceCharge, expense.Subtotal))
+		expense.Amount = utils.Round(expense.Subtotal + expense.ExtraCharges())
+	}
+	if len(request.PaidByShares) > 0 {
+		if err := s.applyPayerShares(expense, request.PaidByShares); err != nil {
+			return nil, err
+		}
+	}
+	expense.Category = utils.NormalizeCategory(request.Category)
+	expense.CreatedBy = utils.NormalizeName(request.CreatedBy)
+	expense.Notes = strings.TrimSpace(request.Notes)
+	expense.IdempotencyKey = strings.TrimSpace(request.IdempotencyKey)
 
 	return expense, nil
 }
 
+// applyPayerShares records what each of several payers paid toward an equal split.
+// PaidBy defaults to the payer who paid the most and must otherwise be one of them.
+func (s *ExpenseService) applyPayerShares(expense *models.Expense, shares map[string]float64) error {
+	if err := utils.ValidatePayerShares(shares, expense.Amount); err != nil {
+		return err
+	}
+
+	expense.PaidByShares = make(map[string]float64, len(shares))
+	for payer, share := range shares {
+		expense.PaidByShares[utils.NormalizeName(payer)] += utils.Round(share)
+	}
+
+	if expense.PaidBy == "" {
+		for _, payer := range expense.Payers() {
+			if expense.PaidBy == "" || expense.PaidByShares[payer] > expense.PaidByShares[expense.PaidBy] {
+				expense.PaidBy = payer
+			}
+		}
+	}
+	if _, ok := expense.PaidByShares[expense.PaidBy]; !ok {
+		return utils.NewValidationError("paidBy must be one of the payers in paidByShares")
+	}
+	return nil
+}
+
 // CreateItemsExpense creates an items-based expense with validation
 func (s *ExpenseService) CreateItemsExpense(request *models.AddItemsExpenseRequest) (*models.Expense, error) {
 	if err := s.validateItemsExpenseRequest(request); err != nil {
@@ -115,17 +654,50 @@ func (s *ExpenseService) CreateItemsExpense(request *models.AddItemsExpenseReque
 		paidBy,
 		processedItems,
 	)
+	if request.TaxInclusive && request.Tax > subtotal {
+		return nil, utils.NewValidationError("included tax cannot exceed the subtotal")
+	}
+	if err := utils.ValidateTotalDiscount(request.TotalDiscount, subtotal, expense.Tax+expense.ItemTax(), expense.ServiceCharge, request.TaxInclusive); err != nil {
+		return nil, err
+	}
+	// Tax-inclusive bills only add extras on top of the subtotal; item tax rates add to the bill
+	expense.TaxInclusive = request.TaxInclusive
+	if request.TaxOnServiceCharge {
+		expense.TaxOnServiceCharge = true
+		expense.Tax = utils.Round(expense.Tax + serviceChargeTax(expense.Tax, expense.ServiceCharge, taxedSubtotal(expense.Items)))
+	}
+	expense.ExtrasSplitMode = request.ExtrasSplitMode
+	expense.ExtrasSplitAmong = uniqueNames(utils.NormalizeNames(request.ExtrasSplitAmong))
+	expense.Amount = utils.Round(expense.Subtotal + expense.ExtraCharges())
+	expense.Category = utils.NormalizeCategory(request.Category)
+	expense.CreatedBy = utils.NormalizeName(request.CreatedBy)
+	expense.Notes = strings.TrimSpace(request.Notes)
+	expense.IdempotencyKey = strings.TrimSpace(request.IdempotencyKey)
 
 	return expense, nil
 }
 
-// formatExpenseForDisplay formats expense names for display
+// formatExpenseForDisplay formats expense names for display, preferring the trip's aliases
 func (s *ExpenseService) formatExpenseForDisplay(expense *models.Expense) *models.Expense {
+	return formatExpenseWithAliases(expense, tripAliases(s.tripRepo, expense.TripID))
+}
+
+// formatExpenseWithAliases formats expense names for display with the given aliases
+func formatExpenseWithAliases(expense *models.Expense, aliases utils.NameAliases) *models.Expense {
 	formatted := *expense
-	formatted.PaidBy = utils.FormatNameForDisplay(expense.PaidBy)
+	formatted.PaidBy = aliases.Format(expense.PaidBy)
+	formatted.CreatedBy = aliases.Format(expense.CreatedBy)
+	formatted.ConfirmedBy = aliases.Format(expense.ConfirmedBy)
+	formatted.NameKeys = aliases.NameKeys(expenseNames(expense)...)
 
 	if len(expense.SplitAmong) > 0 {
-		formatted.SplitAmong = utils.FormatNamesForDisplay(expense.SplitAmong)
+		formatted.SplitAmong = aliases.FormatNames(expense.SplitAmong)
+	}
+	if len(expense.ExtrasSplitAmong) > 0 {
+		formatted.ExtrasSplitAmong = aliases.FormatNames(expense.ExtrasSplitAmong)
+	}
+	if len(expense.PaidByShares) > 0 {
+		formatted.PaidByShares = utils.FormatNameMapKeysWith(expense.PaidByShares, aliases)
 	}
 
 	if len(expense.Items) > 0 {
@@ -137,8 +709,15 @@ func (s *ExpenseService) formatExpenseForDisplay(expense *models.Expense) *model
 				Quantity:     item.Quantity,
 				Amount:       item.Amount,
 				ItemDiscount: item.ItemDiscount,
-				PaidBy:       utils.FormatNameForDisplay(item.PaidBy),
-				Consumers:    utils.FormatNamesForDisplay(item.Consumers),
+				PaidBy:       aliases.Format(item.PaidBy),
+				Consumers:    aliases.FormatNames(item.Consumers),
+				TaxRate:      item.TaxRate,
+			}
+			if item.ConsumerWeights != nil {
+				formattedItems[j].ConsumerWeights = utils.FormatNameMapKeysWith(item.ConsumerWeights, aliases)
+			}
+			if item.ConsumerQuantities != nil {
+				formattedItems[j].ConsumerQuantities = utils.FormatNameMapKeysWith(item.ConsumerQuantities, aliases)
 			}
 		}
 		formatted.Items = formattedItems
@@ -147,6 +726,47 @@ func (s *ExpenseService) formatExpenseForDisplay(expense *models.Expense) *model
 	return &formatted
 }
 
+// ResolveAliases maps the trip's display names used in a new expense, such as
+// nicknames, back to the participants' stored names
+func (s *ExpenseService) ResolveAliases(trip *models.Trip, expense *models.Expense) {
+	resolveExpenseAliases(expense, trip.Aliases)
+}
+
+// resolveExpenseAliases maps every name in an expense through aliases.Key
+func resolveExpenseAliases(expense *models.Expense, aliases utils.NameAliases) {
+	if len(aliases) == 0 {
+		return
+	}
+
+	expense.PaidBy = aliases.Key(expense.PaidBy)
+	expense.CreatedBy = aliases.Key(expense.CreatedBy)
+	expense.SplitAmong = aliases.Keys(expense.SplitAmong)
+	expense.ExtrasSplitAmong = aliases.Keys(expense.ExtrasSplitAmong)
+	expense.PaidByShares = utils.KeyNameMapKeys(expense.PaidByShares, aliases)
+	for i := range expense.Items {
+		item := &expense.Items[i]
+		item.PaidBy = aliases.Key(item.PaidBy)
+		item.Consumers = aliases.Keys(item.Consumers)
+		item.ConsumerWeights = utils.KeyNameMapKeys(item.ConsumerWeights, aliases)
+		item.ConsumerQuantities = utils.KeyNameMapKeys(item.ConsumerQuantities, aliases)
+	}
+}
+
+// expenseNames lists every stored name an expense mentions, possibly with repeats
+func expenseNames(expense *models.Expense) []string {
+	names := []string{expense.PaidBy, expense.CreatedBy, expense.ConfirmedBy}
+	names = append(names, expense.SplitAmong...)
+	names = append(names, expense.ExtrasSplitAmong...)
+	for payer := range expense.PaidByShares {
+		names = append(names, payer)
+	}
+	for _, item := range expense.Items {
+		names = append(names, item.PaidBy)
+		names = append(names, item.Consumers...)
+	}
+	return names
+}
+
 // processExpenseItems processes items for an expense and returns processed items, subtotal and paidBy
 func (s *ExpenseService) processExpenseItems(items []models.Item) ([]models.Item, float64, string, error) {
 	var subtotal float64
@@ -162,6 +782,18 @@ func (s *ExpenseService) processExpenseItems(items []models.Item) ([]models.Item
 			return nil, 0, "", utils.NewValidationError(fmt.Sprintf("Item %d: missing paidBy or consumers", i+1))
 		}
 
+		if err := utils.ValidateConsumerWeights(item.ConsumerWeights, item.Consumers); err != nil {
+			return nil, 0, "", utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
+		}
+
+		if err := utils.ValidateConsumerQuantities(item.ConsumerQuantities, item.Consumers, item.Quantity); err != nil {
+			return nil, 0, "", utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
+		}
+
+		if err := utils.ValidateTaxRate(item.TaxRate); err != nil {
+			return nil, 0, "", utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
+		}
+
 		// Normalize names
 		normalizedPaidBy := utils.NormalizeName(item.PaidBy)
 		normalizedConsumers := utils.NormalizeNames(item.Consumers)
@@ -172,23 +804,32 @@ func (s *ExpenseService) processExpenseItems(items []models.Item) ([]models.Item
 		}
 
 		// Calculate item amount
-		itemAmount := item.UnitPrice*float64(item.Quantity) - item.ItemDiscount
+		itemAmount := item.UnitPrice*item.Quantity - item.ItemDiscount
 		itemAmount = utils.Round(itemAmount)
 		subtotal += itemAmount
 
 		// Store processed item
 		processedItems[i] = models.Item{
-			Description:  item.Description,
-			UnitPrice:    item.UnitPrice,
-			Quantity:     item.Quantity,
-			Amount:       itemAmount,
-			ItemDiscount: item.ItemDiscount,
-			PaidBy:       normalizedPaidBy,
-			Consumers:    normalizedConsumers,
+			Description:        item.Description,
+			UnitPrice:          item.UnitPrice,
+			Quantity:           item.Quantity,
+			Amount:             itemAmount,
+			ItemDiscount:       item.ItemDiscount,
+			PaidBy:             normalizedPaidBy,
+			Consumers:          normalizedConsumers,
+			ConsumerWeights:    utils.NormalizeNameMapKeys(item.ConsumerWeights),
+			ConsumerQuantities: utils.NormalizeNameMapKeys(item.ConsumerQuantities),
+			TaxRate:            item.TaxRate,
 		}
 	}
 
-	return processedItems, utils.Round(subtotal), paidBy, nil
+	// Negative lines (refunds, coupons) are allowed as long as the bill stays positive
+	subtotal = utils.Round(subtotal)
+	if err := utils.ValidateItemsSubtotal(subtotal); err != nil {
+		return nil, 0, "", err
+	}
+
+	return processedItems, subtotal, paidBy, nil
 }
 
 // validateEqualExpenseRequest validates an equal expense request
@@ -205,15 +846,26 @@ func (s *ExpenseService) validateEqualExpenseRequest(request *models.AddEqualExp
 	if err := utils.ValidateNonNegative(request.Tax, "tax"); err != nil {
 		return err
 	}
+	if request.TaxInclusive && request.Tax > request.Subtotal {
+		return utils.NewValidationError("included tax cannot exceed the subtotal")
+	}
+	if err := utils.ValidateTaxOnServiceCharge(request.TaxOnServiceCharge, request.TaxInclusive); err != nil {
+		return err
+	}
 	if err := utils.ValidateNonNegative(request.ServiceCharge, "service charge"); err != nil {
 		return err
 	}
 	if err := utils.ValidateNonNegative(request.TotalDiscount, "discount"); err != nil {
 		return err
 	}
-	if err := utils.ValidateRequired(request.PaidBy, "paidBy"); err != nil {
+	if err := utils.ValidateTotalDiscount(request.TotalDiscount, request.Subtotal, request.Tax, request.ServiceCharge, request.TaxInclusive); err != nil {
 		return err
 	}
+	if len(request.PaidByShares) == 0 {
+		if err := utils.ValidateRequired(request.PaidBy, "paidBy"); err != nil {
+			return err
+		}
+	}
 	if err := utils.ValidateNotEmpty(request.SplitAmong, "splitAmong"); err != nil {
 		return err
 	}
@@ -240,6 +892,14 @@ func (s *ExpenseService) validateItemsExpenseRequest(request *models.AddItemsExp
 	if err := utils.ValidateNonNegative(request.TotalDiscount, "discount"); err != nil {
 		return err
 	}
+	if err := utils.ValidateTaxOnServiceCharge(request.TaxOnServiceCharge, request.TaxInclusive); err != nil {
+		return err
+	}
+	switch request.ExtrasSplitMode {
+	case "", models.ExtrasSplitProportional, models.ExtrasSplitEqual:
+	default:
+		return utils.NewValidationError("extrasSplitMode must be \"proportional\" or \"equal\"")
+	}
 	if err := utils.ValidateNotEmpty(request.Items, "items"); err != nil {
 		return err
 	}
@@ -258,6 +918,15 @@ func (s *ExpenseService) validateItemsExpenseRequest(request *models.AddItemsExp
 		if err := utils.ValidateParticipantNames(item.Consumers); err != nil {
 			return utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
 		}
+		if err := utils.ValidateConsumerWeights(item.ConsumerWeights, item.Consumers); err != nil {
+			return utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
+		}
+		if err := utils.ValidateConsumerQuantities(item.ConsumerQuantities, item.Consumers, item.Quantity); err != nil {
+			return utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
+		}
+		if err := utils.ValidateItemDiscount(item.ItemDiscount, item.UnitPrice, item.Quantity); err != nil {
+			return utils.NewValidationError(fmt.Sprintf("Item %d: %s", i+1, err.Error()))
+		}
 	}
 
 	return nil
@@ -265,15 +934,26 @@ func (s *ExpenseService) validateItemsExpenseRequest(request *models.AddItemsExp
 
 // Legacy functions for backward compatibility
 func GetExpenses(tripID string) ([]*models.Expense, error) {
-	return expenseRepo.GetExpenses(tripID)
+	return expenseRepo.GetExpenses(tripID, repository.ExpenseListOptions{})
 }
 
 func StoreExpense(expense *models.Expense) error {
-	return expenseRepo.StoreExpense(expense)
+	service := NewExpenseService()
+	if err := service.repo.StoreExpense(expense); err != nil {
+		return err
+	}
+	service.settlements.invalidate(expense.TripID)
+	service.notifyExpenseAdded(expense)
+	return nil
 }
 
 func RemoveExpense(tripID string, expenseID string) (bool, error) {
-	return expenseRepo.RemoveExpense(tripID, expenseID)
+	service := NewExpenseService()
+	found, err := service.repo.RemoveExpense(tripID, expenseID)
+	if found {
+		service.settlements.invalidate(tripID)
+	}
+	return found, err
 }
 
 func Round(num float64) float64 {
@@ -317,7 +997,7 @@ func ConvertReceiptItemToExpenseItem(receiptItem models.ReceiptItem, paidBy stri
 	return models.Item{
 		Description:  receiptItem.Name,
 		UnitPrice:    receiptItem.Price,
-		Quantity:     int(receiptItem.Quantity),
+		Quantity:     receiptItem.Quantity,
 		ItemDiscount: receiptItem.Discount,
 		PaidBy:       utils.NormalizeName(paidBy),
 		Consumers:    utils.NormalizeNames(consumers),
@@ -0,0 +1,580 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockExpenseService(t *testing.T) (*ExpenseService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return &ExpenseService{repo: &repository.ExpenseRepository{DB: db}}, mock
+}
+
+func TestExpenseService_BulkStoreExpenses_ReportsEveryInvalidIndex(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+	trip := &models.Trip{ID: "trip1", Code: "ABC123"}
+
+	payloads := []models.BulkExpensePayload{
+		{SplitType: "equal", Description: "Taxi", Subtotal: 30, PaidBy: "alice", SplitAmong: []string{"alice", "bob"}},
+		{SplitType: "equal", Description: "", Subtotal: 30, PaidBy: "alice", SplitAmong: []string{"alice"}},
+		{SplitType: "refund", Description: "Oops"},
+	}
+
+	ids, err := service.BulkStoreExpenses(trip, payloads)
+
+	assert.Nil(t, ids)
+	var validationErr *BulkValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Len(t, validationErr.Errors, 2)
+	assert.Equal(t, 1, validationErr.Errors[0].Index)
+	assert.Equal(t, 2, validationErr.Errors[1].Index)
+
+	// Nothing touches the database when validation fails
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_BulkStoreExpenses_StoresAllInOneTransaction(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+	trip := &models.Trip{ID: "trip1", Code: "ABC123"}
+
+	payloads := []models.BulkExpensePayload{
+		{SplitType: "equal", Description: "Taxi", Subtotal: 30, PaidBy: "Alice", SplitAmong: []string{"Alice", "Bob"}},
+		{SplitType: "items", Description: "Lunch", Items: []models.Item{
+			{Description: "Noodles", UnitPrice: 20, Quantity: 1, PaidBy: "Bob", Consumers: []string{"Bob"}},
+		}},
+	}
+
+	mock.ExpectBegin()
+	expectTripLock(mock, "trip1")
+	for i, participant := range []string{"alice", "bob"} {
+		expectParticipantCount(mock, "trip1", participant, i, false)
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO trip_participants")).
+			WithArgs("trip1", participant).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expenses")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expense_participants")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expense_participants")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expenses")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO expenses_items")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO item_consumers")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	ids, err := service.BulkStoreExpenses(trip, payloads)
+
+	assert.NoError(t, err)
+	assert.Len(t, ids, 2)
+	assert.NotEqual(t, ids[0], ids[1])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_BulkStoreExpenses_KeepsIdempotencyKeysAndDefaultConsumers(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+	trip := &models.Trip{ID: "trip1", Code: "ABC123", Participants: []string{"alice", "bob"}, DefaultConsumers: []string{"alice", "bob"}}
+
+	payloads := []models.BulkExpensePayload{
+		{SplitType: "equal", Description: "Taxi", Subtotal: 30, PaidBy: "alice", SplitAmong: []string{"alice", "bob"}, IdempotencyKey: "taxi-1"},
+		{SplitType: "items", Description: "Lunch", ExtrasSplitMode: "equal", Items: []models.Item{
+			{Description: "Noodles", UnitPrice: 20, Quantity: 1, PaidBy: "bob"},
+		}},
+	}
+
+	// The taxi was stored by an earlier attempt, so only lunch is inserted
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expenses WHERE trip_id = $1 AND idempotency_key = $2")).WithArgs("trip1", "taxi-1").
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow("old1", "trip1", "Taxi", 30, 30, 0, 0, 0, "alice", "equal", 1, nil, "taxi-1", "", false, "", "pending", "", nil, "", false))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT participant FROM expense_participants")).WithArgs("old1").
+		WillReturnRows(sqlmock.NewRows([]string{"participant"}).AddRow("alice").AddRow("bob"))
+	expectPayerShares(mock, "old1")
+	mock.ExpectBegin()
+	expectTripLock(mock, "trip1")
+	for _, participant := range []string{"bob", "alice"} {
+		expectParticipantCount(mock, "trip1", participant, 2, true)
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO trip_participants")).WithArgs("trip1", participant).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expenses")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO expenses_items")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	for i, consumer := range []string{"alice", "bob"} {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO item_consumers")).WithArgs(7, consumer, 1.0, sqlmock.AnyArg(), i).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	ids, err := service.BulkStoreExpenses(trip, payloads)
+
+	assert.NoError(t, err)
+	assert.Len(t, ids, 2)
+	assert.Equal(t, "old1", ids[0])
+	assert.NotEqual(t, "old1", ids[1])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_BulkStoreExpenses_RollsBackOnStoreFailure(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+	trip := &models.Trip{ID: "trip1", Code: "ABC123"}
+
+	payloads := []models.BulkExpensePayload{
+		{SplitType: "equal", Description: "Taxi", Subtotal: 30, PaidBy: "alice", SplitAmong: []string{"alice"}},
+	}
+
+	mock.ExpectBegin()
+	expectTripLock(mock, "trip1")
+	expectParticipantCount(mock, "trip1", "alice", 0, false)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO trip_participants")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expenses")).WillReturnError(errors.New("connection lost"))
+	mock.ExpectRollback()
+
+	ids, err := service.BulkStoreExpenses(trip, payloads)
+
+	assert.Nil(t, ids)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_StoreExpense_UnknownTrip(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+	expense := models.NewEqualExpense("exp1", "deleted-trip", "Taxi", 30, 0, 0, 0, "alice", []string{"alice", "bob"})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expenses")).
+		WillReturnError(&pq.Error{Code: "23503", Message: `insert or update on table "expenses" violates foreign key constraint`})
+	mock.ExpectRollback()
+
+	err := service.StoreExpense(expense)
+
+	var appErr *utils.AppError
+	assert.ErrorAs(t, err, &appErr)
+	assert.Equal(t, http.StatusNotFound, appErr.Code)
+	assert.Equal(t, "Trip not found", appErr.Message)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_ValidateExtrasSplitAmong(t *testing.T) {
+	service := &ExpenseService{}
+	trip := &models.Trip{ID: "trip1", Participants: []string{"Alice", "Bob"}}
+	expense := &models.Expense{
+		SplitType: "items",
+		PaidBy:    "alice",
+		Items:     []models.Item{{Description: "Pizza", Amount: 30, PaidBy: "alice", Consumers: []string{"alice", "carol"}}},
+	}
+
+	// Carol is new to the trip but takes part in the expense
+	expense.ExtrasSplitAmong = []string{"bob", "carol"}
+	assert.NoError(t, service.ValidateExtrasSplitAmong(trip, expense))
+
+	expense.ExtrasSplitAmong = []string{"bob", "erin"}
+	assert.EqualError(t, service.ValidateExtrasSplitAmong(trip, expense), "extrasSplitAmong must name trip participants, unknown: Erin")
+}
+
+func TestExpenseService_FormatExpenseForDisplay_IncludesNameKeys(t *testing.T) {
+	service := &ExpenseService{}
+	expense := &models.Expense{
+		SplitType: "items",
+		PaidBy:    "maria del carmen",
+		Items: []models.Item{
+			{Description: "Paella", Amount: 30, PaidBy: "maria del carmen", Consumers: []string{"maria del carmen", "jo"}},
+		},
+	}
+
+	formatted := service.formatExpenseForDisplay(expense)
+
+	assert.Equal(t, "Maria del Carmen", formatted.PaidBy)
+	assert.Equal(t, map[string]string{"Maria del Carmen": "maria del carmen", "Jo": "jo"}, formatted.NameKeys)
+	assert.Nil(t, expense.NameKeys)
+}
+
+func TestCloneExpense_DeepCopiesItems(t *testing.T) {
+	original := &models.Expense{
+		ID:         "exp1",
+		SplitAmong: []string{"alice", "bob"},
+		Items: []models.Item{
+			{Description: "Pizza", Consumers: []string{"alice", "bob"}, ConsumerWeights: map[string]float64{"alice": 2}},
+		},
+	}
+
+	clone := cloneExpense(original)
+	clone.SplitAmong[0] = "carol"
+	clone.Items[0].Description = "Pasta"
+	clone.Items[0].Consumers[0] = "carol"
+	clone.Items[0].ConsumerWeights["alice"] = 5
+
+	assert.Equal(t, "alice", original.SplitAmong[0])
+	assert.Equal(t, "Pizza", original.Items[0].Description)
+	assert.Equal(t, "alice", original.Items[0].Consumers[0])
+	assert.Equal(t, 2.0, original.Items[0].ConsumerWeights["alice"])
+}
+
+func TestExpenseService_DuplicateExpense_RejectsExpenseFromAnotherTrip(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+
+	// The trip has no expense with the requested ID, so the new payer isn't added either
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expenses WHERE trip_id = $1 AND id = $2")).
+		WithArgs("trip1", "other").
+		WillReturnRows(sqlmock.NewRows(nil))
+
+	expense, err := service.DuplicateExpense("trip1", &models.DuplicateExpenseRequest{Code: "ABC123", ExpenseID: "other", PaidBy: "Dave"})
+
+	assert.Nil(t, expense)
+	assert.Equal(t, utils.NewNotFoundError("Expense"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_ListExpenses_SearchMatchesDescriptionNewestFirst(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expenses WHERE trip_id = $1 AND paid_by = $2 AND description ILIKE $3 ORDER BY creation_time DESC")).
+		WithArgs("trip1", "alice", "%sushi\\_bar%").
+		WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM expenses WHERE trip_id = $1 AND paid_by = $2 AND description ILIKE $3")).
+		WithArgs("trip1", "alice", "%sushi\\_bar%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	expenses, total, err := service.ListExpenses("trip1", &models.ListExpensesRequest{
+		Code:   "ABC123",
+		PaidBy: "Alice",
+		Search: "  Sushi_Bar ",
+	})
+
+	assert.NoError(t, err)
+	assert.Empty(t, expenses)
+	assert.NotNil(t, expenses)
+	assert.Equal(t, 0, total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_ValidateKnownParticipants(t *testing.T) {
+	service := &ExpenseService{}
+	trip := &models.Trip{ID: "trip1", Code: "ABC123", Participants: []string{"alice", "bob"}}
+
+	known := &models.Expense{
+		SplitType: "items",
+		PaidBy:    "alice",
+		Items: []models.Item{
+			{Description: "Dinner", Amount: 30, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+		},
+	}
+	assert.NoError(t, service.ValidateKnownParticipants(trip, known))
+
+	typo := &models.Expense{
+		SplitType: "items",
+		PaidBy:    "alise",
+		Items: []models.Item{
+			{Description: "Dinner", Amount: 30, PaidBy: "alise", Consumers: []string{"alice", "bobb", "carol"}},
+		},
+	}
+	err := service.ValidateKnownParticipants(trip, typo)
+	assert.EqualError(t, err, "Unknown participants: Alise, Bobb, Carol")
+}
+
+func TestExpenseService_ValidateKnownParticipants_AliasedTrip(t *testing.T) {
+	service := &ExpenseService{}
+	expense := &models.Expense{SplitType: "equal", PaidBy: "leonardo dicaprio", SplitAmong: []string{"leonardo dicaprio", "bob"}}
+
+	assert.NoError(t, service.ValidateKnownParticipants(newAliasedTrip(), expense))
+
+	expense.SplitAmong = append(expense.SplitAmong, "leo")
+	assert.EqualError(t, service.ValidateKnownParticipants(newAliasedTrip(), expense), "Unknown participants: Leo")
+}
+
+func TestExpenseService_CreateEqualExpense_DiscountLimit(t *testing.T) {
+	service := &ExpenseService{}
+	request := func(discount float64) *models.AddEqualExpenseRequest {
+		return &models.AddEqualExpenseRequest{
+			Code:          "ABC123",
+			Description:   "Dinner",
+			Subtotal:      100,
+			Tax:           10,
+			ServiceCharge: 5,
+			TotalDiscount: discount,
+			PaidBy:        "alice",
+			SplitAmong:    []string{"alice", "bob"},
+		}
+	}
+
+	_, err := service.CreateEqualExpense(request(115))
+	assert.NoError(t, err)
+
+	_, err = service.CreateEqualExpense(request(116))
+	assert.EqualError(t, err, "discount 116 cannot exceed the subtotal plus tax and service charge (115)")
+}
+
+func TestExpenseService_CreateEqualExpense_TaxOnServiceCharge(t *testing.T) {
+	service := &ExpenseService{}
+	request := &models.AddEqualExpenseRequest{
+		Code:               "ABC123",
+		Description:        "Dinner",
+		Subtotal:           200,
+		Tax:                20,
+		ServiceCharge:      10,
+		PaidBy:             "alice",
+		SplitAmong:         []string{"alice", "bob"},
+		TaxOnServiceCharge: true,
+	}
+
+	expense, err := service.CreateEqualExpense(request)
+
+	assert.NoError(t, err)
+	assert.True(t, expense.TaxOnServiceCharge)
+	assert.Equal(t, 21.0, expense.Tax) // 10% of 200 + 10
+	assert.Equal(t, 231.0, expense.Amount)
+	assert.Equal(t, expense.ExpectedAmount(), expense.Amount)
+}
+
+func TestExpenseService_CreateItemsExpense_DiscountLimits(t *testing.T) {
+	service := &ExpenseService{}
+	request := func(itemDiscount, totalDiscount float64) *models.AddItemsExpenseRequest {
+		return &models.AddItemsExpenseRequest{
+			Code:        "ABC123",
+			Description: "Groceries",
+			Items: []models.Item{
+				{Description: "Rice", UnitPrice: 25, Quantity: 2, ItemDiscount: itemDiscount, PaidBy: "alice", Consumers: []string{"alice"}},
+				{Description: "Eggs", UnitPrice: 30, Quantity: 1, PaidBy: "alice", Consumers: []string{"bob"}},
+			},
+			Tax:           8,
+			TotalDiscount: totalDiscount,
+		}
+	}
+
+	_, err := service.CreateItemsExpense(request(50, 38))
+	assert.NoError(t, err)
+
+	_, err = service.CreateItemsExpense(request(50.01, 0))
+	assert.EqualError(t, err, "Item 1: item discount 50.01 cannot exceed the item total 50")
+
+	_, err = service.CreateItemsExpense(request(0, 88.5))
+	assert.EqualError(t, err, "discount 88.5 cannot exceed the subtotal plus tax and service charge (88)")
+}
+
+func TestExpenseService_CreateItemsExpense_FractionalQuantity(t *testing.T) {
+	service := &ExpenseService{}
+
+	expense, err := service.CreateItemsExpense(&models.AddItemsExpenseRequest{
+		Code:        "ABC123",
+		Description: "Market",
+		Items: []models.Item{
+			{Description: "Olive oil (L)", UnitPrice: 18000, Quantity: 1.25, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+			{Description: "Apples (kg)", UnitPrice: 30000, Quantity: 0.5, PaidBy: "alice", Consumers: []string{"bob"}},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1.25, expense.Items[0].Quantity)
+	assert.Equal(t, 22500.0, expense.Items[0].Amount)
+	assert.Equal(t, 15000.0, expense.Items[1].Amount)
+	assert.Equal(t, 37500.0, expense.Amount)
+}
+
+func TestConvertReceiptItemToExpenseItem_KeepsFractionalQuantity(t *testing.T) {
+	item := ConvertReceiptItemToExpenseItem(models.ReceiptItem{Name: "Beef 0.5 kg", Price: 250000, Quantity: 0.5, Discount: 5000}, "Alice", []string{"Alice", "Bob"})
+
+	assert.Equal(t, 0.5, item.Quantity)
+	assert.Equal(t, 120000.0, item.Amount)
+	assert.Equal(t, "alice", item.PaidBy)
+}
+
+func TestReconcileExpenseAmount(t *testing.T) {
+	consistent := &models.Expense{SplitType: "equal", Amount: 105, Subtotal: 100, Tax: 10, ServiceCharge: 5, TotalDiscount: 10}
+	reconcileExpenseAmount(consistent)
+	assert.True(t, *consistent.Reconciled)
+	assert.Zero(t, consistent.Discrepancy)
+
+	// A rounding cent is tolerated
+	rounded := &models.Expense{SplitType: "equal", Amount: 33.34, Subtotal: 33.33}
+	reconcileExpenseAmount(rounded)
+	assert.True(t, *rounded.Reconciled)
+
+	// The amount was edited without updating its parts
+	drifted := &models.Expense{SplitType: "equal", Amount: 150, Subtotal: 100, Tax: 10}
+	reconcileExpenseAmount(drifted)
+	assert.False(t, *drifted.Reconciled)
+	assert.Equal(t, float64(40), drifted.Discrepancy)
+	assert.Equal(t, float64(150), drifted.Amount)
+
+	inclusive := &models.Expense{SplitType: "equal", Amount: 110, Subtotal: 110, Tax: 10, TaxInclusive: true}
+	reconcileExpenseAmount(inclusive)
+	assert.True(t, *inclusive.Reconciled)
+}
+
+// expenseColumnNames lists the expense columns selected by the repository, in order
+var expenseColumnNames = []string{
+	"id", "trip_id", "description", "amount", "subtotal", "tax", "service_charge",
+	"total_discount", "paid_by", "split_type", "creation_time", "receipt_image", "idempotency_key",
+	"category", "tax_inclusive", "created_by", "status", "confirmed_by", "notes", "extras_split_mode",
+	"tax_on_service_charge",
+}
+
+// expectEqualExpense queues an equal-split expense row with its participants
+func expectEqualExpense(mock sqlmock.Sqlmock, id, paidBy string, amount float64, status string, splitAmong ...string) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expenses WHERE trip_id = $1 AND id = $2")).WithArgs("trip1", id).
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow(id, "trip1", "Dinner", amount, amount, 0, 0, 0, paidBy, "equal", 1, nil, nil, "", false, "", status, "", nil, "", false))
+	participants := sqlmock.NewRows([]string{"participant"})
+	for _, name := range splitAmong {
+		participants.AddRow(name)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT participant FROM expense_participants")).WithArgs(id).
+		WillReturnRows(participants)
+	expectPayerShares(mock, id)
+}
+
+// expectPayerShares expects the payer shares of an equal expense to be loaded,
+// given as alternating payer names and amounts; none means a single payer
+func expectPayerShares(mock sqlmock.Sqlmock, id string, shares ...interface{}) {
+	rows := sqlmock.NewRows([]string{"payer", "amount"})
+	for i := 0; i+1 < len(shares); i += 2 {
+		rows.AddRow(shares[i], shares[i+1])
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT payer, amount FROM expense_payers")).WithArgs(id).
+		WillReturnRows(rows)
+}
+
+func TestExpenseService_ConfirmExpense(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+	trip := &models.Trip{ID: "trip1", Participants: []string{"alice", "bob"}}
+
+	expectEqualExpense(mock, "exp1", "alice", 90, models.ExpenseStatusPending, "alice", "bob")
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE expenses SET status = $1, confirmed_by = $2 WHERE id = $3 AND trip_id = $4")).
+		WithArgs(models.ExpenseStatusConfirmed, "bob", "exp1", "trip1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expense, err := service.ConfirmExpense(trip, &models.ConfirmExpenseRequest{ExpenseID: "exp1", ConfirmedBy: "Bob"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.ExpenseStatusConfirmed, expense.Status)
+	assert.Equal(t, "Bob", expense.ConfirmedBy)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_ConfirmExpense_RequiresSecondParticipant(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+	trip := &models.Trip{ID: "trip1", Participants: []string{"alice", "bob"}}
+
+	expectEqualExpense(mock, "exp1", "alice", 90, models.ExpenseStatusPending, "alice", "bob")
+
+	_, err := service.ConfirmExpense(trip, &models.ConfirmExpenseRequest{ExpenseID: "exp1", ConfirmedBy: "alice"})
+	assert.Equal(t, utils.NewValidationError("Expense must be confirmed by someone other than the person who added it"), err)
+
+	_, err = service.ConfirmExpense(trip, &models.ConfirmExpenseRequest{ExpenseID: "exp1", ConfirmedBy: "dave"})
+	assert.Equal(t, utils.NewValidationError("Dave is not a participant in this trip"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_ConfirmExpense_AliasedTrip(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+	trip := newAliasedTrip()
+	trip.ID = "trip1"
+
+	expectEqualExpense(mock, "exp1", "bob", 90, models.ExpenseStatusPending, "leonardo dicaprio", "bob")
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE expenses SET status = $1, confirmed_by = $2 WHERE id = $3 AND trip_id = $4")).
+		WithArgs(models.ExpenseStatusConfirmed, "leonardo dicaprio", "exp1", "trip1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err := service.ConfirmExpense(trip, &models.ConfirmExpenseRequest{ExpenseID: "exp1", ConfirmedBy: "Leo"})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_UpdateExpenseNotes(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE expenses SET notes = $1 WHERE id = $2 AND trip_id = $3")).
+		WithArgs("Driver took cash only", "exp1", "trip1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expenses WHERE trip_id = $1 AND id = $2")).WithArgs("trip1", "exp1").
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow("exp1", "trip1", "Taxi", 40, 40, 0, 0, 0, "alice", "equal", 1, nil, nil, "", false, "", models.ExpenseStatusConfirmed, "bob", "Driver took cash only", "", false))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT participant FROM expense_participants")).WithArgs("exp1").
+		WillReturnRows(sqlmock.NewRows([]string{"participant"}).AddRow("alice").AddRow("bob"))
+	expectPayerShares(mock, "exp1")
+
+	expense, err := service.UpdateExpenseNotes("trip1", &models.UpdateExpenseNotesRequest{ExpenseID: "exp1", Notes: "  Driver took cash only "})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Driver took cash only", expense.Notes)
+	assert.Equal(t, float64(40), expense.Amount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_UpdateExpenseNotes_UnknownExpense(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE expenses SET notes = $1")).
+		WithArgs(sql.NullString{}, "missing", "trip1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := service.UpdateExpenseNotes("trip1", &models.UpdateExpenseNotesRequest{ExpenseID: "missing"})
+
+	assert.Equal(t, utils.NewNotFoundError("Expense"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenseService_CreateEqualExpense_PayerShares(t *testing.T) {
+	service := &ExpenseService{}
+	request := func(paidBy string, shares map[string]float64) *models.AddEqualExpenseRequest {
+		return &models.AddEqualExpenseRequest{
+			Code:         "ABC123",
+			Description:  "Villa",
+			Subtotal:     100,
+			Tax:          10,
+			PaidBy:       paidBy,
+			PaidByShares: shares,
+			SplitAmong:   []string{"alice", "bob", "carol"},
+		}
+	}
+
+	expense, err := service.CreateEqualExpense(request("", map[string]float64{"Alice": 40, "BOB": 70}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"alice": 40, "bob": 70}, expense.PaidByShares)
+	assert.Equal(t, "bob", expense.PaidBy)
+
+	expense, err = service.CreateEqualExpense(request("Alice", map[string]float64{"alice": 40, "bob": 70}))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", expense.PaidBy)
+
+	_, err = service.CreateEqualExpense(request("", map[string]float64{"alice": 40, "bob": 60}))
+	assert.EqualError(t, err, "payer shares add up to 100 but the expense total is 110")
+
+	_, err = service.CreateEqualExpense(request("carol", map[string]float64{"alice": 40, "bob": 70}))
+	assert.EqualError(t, err, "paidBy must be one of the payers in paidByShares")
+
+	_, err = service.CreateEqualExpense(request("", map[string]float64{"alice": 120, "bob": -10}))
+	assert.EqualError(t, err, "amount paid by bob must be positive")
+
+	// Without shares the single payer is still required
+	_, err = service.CreateEqualExpense(request("", nil))
+	assert.EqualError(t, err, "paidBy is required")
+}
+
+func TestExpenseService_GetExpense_LoadsPayerShares(t *testing.T) {
+	service, mock := newMockExpenseService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expenses WHERE trip_id = $1 AND id = $2")).WithArgs("trip1", "exp1").
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow("exp1", "trip1", "Villa", 110, 100, 10, 0, 0, "bob", "equal", 1, nil, nil, "", false, "", "confirmed", "", nil, "", false))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT participant FROM expense_participants")).WithArgs("exp1").
+		WillReturnRows(sqlmock.NewRows([]string{"participant"}).AddRow("alice").AddRow("bob"))
+	expectPayerShares(mock, "exp1", "alice", 40.0, "bob", 70.0)
+
+	expense, err := service.repo.GetExpense("trip1", "exp1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"alice": 40, "bob": 70}, expense.PaidByShares)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Receipt processing outcomes recorded by receiptProcessingTotal
+const (
+	receiptResultSuccess = "success"
+	receiptResultFailure = "failure"
+)
+
+// metricsRegistry holds the application's collectors. It is only exposed over HTTP
+// when METRICS_ENABLED is set; recording into it otherwise costs next to nothing.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sharetab_http_requests_total",
+		Help: "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sharetab_http_request_duration_seconds",
+		Help:    "HTTP request latency, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	receiptProcessingTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sharetab_receipt_processing_total",
+		Help: "Receipts processed with Claude, by result (success or failure).",
+	}, []string{"result"})
+
+	claudeAPILatency = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sharetab_claude_api_latency_seconds",
+		Help: "Latency of the most recent Claude API call.",
+	})
+
+	settlementDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sharetab_settlement_calculation_duration_seconds",
+		Help:    "Time spent computing settlements for a trip (cache misses only).",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		httpRequestsTotal,
+		httpRequestDuration,
+		receiptProcessingTotal,
+		claudeAPILatency,
+		settlementDuration,
+	)
+}
+
+// MetricsEnabled reports whether METRICS_ENABLED turns on the /metrics endpoint
+func MetricsEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("METRICS_ENABLED"))
+	return err == nil && enabled
+}
+
+// MetricsHandler serves the collected metrics in the Prometheus exposition format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTPRequest records a handled request against its route pattern
+func ObserveHTTPRequest(method, route string, status int, elapsed time.Duration) {
+	httpRequestsTotal.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpRequestDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// observeReceiptProcessing counts a processed receipt as a success or failure
+func observeReceiptProcessing(err error) {
+	result := receiptResultSuccess
+	if err != nil {
+		result = receiptResultFailure
+	}
+	receiptProcessingTotal.WithLabelValues(result).Inc()
+}
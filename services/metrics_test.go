@@ -0,0 +1,43 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsEnabled(t *testing.T) {
+	t.Setenv("METRICS_ENABLED", "")
+	assert.False(t, MetricsEnabled())
+
+	t.Setenv("METRICS_ENABLED", "not-a-bool")
+	assert.False(t, MetricsEnabled())
+
+	t.Setenv("METRICS_ENABLED", "true")
+	assert.True(t, MetricsEnabled())
+}
+
+func TestObserveReceiptProcessing(t *testing.T) {
+	successes := testutil.ToFloat64(receiptProcessingTotal.WithLabelValues(receiptResultSuccess))
+	failures := testutil.ToFloat64(receiptProcessingTotal.WithLabelValues(receiptResultFailure))
+
+	observeReceiptProcessing(nil)
+	observeReceiptProcessing(errors.New("invalid_receipt"))
+	observeReceiptProcessing(errors.New("claude_unavailable"))
+
+	assert.Equal(t, successes+1, testutil.ToFloat64(receiptProcessingTotal.WithLabelValues(receiptResultSuccess)))
+	assert.Equal(t, failures+2, testutil.ToFloat64(receiptProcessingTotal.WithLabelValues(receiptResultFailure)))
+}
+
+func TestObserveHTTPRequest_LabelsByRoute(t *testing.T) {
+	counter := httpRequestsTotal.WithLabelValues("GET", "/api/v1/trips/:code", "200")
+	before := testutil.ToFloat64(counter)
+
+	ObserveHTTPRequest("GET", "/api/v1/trips/:code", 200, 15*time.Millisecond)
+	ObserveHTTPRequest("GET", "/api/v1/trips/:code", 200, 25*time.Millisecond)
+
+	assert.Equal(t, before+2, testutil.ToFloat64(counter))
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"math"
+	"sort"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+)
+
+// minimalSettlementPeopleLimit is the group size from which the exhaustive search
+// becomes too expensive (it is exponential in people) and greedy is used instead
+const minimalSettlementPeopleLimit = 12
+
+// calculateMinimalSettlements finds settlements with the fewest transfers
+// It partitions people into as many zero-sum groups as possible, since a group of
+// n people can always settle with n-1 transfers, then settles each group greedily
+func (s *SettlementService) calculateMinimalSettlements(balances map[string]float64) []models.Settlement {
+	var people []PersonBalance
+	for person, balance := range balances {
+		if math.Round(balance*100) != 0 {
+			people = append(people, PersonBalance{Person: person, Balance: balance})
+		}
+	}
+	// Group in name order so the same balances always give the same settlements
+	sort.Slice(people, func(i, j int) bool { return people[i].Person < people[j].Person })
+
+	if len(people) >= minimalSettlementPeopleLimit {
+		return s.calculateOptimalSettlements(balances)
+	}
+
+	settlements := []models.Settlement{}
+	for _, group := range zeroSumGroups(people) {
+		groupBalances := make(map[string]float64, len(group))
+		for _, person := range group {
+			groupBalances[person.Person] = person.Balance
+		}
+		settlements = append(settlements, s.calculateOptimalSettlements(groupBalances)...)
+	}
+
+	return settlements
+}
+
+// zeroSumGroups splits people into the maximum number of groups whose balances sum to zero
+// Any rounding leftover ends up in the last group
+func zeroSumGroups(people []PersonBalance) [][]PersonBalance {
+	n := len(people)
+	if n == 0 {
+		return nil
+	}
+
+	// Work in cents so that sums compare exactly
+	cents := make([]int64, n)
+	for i, person := range people {
+		cents[i] = int64(math.Round(person.Balance * 100))
+	}
+
+	full := 1<<n - 1
+	sums := make([]int64, full+1)
+	groups := make([]int, full+1) // Max zero-sum groups that can be formed from a mask
+	for mask := 1; mask <= full; mask++ {
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 {
+				sums[mask] = sums[mask&^(1<<i)] + cents[i]
+				break
+			}
+		}
+
+		best := 0
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && groups[mask&^(1<<i)] > best {
+				best = groups[mask&^(1<<i)]
+			}
+		}
+		if sums[mask] == 0 {
+			best++
+		}
+		groups[mask] = best
+	}
+
+	// Rebuild an ordering of people in which every zero prefix sum closes a group
+	order := make([]int, 0, n)
+	for mask := full; mask != 0; {
+		gain := 0
+		if sums[mask] == 0 {
+			gain = 1
+		}
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && groups[mask&^(1<<i)]+gain == groups[mask] {
+				order = append(order, i)
+				mask &^= 1 << i
+				break
+			}
+		}
+	}
+
+	var result [][]PersonBalance
+	var current []PersonBalance
+	var running int64
+	for k := len(order) - 1; k >= 0; k-- {
+		i := order[k]
+		current = append(current, people[i])
+		running += cents[i]
+		if running == 0 {
+			result = append(result, current)
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		result = append(result, current)
+	}
+
+	return result
+}
@@ -2,8 +2,11 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"github.com/fadhlanhapp/sharetab-backend/models"
 	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"sort"
 	"strings"
 	"time"
 )
@@ -12,6 +15,8 @@ import (
 type PaymentService struct {
 	paymentRepo *repository.PaymentRepository
 	tripRepo    *repository.TripRepository
+	webhooks    *WebhookNotifier
+	settlements *settlementCache // Invalidated when a trip's payments change
 }
 
 // NewPaymentService creates a new payment service
@@ -19,36 +24,47 @@ func NewPaymentService(paymentRepo *repository.PaymentRepository, tripRepo *repo
 	return &PaymentService{
 		paymentRepo: paymentRepo,
 		tripRepo:    tripRepo,
+		webhooks:    NewWebhookNotifier(),
+		settlements: sharedSettlementCache,
 	}
 }
 
 // CreatePayment creates a new payment record
 func (s *PaymentService) CreatePayment(req *models.PaymentRequest) (*models.Payment, error) {
 	// Validate input
-	if strings.TrimSpace(req.FromPerson) == "" {
-		return nil, errors.New("from_person is required")
+	if err := validatePayment(req.FromPerson, req.ToPerson, req.Amount); err != nil {
+		return nil, err
 	}
-	if strings.TrimSpace(req.ToPerson) == "" {
-		return nil, errors.New("to_person is required")
+
+	// Get trip by code
+	trip, err := lookupTrip(s.tripRepo, req.Code)
+	if err != nil {
+		return nil, err
 	}
+
+	// Display names shown to clients, such as nicknames, refer to their participants
+	aliases := utils.NameAliases(trip.Aliases)
+	req.FromPerson, req.ToPerson = aliases.Key(req.FromPerson), aliases.Key(req.ToPerson)
 	if req.FromPerson == req.ToPerson {
 		return nil, errors.New("cannot pay to yourself")
 	}
-	if req.Amount <= 0 {
-		return nil, errors.New("amount must be greater than 0")
-	}
 
-	// Get trip by code
-	trip, err := s.tripRepo.GetTripByCode(req.Code)
-	if err != nil {
-		return nil, errors.New("trip not found: " + err.Error())
+	// Both people must belong to the trip unless new ones may be added
+	if req.AllowNew {
+		for _, person := range []string{req.FromPerson, req.ToPerson} {
+			if err := addTripParticipant(s.tripRepo, trip.ID, utils.NormalizeName(person)); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := validatePaymentParticipants(trip, req.FromPerson, req.ToPerson); err != nil {
+		return nil, err
 	}
 
 	// Create payment
 	payment := &models.Payment{
 		TripID:      trip.ID, // trip.ID is string, payment.TripID is now string
-		FromPerson:  strings.TrimSpace(req.FromPerson),
-		ToPerson:    strings.TrimSpace(req.ToPerson),
+		FromPerson:  utils.NormalizeName(req.FromPerson),
+		ToPerson:    utils.NormalizeName(req.ToPerson),
 		Amount:      req.Amount,
 		Description: strings.TrimSpace(req.Description),
 		PaymentDate: time.Now(),
@@ -59,21 +75,249 @@ func (s *PaymentService) CreatePayment(req *models.PaymentRequest) (*models.Paym
 	if err != nil {
 		return nil, err
 	}
+	s.settlements.invalidate(trip.ID)
+
+	s.notifyPaymentAdded(trip, payment)
 
+	formatPaymentForDisplay(payment)
 	return payment, nil
 }
 
+// BulkPaymentValidationError lists every payment in a bulk request that failed validation
+type BulkPaymentValidationError struct {
+	Errors []models.BulkPaymentError
+}
+
+func (e *BulkPaymentValidationError) Error() string {
+	return fmt.Sprintf("%d of the payments are invalid", len(e.Errors))
+}
+
+// BulkCreatePayments validates every payment up front and then stores all of them in
+// a single transaction, so a rejected payment means none are created
+func (s *PaymentService) BulkCreatePayments(req *models.BulkPaymentRequest) ([]models.Payment, error) {
+	// Get trip by code
+	trip, err := lookupTrip(s.tripRepo, req.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	payments := make([]*models.Payment, 0, len(req.Payments))
+	var validationErrors []models.BulkPaymentError
+
+	aliases := utils.NameAliases(trip.Aliases)
+	for i, item := range req.Payments {
+		item.FromPerson, item.ToPerson = aliases.Key(item.FromPerson), aliases.Key(item.ToPerson)
+		err := validatePayment(item.FromPerson, item.ToPerson, item.Amount)
+		if err == nil && !req.AllowNew {
+			err = validatePaymentParticipants(trip, item.FromPerson, item.ToPerson)
+		}
+		if err != nil {
+			validationErrors = append(validationErrors, models.BulkPaymentError{Index: i, Error: err.Error()})
+			continue
+		}
+		payments = append(payments, &models.Payment{
+			TripID:      trip.ID,
+			FromPerson:  utils.NormalizeName(item.FromPerson),
+			ToPerson:    utils.NormalizeName(item.ToPerson),
+			Amount:      item.Amount,
+			Description: strings.TrimSpace(item.Description),
+			PaymentDate: now,
+			CreatedAt:   now,
+		})
+	}
+
+	if len(validationErrors) > 0 {
+		return nil, &BulkPaymentValidationError{Errors: validationErrors}
+	}
+
+	var newParticipants []string
+	if req.AllowNew {
+		newParticipants = paymentParticipants(payments)
+	}
+	limit := maxParticipants()
+	if err := s.paymentRepo.CreatePayments(trip.ID, newParticipants, payments, limit); err != nil {
+		if errors.Is(err, repository.ErrTooManyParticipants) {
+			return nil, tooManyParticipantsError(limit)
+		}
+		return nil, err
+	}
+	s.settlements.invalidate(trip.ID)
+
+	created := make([]models.Payment, len(payments))
+	for i, payment := range payments {
+		s.notifyPaymentAdded(trip, payment)
+		formatPaymentForDisplay(payment)
+		created[i] = *payment
+	}
+	return created, nil
+}
+
+// validatePayment checks the people and amount of a payment
+func validatePayment(fromPerson, toPerson string, amount float64) error {
+	if strings.TrimSpace(fromPerson) == "" {
+		return errors.New("from_person is required")
+	}
+	if strings.TrimSpace(toPerson) == "" {
+		return errors.New("to_person is required")
+	}
+	if utils.NormalizeName(fromPerson) == utils.NormalizeName(toPerson) {
+		return errors.New("cannot pay to yourself")
+	}
+	if amount <= 0 {
+		return errors.New("amount must be greater than 0")
+	}
+	return nil
+}
+
+// validatePaymentParticipants rejects a payment naming someone who is not a participant
+// of the trip, saying which side of the payment is unknown
+func validatePaymentParticipants(trip *models.Trip, fromPerson, toPerson string) error {
+	known := participantKeys(trip)
+
+	if name := utils.NormalizeName(fromPerson); !known[name] {
+		return fmt.Errorf("from_person %s is not a participant in this trip", utils.FormatNameForDisplay(name))
+	}
+	if name := utils.NormalizeName(toPerson); !known[name] {
+		return fmt.Errorf("to_person %s is not a participant in this trip", utils.FormatNameForDisplay(name))
+	}
+	return nil
+}
+
+// paymentParticipants returns every normalized name that sends or receives the payments
+func paymentParticipants(payments []*models.Payment) []string {
+	seen := make(map[string]bool)
+	var participants []string
+	for _, payment := range payments {
+		for _, name := range []string{payment.FromPerson, payment.ToPerson} {
+			if !seen[name] {
+				seen[name] = true
+				participants = append(participants, name)
+			}
+		}
+	}
+	return participants
+}
+
+// formatPaymentForDisplay converts a payment's stored lowercase names to display form
+func formatPaymentForDisplay(payment *models.Payment) {
+	payment.FromPerson = utils.FormatNameForDisplay(payment.FromPerson)
+	payment.ToPerson = utils.FormatNameForDisplay(payment.ToPerson)
+}
+
+// notifyPaymentAdded notifies the trip's webhook of a new payment in the background
+func (s *PaymentService) notifyPaymentAdded(trip *models.Trip, payment *models.Payment) {
+	summary := fmt.Sprintf("%s paid %s %s",
+		utils.FormatNameForDisplay(payment.FromPerson),
+		utils.FormatNameForDisplay(payment.ToPerson),
+		utils.FormatAmountForCurrency(payment.Amount, trip.Currency))
+	s.webhooks.Notify(trip.WebhookURL, NewWebhookEvent(WebhookEventPaymentAdded, trip.Code, summary))
+}
+
 // GetPaymentsByTripCode retrieves all payments for a trip by code
 func (s *PaymentService) GetPaymentsByTripCode(code string) ([]models.Payment, error) {
 	// Get trip by code
-	trip, err := s.tripRepo.GetTripByCode(code)
+	trip, err := lookupTrip(s.tripRepo, code)
 	if err != nil {
-		return nil, errors.New("trip not found")
+		return nil, err
 	}
 
 	return s.paymentRepo.GetPaymentsByTripID(trip.ID)
 }
 
+// paymentDateLayout is the format of the date filters when listing payments
+const paymentDateLayout = "2006-01-02"
+
+// ListPayments retrieves a trip's payments between two optional inclusive dates, along
+// with how much each person sent and received over that range
+func (s *PaymentService) ListPayments(code, fromDate, toDate string) (*models.PaymentListResult, error) {
+	from, to, err := parsePaymentDateRange(fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	trip, err := lookupTrip(s.tripRepo, code)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := s.paymentRepo.GetPaymentsByTripIDInRange(trip.ID, from, to)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve payments")
+	}
+	if payments == nil {
+		payments = []models.Payment{}
+	}
+
+	totals := summarizePaymentTotals(payments)
+	for i := range payments {
+		formatPaymentForDisplay(&payments[i])
+	}
+
+	return &models.PaymentListResult{
+		Payments: payments,
+		Totals:   totals,
+	}, nil
+}
+
+// parsePaymentDateRange parses inclusive YYYY-MM-DD bounds into a half-open time range
+// An empty date gives a zero time, leaving that side open
+func parsePaymentDateRange(fromDate, toDate string) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+
+	if fromDate != "" {
+		from, err = time.ParseInLocation(paymentDateLayout, fromDate, time.Local)
+		if err != nil {
+			return from, to, utils.NewValidationError("from_date must be a date in YYYY-MM-DD format")
+		}
+	}
+	if toDate != "" {
+		to, err = time.ParseInLocation(paymentDateLayout, toDate, time.Local)
+		if err != nil {
+			return from, to, utils.NewValidationError("to_date must be a date in YYYY-MM-DD format")
+		}
+		// Include every payment made on the last day
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, utils.NewValidationError("from_date must not be after to_date")
+	}
+
+	return from, to, nil
+}
+
+// summarizePaymentTotals totals the amount each person sent and received, sorted by name
+func summarizePaymentTotals(payments []models.Payment) []models.PersonPaymentTotal {
+	totals := make(map[string]*models.PersonPaymentTotal)
+	personTotal := func(person string) *models.PersonPaymentTotal {
+		name := utils.FormatNameForDisplay(utils.NormalizeName(person))
+		total, exists := totals[name]
+		if !exists {
+			total = &models.PersonPaymentTotal{Person: name}
+			totals[name] = total
+		}
+		return total
+	}
+
+	for _, payment := range payments {
+		personTotal(payment.FromPerson).TotalSent += payment.Amount
+		personTotal(payment.ToPerson).TotalReceived += payment.Amount
+	}
+
+	result := make([]models.PersonPaymentTotal, 0, len(totals))
+	for _, total := range totals {
+		total.TotalSent = utils.Round(total.TotalSent)
+		total.TotalReceived = utils.Round(total.TotalReceived)
+		result = append(result, *total)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Person < result[j].Person
+	})
+
+	return result
+}
+
 // GetPaymentsByTripID retrieves all payments for a trip by ID
 func (s *PaymentService) GetPaymentsByTripID(tripID string) ([]models.Payment, error) {
 	return s.paymentRepo.GetPaymentsByTripID(tripID)
@@ -82,12 +326,16 @@ func (s *PaymentService) GetPaymentsByTripID(tripID string) ([]models.Payment, e
 // DeletePayment deletes a payment by ID
 func (s *PaymentService) DeletePayment(paymentID int) error {
 	// Check if payment exists
-	_, err := s.paymentRepo.GetPaymentByID(paymentID)
+	payment, err := s.paymentRepo.GetPaymentByID(paymentID)
 	if err != nil {
 		return errors.New("payment not found")
 	}
 
-	return s.paymentRepo.DeletePayment(paymentID)
+	if err := s.paymentRepo.DeletePayment(paymentID); err != nil {
+		return err
+	}
+	s.settlements.invalidate(payment.TripID)
+	return nil
 }
 
 // CalculateBalancesWithPayments calculates balances including payments
@@ -106,11 +354,17 @@ func (s *PaymentService) CalculateBalancesWithPayments(tripCode string, original
 
 	// Apply payments to balances
 	for _, payment := range payments {
-		// The person who paid reduces their debt (becomes less negative or more positive)
-		adjustedBalances[payment.FromPerson] += payment.Amount
-		// The person who received payment increases their debt (becomes more negative or less positive)
-		adjustedBalances[payment.ToPerson] -= payment.Amount
+		applyPayment(adjustedBalances, payment)
 	}
 
 	return adjustedBalances, nil
+}
+
+// applyPayment moves a payment's amount between the balances of its two people
+func applyPayment(balances map[string]float64, payment models.Payment) {
+	// The person who paid reduces their debt (becomes less negative or more positive)
+	// Older payments may have been stored without normalized names
+	balances[utils.NormalizeName(payment.FromPerson)] += payment.Amount
+	// The person who received payment increases their debt (becomes more negative or less positive)
+	balances[utils.NormalizeName(payment.ToPerson)] -= payment.Amount
 }
\ No newline at end of file
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockPaymentService(t *testing.T) (*PaymentService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	service := NewPaymentService(repository.NewPaymentRepository(db), &repository.TripRepository{DB: db})
+	return service, mock
+}
+
+// expectTripLookup expects the trip and participant queries for trip "trip-1" with code ABC123,
+// whose participants are alice, bob and carol
+func expectTripLookup(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM trips WHERE code = $1")).WithArgs("ABC123").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "name", "creation_time", "currency", "webhook_url", "owner", "archived"}).
+			AddRow("trip-1", "ABC123", "Bali", 0, "IDR", "", "", false))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM trip_participants WHERE trip_id = $1")).WithArgs("trip-1").
+		WillReturnRows(sqlmock.NewRows([]string{"participant", "exclude_from_auto", "default_consumer"}).
+			AddRow("alice", false, false).AddRow("bob", false, false).AddRow("carol", false, false))
+	expectAliases(mock, "trip-1")
+}
+
+func TestPaymentService_BulkCreatePayments(t *testing.T) {
+	service, mock := newMockPaymentService(t)
+	expectTripLookup(mock)
+
+	insert := regexp.QuoteMeta("INSERT INTO payments")
+	mock.ExpectBegin()
+	mock.ExpectQuery(insert).WithArgs("trip-1", "alice", "bob", 50.0, "Dinner", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(insert).WithArgs("trip-1", "alice", "carol", 25.0, "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+	mock.ExpectCommit()
+
+	payments, err := service.BulkCreatePayments(&models.BulkPaymentRequest{
+		Code: "ABC123",
+		Payments: []models.BulkPaymentItem{
+			{FromPerson: "alice", ToPerson: "bob", Amount: 50, Description: " Dinner "},
+			{FromPerson: "alice", ToPerson: "carol", Amount: 25},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, payments, 2)
+	assert.Equal(t, 7, payments[0].ID)
+	assert.Equal(t, "Dinner", payments[0].Description)
+	assert.Equal(t, 8, payments[1].ID)
+	assert.Equal(t, "trip-1", payments[1].TripID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentService_BulkCreatePayments_InvalidPaymentCreatesNone(t *testing.T) {
+	service, mock := newMockPaymentService(t)
+	expectTripLookup(mock)
+
+	payments, err := service.BulkCreatePayments(&models.BulkPaymentRequest{
+		Code: "ABC123",
+		Payments: []models.BulkPaymentItem{
+			{FromPerson: "alice", ToPerson: "bob", Amount: 50},
+			{FromPerson: "alice", ToPerson: "alice", Amount: 10},
+			{FromPerson: "bob", ToPerson: "carol", Amount: 0},
+		},
+	})
+
+	assert.Nil(t, payments)
+	var validationErr *BulkPaymentValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []models.BulkPaymentError{
+		{Index: 1, Error: "cannot pay to yourself"},
+		{Index: 2, Error: "amount must be greater than 0"},
+	}, validationErr.Errors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentService_BulkCreatePayments_RollsBackOnInsertFailure(t *testing.T) {
+	service, mock := newMockPaymentService(t)
+	expectTripLookup(mock)
+
+	insert := regexp.QuoteMeta("INSERT INTO payments")
+	mock.ExpectBegin()
+	mock.ExpectQuery(insert).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(insert).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	payments, err := service.BulkCreatePayments(&models.BulkPaymentRequest{
+		Code: "ABC123",
+		Payments: []models.BulkPaymentItem{
+			{FromPerson: "alice", ToPerson: "bob", Amount: 50},
+			{FromPerson: "alice", ToPerson: "carol", Amount: 25},
+		},
+	})
+
+	assert.Nil(t, payments)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentService_BulkCreatePayments_EnforcesParticipantLimit(t *testing.T) {
+	t.Setenv("MAX_PARTICIPANTS", "4")
+	service, mock := newMockPaymentService(t)
+	expectTripLookup(mock)
+
+	mock.ExpectBegin()
+	expectTripLock(mock, "trip-1")
+	expectParticipantCount(mock, "trip-1", "dave", 3, false)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO trip_participants")).WithArgs("trip-1", "dave").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectParticipantCount(mock, "trip-1", "erin", 4, false)
+	mock.ExpectRollback()
+
+	payments, err := service.BulkCreatePayments(&models.BulkPaymentRequest{
+		Code:     "ABC123",
+		AllowNew: true,
+		Payments: []models.BulkPaymentItem{{FromPerson: "Dave", ToPerson: "Erin", Amount: 50}},
+	})
+
+	assert.Nil(t, payments)
+	assert.Equal(t, utils.NewValidationError("A trip can have at most 4 participants"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentService_BulkCreatePayments_UnknownTrip(t *testing.T) {
+	service, mock := newMockPaymentService(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM trips WHERE code = $1")).WithArgs("NOPE00").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	payments, err := service.BulkCreatePayments(&models.BulkPaymentRequest{
+		Code:     "NOPE00",
+		Payments: []models.BulkPaymentItem{{FromPerson: "alice", ToPerson: "bob", Amount: 50}},
+	})
+
+	assert.Nil(t, payments)
+	assert.Equal(t, utils.NewNotFoundError("Trip"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentService_ListPayments_FiltersByDateAndTotalsPerPerson(t *testing.T) {
+	service, mock := newMockPaymentService(t)
+	expectTripLookup(mock)
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(2024, 3, 4, 0, 0, 0, 0, time.Local)
+	paid := time.Date(2024, 3, 2, 10, 0, 0, 0, time.Local)
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE trip_id = $1 AND payment_date >= $2 AND payment_date < $3 ORDER BY payment_date DESC")).
+		WithArgs("trip-1", from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trip_id", "from_person", "to_person", "amount", "description", "payment_date", "created_at"}).
+			AddRow(1, "trip-1", "bob", "alice", 30.0, "", paid, paid).
+			AddRow(2, "trip-1", "bob", "alice", 20.5, "", paid, paid).
+			AddRow(3, "trip-1", "carol", "bob", 10.0, "", paid, paid))
+
+	result, err := service.ListPayments("ABC123", "2024-03-01", "2024-03-03")
+
+	assert.NoError(t, err)
+	assert.Len(t, result.Payments, 3)
+	assert.Equal(t, []models.PersonPaymentTotal{
+		{Person: "Alice", TotalSent: 0, TotalReceived: 50.5},
+		{Person: "Bob", TotalSent: 50.5, TotalReceived: 10},
+		{Person: "Carol", TotalSent: 10, TotalReceived: 0},
+	}, result.Totals)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentService_ListPayments_NoDatesReturnsAll(t *testing.T) {
+	service, mock := newMockPaymentService(t)
+	expectTripLookup(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE trip_id = $1 ORDER BY payment_date DESC")).
+		WithArgs("trip-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trip_id", "from_person", "to_person", "amount", "description", "payment_date", "created_at"}))
+
+	result, err := service.ListPayments("ABC123", "", "")
+
+	assert.NoError(t, err)
+	assert.NotNil(t, result.Payments)
+	assert.Empty(t, result.Payments)
+	assert.Empty(t, result.Totals)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParsePaymentDateRange_Invalid(t *testing.T) {
+	_, _, err := parsePaymentDateRange("03/01/2024", "")
+	assert.EqualError(t, err, "from_date must be a date in YYYY-MM-DD format")
+
+	_, _, err = parsePaymentDateRange("", "tomorrow")
+	assert.EqualError(t, err, "to_date must be a date in YYYY-MM-DD format")
+
+	_, _, err = parsePaymentDateRange("2024-03-05", "2024-03-01")
+	assert.EqualError(t, err, "from_date must not be after to_date")
+
+	from, to, err := parsePaymentDateRange("2024-03-05", "2024-03-05")
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, to.Sub(from))
+}
+
+func TestPaymentService_PaymentNamesMatchNormalizedExpenseBalances(t *testing.T) {
+	service, mock := newMockPaymentService(t)
+
+	// Bob paid for dinner shared with alice, so alice owes him 50
+	expenses := []*models.Expense{
+		{SplitType: "equal", Amount: 100, PaidBy: "bob", SplitAmong: []string{"alice", "bob"}},
+	}
+	balances := (&SettlementService{}).calculateBalances(expenses)
+	assert.Equal(t, float64(-50), balances["alice"])
+
+	// The payment is stored with normalized names and returned for display
+	expectTripLookup(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO payments")).
+		WithArgs("trip-1", "alice", "bob", 50.0, "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	payment, err := service.CreatePayment(&models.PaymentRequest{Code: "ABC123", FromPerson: " Alice ", ToPerson: "BOB", Amount: 50})
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", payment.FromPerson)
+	assert.Equal(t, "Bob", payment.ToPerson)
+
+	// A payment stored before names were normalized still settles the balance
+	now := time.Now()
+	expectTripLookup(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM payments")).WithArgs("trip-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trip_id", "from_person", "to_person", "amount", "description", "payment_date", "created_at"}).
+			AddRow(1, "trip-1", "Alice", "Bob", 50.0, "", now, now))
+
+	adjusted, err := service.CalculateBalancesWithPayments("ABC123", balances)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"alice": 0, "bob": 0}, adjusted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestValidatePayment_SelfPaymentIgnoresCase(t *testing.T) {
+	assert.EqualError(t, validatePayment("Alice", " alice", 10), "cannot pay to yourself")
+}
+
+func TestPaymentService_CreatePayment_RejectsNonParticipant(t *testing.T) {
+	service, mock := newMockPaymentService(t)
+	expectTripLookup(mock)
+
+	payment, err := service.CreatePayment(&models.PaymentRequest{Code: "ABC123", FromPerson: "alice", ToPerson: "Dave", Amount: 20})
+
+	assert.Nil(t, payment)
+	assert.EqualError(t, err, "to_person Dave is not a participant in this trip")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentService_CreatePayment_AllowNewAddsParticipant(t *testing.T) {
+	service, mock := newMockPaymentService(t)
+	expectTripLookup(mock)
+
+	addParticipant := regexp.QuoteMeta("INSERT INTO trip_participants")
+	mock.ExpectBegin()
+	expectTripLock(mock, "trip-1")
+	expectParticipantCount(mock, "trip-1", "dave", 3, false)
+	mock.ExpectExec(addParticipant).WithArgs("trip-1", "dave").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	expectTripLock(mock, "trip-1")
+	expectParticipantCount(mock, "trip-1", "alice", 4, true)
+	mock.ExpectExec(addParticipant).WithArgs("trip-1", "alice").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO payments")).
+		WithArgs("trip-1", "dave", "alice", 20.0, "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	payment, err := service.CreatePayment(&models.PaymentRequest{Code: "ABC123", FromPerson: "Dave", ToPerson: "alice", Amount: 20, AllowNew: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, payment.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentService_CreatePayment_AcceptsDisplayNames(t *testing.T) {
+	service, mock := newMockPaymentService(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM trips WHERE code = $1")).WithArgs("ABC123").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "name", "creation_time", "currency", "webhook_url", "owner", "archived"}).
+			AddRow("trip-1", "ABC123", "Bali", 0, "IDR", "", "", false))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM trip_participants WHERE trip_id = $1")).WithArgs("trip-1").
+		WillReturnRows(sqlmock.NewRows([]string{"participant", "exclude_from_auto", "default_consumer"}).
+			AddRow("alice", false, false).AddRow("robert", false, false))
+	expectAliases(mock, "trip-1", "robert", "Bobby")
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO payments")).
+		WithArgs("trip-1", "robert", "alice", 20.0, "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+
+	payment, err := service.CreatePayment(&models.PaymentRequest{Code: "ABC123", FromPerson: "Bobby", ToPerson: "Alice", Amount: 20})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, payment.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPaymentService_BulkCreatePayments_RejectsNonParticipant(t *testing.T) {
+	service, mock := newMockPaymentService(t)
+	expectTripLookup(mock)
+
+	_, err := service.BulkCreatePayments(&models.BulkPaymentRequest{
+		Code: "ABC123",
+		Payments: []models.BulkPaymentItem{
+			{FromPerson: "alice", ToPerson: "bob", Amount: 50},
+			{FromPerson: "erin", ToPerson: "bob", Amount: 10},
+		},
+	})
+
+	var validationErr *BulkPaymentValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []models.BulkPaymentError{
+		{Index: 1, Error: "from_person Erin is not a participant in this trip"},
+	}, validationErr.Errors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestValidatePaymentParticipants_AliasedTrip(t *testing.T) {
+	assert.NoError(t, validatePaymentParticipants(newAliasedTrip(), "leonardo dicaprio", "bob"))
+	assert.EqualError(t, validatePaymentParticipants(newAliasedTrip(), "leo", "bob"), "from_person Leo is not a participant in this trip")
+}
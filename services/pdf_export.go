@@ -0,0 +1,123 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/go-pdf/fpdf"
+)
+
+// PDF layout in millimetres: balances and settlements are rendered side by side
+// so that around 20 participants still fit on a single A4 page
+const (
+	pdfMargin      = 15.0
+	pdfColumnWidth = 85.0
+	pdfColumnGap   = 10.0
+	pdfRowHeight   = 6.0
+)
+
+// ExportTripToPDF generates a one-page PDF with a trip's net balances and required settlements
+func (s *ExcelService) ExportTripToPDF(tripCode string) ([]byte, string, error) {
+	// Get trip data
+	trip, err := s.tripService.GetTripByCode(tripCode)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Get all expenses
+	expenses, err := s.expenseService.GetExpenses(trip.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Get settlements
+	settlementResult, err := s.settlementService.CalculateSettlementsWithOptions(trip.ID, SettlementOptions{Currency: trip.Currency})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	err = renderTripPDF(&buf, trip.Name, sortedPersonSummaries(expenses, trip.Currency), settlementResult.Settlements, time.Now())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to write PDF: %v", err)
+	}
+
+	filename := fmt.Sprintf("%s_Summary_%s.pdf",
+		utils.CleanFileName(trip.Name),
+		time.Now().Format("2006-01-02"))
+
+	return buf.Bytes(), filename, nil
+}
+
+// renderTripPDF writes the trip summary document
+func renderTripPDF(out io.Writer, tripName string, summaries []PersonSummary, settlements []models.Settlement, generatedAt time.Time) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(false, pdfMargin)
+	pdf.AddPage()
+
+	// Core fonts are cp1252, so translate names from UTF-8
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	// Title
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, tr(tripName), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.SetTextColor(100, 100, 100)
+	pdf.CellFormat(0, 5, "Generated "+generatedAt.Format("2 January 2006"), "", 1, "L", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+
+	top := pdf.GetY() + 6
+
+	// Net balances column
+	balanceRows := make([][2]string, len(summaries))
+	for i, summary := range summaries {
+		balanceRows[i] = [2]string{tr(summary.Name), formatExportAmount(summary.NetBalance)}
+	}
+	writePDFTable(pdf, pdfMargin, top, "Net Balances", [2]string{"Person", "Balance"}, balanceRows, "No expenses recorded")
+
+	// Required settlements column
+	settlementRows := make([][2]string, len(settlements))
+	for i, settlement := range settlements {
+		settlementRows[i] = [2]string{
+			tr(settlement.From + " -> " + settlement.To),
+			formatExportAmount(settlement.Amount),
+		}
+	}
+	writePDFTable(pdf, pdfMargin+pdfColumnWidth+pdfColumnGap, top, "Required Settlements", [2]string{"Payment", "Amount"}, settlementRows, "Everyone is settled up")
+
+	return pdf.Output(out)
+}
+
+// writePDFTable renders a titled two-column table with right-aligned amounts at the given position
+func writePDFTable(pdf *fpdf.Fpdf, x, y float64, title string, headers [2]string, rows [][2]string, emptyText string) {
+	labelWidth := pdfColumnWidth * 0.65
+	amountWidth := pdfColumnWidth - labelWidth
+
+	pdf.SetXY(x, y)
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(pdfColumnWidth, 8, title, "", 2, "L", false, 0, "")
+
+	pdf.SetX(x)
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetFillColor(230, 243, 255)
+	pdf.CellFormat(labelWidth, pdfRowHeight, headers[0], "B", 0, "L", true, 0, "")
+	pdf.CellFormat(amountWidth, pdfRowHeight, headers[1], "B", 2, "R", true, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	if len(rows) == 0 {
+		pdf.SetX(x)
+		pdf.CellFormat(pdfColumnWidth, pdfRowHeight, emptyText, "", 2, "L", false, 0, "")
+		return
+	}
+
+	for _, row := range rows {
+		pdf.SetX(x)
+		pdf.CellFormat(labelWidth, pdfRowHeight, row[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(amountWidth, pdfRowHeight, row[1], "", 2, "R", false, 0, "")
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTripPDF_TwentyParticipantsFitOnePage(t *testing.T) {
+	var summaries []PersonSummary
+	var settlements []models.Settlement
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("Person %02d", i)
+		summaries = append(summaries, PersonSummary{Name: name, NetBalance: float64(i) - 10})
+		if i > 0 {
+			settlements = append(settlements, models.Settlement{From: name, To: "Person 00", Amount: 12.5})
+		}
+	}
+
+	var buf bytes.Buffer
+	err := renderTripPDF(&buf, "Bali Trip", summaries, settlements, time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC))
+
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("/Type /Page\n")))
+}
+
+func TestRenderTripPDF_NoData(t *testing.T) {
+	var buf bytes.Buffer
+	err := renderTripPDF(&buf, "Empty Trip", nil, nil, time.Now())
+
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+}
+
+func TestExportTripToPDF_UnknownTrip(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM trips WHERE code = $1")).WithArgs("ABC123").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	service := NewExcelService(&TripService{repo: &repository.TripRepository{DB: db}}, nil, nil, nil)
+
+	_, _, err = service.ExportTripToPDF("ABC123")
+
+	assert.Equal(t, utils.NewNotFoundError("Trip"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
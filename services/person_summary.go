@@ -0,0 +1,136 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// PersonSummary represents a person's spending summary
+type PersonSummary struct {
+	Name       string
+	TotalSpent float64 // How much they paid out
+	TotalOwed  float64 // How much they consumed
+	NetBalance float64 // Positive = should receive, Negative = should pay
+}
+
+// sortedPersonSummaries calculates person summaries sorted by name for consistent output
+func sortedPersonSummaries(expenses []*models.Expense, currency string) []PersonSummary {
+	summaries := calculatePersonSummaries(expenses, currency)
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries
+}
+
+// calculatePersonSummaries calculates spending summary for each person, splitting
+// item expenses in the trip currency's minor unit
+func calculatePersonSummaries(expenses []*models.Expense, currency string) []PersonSummary {
+	summaryMap := make(map[string]*PersonSummary)
+
+	for _, expense := range expenses {
+		if expense.SplitType == utils.SplitTypeEqual {
+			processEqualExpenseForSummary(expense, summaryMap)
+		} else {
+			processItemExpenseForSummary(expense, summaryMap, currency)
+		}
+	}
+
+	// Convert map to slice
+	var summaries []PersonSummary
+	for _, summary := range summaryMap {
+		summary.NetBalance = summary.TotalSpent - summary.TotalOwed
+		summaries = append(summaries, *summary)
+	}
+
+	return summaries
+}
+
+// processEqualExpenseForSummary processes equal split expense for summary
+func processEqualExpenseForSummary(expense *models.Expense, summaryMap map[string]*PersonSummary) {
+	for payer, share := range expense.PayerShares() {
+		paidBy := utils.FormatNameForDisplay(payer)
+
+		// Initialize payer if not exists
+		if _, exists := summaryMap[paidBy]; !exists {
+			summaryMap[paidBy] = &PersonSummary{Name: paidBy}
+		}
+
+		// Add to total spent
+		summaryMap[paidBy].TotalSpent += share
+	}
+
+	// Calculate share per person
+	sharePerPerson := expense.Amount / float64(len(expense.SplitAmong))
+
+	// Add to each person's owed amount
+	for _, person := range expense.SplitAmong {
+		formattedName := utils.FormatNameForDisplay(person)
+		if _, exists := summaryMap[formattedName]; !exists {
+			summaryMap[formattedName] = &PersonSummary{Name: formattedName}
+		}
+		summaryMap[formattedName].TotalOwed += sharePerPerson
+	}
+}
+
+// processItemExpenseForSummary processes item-based expense for summary
+func processItemExpenseForSummary(expense *models.Expense, summaryMap map[string]*PersonSummary, currency string) {
+	// Each payer spent the items they paid for
+	for _, item := range expense.Items {
+		paidBy := utils.FormatNameForDisplay(item.PaidBy)
+
+		// Initialize payer if not exists
+		if _, exists := summaryMap[paidBy]; !exists {
+			summaryMap[paidBy] = &PersonSummary{Name: paidBy}
+		}
+
+		// Add to total spent
+		summaryMap[paidBy].TotalSpent += item.Amount
+	}
+
+	// The primary payer also paid the extra charges (tax, service, discount)
+	extraCharges := expense.ExtraCharges()
+	if extraCharges != 0 {
+		formattedPayer := utils.FormatNameForDisplay(findPrimaryPayerForSummary(expense))
+
+		if _, exists := summaryMap[formattedPayer]; !exists {
+			summaryMap[formattedPayer] = &PersonSummary{Name: formattedPayer}
+		}
+
+		// Add extra charges to spending
+		summaryMap[formattedPayer].TotalSpent += extraCharges
+	}
+
+	// Each consumer owes their item share plus proportional extras
+	for consumer, allocation := range allocateItemSplit(expense.Items, expenseCharges(expense, currency)) {
+		formattedName := utils.FormatNameForDisplay(consumer)
+		if _, exists := summaryMap[formattedName]; !exists {
+			summaryMap[formattedName] = &PersonSummary{Name: formattedName}
+		}
+		summaryMap[formattedName].TotalOwed += allocation.Total
+	}
+}
+
+// findPrimaryPayerForSummary finds the primary payer for an expense
+func findPrimaryPayerForSummary(expense *models.Expense) string {
+	payerAmounts := make(map[string]float64)
+	for _, item := range expense.Items {
+		payerAmounts[item.PaidBy] += item.Amount
+	}
+
+	var primaryPayer string
+	var maxAmount float64
+	for payer, amount := range payerAmounts {
+		if amount > maxAmount {
+			maxAmount = amount
+			primaryPayer = payer
+		}
+	}
+
+	if primaryPayer == "" {
+		primaryPayer = expense.PaidBy
+	}
+
+	return primaryPayer
+}
@@ -0,0 +1,18 @@
+//go:build cgo
+
+package services
+
+import (
+	"bytes"
+
+	"github.com/jdeng/goheif"
+)
+
+// convertHEICToJPEG decodes a HEIC photo and re-encodes it as JPEG
+func convertHEICToJPEG(data []byte) ([]byte, error) {
+	img, err := goheif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return encodeJPEG(img)
+}
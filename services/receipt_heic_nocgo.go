@@ -0,0 +1,10 @@
+//go:build !cgo
+
+package services
+
+import "errors"
+
+// convertHEICToJPEG needs the cgo HEVC decoder, which is not part of this build
+func convertHEICToJPEG(data []byte) ([]byte, error) {
+	return nil, errors.New("HEIC support requires a cgo-enabled build")
+}
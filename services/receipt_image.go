@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"golang.org/x/image/tiff"
+)
+
+// jpegQuality is used when a receipt has to be re-encoded as JPEG
+const jpegQuality = 90
+
+// Receipt images must fit these bounds, in pixels per side; larger images are
+// rejected by Claude and smaller ones cannot hold a readable receipt
+const (
+	minReceiptImageSide = 32
+	maxReceiptImageSide = 8000
+)
+
+func init() {
+	// pdfcpu would otherwise write a configuration directory under the user's home
+	api.DisableConfigDir()
+}
+
+// IsSupportedReceiptExtension reports whether an uploaded receipt file extension can be processed
+func IsSupportedReceiptExtension(ext string) bool {
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "jpg", "jpeg", "png", "heic", "pdf":
+		return true
+	}
+	return false
+}
+
+// PrepareReceiptImage converts an uploaded receipt into an image format Claude accepts.
+// JPEG and PNG pass through unchanged, HEIC photos are converted to JPEG and for a PDF
+// the largest image on its first page is used. It returns the image and its format,
+// which is "jpeg" or "png" as detected from the image bytes, so a PNG named .jpg is
+// still sent to Claude as a PNG. Corrupt or badly sized images are rejected before
+// they reach Claude.
+func PrepareReceiptImage(data []byte, ext string) ([]byte, string, error) {
+	prepared, format, err := convertReceiptImage(data, ext)
+	if err != nil {
+		return nil, "", err
+	}
+	if detected, err := detectReceiptImageFormat(prepared); err != nil {
+		return nil, "", err
+	} else if detected != "" {
+		format = detected
+	}
+	if err := validateReceiptImage(prepared); err != nil {
+		return nil, "", err
+	}
+	return prepared, format, nil
+}
+
+// detectReceiptImageFormat sniffs the image type from its first 512 bytes. It returns
+// "jpeg" or "png" for supported images, an error for any other recognised type and
+// an empty format when the content is unrecognised, leaving that to validateReceiptImage.
+func detectReceiptImageFormat(data []byte) (string, error) {
+	contentType := http.DetectContentType(data[:min(len(data), 512)])
+	switch {
+	case contentType == "image/jpeg":
+		return "jpeg", nil
+	case contentType == "image/png":
+		return "png", nil
+	case strings.HasPrefix(contentType, "image/"), contentType == "application/pdf":
+		return "", fmt.Errorf("unsupported_image_type: the file contains %s data, only JPEG and PNG images are supported", contentType)
+	}
+	return "", nil
+}
+
+// validateReceiptImage checks that an image decodes and has usable dimensions
+func validateReceiptImage(data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("corrupt_image: the file could not be read as an image: %v", err)
+	}
+
+	if config.Width < minReceiptImageSide || config.Height < minReceiptImageSide ||
+		config.Width > maxReceiptImageSide || config.Height > maxReceiptImageSide {
+		return fmt.Errorf("invalid_image_dimensions: image is %dx%d pixels, each side must be between %d and %d",
+			config.Width, config.Height, minReceiptImageSide, maxReceiptImageSide)
+	}
+	return nil
+}
+
+// convertReceiptImage converts a receipt upload by file extension
+func convertReceiptImage(data []byte, ext string) ([]byte, string, error) {
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "jpg", "jpeg":
+		return data, "jpeg", nil
+	case "png":
+		return data, "png", nil
+	case "heic":
+		converted, err := convertHEICToJPEG(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("receipt_format_error: failed to convert HEIC image: %v", err)
+		}
+		return converted, "jpeg", nil
+	case "pdf":
+		return extractPDFReceiptImage(data)
+	default:
+		return nil, "", fmt.Errorf("unsupported image format: %s", ext)
+	}
+}
+
+// extractPDFReceiptImage returns the largest image embedded in the first page of a PDF,
+// which for a scanned receipt is the scan itself
+func extractPDFReceiptImage(data []byte) ([]byte, string, error) {
+	pages, err := api.ExtractImagesRaw(bytes.NewReader(data), []string{"1"}, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("receipt_format_error: failed to read PDF: %v", err)
+	}
+
+	var best []byte
+	var bestType string
+	var bestArea int
+	for _, images := range pages {
+		for _, img := range images {
+			if img.Thumb || img.IsImgMask {
+				continue
+			}
+
+			area := img.Width * img.Height
+			if best != nil && area <= bestArea {
+				continue
+			}
+
+			var buf bytes.Buffer
+			if _, err := buf.ReadFrom(img); err != nil {
+				return nil, "", fmt.Errorf("receipt_format_error: failed to read PDF image: %v", err)
+			}
+			best, bestType, bestArea = buf.Bytes(), img.FileType, area
+		}
+	}
+
+	if best == nil {
+		return nil, "", fmt.Errorf("receipt_format_error: the first page of the PDF contains no scanned image")
+	}
+
+	switch bestType {
+	case "jpg":
+		return best, "jpeg", nil
+	case "png":
+		return best, "png", nil
+	case "tif":
+		// Re-encode losslessly; Claude does not accept TIFF
+		decoded, err := tiff.Decode(bytes.NewReader(best))
+		if err != nil {
+			return nil, "", fmt.Errorf("receipt_format_error: failed to decode PDF image: %v", err)
+		}
+		return encodePNG(decoded)
+	default:
+		return nil, "", fmt.Errorf("receipt_format_error: unsupported image type %q in PDF", bestType)
+	}
+}
+
+// encodeJPEG encodes an image as JPEG
+func encodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodePNG encodes an image as PNG
+func encodePNG(img image.Image) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", fmt.Errorf("receipt_format_error: failed to encode image: %v", err)
+	}
+	return buf.Bytes(), "png", nil
+}
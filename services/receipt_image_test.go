@@ -0,0 +1,108 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"testing"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSupportedReceiptExtension(t *testing.T) {
+	for _, ext := range []string{".jpg", ".JPEG", ".png", ".HEIC", ".pdf"} {
+		assert.True(t, IsSupportedReceiptExtension(ext), ext)
+	}
+	for _, ext := range []string{".gif", ".tiff", ""} {
+		assert.False(t, IsSupportedReceiptExtension(ext), ext)
+	}
+}
+
+func TestPrepareReceiptImage_ExtractsScanFromPDF(t *testing.T) {
+	// A scanned receipt is a PDF page holding a single JPEG
+	scan := image.NewRGBA(image.Rect(0, 0, 40, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 40; x++ {
+			scan.Set(x, y, color.RGBA{uint8(x * 6), uint8(y * 3), 128, 255})
+		}
+	}
+	var jpg bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&jpg, scan, nil))
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.RegisterImageOptionsReader("scan", fpdf.ImageOptions{ImageType: "JPG"}, bytes.NewReader(jpg.Bytes()))
+	pdf.ImageOptions("scan", 10, 10, 40, 80, false, fpdf.ImageOptions{ImageType: "JPG"}, 0, "")
+	var doc bytes.Buffer
+	assert.NoError(t, pdf.Output(&doc))
+
+	data, format, err := PrepareReceiptImage(doc.Bytes(), ".pdf")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	decoded, err := jpeg.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 40, 80), decoded.Bounds())
+}
+
+func TestPrepareReceiptImage_PDFWithoutImage(t *testing.T) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.Cell(40, 10, "Total 10.00")
+	var doc bytes.Buffer
+	assert.NoError(t, pdf.Output(&doc))
+
+	_, _, err := PrepareReceiptImage(doc.Bytes(), ".pdf")
+
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "receipt_format_error:"))
+}
+
+func TestPrepareReceiptImage_PassesThroughJPEGAndRejectsBadHEIC(t *testing.T) {
+	photo, err := encodeJPEG(image.NewRGBA(image.Rect(0, 0, 64, 128)))
+	assert.NoError(t, err)
+
+	data, format, err := PrepareReceiptImage(photo, ".JPG")
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, photo, data)
+
+	_, _, err = PrepareReceiptImage([]byte("not a heic file"), ".heic")
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "receipt_format_error:"))
+}
+
+func TestPrepareReceiptImage_DetectsPNGNamedAsJPEG(t *testing.T) {
+	screenshot, _, err := encodePNG(image.NewRGBA(image.Rect(0, 0, 64, 128)))
+	assert.NoError(t, err)
+
+	data, format, err := PrepareReceiptImage(screenshot, ".jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, screenshot, data)
+}
+
+func TestPrepareReceiptImage_RejectsUnsupportedImageType(t *testing.T) {
+	gif := []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+
+	_, _, err := PrepareReceiptImage(gif, ".png")
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "unsupported_image_type:"))
+	assert.Contains(t, err.Error(), "image/gif")
+}
+
+func TestPrepareReceiptImage_RejectsCorruptAndTinyImages(t *testing.T) {
+	_, _, err := PrepareReceiptImage([]byte("jpeg bytes"), ".jpg")
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "corrupt_image:"))
+
+	tiny, _, err := encodePNG(image.NewRGBA(image.Rect(0, 0, 10, 400)))
+	assert.NoError(t, err)
+	_, _, err = PrepareReceiptImage(tiny, ".png")
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "invalid_image_dimensions:"))
+}
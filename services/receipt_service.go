@@ -2,13 +2,14 @@
 package services
 
 import (
-	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
+	"math"
+	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -18,6 +19,13 @@ import (
 
 // ProcessReceiptWithClaude processes a receipt image using Claude API
 func ProcessReceiptWithClaude(imageBytes []byte, format string, filePath string) (*models.ProcessedReceipt, error) {
+	receipt, err := processReceiptWithClaude(imageBytes, format, filePath)
+	observeReceiptProcessing(err)
+	return receipt, err
+}
+
+// processReceiptWithClaude sends the image to Claude and parses the extracted receipt
+func processReceiptWithClaude(imageBytes []byte, format string, filePath string) (*models.ProcessedReceipt, error) {
 	// Encode image to base64
 	base64Image := base64.StdEncoding.EncodeToString(imageBytes)
 
@@ -45,45 +53,20 @@ func ProcessReceiptWithClaude(imageBytes []byte, format string, filePath string)
 	// Create Claude API request
 	claudeURL := "https://api.anthropic.com/v1/messages"
 
-	// Optimized prompt for receipt extraction
-	prompt := `Extract receipt data in this JSON format:
-
-Note: Some receipts show quantity on separate lines:
-- "3 @ 36.000" (quantity @ unit_price)
-- "Item Name" (on next line)
-Match quantity lines with item names below them. Use unit_price, not total.
-
-{
-  "merchant": "store name",
-  "date": "YYYY-MM-DD",
-  "items": [
-    {
-      "name": "item name",
-      "price": unit_price_per_item,
-      "quantity": number,
-      "discount": number
-    }
-  ],
-  "subtotal": number,
-  "tax": number,
-  "service": number,
-  "discount": number,
-  "total": number
-}
-
-Return only valid JSON. No explanations.`
+	config := loadClaudeConfig()
+	slog.Debug("Processing receipt with Claude", "operation", "process_receipt", "model", config.Model)
 
 	// Construct Claude API request body
 	requestBody := map[string]interface{}{
-		"model":      "claude-3-5-sonnet-20241022",
-		"max_tokens": 4000,
+		"model":      config.Model,
+		"max_tokens": config.MaxTokens,
 		"messages": []map[string]interface{}{
 			{
 				"role": "user",
 				"content": []map[string]interface{}{
 					{
 						"type": "text",
-						"text": prompt,
+						"text": config.Prompt,
 					},
 					{
 						"type": "image",
@@ -104,31 +87,14 @@ Return only valid JSON. No explanations.`
 		return nil, fmt.Errorf("failed to marshal Claude API request: %v", err)
 	}
 
-	// Create the HTTP request
-	req, err := http.NewRequest("POST", claudeURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Claude API request: %v", err)
-	}
-
-	// Add headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", claudeAPIKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	// Send the request
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
+	// Send the request, retrying transient failures
+	client := &http.Client{Timeout: config.Timeout}
+	resp, err := sendClaudeRequest(client, claudeURL, claudeAPIKey, jsonBody, claudeRetryBaseDelay)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request to Claude API: %v", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Claude API returned non-200 status: %d - %s", resp.StatusCode, string(bodyBytes))
-	}
-
 	// Parse the response
 	var claudeResp models.ClaudeResponse
 	if err := json.NewDecoder(resp.Body).Decode(&claudeResp); err != nil {
@@ -186,35 +152,96 @@ Return only valid JSON. No explanations.`
 		return nil, fmt.Errorf("invalid_receipt_data: no items or total amount found - please ensure the receipt is clear and complete")
 	}
 
+	// Reject receipts whose amounts do not add up
+	if err := validateReceiptMath(&processedReceipt); err != nil {
+		return nil, err
+	}
+
+	// Number the items so clients can assign consumers per line
+	for i := range processedReceipt.Items {
+		processedReceipt.Items[i].Index = i
+	}
+
 	// Add the image path to the response
 	processedReceipt.ImagePath = filePath
 
 	return &processedReceipt, nil
 }
 
+// receiptMathTolerance is the largest difference, in receipt currency units, allowed
+// between a receipt's reported subtotal or total and the amounts it is built from
+const receiptMathTolerance = 1.0
+
+// validateReceiptMath checks that the items add up to the subtotal and that
+// subtotal + tax + service - discount equals the total. Checks are skipped for
+// amounts the receipt does not report.
+func validateReceiptMath(receipt *models.ProcessedReceipt) error {
+	if receipt.Subtotal != 0 && len(receipt.Items) > 0 {
+		var itemSum float64
+		for _, item := range receipt.Items {
+			itemSum += item.Price*item.Quantity - item.Discount
+		}
+		itemSum = utils.Round(itemSum)
+
+		if difference := utils.Round(itemSum - receipt.Subtotal); math.Abs(difference) > receiptMathTolerance {
+			return fmt.Errorf("receipt_math_mismatch: items add up to %.2f but the subtotal is %.2f (difference %.2f)",
+				itemSum, receipt.Subtotal, difference)
+		}
+	}
+
+	if receipt.Total != 0 && receipt.Subtotal != 0 {
+		expectedTotal := utils.Round(receipt.Subtotal + receipt.Tax + receipt.Service - receipt.Discount)
+
+		if difference := utils.Round(expectedTotal - receipt.Total); math.Abs(difference) > receiptMathTolerance {
+			return fmt.Errorf("receipt_math_mismatch: subtotal, tax, service and discount add up to %.2f but the total is %.2f (difference %.2f)",
+				expectedTotal, receipt.Total, difference)
+		}
+	}
+
+	return nil
+}
+
 // CreateExpenseFromReceipt creates an expense from a processed receipt
 func CreateExpenseFromReceipt(trip *models.Trip, receipt *models.ProcessedReceipt, paidBy string, splitType string,
-	splitAmong, defaultConsumers []string, imagePath string) (*models.Expense, error) {
+	splitAmong, defaultConsumers []string, uploadPath string) (*models.Expense, error) {
 
 	// Generate expense ID
 	expenseID := utils.GenerateID()
 
+	// Keep the uploaded image under the trip, named after the expense;
+	// it is removed again if the expense cannot be stored
+	imagePath := ""
+	if uploadPath != "" {
+		storedPath, err := StoreReceiptImage(uploadPath, trip.ID, expenseID)
+		if err != nil {
+			return nil, err
+		}
+		imagePath = storedPath
+	}
+	stored := false
+	defer func() {
+		if !stored && imagePath != "" {
+			os.Remove(filepath.Join(ReceiptUploadsDir, imagePath))
+		}
+	}()
+
 	// Set expense description
 	expenseDescription := receipt.Merchant
 	if expenseDescription == "" {
 		expenseDescription = "Receipt " + time.Now().Format("2006-01-02")
 	}
 
+	// Normalize names, mapping display names such as nicknames to their participants
+	aliases := utils.NameAliases(trip.Aliases)
+
 	if splitType == "equal" {
-		// Normalize names
-		normalizedPaidBy := utils.NormalizeName(paidBy)
-		normalizedSplitAmong := utils.NormalizeNames(splitAmong)
+		normalizedPaidBy := aliases.Key(paidBy)
+		normalizedSplitAmong := aliases.Keys(splitAmong)
 
 		// Add participants if they don't exist
 		for _, participant := range normalizedSplitAmong {
-			err := AddParticipant(trip.ID, participant)
-			if err != nil {
-				return nil, fmt.Errorf("failed to add participant %s: %v", participant, err)
+			if err := AddParticipant(trip.ID, participant); err != nil {
+				return nil, err
 			}
 		}
 
@@ -241,29 +268,27 @@ func CreateExpenseFromReceipt(trip *models.Trip, receipt *models.ProcessedReceip
 			return nil, fmt.Errorf("failed to store expense: %v", err)
 		}
 
+		stored = true
 		return expense, nil
 	} else {
-		// Normalize names
-		normalizedPaidBy := utils.NormalizeName(paidBy)
-		normalizedDefaultConsumers := utils.NormalizeNames(defaultConsumers)
+		normalizedPaidBy := aliases.Key(paidBy)
+		normalizedDefaultConsumers := aliases.Keys(defaultConsumers)
 
 		// Create items-based expense
-		expenseItems := make([]models.Item, 0, len(receipt.Items))
-
-		for _, receiptItem := range receipt.Items {
-			item := ConvertReceiptItemToExpenseItem(receiptItem, normalizedPaidBy, normalizedDefaultConsumers)
-			expenseItems = append(expenseItems, item)
+		expenseItems, err := convertReceiptItems(receipt.Items, normalizedPaidBy, normalizedDefaultConsumers)
+		if err != nil {
+			return nil, err
+		}
 
-			// Add participants
-			err := AddParticipant(trip.ID, normalizedPaidBy)
-			if err != nil {
-				return nil, fmt.Errorf("failed to add participant %s: %v", normalizedPaidBy, err)
+		// Add participants
+		if len(expenseItems) > 0 {
+			if err := AddParticipant(trip.ID, normalizedPaidBy); err != nil {
+				return nil, err
 			}
 
 			for _, consumer := range normalizedDefaultConsumers {
-				err := AddParticipant(trip.ID, consumer)
-				if err != nil {
-					return nil, fmt.Errorf("failed to add participant %s: %v", consumer, err)
+				if err := AddParticipant(trip.ID, consumer); err != nil {
+					return nil, err
 				}
 			}
 		}
@@ -285,11 +310,184 @@ func CreateExpenseFromReceipt(trip *models.Trip, receipt *models.ProcessedReceip
 		}
 
 		// FIXED: Changed StoreExpense(trip.ID, expense) to StoreExpense(expense)
-		err := StoreExpense(expense)
+		err = StoreExpense(expense)
 		if err != nil {
 			return nil, fmt.Errorf("failed to store expense: %v", err)
 		}
 
+		stored = true
 		return expense, nil
 	}
 }
+
+// convertReceiptItems converts receipt lines into expense items charged to the given
+// consumers, leaving out informational lines
+func convertReceiptItems(receiptItems []models.ReceiptItem, paidBy string, consumers []string) ([]models.Item, error) {
+	items := make([]models.Item, 0, len(receiptItems))
+	skipped := 0
+	for _, receiptItem := range receiptItems {
+		skip, err := skipReceiptLine(receiptItem)
+		if err != nil {
+			return nil, err
+		}
+		if skip {
+			skipped++
+			continue
+		}
+		items = append(items, ConvertReceiptItemToExpenseItem(receiptItem, paidBy, consumers))
+	}
+	logSkippedReceiptLines(skipped)
+	return items, nil
+}
+
+// skipReceiptLine reports whether a receipt line is informational, such as a "FOOD"
+// section header, which Claude returns with no price and no quantity. A line with a
+// price but no quantity can't be split and is rejected.
+func skipReceiptLine(item models.ReceiptItem) (bool, error) {
+	if item.Quantity > 0 {
+		return false, nil
+	}
+	if item.Price == 0 {
+		return true, nil
+	}
+	return false, utils.NewValidationError(fmt.Sprintf("Receipt line %q has a price of %.2f but no quantity", item.Name, item.Price))
+}
+
+// logSkippedReceiptLines records how many informational receipt lines were left out
+func logSkippedReceiptLines(skipped int) {
+	if skipped > 0 {
+		slog.Info("Skipped informational receipt lines", "operation", "receipt_to_expense", "skipped", skipped)
+	}
+}
+
+// CreateExpenseFromAssignedReceipt creates an item-split expense from a processed receipt
+// using the per-item consumer assignments in the request
+func CreateExpenseFromAssignedReceipt(trip *models.Trip, request *models.AddAssignedReceiptExpenseRequest) (*models.Expense, error) {
+	receipt := &request.Receipt
+	// Inline receipts come from the client, so their amounts must add up like processed ones
+	if err := validateReceiptMath(receipt); err != nil {
+		return nil, utils.NewValidationError(err.Error())
+	}
+
+	items, participants, err := assignReceiptItems(trip, request)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, participant := range participants {
+		if err := AddParticipant(trip.ID, participant); err != nil {
+			return nil, err
+		}
+	}
+
+	expenseDescription := receipt.Merchant
+	if expenseDescription == "" {
+		expenseDescription = "Receipt " + time.Now().Format("2006-01-02")
+	}
+
+	expense := &models.Expense{
+		ID:            utils.GenerateID(),
+		CreationTime:  time.Now().UnixMilli(),
+		TripID:        trip.ID,
+		Description:   expenseDescription,
+		Amount:        utils.Round(receipt.Total),
+		Subtotal:      utils.Round(receipt.Subtotal),
+		Tax:           utils.Round(receipt.Tax),
+		ServiceCharge: utils.Round(receipt.Service),
+		TotalDiscount: utils.Round(receipt.Discount),
+		PaidBy:        utils.NameAliases(trip.Aliases).Key(request.PaidBy),
+		SplitType:     utils.SplitTypeItems,
+		Items:         items,
+	}
+
+	if err := StoreExpense(expense); err != nil {
+		return nil, utils.NewInternalError("Failed to store expense")
+	}
+	return expense, nil
+}
+
+// assignReceiptItems converts receipt items into expense items, giving each item its
+// assigned consumers or the default consumers. Every consumer must be a trip participant,
+// the payer, a default consumer or one of the new participants. It returns the items and
+// the normalized names that take part in the expense.
+func assignReceiptItems(trip *models.Trip, request *models.AddAssignedReceiptExpenseRequest) ([]models.Item, []string, error) {
+	receiptItems := request.Receipt.Items
+	if len(receiptItems) == 0 {
+		return nil, nil, utils.NewValidationError("Receipt has no items")
+	}
+	// Assignments refer to each item's Index, which stays put when a client leaves
+	// informational lines out of the receipt it sends
+	indexes := make(map[int]bool, len(receiptItems))
+	for _, receiptItem := range receiptItems {
+		if indexes[receiptItem.Index] && len(request.Assignments) > 0 {
+			return nil, nil, utils.NewValidationError(fmt.Sprintf("Receipt has several items with index %d", receiptItem.Index))
+		}
+		indexes[receiptItem.Index] = true
+	}
+	for index := range request.Assignments {
+		if !indexes[index] {
+			return nil, nil, utils.NewValidationError(fmt.Sprintf("Assignment for unknown item index %d", index))
+		}
+	}
+
+	// Display names shown to clients, such as nicknames, refer to their participants
+	aliases := utils.NameAliases(trip.Aliases)
+	paidBy := aliases.Key(request.PaidBy)
+	defaultConsumers := aliases.Keys(request.DefaultConsumers)
+
+	known := participantKeys(trip)
+	known[paidBy] = true
+	for _, names := range [][]string{defaultConsumers, aliases.Keys(request.NewParticipants)} {
+		for _, name := range names {
+			known[name] = true
+		}
+	}
+
+	items := make([]models.Item, 0, len(receiptItems))
+	seen := map[string]bool{paidBy: true}
+	participants := []string{paidBy}
+	var unknown []string
+	skipped := 0
+
+	for _, receiptItem := range receiptItems {
+		skip, err := skipReceiptLine(receiptItem)
+		if err != nil {
+			return nil, nil, err
+		}
+		if skip {
+			skipped++
+			continue
+		}
+
+		consumers := defaultConsumers
+		if assigned, ok := request.Assignments[receiptItem.Index]; ok && len(assigned) > 0 {
+			consumers = aliases.Keys(assigned)
+		}
+		if len(consumers) == 0 {
+			return nil, nil, utils.NewValidationError(fmt.Sprintf("Item %d (%s) has no consumers", receiptItem.Index, receiptItem.Name))
+		}
+
+		for _, consumer := range consumers {
+			if seen[consumer] {
+				continue
+			}
+			seen[consumer] = true
+			if !known[consumer] {
+				unknown = append(unknown, utils.FormatNameForDisplay(consumer))
+				continue
+			}
+			participants = append(participants, consumer)
+		}
+
+		items = append(items, ConvertReceiptItemToExpenseItem(receiptItem, paidBy, consumers))
+	}
+
+	if len(unknown) > 0 {
+		return nil, nil, utils.NewValidationError(fmt.Sprintf("Unknown participants: %s", strings.Join(unknown, ", ")))
+	}
+	if len(items) == 0 {
+		return nil, nil, utils.NewValidationError("Receipt has no items")
+	}
+	logSkippedReceiptLines(skipped)
+	return items, participants, nil
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAssignedReceiptRequest() *models.AddAssignedReceiptExpenseRequest {
+	return &models.AddAssignedReceiptExpenseRequest{
+		Code:   "ABC123",
+		PaidBy: "Alice",
+		Receipt: models.ProcessedReceipt{
+			Merchant: "Warung",
+			Items: []models.ReceiptItem{
+				{Index: 0, Name: "Nasi Goreng", Price: 30, Quantity: 1},
+				{Index: 1, Name: "Es Teh", Price: 5, Quantity: 2},
+				{Index: 2, Name: "Sate", Price: 40, Quantity: 1},
+			},
+		},
+		DefaultConsumers: []string{"Alice", "Bob"},
+	}
+}
+
+func TestAssignReceiptItems_UsesAssignmentsAndDefaults(t *testing.T) {
+	trip := &models.Trip{ID: "trip1", Participants: []string{"Alice", "Bob", "Carol"}}
+	request := newAssignedReceiptRequest()
+	request.Assignments = map[int][]string{
+		1: {"Carol"},
+		2: {"Bob", "Dave"},
+	}
+	request.NewParticipants = []string{"Dave"}
+
+	items, participants, err := assignReceiptItems(trip, request)
+
+	assert.NoError(t, err)
+	assert.Len(t, items, 3)
+	assert.Equal(t, []string{"alice", "bob"}, items[0].Consumers)
+	assert.Equal(t, []string{"carol"}, items[1].Consumers)
+	assert.Equal(t, []string{"bob", "dave"}, items[2].Consumers)
+	assert.Equal(t, float64(10), items[1].Amount)
+	assert.Equal(t, "alice", items[2].PaidBy)
+	assert.Equal(t, []string{"alice", "bob", "carol", "dave"}, participants)
+}
+
+func TestAssignReceiptItems_AliasedTrip(t *testing.T) {
+	request := newAssignedReceiptRequest()
+	request.PaidBy = "Leo"
+	request.DefaultConsumers = []string{"Leo", "Bob"}
+	request.Assignments = map[int][]string{1: {"LEO"}}
+
+	items, participants, err := assignReceiptItems(newAliasedTrip(), request)
+
+	// The nickname means the existing participant, never a new "leo"
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"leonardo dicaprio", "bob"}, items[0].Consumers)
+	assert.Equal(t, []string{"leonardo dicaprio"}, items[1].Consumers)
+	assert.Equal(t, "leonardo dicaprio", items[2].PaidBy)
+	assert.Equal(t, []string{"leonardo dicaprio", "bob"}, participants)
+}
+
+func TestAssignReceiptItems_RejectsUnknownConsumers(t *testing.T) {
+	trip := &models.Trip{ID: "trip1", Participants: []string{"Alice", "Bob"}}
+	request := newAssignedReceiptRequest()
+	request.Assignments = map[int][]string{0: {"Bobb", "Erin"}}
+
+	_, _, err := assignReceiptItems(trip, request)
+
+	assert.EqualError(t, err, "Unknown participants: Bobb, Erin")
+}
+
+func TestAssignReceiptItems_RejectsUnknownIndex(t *testing.T) {
+	trip := &models.Trip{ID: "trip1", Participants: []string{"Alice", "Bob"}}
+	request := newAssignedReceiptRequest()
+	request.Assignments = map[int][]string{3: {"Bob"}}
+
+	_, _, err := assignReceiptItems(trip, request)
+
+	assert.Error(t, err)
+}
+
+func TestAssignReceiptItems_RequiresConsumersForEveryItem(t *testing.T) {
+	trip := &models.Trip{ID: "trip1", Participants: []string{"Alice", "Bob"}}
+	request := newAssignedReceiptRequest()
+	request.DefaultConsumers = nil
+	request.Assignments = map[int][]string{0: {"Bob"}, 1: {"Alice"}}
+
+	_, _, err := assignReceiptItems(trip, request)
+
+	assert.EqualError(t, err, "Item 2 (Sate) has no consumers")
+}
+
+func TestConvertReceiptItems_SkipsInformationalLines(t *testing.T) {
+	receiptItems := []models.ReceiptItem{
+		{Name: "FOOD", Price: 0, Quantity: 0},
+		{Name: "Nasi Goreng", Price: 25, Quantity: 2},
+		{Name: "DRINKS", Price: 0, Quantity: 0},
+		{Name: "Es Teh", Price: 5, Quantity: 1},
+	}
+
+	items, err := convertReceiptItems(receiptItems, "alice", []string{"alice", "bob"})
+
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "Nasi Goreng", items[0].Description)
+	assert.Equal(t, float64(50), items[0].Amount)
+	assert.Equal(t, "Es Teh", items[1].Description)
+}
+
+func TestConvertReceiptItems_RejectsPricedLineWithoutQuantity(t *testing.T) {
+	receiptItems := []models.ReceiptItem{
+		{Name: "Nasi Goreng", Price: 25, Quantity: 2},
+		{Name: "Sate", Price: 40, Quantity: 0},
+	}
+
+	_, err := convertReceiptItems(receiptItems, "alice", []string{"alice"})
+
+	assert.EqualError(t, err, `Receipt line "Sate" has a price of 40.00 but no quantity`)
+}
+
+func TestAssignReceiptItems_SkipsInformationalLines(t *testing.T) {
+	trip := &models.Trip{ID: "trip1", Participants: []string{"Alice", "Bob", "Carol"}}
+	request := newAssignedReceiptRequest()
+	request.Receipt.Items = []models.ReceiptItem{
+		{Index: 0, Name: "FOOD"},
+		{Index: 1, Name: "Nasi Goreng", Price: 30, Quantity: 1},
+		{Index: 2, Name: "Es Teh", Price: 5, Quantity: 2},
+	}
+	request.Assignments = map[int][]string{2: {"Carol"}}
+
+	items, _, err := assignReceiptItems(trip, request)
+
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, []string{"carol"}, items[1].Consumers)
+}
+
+func TestAssignReceiptItems_AssignsByItemIndex(t *testing.T) {
+	trip := &models.Trip{ID: "trip1", Participants: []string{"Alice", "Bob", "Carol"}}
+	request := newAssignedReceiptRequest()
+	// The client left out item 1, so Sate now sits at position 1
+	request.Receipt.Items = []models.ReceiptItem{request.Receipt.Items[0], request.Receipt.Items[2]}
+	request.Assignments = map[int][]string{2: {"Carol"}}
+
+	items, _, err := assignReceiptItems(trip, request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Sate", items[1].Description)
+	assert.Equal(t, []string{"carol"}, items[1].Consumers)
+
+	request.Assignments = map[int][]string{1: {"Carol"}}
+	_, _, err = assignReceiptItems(trip, request)
+	assert.EqualError(t, err, "Assignment for unknown item index 1")
+}
+
+func TestCreateExpenseFromAssignedReceipt_RejectsMismatchedTotal(t *testing.T) {
+	trip := &models.Trip{ID: "trip1", Participants: []string{"Alice", "Bob"}}
+	request := newAssignedReceiptRequest()
+	request.Receipt.Subtotal = 80
+	request.Receipt.Total = 5000
+
+	_, err := CreateExpenseFromAssignedReceipt(trip, request)
+
+	var appErr *utils.AppError
+	assert.ErrorAs(t, err, &appErr)
+	assert.Equal(t, http.StatusBadRequest, appErr.Code)
+	assert.True(t, strings.HasPrefix(appErr.Message, "receipt_math_mismatch:"))
+}
+
+func TestValidateReceiptMath(t *testing.T) {
+	receipt := &models.ProcessedReceipt{
+		Items: []models.ReceiptItem{
+			{Name: "Nasi Goreng", Price: 30, Quantity: 1},
+			{Name: "Es Teh", Price: 5, Quantity: 2, Discount: 1},
+		},
+		Subtotal: 39,
+		Tax:      3.9,
+		Service:  2,
+		Discount: 4,
+		Total:    40.9,
+	}
+	assert.NoError(t, validateReceiptMath(receipt))
+
+	// Small rounding differences are within tolerance
+	receipt.Total = 41.5
+	assert.NoError(t, validateReceiptMath(receipt))
+
+	// Unreported amounts are not checked
+	assert.NoError(t, validateReceiptMath(&models.ProcessedReceipt{Items: receipt.Items, Total: 100}))
+}
+
+func TestValidateReceiptMath_Mismatch(t *testing.T) {
+	receipt := &models.ProcessedReceipt{
+		Items:    []models.ReceiptItem{{Name: "Sate", Price: 40, Quantity: 2}},
+		Subtotal: 40,
+		Total:    40,
+	}
+	err := validateReceiptMath(receipt)
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "receipt_math_mismatch:"))
+	assert.Contains(t, err.Error(), "difference 40.00")
+
+	receipt.Subtotal = 80
+	receipt.Tax = 8
+	receipt.Total = 80
+	err = validateReceiptMath(receipt)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "total is 80.00")
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// ReceiptUploadsDir is where uploaded receipts are written and retained images and
+// attachments are kept. InitUploadsDir sets it from UPLOADS_DIR at startup.
+var ReceiptUploadsDir = defaultUploadsDir
+
+// defaultUploadsDir is used when UPLOADS_DIR is not set
+const defaultUploadsDir = "uploads"
+
+// InitUploadsDir reads the uploads directory from UPLOADS_DIR, defaulting to
+// "uploads", and creates it if needed
+func InitUploadsDir() error {
+	ReceiptUploadsDir = defaultUploadsDir
+	if dir := strings.TrimSpace(os.Getenv("UPLOADS_DIR")); dir != "" {
+		ReceiptUploadsDir = dir
+	}
+
+	if err := os.MkdirAll(ReceiptUploadsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create uploads directory %s: %v", ReceiptUploadsDir, err)
+	}
+	return nil
+}
+
+// Receipt image retention defaults
+const (
+	defaultReceiptImageMaxAge   = 90 * 24 * time.Hour
+	receiptImageCleanupInterval = 24 * time.Hour
+)
+
+// receiptContentTypes maps retained receipt extensions to their content type
+var receiptContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".pdf":  "application/pdf",
+}
+
+// StoreReceiptImage moves an uploaded receipt into the trip's uploads subdirectory,
+// named after the expense, and returns its path relative to ReceiptUploadsDir
+func StoreReceiptImage(uploadPath, tripID, expenseID string) (string, error) {
+	tripDir := filepath.Join(ReceiptUploadsDir, tripID)
+	if err := os.MkdirAll(tripDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create receipt directory: %v", err)
+	}
+
+	relativePath := filepath.Join(tripID, expenseID+strings.ToLower(filepath.Ext(uploadPath)))
+	if err := os.Rename(uploadPath, filepath.Join(ReceiptUploadsDir, relativePath)); err != nil {
+		return "", fmt.Errorf("failed to store receipt image: %v", err)
+	}
+	return filepath.ToSlash(relativePath), nil
+}
+
+// GetReceiptImage returns the file path and content type of the retained receipt image
+// of an expense in the given trip
+func (s *ExpenseService) GetReceiptImage(tripID, expenseID string) (string, string, error) {
+	receiptImage, err := s.repo.GetReceiptImage(tripID, expenseID)
+	if err != nil {
+		return "", "", utils.NewInternalError("Failed to get receipt image")
+	}
+	if receiptImage == "" {
+		return "", "", utils.NewNotFoundError("Receipt image")
+	}
+
+	filePath, ok := resolveReceiptImagePath(receiptImage)
+	if !ok {
+		return "", "", utils.NewNotFoundError("Receipt image")
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		return "", "", utils.NewNotFoundError("Receipt image")
+	}
+
+	contentType, ok := receiptContentTypes[strings.ToLower(filepath.Ext(filePath))]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	return filePath, contentType, nil
+}
+
+// resolveReceiptImagePath turns a stored receipt image path into a file path,
+// rejecting paths that would escape the uploads directory
+func resolveReceiptImagePath(receiptImage string) (string, bool) {
+	cleaned := filepath.Clean(filepath.FromSlash(receiptImage))
+	if filepath.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join(ReceiptUploadsDir, cleaned), true
+}
+
+// CleanupReceiptImages deletes files under dir last modified more than maxAge ago
+// and removes trip directories left empty, returning the number of files deleted.
+// Expense attachment directories are skipped.
+func CleanupReceiptImages(dir string, maxAge time.Duration, now time.Time) (int, error) {
+	cutoff := now.Add(-maxAge)
+	removed := 0
+	var dirs []string
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == attachmentsDirName {
+				return filepath.SkipDir
+			}
+			if path != dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to clean up receipt images: %v", err)
+	}
+
+	// Deepest directories first; non-empty ones fail to delete and are kept
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return removed, nil
+}
+
+// RemoveTripReceiptImages deletes every retained receipt image of a trip
+func RemoveTripReceiptImages(tripID string) error {
+	if tripID == "" || tripID == "." || tripID == ".." || strings.ContainsAny(tripID, `/\`) {
+		return fmt.Errorf("invalid trip ID %q", tripID)
+	}
+	return os.RemoveAll(filepath.Join(ReceiptUploadsDir, tripID))
+}
+
+// StartReceiptImageCleanup deletes expired receipt images now and then once a day.
+// The maximum age comes from RECEIPT_IMAGE_MAX_AGE (e.g. "720h"), defaulting to
+// 90 days; "0" keeps images forever.
+func StartReceiptImageCleanup() {
+	maxAge := receiptImageMaxAge()
+	if maxAge == 0 {
+		slog.Info("Receipt image cleanup disabled")
+		return
+	}
+
+	go func() {
+		for {
+			removed, err := CleanupReceiptImages(ReceiptUploadsDir, maxAge, time.Now())
+			if err != nil {
+				slog.Warn("Receipt image cleanup failed", "operation", "cleanup_receipt_images", "error", err)
+			} else if removed > 0 {
+				slog.Info("Deleted expired receipt images", "operation", "cleanup_receipt_images", "count", removed, "maxAge", maxAge.String())
+			}
+			time.Sleep(receiptImageCleanupInterval)
+		}
+	}()
+}
+
+// receiptImageMaxAge reads RECEIPT_IMAGE_MAX_AGE, defaulting to 90 days
+func receiptImageMaxAge() time.Duration {
+	value := os.Getenv("RECEIPT_IMAGE_MAX_AGE")
+	if value == "" {
+		return defaultReceiptImageMaxAge
+	}
+	if value == "0" {
+		return 0
+	}
+
+	maxAge, err := time.ParseDuration(value)
+	if err != nil || maxAge <= 0 {
+		slog.Warn("Invalid RECEIPT_IMAGE_MAX_AGE, using default", "value", value, "default", defaultReceiptImageMaxAge.String())
+		return defaultReceiptImageMaxAge
+	}
+	return maxAge
+}
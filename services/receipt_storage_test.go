@@ -0,0 +1,110 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveReceiptImagePath(t *testing.T) {
+	path, ok := resolveReceiptImagePath("trip1/expense1.jpg")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(ReceiptUploadsDir, "trip1", "expense1.jpg"), path)
+
+	// Images stored before per-trip directories live at the top level
+	path, ok = resolveReceiptImagePath("legacy.png")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(ReceiptUploadsDir, "legacy.png"), path)
+
+	for _, stored := range []string{"../main.go", "trip1/../../main.go", "/etc/passwd", ".."} {
+		_, ok := resolveReceiptImagePath(stored)
+		assert.False(t, ok, stored)
+	}
+}
+
+func TestCleanupReceiptImages(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	write := func(name string, age time.Duration) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("image"), 0644))
+		assert.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+		return path
+	}
+
+	expired := write("trip1/old.jpg", 48*time.Hour)
+	fresh := write("trip2/new.jpg", time.Hour)
+	write("trip2/old.png", 72*time.Hour)
+	attachment := write("trip2/exp1/attachments/note.txt", 72*time.Hour)
+
+	removed, err := CleanupReceiptImages(dir, 24*time.Hour, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.NoFileExists(t, expired)
+	assert.FileExists(t, fresh)
+	assert.FileExists(t, attachment)
+	assert.NoDirExists(t, filepath.Join(dir, "trip1"))
+	assert.DirExists(t, filepath.Join(dir, "trip2"))
+}
+
+func TestReceiptImageMaxAge(t *testing.T) {
+	t.Setenv("RECEIPT_IMAGE_MAX_AGE", "")
+	assert.Equal(t, defaultReceiptImageMaxAge, receiptImageMaxAge())
+
+	t.Setenv("RECEIPT_IMAGE_MAX_AGE", "720h")
+	assert.Equal(t, 720*time.Hour, receiptImageMaxAge())
+
+	t.Setenv("RECEIPT_IMAGE_MAX_AGE", "0")
+	assert.Equal(t, time.Duration(0), receiptImageMaxAge())
+
+	t.Setenv("RECEIPT_IMAGE_MAX_AGE", "forever")
+	assert.Equal(t, defaultReceiptImageMaxAge, receiptImageMaxAge())
+}
+
+func TestRemoveTripReceiptImages_RejectsPathsOutsideUploads(t *testing.T) {
+	assert.Error(t, RemoveTripReceiptImages(""))
+	assert.Error(t, RemoveTripReceiptImages("../etc"))
+	assert.Error(t, RemoveTripReceiptImages("a/b"))
+	assert.Error(t, RemoveTripReceiptImages(".."))
+}
+
+func TestInitUploadsDir_StoresReceiptsInConfiguredDir(t *testing.T) {
+	inTempDir(t)
+	uploads := filepath.Join(t.TempDir(), "mounted", "uploads")
+	t.Setenv("UPLOADS_DIR", uploads)
+	t.Cleanup(func() { ReceiptUploadsDir = defaultUploadsDir })
+
+	assert.NoError(t, InitUploadsDir())
+	assert.Equal(t, uploads, ReceiptUploadsDir)
+	assert.DirExists(t, uploads)
+
+	upload := filepath.Join(uploads, "upload.JPG")
+	assert.NoError(t, os.WriteFile(upload, []byte("image"), 0644))
+
+	stored, err := StoreReceiptImage(upload, "trip1", "exp1")
+	assert.NoError(t, err)
+	assert.Equal(t, "trip1/exp1.jpg", stored)
+	assert.FileExists(t, filepath.Join(uploads, "trip1", "exp1.jpg"))
+
+	path, ok := resolveReceiptImagePath(stored)
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(uploads, "trip1", "exp1.jpg"), path)
+
+	// Nothing is written to the default directory
+	assert.NoDirExists(t, defaultUploadsDir)
+}
+
+func TestInitUploadsDir_DefaultsToUploads(t *testing.T) {
+	inTempDir(t)
+	t.Setenv("UPLOADS_DIR", "")
+
+	assert.NoError(t, InitUploadsDir())
+	assert.Equal(t, "uploads", ReceiptUploadsDir)
+	assert.DirExists(t, "uploads")
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"encoding/json"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// ReceiptService keeps processed receipts so expenses can be created from them later
+type ReceiptService struct {
+	repo *repository.ReceiptRepository
+}
+
+// NewReceiptService creates a new receipt service
+func NewReceiptService(repo *repository.ReceiptRepository) *ReceiptService {
+	return &ReceiptService{
+		repo: repo,
+	}
+}
+
+// SaveReceipt stores a processed receipt and sets its generated ID
+func (s *ReceiptService) SaveReceipt(receipt *models.ProcessedReceipt) error {
+	stored := *receipt
+	stored.ID = ""
+	stored.ImagePath = ""
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return utils.NewInternalError("Failed to serialize receipt")
+	}
+
+	id := utils.GenerateID()
+	if err := s.repo.CreateReceipt(id, data); err != nil {
+		return utils.NewInternalError("Failed to store receipt")
+	}
+
+	receipt.ID = id
+	return nil
+}
+
+// GetReceipt returns a stored processed receipt by ID
+func (s *ReceiptService) GetReceipt(id string) (*models.ProcessedReceipt, error) {
+	data, err := s.repo.GetReceipt(id)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve receipt")
+	}
+	if data == nil {
+		return nil, utils.NewNotFoundError("Receipt")
+	}
+
+	var receipt models.ProcessedReceipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		return nil, utils.NewInternalError("Failed to read stored receipt")
+	}
+	receipt.ID = id
+	return &receipt, nil
+}
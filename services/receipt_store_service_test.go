@@ -0,0 +1,75 @@
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockReceiptService(t *testing.T) (*ReceiptService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return NewReceiptService(repository.NewReceiptRepository(db)), mock
+}
+
+// receiptJSON matches stored receipt data without the ID or image path
+type receiptJSON struct{}
+
+func (receiptJSON) Match(value driver.Value) bool {
+	var receipt models.ProcessedReceipt
+	data, ok := value.([]byte)
+	return ok && json.Unmarshal(data, &receipt) == nil &&
+		receipt.ID == "" && receipt.ImagePath == "" && receipt.Merchant == "Warung"
+}
+
+func TestReceiptService_SaveReceipt(t *testing.T) {
+	service, mock := newMockReceiptService(t)
+	receipt := &models.ProcessedReceipt{
+		Merchant:  "Warung",
+		Items:     []models.ReceiptItem{{Name: "Sate", Price: 40, Quantity: 1}},
+		Total:     40,
+		ImagePath: "uploads/upload.jpg",
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO receipts")).
+		WithArgs(sqlmock.AnyArg(), receiptJSON{}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := service.SaveReceipt(receipt)
+
+	assert.NoError(t, err)
+	assert.Len(t, receipt.ID, utils.IDLength)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReceiptService_GetReceipt(t *testing.T) {
+	service, mock := newMockReceiptService(t)
+	query := regexp.QuoteMeta("SELECT data FROM receipts WHERE id = $1")
+
+	mock.ExpectQuery(query).WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).
+			AddRow([]byte(`{"merchant":"Warung","items":[{"index":0,"name":"Sate","price":40,"quantity":1}],"total":40}`)))
+	mock.ExpectQuery(query).WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"data"}))
+
+	receipt, err := service.GetReceipt("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", receipt.ID)
+	assert.Equal(t, "Warung", receipt.Merchant)
+	assert.Len(t, receipt.Items, 1)
+
+	_, err = service.GetReceipt("missing")
+	appErr, ok := err.(*utils.AppError)
+	assert.True(t, ok)
+	assert.Equal(t, 404, appErr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// ReconcileMaxDaysApart is how far a bank transaction's date may drift from the recorded payment date
+const ReconcileMaxDaysApart = 3
+
+// reconcileAmountTolerance is the largest amount difference still considered a match
+const reconcileAmountTolerance = 0.01
+
+// bankDateLayouts lists the date formats accepted in bank statement exports
+var bankDateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"02/01/2006",
+	"02-01-2006",
+	"2/1/2006",
+	time.RFC3339,
+}
+
+// ParseBankStatementCSV parses a CSV with (date, amount, counterparty) columns.
+// A header row is skipped when its first column isn't a date.
+func ParseBankStatementCSV(r io.Reader) ([]models.BankTransaction, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var transactions []models.BankTransaction
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		line++
+
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected date, amount and counterparty columns", line)
+		}
+
+		date, err := parseBankDate(record[0])
+		if err != nil {
+			if line == 1 {
+				continue // Header row
+			}
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		amount, err := parseBankAmount(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		transaction := models.BankTransaction{
+			Row:    line,
+			Date:   date,
+			Amount: amount,
+		}
+		if len(record) > 2 {
+			transaction.Counterparty = strings.TrimSpace(record[2])
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, nil
+}
+
+// parseBankDate parses a date using the supported bank export layouts
+func parseBankDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range bankDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+// parseBankAmount parses an amount such as "-57.500", "1,250.00" or "Rp 57.500,50"
+// and returns its absolute value
+func parseBankAmount(value string) (float64, error) {
+	var cleaned strings.Builder
+	for _, r := range value {
+		if (r >= '0' && r <= '9') || r == '.' || r == ',' {
+			cleaned.WriteRune(r)
+		}
+	}
+	number := cleaned.String()
+	if number == "" {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+
+	lastDot := strings.LastIndex(number, ".")
+	lastComma := strings.LastIndex(number, ",")
+
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// Whichever separator comes last is the decimal separator
+		if lastComma > lastDot {
+			number = strings.ReplaceAll(number, ".", "")
+			number = strings.Replace(number, ",", ".", 1)
+		} else {
+			number = strings.ReplaceAll(number, ",", "")
+		}
+	case lastComma >= 0:
+		if strings.Count(number, ",") == 1 && len(number)-lastComma-1 != 3 {
+			number = strings.Replace(number, ",", ".", 1)
+		} else {
+			number = strings.ReplaceAll(number, ",", "")
+		}
+	case lastDot >= 0:
+		// A single dot followed by exactly three digits is a thousands separator
+		if strings.Count(number, ".") > 1 || len(number)-lastDot-1 == 3 {
+			number = strings.ReplaceAll(number, ".", "")
+		}
+	}
+
+	amount, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	return math.Abs(amount), nil
+}
+
+// ReconcilePayments matches bank transactions to recorded payments by amount and
+// date proximity. Each payment matches at most one transaction. Among candidates
+// a counterparty naming one of the payment's people wins, then the closest date.
+func ReconcilePayments(transactions []models.BankTransaction, payments []models.Payment, maxDaysApart int) models.ReconcileResult {
+	result := models.ReconcileResult{
+		Matched:               []models.ReconcileMatch{},
+		UnmatchedTransactions: []models.BankTransaction{},
+		UnmatchedPayments:     []models.Payment{},
+	}
+
+	used := make([]bool, len(payments))
+	for _, transaction := range transactions {
+		best := -1
+		bestDays := 0
+		bestNamed := false
+
+		for i, payment := range payments {
+			if used[i] || math.Abs(payment.Amount-transaction.Amount) > reconcileAmountTolerance {
+				continue
+			}
+
+			days := daysApart(transaction.Date, payment.PaymentDate)
+			if days > maxDaysApart {
+				continue
+			}
+
+			named := counterpartyMatches(transaction.Counterparty, payment)
+			if best == -1 || (named && !bestNamed) || (named == bestNamed && days < bestDays) {
+				best, bestDays, bestNamed = i, days, named
+			}
+		}
+
+		if best == -1 {
+			result.UnmatchedTransactions = append(result.UnmatchedTransactions, transaction)
+			continue
+		}
+
+		used[best] = true
+		result.Matched = append(result.Matched, models.ReconcileMatch{
+			Transaction: transaction,
+			Payment:     payments[best],
+			DaysApart:   bestDays,
+		})
+	}
+
+	for i, payment := range payments {
+		if !used[i] {
+			result.UnmatchedPayments = append(result.UnmatchedPayments, payment)
+		}
+	}
+
+	return result
+}
+
+// daysApart returns the number of calendar days between two dates
+func daysApart(a, b time.Time) int {
+	dayA := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	dayB := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	days := dayA.Sub(dayB).Hours() / 24
+	return int(math.Abs(math.Round(days)))
+}
+
+// counterpartyMatches reports whether a counterparty names either side of a payment
+func counterpartyMatches(counterparty string, payment models.Payment) bool {
+	counterparty = utils.NormalizeName(counterparty)
+	if counterparty == "" {
+		return false
+	}
+	for _, person := range []string{payment.FromPerson, payment.ToPerson} {
+		person = utils.NormalizeName(person)
+		if person != "" && strings.Contains(counterparty, person) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReconcileBankStatement parses a bank statement CSV and matches it against a trip's payments
+func (s *PaymentService) ReconcileBankStatement(tripCode string, statement io.Reader) (*models.ReconcileResult, error) {
+	transactions, err := ParseBankStatementCSV(statement)
+	if err != nil {
+		return nil, utils.NewValidationError(err.Error())
+	}
+	if len(transactions) == 0 {
+		return nil, utils.NewValidationError("bank statement contains no transactions")
+	}
+
+	payments, err := s.GetPaymentsByTripCode(tripCode)
+	var appErr *utils.AppError
+	if errors.As(err, &appErr) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve payments")
+	}
+
+	result := ReconcilePayments(transactions, payments, ReconcileMaxDaysApart)
+	return &result, nil
+}
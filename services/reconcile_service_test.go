@@ -0,0 +1,71 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBankStatementCSV(t *testing.T) {
+	csvData := `Date,Amount,Counterparty
+2024-03-01,-57.500,ALICE SMITH
+02/03/2024,"1,250.00",Bob
+2024-03-04,"Rp 20.000,50",
+`
+
+	transactions, err := ParseBankStatementCSV(strings.NewReader(csvData))
+
+	assert.NoError(t, err)
+	assert.Len(t, transactions, 3)
+	assert.Equal(t, float64(57500), transactions[0].Amount)
+	assert.Equal(t, "ALICE SMITH", transactions[0].Counterparty)
+	assert.Equal(t, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), transactions[1].Date)
+	assert.Equal(t, float64(1250), transactions[1].Amount)
+	assert.Equal(t, 20000.5, transactions[2].Amount)
+	assert.Equal(t, 4, transactions[2].Row)
+}
+
+func TestParseBankStatementCSV_InvalidRow(t *testing.T) {
+	_, err := ParseBankStatementCSV(strings.NewReader("2024-03-01,100,Alice\nnot-a-date,100,Bob\n"))
+	assert.Error(t, err)
+}
+
+func TestReconcileBankStatement_InvalidCSV(t *testing.T) {
+	service, _ := newMockPaymentService(t)
+
+	_, err := service.ReconcileBankStatement("ABC123", strings.NewReader("not-a-date,100,Bob\n"))
+
+	var appErr *utils.AppError
+	assert.ErrorAs(t, err, &appErr)
+	assert.Equal(t, http.StatusBadRequest, appErr.Code)
+}
+
+func TestReconcilePayments(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 12, 0, 0, 0, time.UTC) }
+
+	payments := []models.Payment{
+		{ID: 1, FromPerson: "bob", ToPerson: "alice", Amount: 50000, PaymentDate: day(1)},
+		{ID: 2, FromPerson: "carol", ToPerson: "alice", Amount: 50000, PaymentDate: day(2)},
+		{ID: 3, FromPerson: "dave", ToPerson: "alice", Amount: 75000, PaymentDate: day(1)},
+	}
+	transactions := []models.BankTransaction{
+		{Row: 2, Date: day(2), Amount: 50000, Counterparty: "TRF BOB"}, // Bob is named, so payment 1 wins over the closer payment 2
+		{Row: 3, Date: day(3), Amount: 50000},                          // Remaining 50k payment
+		{Row: 4, Date: day(20), Amount: 75000},                         // Too far from payment 3
+	}
+
+	result := ReconcilePayments(transactions, payments, ReconcileMaxDaysApart)
+
+	assert.Len(t, result.Matched, 2)
+	assert.Equal(t, 1, result.Matched[0].Payment.ID)
+	assert.Equal(t, 1, result.Matched[0].DaysApart)
+	assert.Equal(t, 2, result.Matched[1].Payment.ID)
+	assert.Equal(t, []models.BankTransaction{transactions[2]}, result.UnmatchedTransactions)
+	assert.Len(t, result.UnmatchedPayments, 1)
+	assert.Equal(t, 3, result.UnmatchedPayments[0].ID)
+}
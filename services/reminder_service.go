@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// DefaultReminderDueDays is used when a reminder request doesn't specify a due date
+const DefaultReminderDueDays = 7
+
+// BuildSettlementReminders groups settlements by debtor into reminder entries
+func BuildSettlementReminders(settlements []models.Settlement, dueDate time.Time) []models.SettlementReminder {
+	byDebtor := make(map[string]*models.SettlementReminder)
+	var debtors []string
+
+	for _, settlement := range settlements {
+		reminder, exists := byDebtor[settlement.From]
+		if !exists {
+			reminder = &models.SettlementReminder{
+				Debtor:  settlement.From,
+				DueDate: dueDate.Format("2006-01-02"),
+			}
+			byDebtor[settlement.From] = reminder
+			debtors = append(debtors, settlement.From)
+		}
+		reminder.Payments = append(reminder.Payments, models.ReminderPayment{
+			To:     settlement.To,
+			Amount: settlement.Amount,
+		})
+		reminder.TotalDue = utils.Round(reminder.TotalDue + settlement.Amount)
+	}
+
+	sort.Strings(debtors)
+	reminders := make([]models.SettlementReminder, 0, len(debtors))
+	for _, debtor := range debtors {
+		reminders = append(reminders, *byDebtor[debtor])
+	}
+	return reminders
+}
+
+// GenerateRemindersICS renders reminders as an iCalendar document with one
+// all-day event per debtor on the due date
+func GenerateRemindersICS(trip *models.Trip, reminders []models.SettlementReminder, now time.Time) string {
+	var b strings.Builder
+	writeICSLine(&b, "BEGIN:VCALENDAR")
+	writeICSLine(&b, "VERSION:2.0")
+	writeICSLine(&b, "PRODID:-//ShareTab//Settlement Reminders//EN")
+	writeICSLine(&b, "CALSCALE:GREGORIAN")
+	writeICSLine(&b, "METHOD:PUBLISH")
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, reminder := range reminders {
+		dueDate, err := time.Parse("2006-01-02", reminder.DueDate)
+		if err != nil {
+			continue
+		}
+
+		var lines []string
+		for _, payment := range reminder.Payments {
+			lines = append(lines, fmt.Sprintf("Pay %s %.2f", payment.To, payment.Amount))
+		}
+
+		writeICSLine(&b, "BEGIN:VEVENT")
+		writeICSLine(&b, fmt.Sprintf("UID:%s-%s@sharetab", trip.Code, strings.ToLower(utils.CleanFileName(reminder.Debtor))))
+		writeICSLine(&b, "DTSTAMP:"+stamp)
+		writeICSLine(&b, "DTSTART;VALUE=DATE:"+dueDate.Format("20060102"))
+		writeICSLine(&b, "DTEND;VALUE=DATE:"+dueDate.AddDate(0, 0, 1).Format("20060102"))
+		writeICSLine(&b, "SUMMARY:"+escapeICSText(fmt.Sprintf("%s: settle %.2f for %s", reminder.Debtor, reminder.TotalDue, trip.Name)))
+		writeICSLine(&b, "DESCRIPTION:"+escapeICSText(strings.Join(lines, "\n")))
+		writeICSLine(&b, "BEGIN:VALARM")
+		writeICSLine(&b, "ACTION:DISPLAY")
+		writeICSLine(&b, "DESCRIPTION:"+escapeICSText("Settle up for "+trip.Name))
+		writeICSLine(&b, "TRIGGER:-PT9H")
+		writeICSLine(&b, "END:VALARM")
+		writeICSLine(&b, "END:VEVENT")
+	}
+
+	writeICSLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// escapeICSText escapes text values per RFC 5545
+func escapeICSText(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return replacer.Replace(value)
+}
+
+// writeICSLine writes a content line, folding it at 75 octets as RFC 5545 requires
+func writeICSLine(b *strings.Builder, line string) {
+	maxOctets := 75
+	for len(line) > maxOctets {
+		cut := maxOctets
+		// Don't split a multi-byte UTF-8 sequence
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		maxOctets = 74 // Continuation lines start with a space
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
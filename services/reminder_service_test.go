@@ -0,0 +1,68 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSettlementReminders_GroupsByDebtor(t *testing.T) {
+	settlements := []models.Settlement{
+		{From: "Carol", To: "Alice", Amount: 20},
+		{From: "Bob", To: "Alice", Amount: 57.5},
+		{From: "Carol", To: "Dave", Amount: 10.25},
+	}
+	due := time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)
+
+	reminders := BuildSettlementReminders(settlements, due)
+
+	assert.Len(t, reminders, 2)
+	assert.Equal(t, "Bob", reminders[0].Debtor)
+	assert.Equal(t, 57.5, reminders[0].TotalDue)
+	assert.Equal(t, "Carol", reminders[1].Debtor)
+	assert.Equal(t, 30.25, reminders[1].TotalDue)
+	assert.Len(t, reminders[1].Payments, 2)
+	assert.Equal(t, "2024-03-08", reminders[1].DueDate)
+}
+
+func TestGenerateRemindersICS(t *testing.T) {
+	trip := &models.Trip{Code: "ABC123", Name: "Bali, 2024"}
+	reminders := []models.SettlementReminder{
+		{
+			Debtor:   "Bob",
+			TotalDue: 57.5,
+			DueDate:  "2024-03-08",
+			Payments: []models.ReminderPayment{{To: "Alice", Amount: 57.5}},
+		},
+	}
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	ics := GenerateRemindersICS(trip, reminders, now)
+
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(ics, "END:VCALENDAR\r\n"))
+	assert.Contains(t, ics, "UID:ABC123-bob@sharetab\r\n")
+	assert.Contains(t, ics, "DTSTAMP:20240301T100000Z\r\n")
+	assert.Contains(t, ics, "DTSTART;VALUE=DATE:20240308\r\n")
+	assert.Contains(t, ics, "DTEND;VALUE=DATE:20240309\r\n")
+	assert.Contains(t, ics, `SUMMARY:Bob: settle 57.50 for Bali\, 2024`)
+	assert.Contains(t, ics, "DESCRIPTION:Pay Alice 57.50\r\n")
+
+	for _, line := range strings.Split(ics, "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+}
+
+func TestWriteICSLine_FoldsLongLines(t *testing.T) {
+	var b strings.Builder
+	writeICSLine(&b, "DESCRIPTION:"+strings.Repeat("é", 120))
+
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+	unfolded := strings.ReplaceAll(b.String(), "\r\n ", "")
+	assert.Equal(t, "DESCRIPTION:"+strings.Repeat("é", 120)+"\r\n", unfolded)
+}
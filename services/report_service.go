@@ -0,0 +1,253 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// ReportService handles trip spending reports
+type ReportService struct {
+	expenseService *ExpenseService
+	paymentService *PaymentService
+}
+
+// NewReportService creates a new report service
+func NewReportService(expenseService *ExpenseService, paymentService *PaymentService) *ReportService {
+	return &ReportService{
+		expenseService: expenseService,
+		paymentService: paymentService,
+	}
+}
+
+// Limits on expense search results
+const (
+	DefaultExpenseSearchLimit = 50
+	MaxExpenseSearchLimit     = 100
+)
+
+// SearchExpenses finds expenses whose description contains query across all of an
+// owner's trips, newest first. A limit of 0 uses DefaultExpenseSearchLimit.
+func (s *ReportService) SearchExpenses(owner, query string, limit int) ([]models.ExpenseMatch, error) {
+	if err := utils.ValidateRequired(owner, "owner"); err != nil {
+		return nil, err
+	}
+	query = strings.TrimSpace(query)
+	if err := utils.ValidateRequired(query, "query"); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultExpenseSearchLimit
+	}
+	if limit > MaxExpenseSearchLimit {
+		limit = MaxExpenseSearchLimit
+	}
+
+	matches, err := s.expenseService.repo.SearchOwnerExpenses(owner, query, limit)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to search expenses")
+	}
+
+	for i := range matches {
+		matches[i].PaidBy = utils.FormatNameForDisplay(matches[i].PaidBy)
+	}
+	return matches, nil
+}
+
+// GetCategoryBreakdown returns a trip's total spend grouped by expense category
+func (s *ReportService) GetCategoryBreakdown(tripID string) (*models.CategoryBreakdownResult, error) {
+	expenses, err := s.expenseService.GetExpenses(tripID)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := summarizeCategories(expenses)
+
+	var grandTotal float64
+	for _, category := range categories {
+		grandTotal += category.Total
+	}
+
+	return &models.CategoryBreakdownResult{
+		Categories: categories,
+		GrandTotal: utils.Round(grandTotal),
+	}, nil
+}
+
+// GetTripStats returns aggregate spending statistics for a trip, including the
+// participants who have taken no part in it so far
+func (s *ReportService) GetTripStats(trip *models.Trip) (*models.TripStats, error) {
+	expenses, err := s.expenseService.GetExpenses(trip.ID)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := s.paymentService.GetPaymentsByTripID(trip.ID)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve payments")
+	}
+
+	stats := calculateTripStats(expenses, trip.Currency)
+	stats.InactiveParticipants = inactiveParticipants(trip.Participants, stats.People, payments)
+	return stats, nil
+}
+
+// inactiveParticipants lists, in trip order, the participants who neither paid for
+// nor consumed any expense and appear in no payment. Being in an equal split counts
+// as consuming, since that share is still owed. Organizers can usually remove them.
+func inactiveParticipants(participants []string, people []models.PersonStats, payments []models.Payment) []string {
+	active := make(map[string]bool)
+	for _, person := range people {
+		if person.TotalSpent != 0 || person.TotalOwed != 0 {
+			active[utils.NormalizeName(person.Name)] = true
+		}
+	}
+	for _, payment := range payments {
+		active[utils.NormalizeName(payment.FromPerson)] = true
+		active[utils.NormalizeName(payment.ToPerson)] = true
+	}
+
+	inactive := []string{}
+	for _, participant := range participants {
+		if !active[utils.NormalizeName(participant)] {
+			inactive = append(inactive, participant)
+		}
+	}
+	return inactive
+}
+
+// GetSpendingTimeline returns a trip's spending per day with per-person running totals
+func (s *ReportService) GetSpendingTimeline(trip *models.Trip) (*models.SpendingTimeline, error) {
+	expenses, err := s.expenseService.GetExpenses(trip.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return calculateSpendingTimeline(expenses, trip.Currency), nil
+}
+
+// calculateSpendingTimeline buckets expenses by creation date and accumulates each
+// person's share day by day. Only days with expenses are included.
+func calculateSpendingTimeline(expenses []*models.Expense, currency string) *models.SpendingTimeline {
+	byDate := make(map[string][]*models.Expense)
+	for _, expense := range expenses {
+		date := formatExpenseDate(expense.CreationTime)
+		byDate[date] = append(byDate[date], expense)
+	}
+
+	dates := make([]string, 0, len(byDate))
+	for date := range byDate {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	timeline := &models.SpendingTimeline{Days: []models.SpendingTimelineDay{}}
+	running := make(map[string]float64)
+	for _, date := range dates {
+		day := models.SpendingTimelineDay{
+			Date:       date,
+			Cumulative: make(map[string]float64),
+		}
+		for _, expense := range byDate[date] {
+			day.TotalSpent += expense.Amount
+		}
+		day.TotalSpent = utils.Round(day.TotalSpent)
+
+		for _, summary := range calculatePersonSummaries(byDate[date], currency) {
+			running[summary.Name] += summary.TotalOwed
+		}
+		for name, total := range running {
+			day.Cumulative[name] = utils.Round(total)
+		}
+
+		timeline.Days = append(timeline.Days, day)
+	}
+
+	return timeline
+}
+
+// calculateTripStats aggregates expenses in a single pass, plus per-person totals
+// An empty trip yields zero values and an empty people list
+func calculateTripStats(expenses []*models.Expense, currency string) *models.TripStats {
+	stats := &models.TripStats{People: []models.PersonStats{}, InactiveParticipants: []string{}}
+
+	payerCounts := make(map[string]int)
+	var biggest *models.Expense
+	for _, expense := range expenses {
+		stats.TotalSpent += expense.Amount
+		stats.ExpenseCount++
+		payerCounts[expense.PaidBy]++
+		if biggest == nil || expense.Amount > biggest.Amount {
+			biggest = expense
+		}
+	}
+
+	if stats.ExpenseCount == 0 {
+		return stats
+	}
+
+	stats.TotalSpent = utils.Round(stats.TotalSpent)
+	stats.AverageExpense = utils.Round(stats.TotalSpent / float64(stats.ExpenseCount))
+	stats.BiggestExpense = models.ExpenseHighlight{
+		ID:          biggest.ID,
+		Description: biggest.Description,
+		Amount:      utils.Round(biggest.Amount),
+		PaidBy:      utils.FormatNameForDisplay(biggest.PaidBy),
+	}
+
+	// Ties go to the alphabetically first payer for a stable answer
+	for payer, count := range payerCounts {
+		name := utils.FormatNameForDisplay(payer)
+		if count > stats.MostActivePayerCount || (count == stats.MostActivePayerCount && name < stats.MostActivePayer) {
+			stats.MostActivePayer = name
+			stats.MostActivePayerCount = count
+		}
+	}
+
+	for _, summary := range sortedPersonSummaries(expenses, currency) {
+		stats.People = append(stats.People, models.PersonStats{
+			Name:       summary.Name,
+			TotalSpent: utils.Round(summary.TotalSpent),
+			TotalOwed:  utils.Round(summary.TotalOwed),
+			NetBalance: utils.Round(summary.NetBalance),
+		})
+	}
+
+	return stats
+}
+
+// summarizeCategories totals expense amounts per category, largest total first
+// Expenses without a category are grouped as uncategorized
+func summarizeCategories(expenses []*models.Expense) []models.CategoryTotal {
+	totals := make(map[string]*models.CategoryTotal)
+	for _, expense := range expenses {
+		category := utils.NormalizeCategory(expense.Category)
+		if category == "" {
+			category = utils.UncategorizedCategory
+		}
+
+		total, exists := totals[category]
+		if !exists {
+			total = &models.CategoryTotal{Category: category}
+			totals[category] = total
+		}
+		total.Total += expense.Amount
+		total.Count++
+	}
+
+	result := make([]models.CategoryTotal, 0, len(totals))
+	for _, total := range totals {
+		total.Total = utils.Round(total.Total)
+		result = append(result, *total)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].Category < result[j].Category
+	})
+
+	return result
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarizeCategories(t *testing.T) {
+	expenses := []*models.Expense{
+		{Amount: 120000, Category: "food"},
+		{Amount: 50000, Category: "transport"},
+		{Amount: 30000, Category: "Food"},
+		{Amount: 50000},
+	}
+
+	categories := summarizeCategories(expenses)
+
+	assert.Equal(t, []models.CategoryTotal{
+		{Category: "food", Total: 150000, Count: 2},
+		{Category: "transport", Total: 50000, Count: 1},
+		{Category: "uncategorized", Total: 50000, Count: 1},
+	}, categories)
+}
+
+func TestSummarizeCategories_NoExpenses(t *testing.T) {
+	categories := summarizeCategories(nil)
+
+	assert.NotNil(t, categories)
+	assert.Empty(t, categories)
+}
+
+func TestCalculateTripStats(t *testing.T) {
+	expenses := []*models.Expense{
+		{ID: "e1", Description: "Dinner", Amount: 90, PaidBy: "alice", SplitType: "equal", SplitAmong: []string{"alice", "bob", "carol"}},
+		{ID: "e2", Description: "Hotel", Amount: 300, PaidBy: "bob", SplitType: "equal", SplitAmong: []string{"alice", "bob", "carol"}},
+		{ID: "e3", Description: "Taxi", Amount: 30, PaidBy: "alice", SplitType: "equal", SplitAmong: []string{"alice", "bob", "carol"}},
+	}
+
+	stats := calculateTripStats(expenses, "")
+
+	assert.Equal(t, 420.0, stats.TotalSpent)
+	assert.Equal(t, 3, stats.ExpenseCount)
+	assert.Equal(t, 140.0, stats.AverageExpense)
+	assert.Equal(t, "e2", stats.BiggestExpense.ID)
+	assert.Equal(t, "Bob", stats.BiggestExpense.PaidBy)
+	assert.Equal(t, "Alice", stats.MostActivePayer)
+	assert.Equal(t, 2, stats.MostActivePayerCount)
+
+	assert.Equal(t, []models.PersonStats{
+		{Name: "Alice", TotalSpent: 120, TotalOwed: 140, NetBalance: -20},
+		{Name: "Bob", TotalSpent: 300, TotalOwed: 140, NetBalance: 160},
+		{Name: "Carol", TotalSpent: 0, TotalOwed: 140, NetBalance: -140},
+	}, stats.People)
+}
+
+func TestCalculateTripStats_EmptyTrip(t *testing.T) {
+	stats := calculateTripStats(nil, "")
+
+	assert.Equal(t, 0.0, stats.TotalSpent)
+	assert.Equal(t, 0, stats.ExpenseCount)
+	assert.Equal(t, 0.0, stats.AverageExpense)
+	assert.Equal(t, "", stats.MostActivePayer)
+	assert.NotNil(t, stats.People)
+	assert.Empty(t, stats.People)
+}
+
+func TestInactiveParticipants(t *testing.T) {
+	people := []models.PersonStats{
+		{Name: "Alice", TotalSpent: 100, TotalOwed: 50, NetBalance: 50},
+		{Name: "Bob", TotalOwed: 50, NetBalance: -50},
+		{Name: "Dave"}, // Listed on a free item only
+	}
+	payments := []models.Payment{{FromPerson: "carol", ToPerson: "alice", Amount: 10}}
+
+	inactive := inactiveParticipants([]string{"Alice", "Bob", "Carol", "Dave", "Erin"}, people, payments)
+
+	assert.Equal(t, []string{"Dave", "Erin"}, inactive)
+	assert.Equal(t, []string{}, inactiveParticipants(nil, people, payments))
+}
+
+func TestCalculateSpendingTimeline(t *testing.T) {
+	day1 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local).UnixMilli()
+	day3 := time.Date(2024, 3, 3, 12, 0, 0, 0, time.Local).UnixMilli()
+	everyone := []string{"alice", "bob"}
+
+	expenses := []*models.Expense{
+		{Amount: 60, PaidBy: "bob", SplitType: "equal", SplitAmong: []string{"alice", "bob", "carol"}, CreationTime: day3},
+		{Amount: 100, PaidBy: "alice", SplitType: "equal", SplitAmong: everyone, CreationTime: day1},
+		{Amount: 40, PaidBy: "bob", SplitType: "equal", SplitAmong: everyone, CreationTime: day1 + 3600000},
+	}
+
+	timeline := calculateSpendingTimeline(expenses, "")
+
+	assert.Equal(t, []models.SpendingTimelineDay{
+		{Date: "2024-03-01", TotalSpent: 140, Cumulative: map[string]float64{"Alice": 70, "Bob": 70}},
+		{Date: "2024-03-03", TotalSpent: 60, Cumulative: map[string]float64{"Alice": 90, "Bob": 90, "Carol": 20}},
+	}, timeline.Days)
+}
+
+func TestCalculateSpendingTimeline_NoExpenses(t *testing.T) {
+	timeline := calculateSpendingTimeline(nil, "")
+
+	assert.NotNil(t, timeline.Days)
+	assert.Empty(t, timeline.Days)
+}
+
+func TestReportService_SearchExpenses(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := NewReportService(&ExpenseService{repo: &repository.ExpenseRepository{DB: db}}, nil)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expenses e JOIN trips t ON t.id = e.trip_id")).
+		WithArgs("owner-1", `%50\% off hotel%`, DefaultExpenseSearchLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "name", "description", "amount", "paid_by", "category", "creation_time"}).
+			AddRow("exp2", "BALI24", "Bali", "50% off hotel", 120.0, "mary jane", "lodging", int64(2000)).
+			AddRow("exp1", "TOKY23", "Tokyo", "Hotel 50% off hotel deal", 300.0, "bob", "", int64(1000)))
+
+	matches, err := service.SearchExpenses("owner-1", " 50% off hotel ", 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ExpenseMatch{
+		{ExpenseID: "exp2", TripCode: "BALI24", TripName: "Bali", Description: "50% off hotel", Amount: 120, PaidBy: "Mary Jane", Category: "lodging", CreationTime: 2000},
+		{ExpenseID: "exp1", TripCode: "TOKY23", TripName: "Tokyo", Description: "Hotel 50% off hotel deal", Amount: 300, PaidBy: "Bob", CreationTime: 1000},
+	}, matches)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReportService_SearchExpenses_CapsLimitAndRequiresQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := NewReportService(&ExpenseService{repo: &repository.ExpenseRepository{DB: db}}, nil)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expenses e JOIN trips t")).
+		WithArgs("owner-1", "%hotel%", MaxExpenseSearchLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "name", "description", "amount", "paid_by", "category", "creation_time"}))
+
+	matches, err := service.SearchExpenses("owner-1", "hotel", 1000)
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+
+	_, err = service.SearchExpenses("owner-1", "  ", 10)
+	assert.EqualError(t, err, "query is required")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+)
+
+// settlementCache keeps the last computed settlement result per trip and options.
+// Expense and payment changes invalidate a trip's entries; a per-trip generation
+// stops a calculation that raced with an invalidation from storing a stale result.
+type settlementCache struct {
+	mu          sync.Mutex
+	entries     map[string]map[SettlementOptions]*models.SettlementResult
+	generations map[string]uint64
+}
+
+// sharedSettlementCache is used by every service built with the default constructors,
+// so changes made through one service instance invalidate results cached by another
+var sharedSettlementCache = newSettlementCache()
+
+// newSettlementCache creates an empty settlement cache
+func newSettlementCache() *settlementCache {
+	return &settlementCache{
+		entries:     make(map[string]map[SettlementOptions]*models.SettlementResult),
+		generations: make(map[string]uint64),
+	}
+}
+
+// get returns the cached result for a trip and options, with the trip's current generation
+// to pass to put. A nil cache never holds anything.
+func (c *settlementCache) get(tripID string, opts SettlementOptions) (*models.SettlementResult, uint64, bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result, ok := c.entries[tripID][opts]
+	return result, c.generations[tripID], ok
+}
+
+// put stores a result computed during the given generation, unless the trip was
+// invalidated since
+func (c *settlementCache) put(tripID string, generation uint64, opts SettlementOptions, result *models.SettlementResult) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[tripID] != generation {
+		return
+	}
+	if c.entries[tripID] == nil {
+		c.entries[tripID] = make(map[SettlementOptions]*models.SettlementResult)
+	}
+	c.entries[tripID][opts] = result
+}
+
+// invalidate drops every cached result for a trip
+func (c *settlementCache) invalidate(tripID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, tripID)
+	c.generations[tripID]++
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// expectConfirmedExpenses queues a trip1 expense listing of confirmed 90 dinners paid by
+// alice and split with bob, one per ID
+func expectConfirmedExpenses(mock sqlmock.Sqlmock, ids ...string) {
+	rows := sqlmock.NewRows(expenseColumnNames)
+	for _, id := range ids {
+		rows.AddRow(id, "trip1", "Dinner", 90, 90, 0, 0, 0, "alice", "equal", 1, nil, nil, "", false, "", models.ExpenseStatusConfirmed, "bob", nil, "", false)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expenses WHERE trip_id = $1")).WithArgs("trip1").WillReturnRows(rows)
+	for _, id := range ids {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT participant FROM expense_participants")).WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"participant"}).AddRow("alice").AddRow("bob"))
+		expectPayerShares(mock, id)
+	}
+}
+
+func newCachedSettlementService(t *testing.T) (*SettlementService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	cache := newSettlementCache()
+	expenseService := &ExpenseService{repo: &repository.ExpenseRepository{DB: db}, settlements: cache}
+	return &SettlementService{expenseService: expenseService, cache: cache}, mock
+}
+
+func TestSettlementService_CacheInvalidatedByStoreExpense(t *testing.T) {
+	service, mock := newCachedSettlementService(t)
+
+	expectConfirmedExpenses(mock, "exp1")
+	first, err := service.CalculateSettlements("trip1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Alice": 45, "Bob": -45}, first.IndividualBalances)
+
+	// Served from the cache without querying again
+	cached, err := service.CalculateSettlements("trip1")
+	assert.NoError(t, err)
+	assert.Same(t, first, cached)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expenses")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expense_participants")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expense_participants")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	err = service.expenseService.StoreExpense(&models.Expense{
+		ID: "exp2", TripID: "trip1", Amount: 90, PaidBy: "alice", SplitType: "equal",
+		SplitAmong: []string{"alice", "bob"}, Status: models.ExpenseStatusConfirmed,
+	})
+	assert.NoError(t, err)
+
+	expectConfirmedExpenses(mock, "exp1", "exp2")
+	updated, err := service.CalculateSettlements("trip1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Alice": 90, "Bob": -90}, updated.IndividualBalances)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSettlementService_BypassCacheRecomputes(t *testing.T) {
+	service, mock := newCachedSettlementService(t)
+
+	expectConfirmedExpenses(mock, "exp1")
+	expectConfirmedExpenses(mock, "exp1")
+
+	first, err := service.CalculateSettlementsWithOptions("trip1", SettlementOptions{})
+	assert.NoError(t, err)
+	second, err := service.CalculateSettlementsWithOptions("trip1", SettlementOptions{BypassCache: true})
+	assert.NoError(t, err)
+
+	assert.NotSame(t, first, second)
+	assert.Equal(t, first, second)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSettlementService_PaymentLookupFailureIsNotCached(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := newSettlementCache()
+	service := &SettlementService{
+		expenseService: &ExpenseService{repo: &repository.ExpenseRepository{DB: db}, settlements: cache},
+		paymentService: NewPaymentService(repository.NewPaymentRepository(db), &repository.TripRepository{DB: db}),
+		cache:          cache,
+	}
+	payments := regexp.QuoteMeta("FROM payments")
+
+	expectConfirmedExpenses(mock, "exp1")
+	mock.ExpectQuery(payments).WithArgs("trip1").WillReturnError(sqlmock.ErrCancelled)
+
+	result, err := service.CalculateSettlements("trip1")
+	assert.Nil(t, result)
+	assert.Equal(t, utils.NewInternalError("Failed to retrieve payments"), err)
+
+	// The failure isn't cached, so the next request computes the result afresh
+	expectConfirmedExpenses(mock, "exp1")
+	mock.ExpectQuery(payments).WithArgs("trip1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trip_id", "from_person", "to_person", "amount", "description", "payment_date", "created_at"}))
+
+	result, err = service.CalculateSettlements("trip1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Alice": 45, "Bob": -45}, result.IndividualBalances)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSettlementCache_DropsResultComputedBeforeInvalidation(t *testing.T) {
+	cache := newSettlementCache()
+
+	_, generation, ok := cache.get("trip1", SettlementOptions{})
+	assert.False(t, ok)
+
+	cache.invalidate("trip1")
+	cache.put("trip1", generation, SettlementOptions{}, &models.SettlementResult{})
+
+	_, _, ok = cache.get("trip1", SettlementOptions{})
+	assert.False(t, ok)
+}
@@ -1,6 +1,11 @@
 package services
 
 import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
 	"github.com/fadhlanhapp/sharetab-backend/models"
 	"github.com/fadhlanhapp/sharetab-backend/utils"
 )
@@ -9,6 +14,7 @@ import (
 type SettlementService struct {
 	expenseService *ExpenseService
 	paymentService *PaymentService
+	cache          *settlementCache // Nil disables caching
 }
 
 // NewSettlementService creates a new settlement service
@@ -16,172 +22,528 @@ func NewSettlementService(expenseService *ExpenseService, paymentService *Paymen
 	return &SettlementService{
 		expenseService: expenseService,
 		paymentService: paymentService,
+		cache:          sharedSettlementCache,
 	}
 }
 
+// SettlementOptions controls how settlements are calculated
+type SettlementOptions struct {
+	MinimizeTransactions bool    // Search for the fewest transfers instead of using the greedy match
+	Currency             string  // Trip base currency; balances are rounded to its minor unit
+	MinSettlementAmount  float64 // Transfers below this are folded into a larger one; 0 uses DefaultMinSettlementAmount
+	FormatCurrency       bool    // Add display strings for amounts in Currency
+	IncludePending       bool    // Also count expenses not yet confirmed
+	BypassCache          bool    // Recompute even when a cached result exists, for debugging
+	EqualSplitRemainder  string  // Who absorbs leftover cents of an equal split; empty uses EqualSplitRemainderRoundRobin
+	Verbose              bool    // Include what each expense charged each person, item by item
+}
+
+// Policies for assigning the cents left over when an equal split doesn't divide evenly
+const (
+	EqualSplitRemainderRoundRobin = "roundRobin" // One extra cent each, in SplitAmong order
+	EqualSplitRemainderPayer      = "payer"      // All extra cents to the payer when they share the expense
+)
+
+// DefaultMinSettlementAmount is the smallest transfer worth asking someone to make
+const DefaultMinSettlementAmount = 0.01
+
 // CalculateSettlements calculates settlements for a trip
 func (s *SettlementService) CalculateSettlements(tripID string) (*models.SettlementResult, error) {
-	tripExpenses, err := s.expenseService.GetExpenses(tripID)
+	return s.CalculateSettlementsWithOptions(tripID, SettlementOptions{})
+}
+
+// CalculateSettlementsWithOptions calculates settlements for a trip using the given options.
+// Results are cached per trip and options until the trip's expenses or payments change;
+// cached results are shared and must not be modified.
+func (s *SettlementService) CalculateSettlementsWithOptions(tripID string, opts SettlementOptions) (*models.SettlementResult, error) {
+	key := opts
+	key.BypassCache = false
+
+	cached, generation, ok := s.cache.get(tripID, key)
+	if ok && !opts.BypassCache {
+		return cached, nil
+	}
+
+	result, err := s.calculateSettlements(tripID, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(tripID, generation, key, result)
+	return result, nil
+}
+
+// PreviewSettlement returns the trip's settlements as they would be after a payment
+// from one participant to another. The payment is only applied in memory: nothing is
+// stored and the cached settlements are left alone.
+func (s *SettlementService) PreviewSettlement(trip *models.Trip, from, to string, amount float64) (*models.SettlementResult, error) {
+	aliases := utils.NameAliases(trip.Aliases)
+	from, to = aliases.Key(from), aliases.Key(to)
+	if err := validatePayment(from, to, amount); err != nil {
+		return nil, utils.NewValidationError(err.Error())
+	}
+	if err := validatePaymentParticipants(trip, from, to); err != nil {
+		return nil, utils.NewValidationError(err.Error())
+	}
+
+	hypothetical := models.Payment{
+		TripID:     trip.ID,
+		FromPerson: utils.NormalizeName(from),
+		ToPerson:   utils.NormalizeName(to),
+		Amount:     amount,
+	}
+	return s.calculateSettlements(trip.ID, SettlementOptions{Currency: trip.Currency}, hypothetical)
+}
+
+// calculateSettlements computes settlements for a trip from its expenses and payments,
+// plus any extra payments that have not been stored
+func (s *SettlementService) calculateSettlements(tripID string, opts SettlementOptions, extraPayments ...models.Payment) (*models.SettlementResult, error) {
+	start := time.Now()
+	defer func() { settlementDuration.Observe(time.Since(start).Seconds()) }()
+
+	tripExpenses, err := s.settledExpenses(tripID, opts.IncludePending)
 	if err != nil {
 		return nil, utils.NewInternalError("Failed to retrieve expenses")
 	}
 
-	if len(tripExpenses) == 0 {
-		return &models.SettlementResult{
+	// Get payments for this trip if payment service is available. A trip without
+	// expenses can still owe money through its payments.
+	payments := extraPayments
+	if s.paymentService != nil {
+		stored, err := s.paymentService.GetPaymentsByTripID(tripID)
+		if err != nil {
+			return nil, utils.NewInternalError("Failed to retrieve payments")
+		}
+		payments = append(stored, extraPayments...)
+	}
+
+	if len(tripExpenses) == 0 && len(payments) == 0 {
+		result := &models.SettlementResult{
 			Settlements:        []models.Settlement{},
 			IndividualBalances: make(map[string]float64),
-		}, nil
+			PersonDetails:      make(map[string]models.PersonSettlementDetail),
+		}
+		if opts.FormatCurrency {
+			formatSettlementAmounts(result, opts.Currency)
+		}
+		return result, nil
 	}
 
-	// Calculate balances from expenses
-	balances := s.calculateBalances(tripExpenses)
+	// Calculate balances from expenses, then apply payments
+	ledger := s.calculateLedgerWithRemainder(tripExpenses, opts.EqualSplitRemainder, opts.Currency)
+	balances := ledger.balances()
+	for _, payment := range payments {
+		applyPayment(balances, payment)
+		ledger.recordPayment(payment.FromPerson, payment.ToPerson, payment.Amount)
+	}
+
+	// Calculate settlements
+	var settlements []models.Settlement
+	if opts.MinimizeTransactions {
+		settlements = s.calculateMinimalSettlements(balances)
+	} else {
+		settlements = s.calculateOptimalSettlements(balances)
+	}
+
+	// Drop transfers too small to be worth making
+	minAmount := opts.MinSettlementAmount
+	if minAmount <= 0 {
+		minAmount = DefaultMinSettlementAmount
+	}
+	settlements = s.suppressSmallSettlements(settlements, minAmount, opts.Currency)
+
+	// Format names for display, preferring the trip's aliases
+	aliases := s.tripAliases(tripID)
+	formattedBalances := utils.FormatNameMapKeysWith(balances, aliases)
+	formattedSettlements := s.formatSettlements(settlements, aliases)
+
+	result := &models.SettlementResult{
+		Settlements:        formattedSettlements,
+		IndividualBalances: formattedBalances,
+		PersonDetails:      utils.FormatNameMapKeysWith(ledger.details(balances), aliases),
+		NameKeys:           settlementNameKeys(tripExpenses, balances, aliases),
+	}
+	if opts.Verbose {
+		result.Breakdown = expenseBreakdown(tripExpenses, opts.EqualSplitRemainder, opts.Currency, aliases)
+	}
+	if opts.FormatCurrency {
+		formatSettlementAmounts(result, opts.Currency)
+	}
+	return result, nil
+}
+
+// settlementNameKeys maps the display name of everyone with a balance to their stored
+// name. Expenses arrive formatted for display and carry their own name keys; anyone
+// known only from payments falls back to the normalized form of their name.
+func settlementNameKeys(expenses []*models.Expense, balances map[string]float64, aliases utils.NameAliases) map[string]string {
+	keys := make(map[string]string, len(balances))
+	for _, expense := range expenses {
+		for display, key := range expense.NameKeys {
+			keys[display] = key
+		}
+	}
+	for person := range balances {
+		display := aliases.Format(person)
+		if _, ok := keys[display]; !ok {
+			keys[display] = utils.NormalizeName(person)
+		}
+	}
+	return keys
+}
+
+// tripAliases returns the display names a trip prefers for its participants
+func (s *SettlementService) tripAliases(tripID string) utils.NameAliases {
+	if s.expenseService == nil {
+		return nil
+	}
+	return tripAliases(s.expenseService.tripRepo, tripID)
+}
+
+// settledExpenses returns the trip's expenses that count toward settlements:
+// confirmed ones only, unless pending expenses are included
+func (s *SettlementService) settledExpenses(tripID string, includePending bool) ([]*models.Expense, error) {
+	tripExpenses, err := s.expenseService.GetExpenses(tripID)
+	if err != nil || includePending {
+		return tripExpenses, err
+	}
+
+	confirmed := make([]*models.Expense, 0, len(tripExpenses))
+	for _, expense := range tripExpenses {
+		if expense.IsConfirmed() {
+			confirmed = append(confirmed, expense)
+		}
+	}
+	return confirmed, nil
+}
+
+// GetSettlementsFor returns the optimal settlements in which the given person is the payer,
+// so everything they owe can be settled at once
+func (s *SettlementService) GetSettlementsFor(trip *models.Trip, person string) (*models.PersonSettlements, error) {
+	name := utils.NameAliases(trip.Aliases).Key(person)
+	if !participantKeys(trip)[name] {
+		return nil, utils.NewValidationError(fmt.Sprintf("%s is not a participant in this trip", utils.FormatNameForDisplay(name)))
+	}
+
+	result, err := s.CalculateSettlementsWithOptions(trip.ID, SettlementOptions{Currency: trip.Currency})
+	if err != nil {
+		return nil, err
+	}
+	return settlementsPaidBy(result.Settlements, name, trip.Currency, trip.Aliases), nil
+}
+
+// settlementsPaidBy keeps the display-formatted settlements paid by a normalized name
+// and totals them in the given currency
+func settlementsPaidBy(settlements []models.Settlement, name string, currency string, aliases utils.NameAliases) *models.PersonSettlements {
+	payer := aliases.Format(name)
+	result := &models.PersonSettlements{
+		Person:      payer,
+		Settlements: []models.Settlement{},
+	}
+	for _, settlement := range settlements {
+		if settlement.From == payer {
+			result.Settlements = append(result.Settlements, settlement)
+			result.Total += settlement.Amount
+		}
+	}
+	result.Total = utils.RoundForCurrency(result.Total, currency)
+	return result
+}
+
+// formatSettlementAmounts adds display strings for settlement amounts and balances
+func formatSettlementAmounts(result *models.SettlementResult, currency string) {
+	for i := range result.Settlements {
+		result.Settlements[i].FormattedAmount = utils.FormatCurrency(result.Settlements[i].Amount, currency)
+	}
+	result.FormattedBalances = utils.FormatCurrencyMap(result.IndividualBalances, currency)
+}
+
+// GetTripBalances returns each person's paid, owed and payment totals with their net
+// balance, rounded to the given trip currency. Settlements are not calculated.
+// Only confirmed expenses are counted.
+func (s *SettlementService) GetTripBalances(tripID string, currency string) (*models.TripBalancesResult, error) {
+	tripExpenses, err := s.settledExpenses(tripID, false)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve expenses")
+	}
+
+	ledger := s.calculateLedgerWithRemainder(tripExpenses, EqualSplitRemainderRoundRobin, currency)
+	ledger.aliases = s.tripAliases(tripID)
 
-	// Apply payments to balances if payment service is available
 	if s.paymentService != nil {
-		// Get payments for this trip using trip ID
 		payments, err := s.paymentService.GetPaymentsByTripID(tripID)
-		if err == nil && len(payments) > 0 {
-			// Apply payments to balances
-			for _, payment := range payments {
-				// Initialize balances if they don't exist
-				if _, exists := balances[payment.FromPerson]; !exists {
-					balances[payment.FromPerson] = 0
-				}
-				if _, exists := balances[payment.ToPerson]; !exists {
-					balances[payment.ToPerson] = 0
-				}
-				
-				// The person who paid reduces their debt (becomes less negative or more positive)
-				balances[payment.FromPerson] += payment.Amount
-				// The person who received payment increases their debt (becomes more negative or less positive)
-				balances[payment.ToPerson] -= payment.Amount
-			}
+		if err != nil {
+			return nil, utils.NewInternalError("Failed to retrieve payments")
+		}
+		for _, payment := range payments {
+			ledger.recordPayment(utils.NormalizeName(payment.FromPerson), utils.NormalizeName(payment.ToPerson), payment.Amount)
 		}
 	}
 
-	// Calculate settlements
-	settlements := s.calculateOptimalSettlements(balances)
+	return &models.TripBalancesResult{Balances: ledger.personBalances()}, nil
+}
+
+// GetSettlementStatus matches recorded payments against the optimal settlements
+// computed from expenses alone, so each settlement shows how much is still outstanding
+// Balances are rounded to the given trip currency before settling; only confirmed expenses are counted
+func (s *SettlementService) GetSettlementStatus(tripID string, currency string) (*models.SettlementStatusResult, error) {
+	tripExpenses, err := s.settledExpenses(tripID, false)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve expenses")
+	}
+
+	var payments []models.Payment
+	if s.paymentService != nil {
+		payments, err = s.paymentService.GetPaymentsByTripID(tripID)
+		if err != nil {
+			return nil, utils.NewInternalError("Failed to retrieve payments")
+		}
+	}
+
+	ledger := s.calculateLedgerWithRemainder(tripExpenses, EqualSplitRemainderRoundRobin, currency)
+	settlements := s.calculateOptimalSettlements(ledger.balances())
+	progress, overpayments := matchPaymentsToSettlements(settlements, payments)
 
 	// Format names for display
-	formattedBalances := utils.FormatNameMapKeys(balances)
-	formattedSettlements := s.formatSettlements(settlements)
+	aliases := s.tripAliases(tripID)
+	for i := range progress {
+		progress[i].From = aliases.Format(progress[i].From)
+		progress[i].To = aliases.Format(progress[i].To)
+	}
 
-	return &models.SettlementResult{
-		Settlements:        formattedSettlements,
-		IndividualBalances: formattedBalances,
+	return &models.SettlementStatusResult{
+		Settlements:  progress,
+		Overpayments: s.formatSettlements(overpayments, aliases),
 	}, nil
 }
 
+// matchPaymentsToSettlements applies each payment to the settlement between the same two people
+// Any amount beyond that settlement, or a payment with no matching settlement, is an overpayment
+func matchPaymentsToSettlements(settlements []models.Settlement, payments []models.Payment) ([]models.SettlementProgress, []models.Settlement) {
+	progress := make([]models.SettlementProgress, len(settlements))
+	for i, settlement := range settlements {
+		progress[i] = models.SettlementProgress{
+			Settlement:      settlement,
+			RemainingAmount: settlement.Amount,
+		}
+	}
+
+	overpaid := make(map[[2]string]float64)
+	var overpaidOrder [][2]string
+
+	for _, payment := range payments {
+		from := utils.NormalizeName(payment.FromPerson)
+		to := utils.NormalizeName(payment.ToPerson)
+		amount := payment.Amount
+
+		for i := range progress {
+			if amount <= 0 {
+				break
+			}
+			if progress[i].From != from || progress[i].To != to || progress[i].RemainingAmount <= 0 {
+				continue
+			}
+			applied := utils.Min(amount, progress[i].RemainingAmount)
+			progress[i].PaidAmount = utils.Round(progress[i].PaidAmount + applied)
+			progress[i].RemainingAmount = utils.Round(progress[i].RemainingAmount - applied)
+			amount = utils.Round(amount - applied)
+		}
+
+		if amount > 0 {
+			key := [2]string{from, to}
+			if _, exists := overpaid[key]; !exists {
+				overpaidOrder = append(overpaidOrder, key)
+			}
+			overpaid[key] = utils.Round(overpaid[key] + amount)
+		}
+	}
+
+	for i := range progress {
+		progress[i].Settled = progress[i].RemainingAmount <= 0
+	}
+
+	overpayments := make([]models.Settlement, 0, len(overpaidOrder))
+	for _, key := range overpaidOrder {
+		overpayments = append(overpayments, models.Settlement{From: key[0], To: key[1], Amount: overpaid[key]})
+	}
+
+	return progress, overpayments
+}
+
 // calculateBalances calculates how much each person has paid and owes
 func (s *SettlementService) calculateBalances(expenses []*models.Expense) map[string]float64 {
-	balances := make(map[string]float64)
+	return s.calculateLedger(expenses).balances()
+}
+
+// calculateLedger records what each person paid and consumed across expenses
+func (s *SettlementService) calculateLedger(expenses []*models.Expense) *balanceLedger {
+	return s.calculateLedgerWithRemainder(expenses, EqualSplitRemainderRoundRobin, "")
+}
+
+// calculateLedgerWithRemainder records what each person paid and consumed, assigning
+// equal-split leftover minor units with the given policy. Shares are split in the
+// currency's minor unit, so balances still sum to zero once rounded to it.
+func (s *SettlementService) calculateLedgerWithRemainder(expenses []*models.Expense, remainder string, currency string) *balanceLedger {
+	ledger := newBalanceLedger()
+	ledger.remainder = remainder
+	ledger.currency = currency
 
 	for _, expense := range expenses {
 		switch expense.SplitType {
 		case utils.SplitTypeEqual:
-			s.processEqualSplitExpense(expense, balances)
+			s.processEqualSplitExpense(expense, ledger)
 		case utils.SplitTypeItems:
-			s.processItemSplitExpense(expense, balances)
+			s.processItemSplitExpense(expense, ledger)
 		}
 	}
 
-	// Round all balances
-	for person, balance := range balances {
-		balances[person] = utils.Round(balance)
-	}
-
-	return balances
+	return ledger
 }
 
 // processEqualSplitExpense processes an equal split expense
-func (s *SettlementService) processEqualSplitExpense(expense *models.Expense, balances map[string]float64) {
-	// The payer pays the total amount
-	if _, exists := balances[expense.PaidBy]; !exists {
-		balances[expense.PaidBy] = 0
+func (s *SettlementService) processEqualSplitExpense(expense *models.Expense, ledger *balanceLedger) {
+	// Each payer is credited what they paid; a single payer pays the total amount
+	for payer, share := range expense.PayerShares() {
+		ledger.credit(payer, share)
 	}
-	balances[expense.PaidBy] += expense.Amount
-
-	// Each person in splitAmong owes their share
-	sharePerPerson := expense.Amount / float64(len(expense.SplitAmong))
-	sharePerPerson = utils.Round(sharePerPerson)
 
-	for _, person := range expense.SplitAmong {
-		if _, exists := balances[person]; !exists {
-			balances[person] = 0
-		}
-		balances[person] -= sharePerPerson
+	// Each person in splitAmong owes their share; the shares sum to the amount exactly
+	for i, share := range equalSplitShares(expense, ledger.remainder, ledger.currency) {
+		ledger.debit(expense.SplitAmong[i], share)
 	}
 }
 
-// processItemSplitExpense processes an item-based expense
-func (s *SettlementService) processItemSplitExpense(expense *models.Expense, balances map[string]float64) {
-	extraCharges := expense.Tax + expense.ServiceCharge - expense.TotalDiscount
+// equalSplitShares divides an expense evenly among SplitAmong in the currency's minor
+// unit (whole cents, or whole rupiah for IDR). Units that don't divide evenly go one
+// each to the earliest people in SplitAmong, or all to the payer under
+// EqualSplitRemainderPayer when the payer is one of them.
+func equalSplitShares(expense *models.Expense, remainder string, currency string) []float64 {
+	count := len(expense.SplitAmong)
+	if count == 0 {
+		return nil
+	}
 
-	// Calculate each person's share of items
-	personItemTotals := make(map[string]float64)
-	var totalItemAmount float64
+	weights := make([]float64, count)
+	for i := range weights {
+		weights[i] = 1 / float64(count)
+	}
+	shares := distributeCharge(expense.Amount, weights, currency)
+	if remainder != EqualSplitRemainderPayer {
+		return shares
+	}
 
-	// Process each item
-	for _, item := range expense.Items {
-		// The payer pays for the item
-		if _, exists := balances[item.PaidBy]; !exists {
-			balances[item.PaidBy] = 0
+	payer := -1
+	for i, person := range expense.SplitAmong {
+		if utils.NormalizeName(person) == utils.NormalizeName(expense.PaidBy) {
+			payer = i
+			break
 		}
-		balances[item.PaidBy] += item.Amount
+	}
+	if payer < 0 {
+		return shares
+	}
 
-		// Each consumer owes their share
-		sharePerPerson := item.Amount / float64(len(item.Consumers))
-		sharePerPerson = utils.Round(sharePerPerson)
+	// Later positions hold the base share; collect everything above it for the payer
+	base := shares[count-1]
+	var extra float64
+	for i := range shares {
+		extra += shares[i] - base
+		shares[i] = base
+	}
+	shares[payer] = utils.RoundForCurrency(base+extra, currency)
+	return shares
+}
 
-		for _, consumer := range item.Consumers {
-			if _, exists := balances[consumer]; !exists {
-				balances[consumer] = 0
-			}
-			balances[consumer] -= sharePerPerson
+// expenseBreakdown lists what each expense charged each person before balances are
+// aggregated, using the same shares as the ledger. Item splits also show each item's
+// shares before bill-level charges; names are formatted for display with aliases.
+func expenseBreakdown(expenses []*models.Expense, remainder string, currency string, aliases utils.NameAliases) []models.ExpenseAllocation {
+	breakdown := make([]models.ExpenseAllocation, 0, len(expenses))
+	for _, expense := range expenses {
+		allocation := models.ExpenseAllocation{
+			ExpenseID:   expense.ID,
+			Description: expense.Description,
+			SplitType:   expense.SplitType,
+			Totals:      make(map[string]float64),
+		}
 
-			// Track consumption for proportional extra charges
-			if _, exists := personItemTotals[consumer]; !exists {
-				personItemTotals[consumer] = 0
+		switch expense.SplitType {
+		case utils.SplitTypeEqual:
+			for i, share := range equalSplitShares(expense, remainder, currency) {
+				person := aliases.Format(expense.SplitAmong[i])
+				allocation.Totals[person] = utils.RoundForCurrency(allocation.Totals[person]+share, currency)
+			}
+		case utils.SplitTypeItems:
+			items, _ := consumedItems(expense)
+			for _, item := range items {
+				shares := make(map[string]float64, len(item.Consumers))
+				for i, share := range roundedItemShares(item, currency) {
+					person := aliases.Format(item.Consumers[i])
+					shares[person] = utils.RoundForCurrency(shares[person]+share, currency)
+				}
+				allocation.Items = append(allocation.Items, models.ItemAllocation{
+					Description: item.Description,
+					Amount:      item.Amount,
+					Shares:      shares,
+				})
+			}
+			for person, personAllocation := range allocateItemSplit(items, expenseCharges(expense, currency)) {
+				allocation.Totals[aliases.Format(person)] = personAllocation.Total
 			}
-			personItemTotals[consumer] += sharePerPerson
+		default:
+			continue
 		}
 
-		totalItemAmount += item.Amount
+		breakdown = append(breakdown, allocation)
 	}
+	return breakdown
+}
 
-	// Handle extra charges proportionally
-	if extraCharges != 0 && totalItemAmount > 0 {
-		primaryPayer := s.findPrimaryPayer(expense)
+// processItemSplitExpense processes an item-based expense
+func (s *SettlementService) processItemSplitExpense(expense *models.Expense, ledger *balanceLedger) {
+	// Each payer is credited for the items they paid for
+	for _, item := range expense.Items {
+		ledger.credit(item.PaidBy, item.Amount)
+	}
 
-		// Primary payer gets credit for paying extra charges
-		if _, exists := balances[primaryPayer]; !exists {
-			balances[primaryPayer] = 0
-		}
-		balances[primaryPayer] += extraCharges
+	// The primary payer is credited for the bill-level extra charges
+	if extraCharges := expense.ExtraCharges(); extraCharges != 0 {
+		ledger.credit(s.findPrimaryPayer(expense), extraCharges)
+	}
 
-		// Distribute extra charges proportionally
-		var totalAllocated float64
-		var lastPerson string
+	items, reassigned := consumedItems(expense)
+	if reassigned > 0 {
+		slog.Warn("Items without consumers charged to their payer", "operation", "calculate_settlements",
+			"tripId", expense.TripID, "expenseId", expense.ID, "items", reassigned)
+	}
 
-		for person, itemTotal := range personItemTotals {
-			proportion := itemTotal / totalItemAmount
-			extraChargeShare := extraCharges * proportion
-			extraChargeShare = utils.Round(extraChargeShare)
+	// Each consumer owes their item share plus proportional extras
+	for person, allocation := range allocateItemSplit(items, expenseCharges(expense, ledger.currency)) {
+		ledger.debit(person, allocation.Total)
+	}
+}
 
-			if _, exists := balances[person]; !exists {
-				balances[person] = 0
-			}
-			balances[person] -= extraChargeShare
-			totalAllocated += extraChargeShare
-			lastPerson = person
+// consumedItems returns the expense's items with any item that has no consumers
+// charged entirely to whoever paid for it, so its amount isn't credited without a
+// matching debit. It also reports how many items were reassigned.
+func consumedItems(expense *models.Expense) ([]models.Item, int) {
+	items := expense.Items
+	reassigned := 0
+	for i, item := range expense.Items {
+		if len(item.Consumers) > 0 {
+			continue
 		}
-
-		// Handle rounding discrepancy
-		roundingDiff := utils.Round(extraCharges - totalAllocated)
-		if roundingDiff != 0 && lastPerson != "" {
-			balances[lastPerson] -= roundingDiff
+		if reassigned == 0 {
+			items = append([]models.Item(nil), expense.Items...)
 		}
+		payer := item.PaidBy
+		if payer == "" {
+			payer = expense.PaidBy
+		}
+		items[i].Consumers = []string{payer}
+		items[i].ConsumerWeights = nil
+		items[i].ConsumerQuantities = nil
+		reassigned++
 	}
+	return items, reassigned
 }
 
 // findPrimaryPayer finds the person who paid for the most items
@@ -246,15 +608,16 @@ func (s *SettlementService) extractDebtors(balances map[string]float64) []Person
 	return debtors
 }
 
-// sortByBalance sorts PersonBalance slice by balance in descending order
+// sortByBalance sorts PersonBalance slice by balance in descending order, then by name,
+// so settlements come out in the same order however the balances map was iterated
 func (s *SettlementService) sortByBalance(slice []PersonBalance) {
-	for i := 0; i < len(slice); i++ {
-		for j := i + 1; j < len(slice); j++ {
-			if slice[i].Balance < slice[j].Balance {
-				slice[i], slice[j] = slice[j], slice[i]
-			}
+	sort.Slice(slice, func(i, j int) bool {
+		a, b := utils.Round(slice[i].Balance), utils.Round(slice[j].Balance)
+		if a != b {
+			return a > b
 		}
-	}
+		return slice[i].Person < slice[j].Person
+	})
 }
 
 // generateSettlements creates the actual settlement transactions
@@ -294,13 +657,39 @@ func (s *SettlementService) generateSettlements(creditors, debtors []PersonBalan
 	return settlements
 }
 
-// formatSettlements formats settlement names for display
-func (s *SettlementService) formatSettlements(settlements []models.Settlement) []models.Settlement {
+// suppressSmallSettlements removes transfers below minAmount. A removed amount is
+// added to a remaining transfer between the same debtor and creditor, if there is
+// one; otherwise the residue is dropped, since moving it onto a transfer with a
+// different counterparty would make someone pay a person they don't owe.
+func (s *SettlementService) suppressSmallSettlements(settlements []models.Settlement, minAmount float64, currency string) []models.Settlement {
+	var kept, small []models.Settlement
+	for _, settlement := range settlements {
+		if settlement.Amount < minAmount {
+			small = append(small, settlement)
+		} else {
+			kept = append(kept, settlement)
+		}
+	}
+
+	for _, residue := range small {
+		for i, settlement := range kept {
+			if settlement.From == residue.From && settlement.To == residue.To {
+				kept[i].Amount = utils.RoundForCurrency(settlement.Amount+residue.Amount, currency)
+				break
+			}
+		}
+	}
+
+	return kept
+}
+
+// formatSettlements formats settlement names for display, preferring the given aliases
+func (s *SettlementService) formatSettlements(settlements []models.Settlement, aliases utils.NameAliases) []models.Settlement {
 	formatted := make([]models.Settlement, len(settlements))
 	for i, settlement := range settlements {
 		formatted[i] = models.Settlement{
-			From:   utils.FormatNameForDisplay(settlement.From),
-			To:     utils.FormatNameForDisplay(settlement.To),
+			From:   aliases.Format(settlement.From),
+			To:     aliases.Format(settlement.To),
 			Amount: settlement.Amount,
 		}
 	}
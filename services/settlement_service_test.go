@@ -0,0 +1,787 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettlementService_CalculateBalances_WeightedItem(t *testing.T) {
+	service := &SettlementService{}
+
+	expenses := []*models.Expense{
+		{
+			SplitType: "items",
+			Amount:    90,
+			Subtotal:  90,
+			PaidBy:    "alice",
+			Items: []models.Item{
+				{
+					Description:     "Pizza",
+					UnitPrice:       90,
+					Quantity:        1,
+					Amount:          90,
+					PaidBy:          "alice",
+					Consumers:       []string{"alice", "bob", "carol"},
+					ConsumerWeights: map[string]float64{"alice": 2},
+				},
+			},
+		},
+	}
+
+	balances := service.calculateBalances(expenses)
+
+	assert.Equal(t, float64(45), balances["alice"])
+	assert.Equal(t, float64(-22.5), balances["bob"])
+	assert.Equal(t, float64(-22.5), balances["carol"])
+}
+
+func TestSettlementService_CalculateBalances_UnweightedItemSplitsEqually(t *testing.T) {
+	service := &SettlementService{}
+
+	expenses := []*models.Expense{
+		{
+			SplitType: "items",
+			Amount:    90,
+			Subtotal:  90,
+			PaidBy:    "alice",
+			Items: []models.Item{
+				{
+					Description: "Pizza",
+					UnitPrice:   90,
+					Quantity:    1,
+					Amount:      90,
+					PaidBy:      "alice",
+					Consumers:   []string{"alice", "bob", "carol"},
+				},
+			},
+		},
+	}
+
+	balances := service.calculateBalances(expenses)
+
+	assert.Equal(t, float64(60), balances["alice"])
+	assert.Equal(t, float64(-30), balances["bob"])
+	assert.Equal(t, float64(-30), balances["carol"])
+}
+
+func TestSettlementService_LedgerDetails(t *testing.T) {
+	service := &SettlementService{}
+
+	expenses := []*models.Expense{
+		{
+			SplitType:  "equal",
+			Amount:     90,
+			PaidBy:     "alice",
+			SplitAmong: []string{"alice", "bob", "carol"},
+		},
+	}
+
+	ledger := service.calculateLedger(expenses)
+	balances := ledger.balances()
+	ledger.recordPayment("bob", "alice", 30)
+	balances["bob"] += 30
+	balances["alice"] -= 30
+
+	details := ledger.details(balances)
+
+	assert.Equal(t, float64(90), details["alice"].TotalPaid)
+	assert.Equal(t, float64(30), details["alice"].TotalConsumed)
+	assert.Equal(t, float64(30), details["alice"].PaymentsReceived)
+	assert.Equal(t, float64(30), details["alice"].NetBalance)
+	assert.Equal(t, float64(30), details["bob"].PaymentsSent)
+	assert.Equal(t, float64(0), details["bob"].NetBalance)
+	assert.Equal(t, float64(-30), details["carol"].NetBalance)
+}
+
+func TestMatchPaymentsToSettlements(t *testing.T) {
+	settlements := []models.Settlement{
+		{From: "bob", To: "alice", Amount: 50},
+		{From: "carol", To: "alice", Amount: 30},
+	}
+	payments := []models.Payment{
+		{FromPerson: "Bob", ToPerson: "Alice", Amount: 20},
+		{FromPerson: "carol", ToPerson: "alice", Amount: 40},
+		{FromPerson: "bob", ToPerson: "carol", Amount: 5},
+	}
+
+	progress, overpayments := matchPaymentsToSettlements(settlements, payments)
+
+	assert.Len(t, progress, 2)
+	assert.Equal(t, 20.0, progress[0].PaidAmount)
+	assert.Equal(t, 30.0, progress[0].RemainingAmount)
+	assert.False(t, progress[0].Settled)
+
+	assert.Equal(t, 30.0, progress[1].PaidAmount)
+	assert.Equal(t, 0.0, progress[1].RemainingAmount)
+	assert.True(t, progress[1].Settled)
+
+	assert.Equal(t, []models.Settlement{
+		{From: "carol", To: "alice", Amount: 10},
+		{From: "bob", To: "carol", Amount: 5},
+	}, overpayments)
+}
+
+func TestSettlementService_MinimalSettlements_FewerTransfersThanGreedy(t *testing.T) {
+	service := &SettlementService{}
+	balances := map[string]float64{
+		"a": 5,
+		"b": 4,
+		"c": -4,
+		"d": -3,
+		"e": -2,
+	}
+
+	greedy := service.calculateOptimalSettlements(balances)
+	minimal := service.calculateMinimalSettlements(balances)
+
+	assert.Len(t, greedy, 4)
+	assert.Len(t, minimal, 3)
+	assertSettlesBalances(t, balances, minimal)
+}
+
+func TestSettlementService_MinimalSettlements_LargeGroupFallsBackToGreedy(t *testing.T) {
+	service := &SettlementService{}
+	balances := make(map[string]float64)
+	var total float64
+	for i := 0; i < minimalSettlementPeopleLimit; i++ {
+		balance := float64(i + 1)
+		if i%2 == 1 {
+			balance = -float64(i)
+		}
+		balances[string(rune('a'+i))] = balance
+		total += balance
+	}
+	balances["z"] = -total
+
+	minimal := service.calculateMinimalSettlements(balances)
+
+	assertSettlesBalances(t, balances, minimal)
+}
+
+// assertSettlesBalances checks that applying the settlements brings every balance to zero
+func assertSettlesBalances(t *testing.T, balances map[string]float64, settlements []models.Settlement) {
+	t.Helper()
+	remaining := make(map[string]float64)
+	for person, balance := range balances {
+		remaining[person] = balance
+	}
+	for _, settlement := range settlements {
+		remaining[settlement.From] += settlement.Amount
+		remaining[settlement.To] -= settlement.Amount
+	}
+	for person, balance := range remaining {
+		assert.InDelta(t, 0, balance, 0.001, person)
+	}
+}
+
+func TestSettlementService_CalculateBalances_NegativeItemReducesShare(t *testing.T) {
+	service := &SettlementService{}
+
+	expenses := []*models.Expense{
+		{
+			SplitType: "items",
+			Amount:    140,
+			Subtotal:  140,
+			PaidBy:    "alice",
+			Items: []models.Item{
+				{Description: "Pizza", Amount: 100, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+				{Description: "Beer", Amount: 60, PaidBy: "alice", Consumers: []string{"bob"}},
+				{Description: "Promo", Amount: -20, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+			},
+		},
+	}
+
+	balances := service.calculateBalances(expenses)
+
+	assert.Equal(t, 100.0, balances["alice"])
+	assert.Equal(t, -100.0, balances["bob"])
+}
+
+func TestSettlementService_CalculateBalances_TaxInclusiveItems(t *testing.T) {
+	service := &SettlementService{}
+
+	expenses := []*models.Expense{
+		{
+			SplitType:    "items",
+			Amount:       110,
+			Subtotal:     110,
+			Tax:          10,
+			TaxInclusive: true,
+			PaidBy:       "alice",
+			Items: []models.Item{
+				{Description: "Meal", Amount: 110, PaidBy: "alice", Consumers: []string{"alice", "bob"}},
+			},
+		},
+	}
+
+	balances := service.calculateBalances(expenses)
+
+	assert.Equal(t, 55.0, balances["alice"])
+	assert.Equal(t, -55.0, balances["bob"])
+}
+
+func TestSettlementService_LedgerRoundsToCurrency(t *testing.T) {
+	service := &SettlementService{}
+
+	expenses := []*models.Expense{
+		{
+			SplitType:  "equal",
+			Amount:     100000,
+			PaidBy:     "alice",
+			SplitAmong: []string{"alice", "bob", "carol"},
+		},
+	}
+
+	ledger := service.calculateLedger(expenses)
+	ledger.currency = "IDR"
+	balances := ledger.balances()
+
+	assert.Equal(t, 66667.0, balances["alice"])
+	assert.Equal(t, -33333.0, balances["bob"])
+	assert.Equal(t, -33333.0, balances["carol"])
+
+	for _, settlement := range service.calculateOptimalSettlements(balances) {
+		assert.Equal(t, 33333.0, settlement.Amount)
+	}
+}
+
+func TestSettlementService_CalculateBalances_ExtraChargeRoundingIsStable(t *testing.T) {
+	service := &SettlementService{}
+
+	newExpenses := func() []*models.Expense {
+		return []*models.Expense{
+			{
+				SplitType:     "items",
+				Amount:        100.10,
+				Subtotal:      100,
+				ServiceCharge: 0.10,
+				PaidBy:        "alice",
+				Items: []models.Item{
+					{Description: "Platter", Amount: 100, PaidBy: "alice", Consumers: []string{"carol", "alice", "bob"}},
+				},
+			},
+		}
+	}
+
+	// 33.33 or 33.34 of items plus 3 or 4 cents of service each; the leftover cents must
+	// always land on the same people and the balances must add up to zero
+	expected := map[string]float64{"alice": 66.74, "bob": -33.36, "carol": -33.38}
+	for run := 0; run < 50; run++ {
+		assert.Equal(t, expected, service.calculateBalances(newExpenses()))
+	}
+}
+
+func TestSettlementService_OptimalSettlements_TwoPeople(t *testing.T) {
+	service := &SettlementService{}
+	balances := map[string]float64{"alice": 25.5, "bob": -25.5}
+
+	settlements := service.calculateOptimalSettlements(balances)
+
+	assert.Equal(t, []models.Settlement{{From: "bob", To: "alice", Amount: 25.5}}, settlements)
+	assertSettlesBalances(t, balances, settlements)
+}
+
+func TestSettlementService_OptimalSettlements_ThreePersonCycle(t *testing.T) {
+	service := &SettlementService{}
+
+	// Alice paid for Bob, Bob paid for Carol and Carol paid for Alice
+	expenses := []*models.Expense{
+		{SplitType: "equal", Amount: 30, PaidBy: "alice", SplitAmong: []string{"bob"}},
+		{SplitType: "equal", Amount: 20, PaidBy: "bob", SplitAmong: []string{"carol"}},
+		{SplitType: "equal", Amount: 10, PaidBy: "carol", SplitAmong: []string{"alice"}},
+	}
+	balances := service.calculateLedger(expenses).balances()
+
+	settlements := service.calculateOptimalSettlements(balances)
+
+	// The cycle nets out, leaving Bob and Carol each owing Alice 10
+	assert.Len(t, settlements, 2)
+	for _, settlement := range settlements {
+		assert.Equal(t, "alice", settlement.To)
+		assert.Equal(t, 10.0, settlement.Amount)
+	}
+	assertSettlesBalances(t, balances, settlements)
+}
+
+func TestSettlementService_OptimalSettlements_OneDebtorSeveralCreditors(t *testing.T) {
+	service := &SettlementService{}
+	balances := map[string]float64{"alice": -90, "bob": 30, "carol": 50, "dave": 10}
+
+	settlements := service.calculateOptimalSettlements(balances)
+
+	assert.Len(t, settlements, 3)
+	for _, settlement := range settlements {
+		assert.Equal(t, "alice", settlement.From)
+	}
+	assertSettlesBalances(t, balances, settlements)
+}
+
+func TestSettlementService_OptimalSettlements_BalancedTrip(t *testing.T) {
+	service := &SettlementService{}
+	balances := map[string]float64{"alice": 0, "bob": 0, "carol": 0}
+
+	assert.Empty(t, service.calculateOptimalSettlements(balances))
+}
+
+func TestSettlementService_OptimalSettlements_IgnoresRoundingResidue(t *testing.T) {
+	service := &SettlementService{}
+
+	// Floating-point leftovers well under a cent must not become one-cent transfers
+	balances := map[string]float64{"alice": 10.004, "bob": -10, "carol": -0.004}
+	settlements := service.calculateOptimalSettlements(balances)
+	assert.Equal(t, []models.Settlement{{From: "bob", To: "alice", Amount: 10}}, settlements)
+
+	balances = map[string]float64{"alice": 0.1 + 0.2 - 0.3, "bob": -(0.1 + 0.2 - 0.3)}
+	assert.Empty(t, service.calculateOptimalSettlements(balances))
+}
+
+func TestSettlementService_SuppressSmallSettlements(t *testing.T) {
+	service := &SettlementService{}
+
+	// Three-decimal currencies can leave half-cent transfers after splitting
+	settlements := []models.Settlement{
+		{From: "alice", To: "carol", Amount: 0.5},
+		{From: "alice", To: "carol", Amount: 0.005},
+	}
+
+	kept := service.suppressSmallSettlements(settlements, DefaultMinSettlementAmount, "KWD")
+
+	assert.Equal(t, []models.Settlement{{From: "alice", To: "carol", Amount: 0.505}}, kept)
+}
+
+func TestSettlementService_SuppressSmallSettlements_DropsResidueBetweenOtherPeople(t *testing.T) {
+	service := &SettlementService{}
+	settlements := []models.Settlement{
+		{From: "alice", To: "dave", Amount: 40},
+		{From: "alice", To: "carol", Amount: 5},
+		{From: "bob", To: "carol", Amount: 2},
+		{From: "alice", To: "frank", Amount: 0.03},
+		{From: "erin", To: "carol", Amount: 0.02},
+	}
+
+	kept := service.suppressSmallSettlements(settlements, 0.05, "")
+
+	// Neither residue has a transfer between the same two people, so both are dropped
+	// rather than charged to someone who owes a different person
+	assert.Equal(t, []models.Settlement{
+		{From: "alice", To: "dave", Amount: 40},
+		{From: "alice", To: "carol", Amount: 5},
+		{From: "bob", To: "carol", Amount: 2},
+	}, kept)
+}
+
+func TestSettlementService_PersonBalancesIncludePayments(t *testing.T) {
+	service := &SettlementService{}
+	expenses := []*models.Expense{
+		{SplitType: "equal", Amount: 90, PaidBy: "alice", SplitAmong: []string{"alice", "bob", "carol"}},
+	}
+
+	ledger := service.calculateLedger(expenses)
+	ledger.recordPayment("bob", "alice", 30)
+
+	assert.Equal(t, []models.PersonBalance{
+		{Name: "Alice", AmountPaid: 90, AmountOwed: 30, PaymentsReceived: 30, Net: 30},
+		{Name: "Bob", AmountOwed: 30, PaymentsSent: 30, Net: 0},
+		{Name: "Carol", AmountOwed: 30, Net: -30},
+	}, ledger.personBalances())
+}
+
+func TestFormatSettlementAmounts(t *testing.T) {
+	result := &models.SettlementResult{
+		Settlements:        []models.Settlement{{From: "Bob", To: "Alice", Amount: 57.5}},
+		IndividualBalances: map[string]float64{"Alice": 57.5, "Bob": -57.5},
+	}
+
+	formatSettlementAmounts(result, "USD")
+
+	assert.Equal(t, 57.5, result.Settlements[0].Amount)
+	assert.Equal(t, "$57.50", result.Settlements[0].FormattedAmount)
+	assert.Equal(t, map[string]string{"Alice": "$57.50", "Bob": "-$57.50"}, result.FormattedBalances)
+}
+
+func TestSettlementService_CalculateBalances_ConsumerQuantities(t *testing.T) {
+	service := &SettlementService{}
+
+	expenses := []*models.Expense{
+		{
+			SplitType: "items",
+			Amount:    90,
+			Subtotal:  90,
+			PaidBy:    "alice",
+			Items: []models.Item{
+				{
+					Description:        "Coffee",
+					UnitPrice:          30,
+					Quantity:           3,
+					Amount:             90,
+					PaidBy:             "alice",
+					Consumers:          []string{"alice", "bob"},
+					ConsumerQuantities: map[string]float64{"alice": 1, "bob": 2},
+				},
+			},
+		},
+	}
+
+	balances := service.calculateBalances(expenses)
+
+	assert.Equal(t, float64(60), balances["alice"])
+	assert.Equal(t, float64(-60), balances["bob"])
+}
+
+// newPendingExpenseSettlementService returns a settlement service over a trip with a
+// confirmed 90 dinner paid by alice and a pending 300 hotel paid by bob, both split three ways
+func newPendingExpenseSettlementService(t *testing.T) *SettlementService {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expenses WHERE trip_id = $1")).WithArgs("trip1").
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+			AddRow("exp1", "trip1", "Dinner", 90, 90, 0, 0, 0, "alice", "equal", 1, nil, nil, "", false, "", models.ExpenseStatusConfirmed, "bob", nil, "", false).
+			AddRow("exp2", "trip1", "Hotel", 300, 300, 0, 0, 0, "bob", "equal", 2, nil, nil, "", false, "", models.ExpenseStatusPending, "", nil, "", false))
+	for _, id := range []string{"exp1", "exp2"} {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT participant FROM expense_participants")).WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"participant"}).AddRow("alice").AddRow("bob").AddRow("carol"))
+		expectPayerShares(mock, id)
+	}
+
+	return &SettlementService{expenseService: &ExpenseService{repo: &repository.ExpenseRepository{DB: db}}}
+}
+
+func TestSettlementService_PendingExpenseDoesNotAffectBalances(t *testing.T) {
+	service := newPendingExpenseSettlementService(t)
+
+	result, err := service.CalculateSettlementsWithOptions("trip1", SettlementOptions{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Alice": 60, "Bob": -30, "Carol": -30}, result.IndividualBalances)
+}
+
+func TestSettlementService_IncludePendingCountsPendingExpenses(t *testing.T) {
+	service := newPendingExpenseSettlementService(t)
+
+	result, err := service.CalculateSettlementsWithOptions("trip1", SettlementOptions{IncludePending: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Alice": -40, "Bob": 170, "Carol": -130}, result.IndividualBalances)
+}
+
+func TestSettlementsPaidBy(t *testing.T) {
+	settlements := []models.Settlement{
+		{From: "Bob", To: "Alice", Amount: 30.25},
+		{From: "Carol", To: "Alice", Amount: 40},
+		{From: "Bob", To: "Dave", Amount: 12.5},
+	}
+
+	result := settlementsPaidBy(settlements, "bob", "USD", nil)
+
+	assert.Equal(t, "Bob", result.Person)
+	assert.Equal(t, []models.Settlement{
+		{From: "Bob", To: "Alice", Amount: 30.25},
+		{From: "Bob", To: "Dave", Amount: 12.5},
+	}, result.Settlements)
+	assert.Equal(t, 42.75, result.Total)
+}
+
+func TestSettlementService_GetSettlementsFor(t *testing.T) {
+	service := newPendingExpenseSettlementService(t)
+	trip := &models.Trip{ID: "trip1", Participants: []string{"alice", "bob", "carol"}}
+
+	result, err := service.GetSettlementsFor(trip, "Carol")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Carol", result.Person)
+	assert.Equal(t, []models.Settlement{{From: "Carol", To: "Alice", Amount: 30}}, result.Settlements)
+	assert.Equal(t, float64(30), result.Total)
+
+	_, err = service.GetSettlementsFor(trip, "dave")
+	assert.Equal(t, utils.NewValidationError("Dave is not a participant in this trip"), err)
+}
+
+func TestSettlementService_EqualSplitRemainder(t *testing.T) {
+	three := []string{"alice", "bob", "carol"}
+	seven := []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace"}
+
+	tests := []struct {
+		name       string
+		amount     float64
+		paidBy     string
+		splitAmong []string
+		remainder  string
+		expected   []float64
+	}{
+		{"three round robin", 100, "carol", three, EqualSplitRemainderRoundRobin, []float64{33.34, 33.33, 33.33}},
+		{"three to payer", 100, "carol", three, EqualSplitRemainderPayer, []float64{33.33, 33.33, 33.34}},
+		{"seven round robin", 100, "alice", seven, EqualSplitRemainderRoundRobin,
+			[]float64{14.29, 14.29, 14.29, 14.29, 14.28, 14.28, 14.28}},
+		{"seven to payer", 100, "grace", seven, EqualSplitRemainderPayer,
+			[]float64{14.28, 14.28, 14.28, 14.28, 14.28, 14.28, 14.32}},
+		{"payer not sharing falls back to round robin", 10, "dave", three, EqualSplitRemainderPayer, []float64{3.34, 3.33, 3.33}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expense := &models.Expense{SplitType: "equal", Amount: tt.amount, PaidBy: tt.paidBy, SplitAmong: tt.splitAmong}
+
+			assert.Equal(t, tt.expected, equalSplitShares(expense, tt.remainder, ""))
+
+			balances := (&SettlementService{}).calculateLedgerWithRemainder([]*models.Expense{expense}, tt.remainder, "").balances()
+			var total float64
+			for _, balance := range balances {
+				total += balance
+			}
+			assert.InDelta(t, 0.0, total, 1e-9)
+		})
+	}
+}
+
+func TestSettlementService_EqualSplitZeroDecimalCurrency(t *testing.T) {
+	service := &SettlementService{}
+	expense := &models.Expense{SplitType: "equal", Amount: 100000, PaidBy: "alice", SplitAmong: []string{"alice", "bob", "carol"}}
+
+	assert.Equal(t, []float64{33334, 33333, 33333}, equalSplitShares(expense, EqualSplitRemainderRoundRobin, "IDR"))
+	assert.Equal(t, []float64{33334, 33333, 33333}, equalSplitShares(expense, EqualSplitRemainderPayer, "IDR"))
+
+	balances := service.calculateLedgerWithRemainder([]*models.Expense{expense}, EqualSplitRemainderRoundRobin, "IDR").balances()
+	assert.Equal(t, map[string]float64{"alice": 66666, "bob": -33333, "carol": -33333}, balances)
+	assert.Equal(t, []models.Settlement{
+		{From: "bob", To: "alice", Amount: 33333},
+		{From: "carol", To: "alice", Amount: 33333},
+	}, service.calculateOptimalSettlements(balances))
+}
+
+func TestSettlementService_ItemSplitZeroDecimalCurrency(t *testing.T) {
+	expense := &models.Expense{
+		SplitType: "items", Amount: 110000, Tax: 10000, PaidBy: "alice",
+		Items: []models.Item{{Description: "Nasi goreng", UnitPrice: 100000, Quantity: 1, Amount: 100000, PaidBy: "alice", Consumers: []string{"alice", "bob", "carol"}}},
+	}
+
+	balances := (&SettlementService{}).calculateLedgerWithRemainder([]*models.Expense{expense}, EqualSplitRemainderRoundRobin, "IDR").balances()
+
+	assert.Equal(t, map[string]float64{"alice": 73332, "bob": -36666, "carol": -36666}, balances)
+}
+
+func TestExpenseBreakdown(t *testing.T) {
+	expenses := []*models.Expense{
+		{ID: "e1", Description: "Taxi", SplitType: "equal", Amount: 10, PaidBy: "alice", SplitAmong: []string{"alice", "bob", "carol"}},
+		{
+			ID: "e2", Description: "Dinner", SplitType: "items", Amount: 33, Tax: 3, PaidBy: "bob",
+			Items: []models.Item{
+				{Description: "Pizza", Amount: 20, PaidBy: "bob", Consumers: []string{"alice", "bob"}},
+				{Description: "Wine", Amount: 10, PaidBy: "bob", Consumers: []string{"bob"}},
+			},
+		},
+	}
+
+	breakdown := expenseBreakdown(expenses, EqualSplitRemainderRoundRobin, "", nil)
+
+	assert.Len(t, breakdown, 2)
+	assert.Equal(t, "e1", breakdown[0].ExpenseID)
+	assert.Empty(t, breakdown[0].Items)
+	assert.Equal(t, map[string]float64{"Alice": 3.34, "Bob": 3.33, "Carol": 3.33}, breakdown[0].Totals)
+
+	assert.Equal(t, []models.ItemAllocation{
+		{Description: "Pizza", Amount: 20, Shares: map[string]float64{"Alice": 10, "Bob": 10}},
+		{Description: "Wine", Amount: 10, Shares: map[string]float64{"Bob": 10}},
+	}, breakdown[1].Items)
+	assert.Equal(t, map[string]float64{"Alice": 11, "Bob": 22}, breakdown[1].Totals)
+
+	// The totals match what the ledger debits each person
+	consumed := make(map[string]float64)
+	for _, allocation := range breakdown {
+		for person, total := range allocation.Totals {
+			consumed[utils.NormalizeName(person)] += total
+		}
+	}
+	ledger := (&SettlementService{}).calculateLedger(expenses)
+	for person, total := range ledger.consumed {
+		assert.InDelta(t, total, consumed[person], 1e-9, person)
+	}
+}
+
+func TestSettlementService_ZeroConsumerItemChargedToPayer(t *testing.T) {
+	service := &SettlementService{}
+	expenses := []*models.Expense{
+		{
+			ID: "e1", SplitType: "items", Amount: 44, Tax: 4, PaidBy: "alice",
+			Items: []models.Item{
+				{Description: "Pasta", Amount: 20, PaidBy: "alice", Consumers: []string{"bob"}},
+				{Description: "Unassigned", Amount: 20, PaidBy: "alice", Consumers: []string{}},
+			},
+		},
+		{SplitType: "equal", Amount: 30, PaidBy: "bob", SplitAmong: []string{"alice", "bob", "carol"}},
+	}
+
+	balances := service.calculateLedger(expenses).balances()
+
+	var total float64
+	for person, balance := range balances {
+		assert.False(t, math.IsNaN(balance) || math.IsInf(balance, 0), person)
+		total += balance
+	}
+	assert.InDelta(t, 0.0, total, 1e-9)
+
+	// Alice paid 44 and owes the unassigned 20 + 2 tax + 10; Bob owes 20 + 2 tax + 10 and paid 30
+	assert.Equal(t, map[string]float64{"alice": 12, "bob": -2, "carol": -10}, balances)
+}
+
+func TestSettlementService_EqualSplitWithSeveralPayers(t *testing.T) {
+	service := &SettlementService{}
+	expenses := []*models.Expense{
+		{
+			SplitType: "equal", Amount: 90, PaidBy: "bob", SplitAmong: []string{"alice", "bob", "carol"},
+			PaidByShares: map[string]float64{"alice": 30, "bob": 60},
+		},
+	}
+
+	balances := service.calculateLedger(expenses).balances()
+
+	// Each payer is credited only what they paid
+	assert.Equal(t, map[string]float64{"alice": 0, "bob": 30, "carol": -30}, balances)
+}
+
+func TestSettlementService_PreviewSettlement(t *testing.T) {
+	service := newPendingExpenseSettlementService(t)
+	trip := &models.Trip{ID: "trip1", Participants: []string{"alice", "bob", "carol"}}
+
+	result, err := service.PreviewSettlement(trip, "Carol", "alice", 30)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Alice": 30, "Bob": -30, "Carol": 0}, result.IndividualBalances)
+	assert.Equal(t, []models.Settlement{{From: "Bob", To: "Alice", Amount: 30}}, result.Settlements)
+	assert.Equal(t, 30.0, result.PersonDetails["Carol"].PaymentsSent)
+
+	_, err = service.PreviewSettlement(trip, "carol", "Carol", 30)
+	assert.Equal(t, utils.NewValidationError("cannot pay to yourself"), err)
+
+	_, err = service.PreviewSettlement(trip, "carol", "dave", 30)
+	assert.Equal(t, utils.NewValidationError("to_person Dave is not a participant in this trip"), err)
+}
+
+func TestSettlementService_PaymentsWithoutExpenses(t *testing.T) {
+	service, mock := newCachedSettlementService(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expenses WHERE trip_id = $1")).WithArgs("trip1").
+		WillReturnRows(sqlmock.NewRows(expenseColumnNames))
+
+	result, err := service.calculateSettlements("trip1", SettlementOptions{}, models.Payment{FromPerson: "bob", ToPerson: "alice", Amount: 30})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, map[string]float64{"Alice": -30, "Bob": 30}, result.IndividualBalances)
+	assert.Equal(t, []models.Settlement{{From: "Alice", To: "Bob", Amount: 30}}, result.Settlements)
+}
+
+func TestSettlementService_CalculateSettlements_StableOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Alice and Bob are owed the same amount by Carol and Dave, so only names break the ties
+	for call := 0; call < 2; call++ {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM expenses WHERE trip_id = $1")).WithArgs("trip1").
+			WillReturnRows(sqlmock.NewRows(expenseColumnNames).
+				AddRow("exp1", "trip1", "Dinner", 40, 40, 0, 0, 0, "bob", "equal", 1, nil, nil, "", false, "", "", "", nil, "", false).
+				AddRow("exp2", "trip1", "Taxi", 40, 40, 0, 0, 0, "alice", "equal", 2, nil, nil, "", false, "", "", "", nil, "", false))
+		for _, id := range []string{"exp1", "exp2"} {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT participant FROM expense_participants")).WithArgs(id).
+				WillReturnRows(sqlmock.NewRows([]string{"participant"}).AddRow("dave").AddRow("carol"))
+			expectPayerShares(mock, id)
+		}
+	}
+
+	service := &SettlementService{expenseService: &ExpenseService{repo: &repository.ExpenseRepository{DB: db}}}
+
+	first, err := service.CalculateSettlements("trip1")
+	assert.NoError(t, err)
+	second, err := service.CalculateSettlements("trip1")
+	assert.NoError(t, err)
+
+	expected := []models.Settlement{
+		{From: "Carol", To: "Alice", Amount: 40},
+		{From: "Dave", To: "Bob", Amount: 40},
+	}
+	assert.Equal(t, expected, first.Settlements)
+	assert.Equal(t, first.Settlements, second.Settlements)
+	assert.Equal(t, map[string]string{"Alice": "alice", "Bob": "bob", "Carol": "carol", "Dave": "dave"}, first.NameKeys)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSettlementService_SortByBalance_BreaksTiesByName(t *testing.T) {
+	service := &SettlementService{}
+	balances := []PersonBalance{{"dave", 10}, {"alice", 5}, {"carol", 10}, {"bob", 10}}
+
+	service.sortByBalance(balances)
+
+	assert.Equal(t, []PersonBalance{{"bob", 10}, {"carol", 10}, {"dave", 10}, {"alice", 5}}, balances)
+}
+
+func TestSettlementService_HonorsStoredExtrasSplitMode(t *testing.T) {
+	service := &SettlementService{}
+	expense := func(mode string) *models.Expense {
+		return &models.Expense{
+			SplitType: "items", Amount: 90, Subtotal: 80, Tax: 8, ServiceCharge: 4, TotalDiscount: 2,
+			PaidBy: "alice", ExtrasSplitMode: mode,
+			Items: []models.Item{
+				{Description: "Steak", Amount: 60, PaidBy: "alice", Consumers: []string{"alice"}},
+				{Description: "Salad", Amount: 20, PaidBy: "alice", Consumers: []string{"bob"}},
+			},
+		}
+	}
+
+	proportional := service.calculateLedger([]*models.Expense{expense(models.ExtrasSplitProportional)}).balances()
+	assert.Equal(t, map[string]float64{"alice": 22.5, "bob": -22.5}, proportional)
+
+	equal := service.calculateLedger([]*models.Expense{expense(models.ExtrasSplitEqual)}).balances()
+	assert.Equal(t, map[string]float64{"alice": 25, "bob": -25}, equal)
+}
+
+func TestSettlementService_ExtrasSplitAmongSubset(t *testing.T) {
+	service := &SettlementService{}
+	expense := func(extrasSplitAmong ...string) *models.Expense {
+		return &models.Expense{
+			SplitType: "items", Amount: 112, Subtotal: 100, ServiceCharge: 12,
+			PaidBy: "alice", ExtrasSplitAmong: extrasSplitAmong,
+			Items: []models.Item{
+				{Description: "Steak", Amount: 60, PaidBy: "alice", Consumers: []string{"alice"}},
+				{Description: "Salad", Amount: 20, PaidBy: "alice", Consumers: []string{"bob"}},
+				{Description: "Soup", Amount: 20, PaidBy: "alice", Consumers: []string{"carol"}},
+			},
+		}
+	}
+
+	// By default the service charge follows consumption, 60:20:20
+	proportional := service.calculateLedger([]*models.Expense{expense()}).balances()
+	assert.Equal(t, map[string]float64{"alice": 44.8, "bob": -22.4, "carol": -22.4}, proportional)
+
+	// Only Bob and Carol were served at the table, so they share it evenly
+	subset := service.calculateLedger([]*models.Expense{expense("bob", "carol")}).balances()
+	assert.Equal(t, map[string]float64{"alice": 52, "bob": -26, "carol": -26}, subset)
+
+	// Someone who ate nothing can still share the extras
+	withGuest := service.calculateLedger([]*models.Expense{expense("carol", "dave")}).balances()
+	assert.Equal(t, map[string]float64{"alice": 52, "bob": -20, "carol": -26, "dave": -6}, withGuest)
+}
+
+func TestBalanceLedger_MatchesDisplayAndStoredNames(t *testing.T) {
+	ledger := newBalanceLedger()
+	ledger.aliases = utils.NameAliases{"mcdonald": "McDonald"}
+
+	// Expenses arrive formatted for display while payments keep their stored names
+	ledger.credit("McDonald", 30)
+	ledger.debit("Bob", 30)
+	ledger.recordPayment("bob", "mcdonald", 30)
+
+	balances := ledger.personBalances()
+	assert.Len(t, balances, 2)
+	assert.Equal(t, "Bob", balances[0].Name)
+	assert.Equal(t, 0.0, balances[0].Net)
+	assert.Equal(t, "McDonald", balances[1].Name)
+	assert.Equal(t, 0.0, balances[1].Net)
+}
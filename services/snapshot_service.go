@@ -0,0 +1,48 @@
+package services
+
+import (
+	"encoding/json"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// SnapshotService handles persistence of settlement snapshots
+type SnapshotService struct {
+	repo *repository.SnapshotRepository
+}
+
+// NewSnapshotService creates a new snapshot service
+func NewSnapshotService(repo *repository.SnapshotRepository) *SnapshotService {
+	return &SnapshotService{
+		repo: repo,
+	}
+}
+
+// SaveSnapshot stores the given settlement result for a trip
+func (s *SnapshotService) SaveSnapshot(tripID string, result *models.SettlementResult) (*models.SettlementSnapshot, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to serialize settlement result")
+	}
+
+	snapshot := &models.SettlementSnapshot{
+		TripID: tripID,
+		Result: data,
+	}
+	if err := s.repo.CreateSnapshot(snapshot); err != nil {
+		return nil, utils.NewInternalError("Failed to store settlement snapshot")
+	}
+
+	return snapshot, nil
+}
+
+// GetSnapshots returns all settlement snapshots for a trip, newest first
+func (s *SnapshotService) GetSnapshots(tripID string) ([]models.SettlementSnapshot, error) {
+	snapshots, err := s.repo.GetSnapshotsByTripID(tripID)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve settlement snapshots")
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/fadhlanhapp/sharetab-backend/utils"
+)
+
+// TemplateService manages expense templates, saved expenses that recur in a trip
+// (rent, utilities) and can be re-added without entering the split again
+type TemplateService struct {
+	repo     *repository.TemplateRepository
+	expenses *ExpenseService
+}
+
+// NewTemplateService creates a new template service
+func NewTemplateService(repo *repository.TemplateRepository, expenses *ExpenseService) *TemplateService {
+	return &TemplateService{
+		repo:     repo,
+		expenses: expenses,
+	}
+}
+
+// CreateTemplate saves one of the trip's expenses as a named template. The template
+// keeps the split type, participants and amounts but not the receipt, status or
+// idempotency key of the original.
+func (s *TemplateService) CreateTemplate(tripID string, request *models.CreateExpenseTemplateRequest) (*models.ExpenseTemplate, error) {
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		return nil, utils.NewValidationError("Template name is required")
+	}
+
+	source, err := s.expenses.GetExpense(tripID, request.ExpenseID)
+	if err != nil {
+		return nil, err
+	}
+
+	expense := cloneExpense(source)
+	expense.ID = ""
+	expense.CreationTime = 0
+	expense.TripID = ""
+	expense.ReceiptImage = ""
+	expense.IdempotencyKey = ""
+	expense.Status = ""
+	expense.ConfirmedBy = ""
+
+	template := &models.ExpenseTemplate{
+		ID:      utils.GenerateID(),
+		TripID:  tripID,
+		Name:    name,
+		Expense: expense,
+	}
+	if err := s.repo.CreateTemplate(template); err != nil {
+		return nil, utils.NewInternalError("Failed to store expense template")
+	}
+
+	return s.formatTemplateForDisplay(template), nil
+}
+
+// GetTemplates returns the trip's templates, ordered by name
+func (s *TemplateService) GetTemplates(tripID string) ([]models.ExpenseTemplate, error) {
+	templates, err := s.repo.GetTemplates(tripID)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve expense templates")
+	}
+
+	for i := range templates {
+		templates[i] = *s.formatTemplateForDisplay(&templates[i])
+	}
+	return templates, nil
+}
+
+// GetTemplate returns one of the trip's templates
+func (s *TemplateService) GetTemplate(tripID, templateID string) (*models.ExpenseTemplate, error) {
+	template, err := s.repo.GetTemplate(tripID, templateID)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve expense template")
+	}
+	if template == nil {
+		return nil, utils.NewNotFoundError("Expense template")
+	}
+	return s.formatTemplateForDisplay(template), nil
+}
+
+// DeleteTemplate removes a template from a trip; expenses created from it are kept
+func (s *TemplateService) DeleteTemplate(tripID, templateID string) error {
+	found, err := s.repo.DeleteTemplate(tripID, templateID)
+	if err != nil {
+		return utils.NewInternalError("Failed to delete expense template")
+	}
+	if !found {
+		return utils.NewNotFoundError("Expense template")
+	}
+	return nil
+}
+
+// CreateExpenseFromTemplate adds a new expense to the trip from one of its templates,
+// with a fresh ID and the current time. An amount override replaces the template's
+// amount as a plain subtotal, clearing tax, service charge and discount, and splits
+// jointly paid expenses between the payers in their original proportions. Item splits
+// take their amounts from their items, so they cannot be overridden.
+func (s *TemplateService) CreateExpenseFromTemplate(trip *models.Trip, request *models.ExpenseFromTemplateRequest) (*models.Expense, error) {
+	template, err := s.repo.GetTemplate(trip.ID, request.TemplateID)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve expense template")
+	}
+	if template == nil {
+		return nil, utils.NewNotFoundError("Expense template")
+	}
+
+	expense := cloneExpense(template.Expense)
+	expense.ID = utils.GenerateID()
+	expense.TripID = trip.ID
+	expense.CreationTime = time.Now().UnixMilli()
+
+	if request.Amount > 0 {
+		if err := overrideTemplateAmount(expense, request.Amount, trip.Currency); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.expenses.StoreExpense(expense); err != nil {
+		return nil, err
+	}
+
+	return s.expenses.formatExpenseForDisplay(expense), nil
+}
+
+// overrideTemplateAmount sets an equal split's amount, rescaling any payer shares
+func overrideTemplateAmount(expense *models.Expense, amount float64, currency string) error {
+	if expense.SplitType != "equal" {
+		return utils.NewValidationError("Amount can only be overridden for equal split templates")
+	}
+
+	amount = utils.Round(amount)
+	if len(expense.PaidByShares) > 0 {
+		payers := expense.Payers()
+		shares := distributeCharge(amount, shareWeights(payers, expense.PaidByShares), currency)
+		for i, payer := range payers {
+			expense.PaidByShares[payer] = shares[i]
+		}
+	}
+
+	expense.Amount = amount
+	expense.Subtotal = amount
+	expense.Tax = 0
+	expense.ServiceCharge = 0
+	expense.TotalDiscount = 0
+	expense.TaxInclusive = false
+	expense.TaxOnServiceCharge = false
+	return nil
+}
+
+// formatTemplateForDisplay formats the names in a template's expense for display
+func (s *TemplateService) formatTemplateForDisplay(template *models.ExpenseTemplate) *models.ExpenseTemplate {
+	formatted := *template
+	if template.Expense != nil {
+		formatted.Expense = s.expenses.formatExpenseForDisplay(template.Expense)
+	}
+	return &formatted
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fadhlanhapp/sharetab-backend/models"
+	"github.com/fadhlanhapp/sharetab-backend/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockTemplateService(t *testing.T) (*TemplateService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	expenses := &ExpenseService{repo: &repository.ExpenseRepository{DB: db}}
+	return NewTemplateService(repository.NewTemplateRepository(db), expenses), mock
+}
+
+func TestTemplateService_CreateExpenseFromTemplate(t *testing.T) {
+	service, mock := newMockTemplateService(t)
+	trip := &models.Trip{ID: "trip1", Code: "ABC123"}
+
+	stored := `{"description":"Rent","amount":1500,"subtotal":1500,"paidBy":"alice","splitType":"equal","splitAmong":["alice","bob","carol"]}`
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expense_templates")).WithArgs("tmpl1", "trip1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trip_id", "name", "expense", "created_at"}).
+			AddRow("tmpl1", "trip1", "Monthly rent", []byte(stored), time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expenses")).
+		WithArgs(sqlmock.AnyArg(), "trip1", "Rent", 1620.0, 1620.0, 0.0, 0.0, 0.0, "alice", "equal",
+			sqlmock.AnyArg(), "", sqlmock.AnyArg(), "", false, "", models.ExpenseStatusPending, "", sqlmock.AnyArg(), "", false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	for range 3 {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO expense_participants")).WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	expense, err := service.CreateExpenseFromTemplate(trip, &models.ExpenseFromTemplateRequest{
+		Code: "ABC123", TemplateID: "tmpl1", Amount: 1620,
+	})
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, expense.ID)
+	assert.Equal(t, "trip1", expense.TripID)
+	assert.NotZero(t, expense.CreationTime)
+	assert.Equal(t, 1620.0, expense.Amount)
+	assert.Equal(t, "Alice", expense.PaidBy)
+	assert.Equal(t, []string{"Alice", "Bob", "Carol"}, expense.SplitAmong)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTemplateService_CreateExpenseFromTemplate_UnknownTemplate(t *testing.T) {
+	service, mock := newMockTemplateService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM expense_templates")).WithArgs("missing", "trip1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trip_id", "name", "expense", "created_at"}))
+
+	expense, err := service.CreateExpenseFromTemplate(&models.Trip{ID: "trip1"}, &models.ExpenseFromTemplateRequest{TemplateID: "missing"})
+
+	assert.Nil(t, expense)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOverrideTemplateAmount_RescalesPayerShares(t *testing.T) {
+	expense := &models.Expense{
+		SplitType:    "equal",
+		Amount:       110,
+		Subtotal:     100,
+		Tax:          10,
+		PaidBy:       "alice",
+		PaidByShares: map[string]float64{"alice": 82.5, "bob": 27.5},
+	}
+
+	assert.NoError(t, overrideTemplateAmount(expense, 100, ""))
+
+	assert.Equal(t, 100.0, expense.Amount)
+	assert.Equal(t, 100.0, expense.Subtotal)
+	assert.Zero(t, expense.Tax)
+	assert.Equal(t, map[string]float64{"alice": 75, "bob": 25}, expense.PaidByShares)
+}
+
+func TestOverrideTemplateAmount_RejectsItemSplits(t *testing.T) {
+	expense := &models.Expense{SplitType: "items", Amount: 40}
+
+	err := overrideTemplateAmount(expense, 50, "")
+
+	assert.Error(t, err)
+	assert.Equal(t, 40.0, expense.Amount)
+}
@@ -1,6 +1,16 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/fadhlanhapp/sharetab-backend/models"
 	"github.com/fadhlanhapp/sharetab-backend/repository"
 	"github.com/fadhlanhapp/sharetab-backend/utils"
@@ -13,20 +23,64 @@ func InitTripService() {
 	tripRepo = repository.NewTripRepository()
 }
 
+// maxTripCodeAttempts caps how many random codes CreateTrip tries before giving up
+const maxTripCodeAttempts = 10
+
+// defaultMaxParticipants caps trip size when MAX_PARTICIPANTS is not set
+const defaultMaxParticipants = 100
+
+// maxParticipants reads the per-trip participant limit from MAX_PARTICIPANTS, defaulting to 100
+func maxParticipants() int {
+	value := os.Getenv("MAX_PARTICIPANTS")
+	if value == "" {
+		return defaultMaxParticipants
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		slog.Warn("Invalid MAX_PARTICIPANTS, using default", "value", value, "default", defaultMaxParticipants)
+		return defaultMaxParticipants
+	}
+	return limit
+}
+
+// tooManyParticipantsError explains that a trip has reached the participant limit
+func tooManyParticipantsError(limit int) error {
+	return utils.NewValidationError(fmt.Sprintf("A trip can have at most %d participants", limit))
+}
+
+// addTripParticipant adds a normalized name to a trip, refusing new people once the
+// trip has reached the participant limit
+func addTripParticipant(repo *repository.TripRepository, tripID, participant string) error {
+	limit := maxParticipants()
+	err := repo.AddParticipant(tripID, participant, limit)
+	if errors.Is(err, repository.ErrTooManyParticipants) {
+		return tooManyParticipantsError(limit)
+	}
+	if err != nil {
+		return utils.NewInternalError("Failed to add participant")
+	}
+	return nil
+}
+
 // TripService handles trip-related business logic
 type TripService struct {
-	repo *repository.TripRepository
+	repo         *repository.TripRepository
+	generateCode func() string
+	settlements  *settlementCache // Invalidated when a trip's display names change
 }
 
 // NewTripService creates a new trip service instance
 func NewTripService() *TripService {
 	return &TripService{
-		repo: repository.NewTripRepository(),
+		repo:         repository.NewTripRepository(),
+		generateCode: utils.GenerateCode,
+		settlements:  sharedSettlementCache,
 	}
 }
 
 // CreateTrip creates a new trip with validation
-func (s *TripService) CreateTrip(name, participant string) (*models.Trip, error) {
+func (s *TripService) CreateTrip(name, participant, currency, owner string) (*models.Trip, error) {
 	if err := utils.ValidateRequired(name, "trip name"); err != nil {
 		return nil, err
 	}
@@ -35,10 +89,14 @@ func (s *TripService) CreateTrip(name, participant string) (*models.Trip, error)
 	}
 
 	tripID := utils.GenerateID()
-	code := utils.GenerateCode()
+	code, err := s.uniqueTripCode()
+	if err != nil {
+		return nil, err
+	}
 	normalizedParticipant := utils.NormalizeName(participant)
 
-	trip := models.NewTrip(tripID, code, name, normalizedParticipant)
+	trip := models.NewTrip(tripID, code, name, normalizedParticipant, utils.NormalizeCurrency(currency))
+	trip.Owner = strings.TrimSpace(owner)
 	if err := s.repo.StoreTrip(trip); err != nil {
 		return nil, utils.NewInternalError("Failed to create trip")
 	}
@@ -46,45 +104,343 @@ func (s *TripService) CreateTrip(name, participant string) (*models.Trip, error)
 	return trip, nil
 }
 
+// uniqueTripCode generates trip codes until it finds one no existing trip uses
+func (s *TripService) uniqueTripCode() (string, error) {
+	generate := s.generateCode
+	if generate == nil {
+		generate = utils.GenerateCode
+	}
+
+	for attempt := 0; attempt < maxTripCodeAttempts; attempt++ {
+		code := generate()
+		exists, err := s.repo.CodeExists(code)
+		if err != nil {
+			return "", utils.NewInternalError("Failed to create trip")
+		}
+		if !exists {
+			return code, nil
+		}
+	}
+
+	return "", utils.NewInternalError("Failed to generate a unique trip code")
+}
+
 // GetTripByCode retrieves a trip by its code with formatted participant names
 func (s *TripService) GetTripByCode(code string) (*models.Trip, error) {
 	if err := utils.ValidateRequired(code, "trip code"); err != nil {
 		return nil, err
 	}
 
-	trip, err := s.repo.GetTripByCode(code)
+	// Malformed codes can't match a trip, so skip the query
+	code = utils.NormalizeTripCode(code)
+	if !utils.IsValidTripCode(code) {
+		return nil, utils.NewValidationError("Invalid trip code")
+	}
+
+	trip, err := lookupTrip(s.repo, code)
 	if err != nil {
-		return nil, utils.NewNotFoundError("Trip")
+		return nil, err
 	}
 
-	// Format participant names for display
-	trip.Participants = utils.FormatNamesForDisplay(trip.Participants)
+	// Format participant names for display, preferring the trip's aliases
+	aliases := utils.NameAliases(trip.Aliases)
+	trip.Participants = aliases.FormatNames(trip.Participants)
+	if len(trip.Guests) > 0 {
+		trip.Guests = aliases.FormatNames(trip.Guests)
+	}
+	if len(trip.DefaultConsumers) > 0 {
+		trip.DefaultConsumers = aliases.FormatNames(trip.DefaultConsumers)
+	}
 	return trip, nil
 }
 
-// AddParticipant adds a participant to a trip if they don't exist already
-func (s *TripService) AddParticipant(tripID, participant string) error {
+// SetAliases sets the display names of some of a trip's participants, keyed by
+// participant name; an empty display name goes back to the title-cased name. A
+// display name may be a different capitalization ("McDonald") or a nickname; names
+// sent back as shown are mapped to the participant with NameAliases.Key.
+func (s *TripService) SetAliases(trip *models.Trip, aliases map[string]string) error {
+	participants := participantKeys(trip)
+	current := utils.NameAliases(trip.Aliases)
+
+	updates := make(map[string]string, len(aliases))
+	for participant, displayName := range aliases {
+		name := current.Key(participant)
+		if !participants[name] {
+			return utils.NewValidationError(fmt.Sprintf("%s is not a participant in this trip", utils.FormatNameForDisplay(name)))
+		}
+		updates[name] = strings.TrimSpace(displayName)
+	}
+
+	merged := make(map[string]string, len(trip.Aliases)+len(updates))
+	for name, displayName := range trip.Aliases {
+		merged[name] = displayName
+	}
+	for name, displayName := range updates {
+		if displayName == "" {
+			delete(merged, name)
+		} else {
+			merged[name] = displayName
+		}
+	}
+	if err := validateAliases(participants, merged); err != nil {
+		return err
+	}
+
+	if err := s.repo.SetAliases(trip.ID, updates); err != nil {
+		return utils.NewInternalError("Failed to update display names")
+	}
+	s.settlements.invalidate(trip.ID)
+	return nil
+}
+
+// validateAliases checks that each display name identifies a single participant, so
+// it can be mapped back to them: it may not be another participant's name or the
+// display name of someone else
+func validateAliases(participants map[string]bool, aliases map[string]string) error {
+	// Checked in name order so the reported conflict doesn't vary between requests
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	owners := make(map[string]string, len(aliases))
+	for _, name := range names {
+		displayName := aliases[name]
+		key := utils.NormalizeName(displayName)
+		if key != name && participants[key] {
+			return utils.NewValidationError(fmt.Sprintf("Display name %q is already the name of another participant", displayName))
+		}
+		if owner, taken := owners[key]; taken {
+			return utils.NewValidationError(fmt.Sprintf("Display name %q is already used for %s", displayName, utils.FormatNameForDisplay(owner)))
+		}
+		owners[key] = name
+	}
+	return nil
+}
+
+// tripAliases returns the trip's participant display names, or nil when the lookup
+// fails so names fall back to title case
+func tripAliases(repo *repository.TripRepository, tripID string) utils.NameAliases {
+	if repo == nil || tripID == "" {
+		return nil
+	}
+	aliases, err := repo.GetAliases(tripID)
+	if err != nil {
+		slog.Warn("Failed to load participant aliases", "operation", "get_aliases", "tripId", tripID, "error", err)
+		return nil
+	}
+	return aliases
+}
+
+// participantKeys returns the stored names of a trip's participants. GetTripByCode
+// hands participants out formatted with their aliases, so each is mapped back with Key.
+func participantKeys(trip *models.Trip) map[string]bool {
+	aliases := utils.NameAliases(trip.Aliases)
+	keys := make(map[string]bool, len(trip.Participants))
+	for _, participant := range trip.Participants {
+		keys[aliases.Key(participant)] = true
+	}
+	return keys
+}
+
+// lookupTrip fetches a trip by code, reporting a missing trip as not found and any
+// other failure, such as a database outage, as an internal error
+func lookupTrip(repo *repository.TripRepository, code string) (*models.Trip, error) {
+	trip, err := repo.GetTripByCode(code)
+	if errors.Is(err, repository.ErrTripNotFound) {
+		return nil, utils.NewNotFoundError("Trip")
+	}
+	if err != nil {
+		slog.Error("Failed to look up trip", "operation", "get_trip", "tripCode", code, "error", err)
+		return nil, utils.NewInternalError("Failed to retrieve trip")
+	}
+	return trip, nil
+}
+
+// LoadActivity adds the trip's expense and payment counts and last activity time
+func (s *TripService) LoadActivity(trip *models.Trip) error {
+	activity, err := s.repo.GetTripActivity(trip.ID)
+	if err != nil {
+		return utils.NewInternalError("Failed to load trip activity")
+	}
+	trip.TripActivity = activity
+	return nil
+}
+
+// SetParticipantGuest marks whether a participant is skipped by "split among all"
+func (s *TripService) SetParticipantGuest(tripID, participant string, guest bool) error {
 	if err := utils.ValidateRequired(participant, "participant name"); err != nil {
 		return err
 	}
 
-	normalizedName := utils.NormalizeName(participant)
-	if err := s.repo.AddParticipant(tripID, normalizedName); err != nil {
-		return utils.NewInternalError("Failed to add participant")
+	found, err := s.repo.SetParticipantGuest(tripID, utils.NormalizeName(participant), guest)
+	if err != nil {
+		return utils.NewInternalError("Failed to update participant")
+	}
+	if !found {
+		return utils.NewNotFoundError("Participant")
+	}
+	return nil
+}
+
+// SetDefaultConsumers sets who is charged for item expenses whose items name no consumers
+// Every default must already be a trip participant; an empty list clears the defaults
+func (s *TripService) SetDefaultConsumers(trip *models.Trip, consumers []string) error {
+	participants := participantKeys(trip)
+
+	normalized := utils.NameAliases(trip.Aliases).Keys(consumers)
+	for _, consumer := range normalized {
+		if !participants[consumer] {
+			return utils.NewValidationError(fmt.Sprintf("%s is not a participant in this trip", utils.FormatNameForDisplay(consumer)))
+		}
+	}
+
+	if err := s.repo.SetDefaultConsumers(trip.ID, normalized); err != nil {
+		return utils.NewInternalError("Failed to update default consumers")
+	}
+	return nil
+}
+
+// ApplyDefaultConsumers gives every item without consumers the trip's default consumers
+func (s *TripService) ApplyDefaultConsumers(trip *models.Trip, items []models.Item) {
+	applyDefaultConsumers(trip, items)
+}
+
+// applyDefaultConsumers gives items without consumers the trip's default consumers
+func applyDefaultConsumers(trip *models.Trip, items []models.Item) {
+	if len(trip.DefaultConsumers) == 0 {
+		return
+	}
+	for i := range items {
+		if len(items[i].Consumers) == 0 {
+			items[i].Consumers = append([]string(nil), trip.DefaultConsumers...)
+		}
+	}
+}
+
+// ListTripsByOwner returns an owner's trips, newest first
+// Archived trips are only included when includeArchived is set
+func (s *TripService) ListTripsByOwner(owner string, includeArchived bool) ([]*models.Trip, error) {
+	owner = strings.TrimSpace(owner)
+	if err := utils.ValidateRequired(owner, "owner"); err != nil {
+		return nil, err
+	}
+
+	trips, err := s.repo.GetTripsByOwner(owner, includeArchived)
+	if err != nil {
+		return nil, utils.NewInternalError("Failed to retrieve trips")
+	}
+	return trips, nil
+}
+
+// SetArchived archives a finished trip or restores it to the default listing
+func (s *TripService) SetArchived(tripID string, archived bool) error {
+	if err := s.repo.SetArchived(tripID, archived); err != nil {
+		return utils.NewInternalError("Failed to update trip")
 	}
 	return nil
 }
 
-// Legacy functions for backward compatibility
+// DeleteTrip permanently deletes a trip with all its expenses, participants and
+// payments, then removes its retained receipt images
+func (s *TripService) DeleteTrip(code string) error {
+	trip, err := s.GetTripByCode(code)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.repo.DeleteTrip(trip.ID)
+	if err != nil {
+		return utils.NewInternalError("Failed to delete trip")
+	}
+	if !deleted {
+		return utils.NewNotFoundError("Trip")
+	}
+	s.settlements.invalidate(trip.ID)
+
+	if err := RemoveTripReceiptImages(trip.ID); err != nil {
+		slog.Warn("Failed to remove receipt images of deleted trip", "operation", "delete_trip", "tripCode", trip.Code, "error", err)
+	}
+	return nil
+}
+
+// SetWebhookURL sets the HTTPS URL that receives a trip's expense and payment events
+// The URL must not point at a loopback, private or link-local address. An empty URL
+// removes the webhook.
+func (s *TripService) SetWebhookURL(tripID, webhookURL string) error {
+	webhookURL = strings.TrimSpace(webhookURL)
+	if webhookURL != "" {
+		parsed, err := url.Parse(webhookURL)
+		if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+			return utils.NewValidationError("webhookUrl must be an https URL")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+		defer cancel()
+		if err := validateWebhookHost(ctx, parsed.Hostname()); err != nil {
+			return utils.NewValidationError("webhookUrl must point to a public host")
+		}
+	}
+
+	if err := s.repo.SetWebhookURL(tripID, webhookURL); err != nil {
+		return utils.NewInternalError("Failed to update webhook")
+	}
+	return nil
+}
+
+// ResolveSplitAmongAll expands "split among all" into every non-guest participant
+// of the trip, plus anyone listed explicitly (guests may still be named directly)
+func (s *TripService) ResolveSplitAmongAll(trip *models.Trip, explicit []string) []string {
+	guests := make(map[string]bool)
+	for _, guest := range trip.Guests {
+		guests[utils.NormalizeName(guest)] = true
+	}
+
+	seen := make(map[string]bool)
+	var resolved []string
+	for _, participant := range trip.Participants {
+		name := utils.NormalizeName(participant)
+		if guests[name] || seen[name] {
+			continue
+		}
+		seen[name] = true
+		resolved = append(resolved, participant)
+	}
+
+	for _, participant := range explicit {
+		name := utils.NormalizeName(participant)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		resolved = append(resolved, participant)
+	}
+
+	return resolved
+}
+
+// AddParticipant adds a participant to a trip if they don't exist already
+func (s *TripService) AddParticipant(tripID, participant string) error {
+	if err := utils.ValidateRequired(participant, "participant name"); err != nil {
+		return err
+	}
+
+	return addTripParticipant(s.repo, tripID, utils.NormalizeName(participant))
+}
+
+// Legacy functions for backward compatibility. They share TripService's name handling,
+// so trips stored or read through either path carry identical participant names.
 func GetTripByCode(code string) (*models.Trip, error) {
-	return tripRepo.GetTripByCode(code)
+	return (&TripService{repo: tripRepo}).GetTripByCode(code)
 }
 
 func StoreTrip(trip *models.Trip) error {
+	trip.Participants = utils.NormalizeNames(trip.Participants)
+	trip.Currency = utils.NormalizeCurrency(trip.Currency)
 	return tripRepo.StoreTrip(trip)
 }
 
 func AddParticipant(tripID string, participant string) error {
 	normalizedName := utils.NormalizeName(participant)
-	return tripRepo.AddParticipant(tripID, normalizedName)
+	return addTripParticipant(tripRepo, tripID, normalizedName)
 }
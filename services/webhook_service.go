@@ -0,0 +1,185 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Webhook event types
+const (
+	WebhookEventExpenseAdded = "expense.added"
+	WebhookEventPaymentAdded = "payment.added"
+)
+
+// Webhook delivery settings
+const (
+	webhookMaxAttempts = 3
+	webhookRetryDelay  = 2 * time.Second
+	webhookTimeout     = 10 * time.Second
+)
+
+// WebhookEvent is the JSON payload posted to a trip's webhook URL
+// Summary is repeated as text and content so Slack and Discord render it as a message
+type WebhookEvent struct {
+	Event     string    `json:"event"`
+	TripCode  string    `json:"tripCode"`
+	Summary   string    `json:"summary"`
+	Text      string    `json:"text"`    // Slack incoming webhooks
+	Content   string    `json:"content"` // Discord webhooks
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// NewWebhookEvent creates an event for a trip with the given summary
+func NewWebhookEvent(eventType, tripCode, summary string) WebhookEvent {
+	return WebhookEvent{
+		Event:     eventType,
+		TripCode:  tripCode,
+		Summary:   summary,
+		Text:      summary,
+		Content:   summary,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// WebhookNotifier posts trip events to webhook URLs in the background
+type WebhookNotifier struct {
+	client      *http.Client
+	maxAttempts int
+	retryDelay  time.Duration
+}
+
+// NewWebhookNotifier creates a notifier with the default retry policy
+// Its client refuses to connect to loopback, private and link-local addresses
+func NewWebhookNotifier() *WebhookNotifier {
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: rejectInternalWebhookAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &WebhookNotifier{
+		client:      &http.Client{Timeout: webhookTimeout, Transport: transport},
+		maxAttempts: webhookMaxAttempts,
+		retryDelay:  webhookRetryDelay,
+	}
+}
+
+// errInternalWebhookAddress rejects webhook URLs that resolve to this host or its network
+var errInternalWebhookAddress = errors.New("webhook address is not publicly routable")
+
+// isPublicWebhookIP reports whether a webhook may be delivered to ip
+func isPublicWebhookIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified())
+}
+
+// rejectInternalWebhookAddress runs before each webhook connection, after DNS
+// resolution, so a host that resolves to an internal address at delivery time is
+// refused even if it resolved to a public one when the URL was set
+func rejectInternalWebhookAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicWebhookIP(ip) {
+		return errInternalWebhookAddress
+	}
+	return nil
+}
+
+// validateWebhookHost checks that a webhook host, and every address it resolves to,
+// is publicly routable
+func validateWebhookHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicWebhookIP(ip) {
+			return errInternalWebhookAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("webhook host %q could not be resolved", host)
+	}
+	for _, addr := range addrs {
+		if !isPublicWebhookIP(addr.IP) {
+			return errInternalWebhookAddress
+		}
+	}
+	return nil
+}
+
+// webhookRejectedError is a delivery failure that retrying can't fix, such as a
+// 4xx response or a blocked address
+type webhookRejectedError struct {
+	err error
+}
+
+func (e *webhookRejectedError) Error() string {
+	return e.err.Error()
+}
+
+// Notify delivers an event asynchronously so the caller's request is never blocked
+// Delivery failures are retried and then logged
+func (n *WebhookNotifier) Notify(url string, event WebhookEvent) {
+	if n == nil || url == "" {
+		return
+	}
+
+	go func() {
+		if err := n.deliver(url, event); err != nil {
+			slog.Error("Webhook delivery failed", "operation", "deliver_webhook", "tripCode", event.TripCode, "event", event.Event, "error", err)
+		}
+	}()
+}
+
+// deliver posts an event, retrying with a growing delay until it succeeds or attempts run out
+func (n *WebhookNotifier) deliver(url string, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = n.post(url, body)
+		if err == nil {
+			return nil
+		}
+		var rejected *webhookRejectedError
+		if errors.As(err, &rejected) {
+			return fmt.Errorf("rejected after %d attempts: %v", attempt, err)
+		}
+		if attempt >= n.maxAttempts {
+			return fmt.Errorf("gave up after %d attempts: %v", attempt, err)
+		}
+		time.Sleep(n.retryDelay * time.Duration(attempt))
+	}
+}
+
+// post sends a single delivery attempt
+// 4xx responses and blocked addresses are returned as a *webhookRejectedError
+func (n *WebhookNotifier) post(url string, body []byte) error {
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if errors.Is(err, errInternalWebhookAddress) {
+		return &webhookRejectedError{err: err}
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return &webhookRejectedError{err: fmt.Errorf("unexpected status %d", resp.StatusCode)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestWebhookNotifier() *WebhookNotifier {
+	return &WebhookNotifier{
+		client:      http.DefaultClient,
+		maxAttempts: 3,
+		retryDelay:  0,
+	}
+}
+
+func TestWebhookNotifier_RetriesUntilDelivered(t *testing.T) {
+	var attempts int32
+	var received WebhookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	event := NewWebhookEvent(WebhookEventExpenseAdded, "ABC123", `Alice added "Dinner" for 150.00`)
+	err := newTestWebhookNotifier().deliver(server.URL, event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	assert.Equal(t, WebhookEventExpenseAdded, received.Event)
+	assert.Equal(t, "ABC123", received.TripCode)
+	assert.Equal(t, event.Summary, received.Text)
+	assert.Equal(t, event.Summary, received.Content)
+}
+
+func TestWebhookNotifier_GivesUpAfterMaxAttempts(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := newTestWebhookNotifier().deliver(server.URL, NewWebhookEvent(WebhookEventPaymentAdded, "ABC123", "Bob paid Alice 20.00"))
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+}
+
+func TestWebhookNotifier_DoesNotRetryClientErrors(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	err := newTestWebhookNotifier().deliver(server.URL, NewWebhookEvent(WebhookEventPaymentAdded, "ABC123", "Bob paid Alice 20.00"))
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestWebhookNotifier_RefusesInternalAddresses(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier()
+	notifier.retryDelay = 0
+	err := notifier.deliver(server.URL, NewWebhookEvent(WebhookEventExpenseAdded, "ABC123", `Alice added "Dinner" for 150.00`))
+
+	assert.ErrorContains(t, err, "rejected after 1 attempts")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&attempts))
+}
+
+func TestValidateWebhookHost_RejectsInternalAddresses(t *testing.T) {
+	for _, host := range []string{"127.0.0.1", "10.0.0.5", "192.168.1.1", "169.254.169.254", "::1", "fd00::1", "0.0.0.0", "localhost"} {
+		assert.Error(t, validateWebhookHost(context.Background(), host), host)
+	}
+	assert.NoError(t, validateWebhookHost(context.Background(), "93.184.216.34"))
+}
@@ -5,6 +5,9 @@ const (
 	SplitTypeEqual = "equal"
 	SplitTypeItems = "items"
 
+	// Category used in reports for expenses without one
+	UncategorizedCategory = "uncategorized"
+
 	// ID and code generation
 	IDCharset   = "abcdefghijklmnopqrstuvwxyz0123456789"
 	CodeCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// currencyDecimals lists ISO 4217 currencies whose minor unit is not two decimals
+// Any currency not listed here, including an empty one, rounds to two decimals
+var currencyDecimals = map[string]int{
+	// No minor unit in everyday use
+	"CLP": 0,
+	"IDR": 0,
+	"ISK": 0,
+	"JPY": 0,
+	"KRW": 0,
+	"PYG": 0,
+	"UGX": 0,
+	"VND": 0,
+
+	// Three decimal places
+	"BHD": 3,
+	"IQD": 3,
+	"JOD": 3,
+	"KWD": 3,
+	"LYD": 3,
+	"OMR": 3,
+	"TND": 3,
+}
+
+// CurrencyDecimals returns the number of decimal places amounts in a currency are rounded to
+func CurrencyDecimals(currency string) int {
+	if decimals, ok := currencyDecimals[NormalizeCurrency(currency)]; ok {
+		return decimals
+	}
+	return 2
+}
+
+// RoundForCurrency rounds a number to the decimal places used by a currency
+func RoundForCurrency(num float64, currency string) float64 {
+	precision := math.Pow10(CurrencyDecimals(currency))
+	return math.Round(num*precision) / precision
+}
+
+// FormatAmountForCurrency formats an amount with the decimal places used by a currency
+func FormatAmountForCurrency(amount float64, currency string) string {
+	return strconv.FormatFloat(RoundForCurrency(amount, currency), 'f', CurrencyDecimals(currency), 64)
+}
+
+// currencyStyle describes how amounts in a currency are written for display
+type currencyStyle struct {
+	symbol      string // Includes any space between symbol and digits
+	thousands   string
+	decimal     string
+	symbolAfter bool
+}
+
+// defaultCurrencyStyle groups with commas and uses a decimal point
+var defaultCurrencyStyle = currencyStyle{thousands: ",", decimal: "."}
+
+// currencyStyles lists symbols and separators for commonly used currencies
+// Unlisted currencies are written with their ISO code in front of the default style
+var currencyStyles = map[string]currencyStyle{
+	"AUD": {symbol: "A$", thousands: ",", decimal: "."},
+	"CAD": {symbol: "C$", thousands: ",", decimal: "."},
+	"CNY": {symbol: "¥", thousands: ",", decimal: "."},
+	"EUR": {symbol: "€", thousands: ".", decimal: ","},
+	"GBP": {symbol: "£", thousands: ",", decimal: "."},
+	"IDR": {symbol: "Rp ", thousands: ".", decimal: ","},
+	"INR": {symbol: "₹", thousands: ",", decimal: "."},
+	"JPY": {symbol: "¥", thousands: ",", decimal: "."},
+	"KRW": {symbol: "₩", thousands: ",", decimal: "."},
+	"MYR": {symbol: "RM", thousands: ",", decimal: "."},
+	"PHP": {symbol: "₱", thousands: ",", decimal: "."},
+	"SGD": {symbol: "S$", thousands: ",", decimal: "."},
+	"THB": {symbol: "฿", thousands: ",", decimal: "."},
+	"USD": {symbol: "$", thousands: ",", decimal: "."},
+	"VND": {symbol: " ₫", thousands: ".", decimal: ",", symbolAfter: true},
+}
+
+// FormatCurrency formats an amount for display in a currency, e.g. "Rp 57.500" or "$57.50"
+// Amounts are rounded to the currency's minor unit and digits are grouped in thousands
+func FormatCurrency(amount float64, currency string) string {
+	currency = NormalizeCurrency(currency)
+	style, ok := currencyStyles[currency]
+	if !ok {
+		style = defaultCurrencyStyle
+		if currency != "" {
+			style.symbol = currency + " "
+		}
+	}
+
+	digits := FormatAmountForCurrency(math.Abs(amount), currency)
+	whole, fraction, _ := strings.Cut(digits, ".")
+
+	var b strings.Builder
+	if RoundForCurrency(amount, currency) < 0 {
+		b.WriteString("-")
+	}
+	if !style.symbolAfter {
+		b.WriteString(style.symbol)
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(style.thousands)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(style.decimal)
+		b.WriteString(fraction)
+	}
+	if style.symbolAfter {
+		b.WriteString(style.symbol)
+	}
+	return b.String()
+}
+
+// FormatCurrencyMap formats every amount in a map for display in a currency
+func FormatCurrencyMap(amounts map[string]float64, currency string) map[string]string {
+	formatted := make(map[string]string, len(amounts))
+	for key, amount := range amounts {
+		formatted[key] = FormatCurrency(amount, currency)
+	}
+	return formatted
+}
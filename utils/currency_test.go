@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundForCurrency(t *testing.T) {
+	assert.Equal(t, float64(57800), RoundForCurrency(57799.5, "IDR"))
+	assert.Equal(t, float64(1235), RoundForCurrency(1234.56, "jpy"))
+	assert.Equal(t, 12.35, RoundForCurrency(12.345, "USD"))
+	assert.Equal(t, 1.235, RoundForCurrency(1.2345, "KWD"))
+}
+
+func TestRoundForCurrency_UnknownCurrencyUsesTwoDecimals(t *testing.T) {
+	assert.Equal(t, Round(10.005), RoundForCurrency(10.005, ""))
+	assert.Equal(t, 3.33, RoundForCurrency(10.0/3, "XYZ"))
+}
+
+func TestFormatAmountForCurrency(t *testing.T) {
+	assert.Equal(t, "57800", FormatAmountForCurrency(57800, "IDR"))
+	assert.Equal(t, "12.50", FormatAmountForCurrency(12.5, "USD"))
+	assert.Equal(t, "12.50", FormatAmountForCurrency(12.5, ""))
+}
+
+func TestFormatCurrency(t *testing.T) {
+	assert.Equal(t, "Rp 57.500", FormatCurrency(57500, "IDR"))
+	assert.Equal(t, "Rp 1.234.568", FormatCurrency(1234567.8, "idr"))
+	assert.Equal(t, "$57.50", FormatCurrency(57.5, "USD"))
+	assert.Equal(t, "$1,234,567.89", FormatCurrency(1234567.891, "USD"))
+	assert.Equal(t, "€1.234,50", FormatCurrency(1234.5, "EUR"))
+	assert.Equal(t, "¥1,235", FormatCurrency(1234.5, "JPY"))
+	assert.Equal(t, "57.500 ₫", FormatCurrency(57500, "VND"))
+	assert.Equal(t, "KWD 1.235", FormatCurrency(1.2345, "KWD"))
+	assert.Equal(t, "100.00", FormatCurrency(100, ""))
+}
+
+func TestFormatCurrency_Negative(t *testing.T) {
+	assert.Equal(t, "-$5.25", FormatCurrency(-5.25, "USD"))
+	assert.Equal(t, "-Rp 1.000", FormatCurrency(-1000, "IDR"))
+	assert.Equal(t, "$0.00", FormatCurrency(-0.001, "USD"))
+}
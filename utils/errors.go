@@ -61,4 +61,13 @@ func HandleError(c *gin.Context, err error) {
 // HandleSuccess sends a success response
 func HandleSuccess(c *gin.Context, data interface{}) {
 	c.JSON(http.StatusOK, data)
+}
+
+// HandleCreated sends a 201 response with a Location header pointing at the new resource.
+// The header is left out when location is empty, as when several resources were created.
+func HandleCreated(c *gin.Context, location string, data interface{}) {
+	if location != "" {
+		c.Header("Location", location)
+	}
+	c.JSON(http.StatusCreated, data)
 }
\ No newline at end of file
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleCreated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	HandleCreated(c, "/api/v1/trips/ABC123", gin.H{"code": "ABC123"})
+
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "/api/v1/trips/ABC123", recorder.Header().Get("Location"))
+	assert.JSONEq(t, `{"code":"ABC123"}`, recorder.Body.String())
+}
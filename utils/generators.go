@@ -1,27 +1,55 @@
 package utils
 
 import (
+	cryptorand "crypto/rand"
+	"math/big"
 	"math/rand"
+	"sync"
 	"time"
 )
 
+// rng is seeded once and shared; *rand.Rand is not safe for concurrent use, so guard it
+var (
+	rng   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	rngMu sync.Mutex
+)
+
 // GenerateID generates a random ID for entities
+// IDs appear in URLs next to the trip code, so they are drawn from crypto/rand
 func GenerateID() string {
-	return generateRandomString(IDCharset, IDLength)
+	return generateRandomString(cryptoIntn, IDCharset, IDLength)
 }
 
 // GenerateCode generates a random trip code
+// Codes are user-facing lookup keys, so they are drawn from crypto/rand
 func GenerateCode() string {
-	return generateRandomString(CodeCharset, CodeLength)
+	return generateRandomString(cryptoIntn, CodeCharset, CodeLength)
+}
+
+// intnFunc returns a random int in [0, n)
+type intnFunc func(n int) int
+
+// rngIntn draws from the shared seeded generator
+func rngIntn(n int) int {
+	rngMu.Lock()
+	defer rngMu.Unlock()
+	return rng.Intn(n)
+}
+
+// cryptoIntn draws from crypto/rand, falling back to the shared generator if it fails
+func cryptoIntn(n int) int {
+	v, err := cryptorand.Int(cryptorand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return rngIntn(n)
+	}
+	return int(v.Int64())
 }
 
 // generateRandomString generates a random string with given charset and length
-func generateRandomString(charset string, length int) string {
-	rand.Seed(time.Now().UnixNano())
-	
+func generateRandomString(intn intnFunc, charset string, length int) string {
 	result := make([]byte, length)
 	for i := range result {
-		result[i] = charset[rand.Intn(len(charset))]
+		result[i] = charset[intn(len(charset))]
 	}
 	return string(result)
-}
\ No newline at end of file
+}
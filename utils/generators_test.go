@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateID_ConcurrentNoCollisions(t *testing.T) {
+	const workers = 100
+	const perWorker = 100
+
+	var mu sync.Mutex
+	seen := make(map[string]bool, workers*perWorker)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids := make([]string, perWorker)
+			for i := range ids {
+				ids[i] = GenerateID()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range ids {
+				seen[id] = true
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, workers*perWorker)
+}
+
+func TestGenerateCode_Format(t *testing.T) {
+	code := GenerateCode()
+
+	assert.Len(t, code, CodeLength)
+	for _, ch := range code {
+		assert.Contains(t, CodeCharset, string(ch))
+	}
+}
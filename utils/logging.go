@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// InitLogging installs a JSON structured logger as the default for slog and the log package
+// LOG_LEVEL selects the minimum level (debug, info, warn or error), defaulting to info
+func InitLogging() {
+	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+		Level: ParseLogLevel(os.Getenv("LOG_LEVEL")),
+	})
+	slog.SetDefault(slog.New(handler))
+}
+
+// ParseLogLevel maps a LOG_LEVEL value to a slog level, falling back to info
+func ParseLogLevel(value string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, ParseLogLevel("debug"))
+	assert.Equal(t, slog.LevelDebug, ParseLogLevel(" DEBUG "))
+	assert.Equal(t, slog.LevelWarn, ParseLogLevel("warn"))
+	assert.Equal(t, slog.LevelWarn, ParseLogLevel("warning"))
+	assert.Equal(t, slog.LevelError, ParseLogLevel("error"))
+	assert.Equal(t, slog.LevelInfo, ParseLogLevel("info"))
+	assert.Equal(t, slog.LevelInfo, ParseLogLevel(""))
+	assert.Equal(t, slog.LevelInfo, ParseLogLevel("verbose"))
+}
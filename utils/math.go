@@ -16,7 +16,7 @@ func Min(a, b float64) float64 {
 func CalculateSubtotal(items []ItemAmount) float64 {
 	var subtotal float64
 	for _, item := range items {
-		itemAmount := item.UnitPrice*float64(item.Quantity) - item.ItemDiscount
+		itemAmount := item.UnitPrice*item.Quantity - item.ItemDiscount
 		subtotal += itemAmount
 	}
 	return Round(subtotal)
@@ -25,6 +25,6 @@ func CalculateSubtotal(items []ItemAmount) float64 {
 // ItemAmount represents the basic structure for items with amounts
 type ItemAmount struct {
 	UnitPrice    float64
-	Quantity     int
+	Quantity     float64
 	ItemDiscount float64
 }
\ No newline at end of file
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimiterPruneInterval is how often idle buckets are dropped
+const rateLimiterPruneInterval = time.Minute
+
+// RateLimiter is a token-bucket limiter keeping one bucket per key, e.g. per client IP.
+// Each bucket holds up to burst tokens and refills continuously at the given rate.
+type RateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // Tokens added per second
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// tokenBucket is the remaining allowance of one key
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing requests per interval for each key,
+// with bursts of up to that many requests
+func NewRateLimiter(requests int, interval time.Duration) *RateLimiter {
+	return &RateLimiter{
+		rate:    float64(requests) / interval.Seconds(),
+		burst:   float64(requests),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the key's bucket. When the bucket is empty it returns false
+// with how long until a token is available.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+	l.refill(bucket, now)
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration(math.Ceil((1 - bucket.tokens) / l.rate * float64(time.Second)))
+	return false, wait
+}
+
+// refill adds the tokens earned since the bucket was last used
+func (l *RateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+}
+
+// prune drops buckets that have refilled completely, since they behave like new ones
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < rateLimiterPruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	for key, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRateLimiter(requests int, interval time.Duration) (*RateLimiter, *time.Time) {
+	limiter := NewRateLimiter(requests, interval)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestRateLimiter_AllowsBurstThenRejects(t *testing.T) {
+	limiter, _ := newTestRateLimiter(3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow("1.2.3.4")
+		assert.True(t, allowed)
+	}
+
+	allowed, retryAfter := limiter.Allow("1.2.3.4")
+	assert.False(t, allowed)
+	assert.Equal(t, 20*time.Second, retryAfter)
+}
+
+func TestRateLimiter_RefillsOverTime(t *testing.T) {
+	limiter, now := newTestRateLimiter(2, time.Minute)
+
+	limiter.Allow("1.2.3.4")
+	limiter.Allow("1.2.3.4")
+	allowed, _ := limiter.Allow("1.2.3.4")
+	assert.False(t, allowed)
+
+	*now = now.Add(30 * time.Second)
+	allowed, _ = limiter.Allow("1.2.3.4")
+	assert.True(t, allowed)
+}
+
+func TestRateLimiter_KeysAreIndependent(t *testing.T) {
+	limiter, _ := newTestRateLimiter(1, time.Minute)
+
+	allowed, _ := limiter.Allow("1.2.3.4")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("5.6.7.8")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("1.2.3.4")
+	assert.False(t, allowed)
+}
+
+func TestRateLimiter_PrunesIdleBuckets(t *testing.T) {
+	limiter, now := newTestRateLimiter(1, time.Minute)
+
+	limiter.Allow("1.2.3.4")
+	*now = now.Add(2 * time.Minute)
+	limiter.Allow("5.6.7.8")
+
+	assert.Len(t, limiter.buckets, 1)
+}
@@ -3,23 +3,65 @@ package utils
 import (
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-// NormalizeName converts a name to lowercase for storage consistency
+// NormalizeName converts a name to lowercase with single spaces between words for storage
+// consistency, so it matches the words FormatNameForDisplay shows
 func NormalizeName(name string) string {
-	return strings.ToLower(strings.TrimSpace(name))
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
 }
 
-// FormatNameForDisplay converts a normalized name to title case for display
+// NormalizeCategory converts an expense category to lowercase for storage consistency
+func NormalizeCategory(category string) string {
+	return strings.ToLower(strings.Join(strings.Fields(category), " "))
+}
+
+// NormalizeTripCode converts a user-supplied trip code to its stored uppercase form
+func NormalizeTripCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// NormalizeCurrency converts a currency code to its stored uppercase ISO 4217 form
+func NormalizeCurrency(currency string) string {
+	return strings.ToUpper(strings.TrimSpace(currency))
+}
+
+// nameParticles are surname particles kept lowercase unless they start the name
+var nameParticles = map[string]bool{
+	"al": true, "bin": true, "binti": true, "da": true, "de": true, "del": true,
+	"della": true, "der": true, "di": true, "du": true, "la": true, "le": true,
+	"van": true, "von": true,
+}
+
+// FormatNameForDisplay converts a normalized name to title case for display,
+// capitalizing each word and each hyphenated part ("jean-luc van damme" becomes
+// "Jean-Luc van Damme"). Single letters are treated as initials and capitalized.
 func FormatNameForDisplay(name string) string {
-	name = strings.TrimSpace(name)
-	if name == "" {
+	words := strings.Fields(strings.ToLower(name))
+	for i, word := range words {
+		if i > 0 && nameParticles[word] {
+			continue
+		}
+
+		parts := strings.Split(word, "-")
+		for j, part := range parts {
+			parts[j] = capitalizeFirst(part)
+		}
+		words[i] = strings.Join(parts, "-")
+	}
+	return strings.Join(words, " ")
+}
+
+// capitalizeFirst upper-cases the first rune of a word, so names starting with
+// a multi-byte character keep their remaining bytes intact
+func capitalizeFirst(word string) string {
+	if word == "" {
 		return ""
 	}
-	
-	// Convert to lowercase and capitalize first letter
-	name = strings.ToLower(name)
-	return strings.ToUpper(string(name[0])) + name[1:]
+	first, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(first)) + word[size:]
 }
 
 // NormalizeNames converts a slice of names to lowercase
@@ -33,19 +75,114 @@ func NormalizeNames(names []string) []string {
 
 // FormatNamesForDisplay converts a slice of names to title case
 func FormatNamesForDisplay(names []string) []string {
+	return NameAliases(nil).FormatNames(names)
+}
+
+// NameAliases maps stored (normalized) names to the display form a trip prefers,
+// for names title casing gets wrong ("McDonald") or nicknames. A nil NameAliases
+// formats every name with FormatNameForDisplay.
+type NameAliases map[string]string
+
+// Format returns a name's alias, or its title-cased form when it has none
+func (a NameAliases) Format(name string) string {
+	if alias, ok := a[NormalizeName(name)]; ok {
+		return alias
+	}
+	return FormatNameForDisplay(name)
+}
+
+// FormatNames formats each name in a slice with Format
+func (a NameAliases) FormatNames(names []string) []string {
 	formatted := make([]string, len(names))
 	for i, name := range names {
-		formatted[i] = FormatNameForDisplay(name)
+		formatted[i] = a.Format(name)
 	}
 	return formatted
 }
 
+// NameKeys maps the display form of each name to its stored form, so clients can
+// send back the exact key of a name they showed. Empty names are skipped; it
+// returns nil when there are none.
+func NameKeys(names ...string) map[string]string {
+	return NameAliases(nil).NameKeys(names...)
+}
+
+// NameKeys is like the NameKeys function but displays names with their aliases
+func (a NameAliases) NameKeys(names ...string) map[string]string {
+	var keys map[string]string
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if keys == nil {
+			keys = make(map[string]string)
+		}
+		keys[a.Format(name)] = name
+	}
+	return keys
+}
+
+// Key returns the stored name a client means: the participant whose alias matches
+// name, ignoring case and extra spaces, or else name in storage format. It
+// undoes Format, so names shown with an alias can be sent back as they were shown.
+func (a NameAliases) Key(name string) string {
+	normalized := NormalizeName(name)
+	for participant, alias := range a {
+		if NormalizeName(alias) == normalized {
+			return participant
+		}
+	}
+	return normalized
+}
+
+// Keys converts each name in a slice with Key
+func (a NameAliases) Keys(names []string) []string {
+	if names == nil {
+		return nil
+	}
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = a.Key(name)
+	}
+	return keys
+}
+
+// KeyNameMapKeys converts a map with names as keys to storage format, mapping
+// aliases back to their participants with Key
+func KeyNameMapKeys[T any](input map[string]T, aliases NameAliases) map[string]T {
+	if input == nil {
+		return nil
+	}
+	result := make(map[string]T, len(input))
+	for name, value := range input {
+		result[aliases.Key(name)] = value
+	}
+	return result
+}
+
+// NormalizeNameMapKeys converts a map with names as keys to storage format
+func NormalizeNameMapKeys[T any](input map[string]T) map[string]T {
+	if input == nil {
+		return nil
+	}
+	result := make(map[string]T)
+	for name, value := range input {
+		result[NormalizeName(name)] = value
+	}
+	return result
+}
+
 // FormatNameMap converts a map with names as keys to display format
 func FormatNameMapKeys[T any](input map[string]T) map[string]T {
+	return FormatNameMapKeysWith(input, nil)
+}
+
+// FormatNameMapKeysWith converts a map with names as keys to display format,
+// preferring the given aliases
+func FormatNameMapKeysWith[T any](input map[string]T, aliases NameAliases) map[string]T {
 	result := make(map[string]T)
 	for name, value := range input {
-		formattedName := FormatNameForDisplay(name)
-		result[formattedName] = value
+		result[aliases.Format(name)] = value
 	}
 	return result
 }
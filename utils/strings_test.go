@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatNameForDisplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"single word", "alice", "Alice"},
+		{"empty", "", ""},
+		{"surrounding whitespace", "  bob  ", "Bob"},
+		{"multi-word", "mary jane", "Mary Jane"},
+		{"mixed case input", "MARY jAne watson", "Mary Jane Watson"},
+		{"repeated spaces", "mary   jane", "Mary Jane"},
+		{"hyphenated", "jean-luc", "Jean-Luc"},
+		{"hyphenated surname", "anne smith-jones", "Anne Smith-Jones"},
+		{"particle", "ludwig van beethoven", "Ludwig van Beethoven"},
+		{"indonesian particle", "ahmad bin abdullah", "Ahmad bin Abdullah"},
+		{"leading particle", "van morrison", "Van Morrison"},
+		{"initial", "john f kennedy", "John F Kennedy"},
+		{"unicode", "josé álvarez", "José Álvarez"},
+		{"unicode hyphenated", "zoë-élise", "Zoë-Élise"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, FormatNameForDisplay(tt.input))
+		})
+	}
+}
+
+func TestFormatNameForDisplay_MultiByteNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ömer", "Ömer"},
+		{"élodie", "Élodie"},
+		{"ñuño", "Ñuño"},
+		{"şükrü yılmaz", "Şükrü Yılmaz"},
+		{"иван петров", "Иван Петров"},
+		{"σοφία", "Σοφία"},
+		{"山田 太郎", "山田 太郎"},
+		{"🙂 dewi", "🙂 Dewi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			formatted := FormatNameForDisplay(tt.input)
+			assert.Equal(t, tt.expected, formatted)
+			assert.True(t, utf8.ValidString(formatted))
+		})
+	}
+}
+
+func TestNormalizeName_StillLowercases(t *testing.T) {
+	assert.Equal(t, "mary jane", NormalizeName("  Mary Jane "))
+	assert.Equal(t, "jean-luc", NormalizeName("Jean-Luc"))
+}
+
+func TestNormalizeName_CollapsesWhitespace(t *testing.T) {
+	assert.Equal(t, "jean luc", NormalizeName("Jean  Luc"))
+	assert.Equal(t, "mary jane watson", NormalizeName("mary\tjane \n watson"))
+	assert.Equal(t, NormalizeName(FormatNameForDisplay("jean   luc")), NormalizeName("jean   luc"))
+}
+
+func TestNameKeys(t *testing.T) {
+	keys := NameKeys("del", "jean luc", "", "del")
+
+	assert.Equal(t, map[string]string{"Del": "del", "Jean Luc": "jean luc"}, keys)
+	assert.Nil(t, NameKeys(""))
+}
+
+func TestNameAliases(t *testing.T) {
+	aliases := NameAliases{"mcdonald": "McDonald"}
+
+	assert.Equal(t, "McDonald", aliases.Format("MCDONALD"))
+	assert.Equal(t, "Mary Jane", aliases.Format("mary jane"))
+	assert.Equal(t, []string{"McDonald", "Bob"}, aliases.FormatNames([]string{"mcdonald", "bob"}))
+	assert.Equal(t, map[string]string{"McDonald": "mcdonald", "Bob": "bob"}, aliases.NameKeys("mcdonald", "bob", ""))
+	assert.Equal(t, map[string]int{"McDonald": 1, "Bob": 2}, FormatNameMapKeysWith(map[string]int{"mcdonald": 1, "bob": 2}, aliases))
+
+	// Without aliases names are title-cased as usual
+	assert.Equal(t, "Mcdonald", NameAliases(nil).Format("mcdonald"))
+}
+
+func TestNameAliases_Key(t *testing.T) {
+	aliases := NameAliases{"robert": "Bobby", "mcdonald": "McDonald"}
+
+	assert.Equal(t, "Bobby", aliases.Format("robert"))
+	assert.Equal(t, "robert", aliases.Key("Bobby"))
+	assert.Equal(t, "robert", aliases.Key(" bobby "))
+	assert.Equal(t, "robert", aliases.Key("Robert"))
+	assert.Equal(t, "mcdonald", aliases.Key("McDonald"))
+	assert.Equal(t, []string{"robert", "alice"}, aliases.Keys([]string{"Bobby", "Alice"}))
+	assert.Equal(t, map[string]float64{"robert": 2, "alice": 1}, KeyNameMapKeys(map[string]float64{"Bobby": 2, "Alice": 1}, aliases))
+
+	// Without aliases names are only normalized
+	assert.Equal(t, "bobby", NameAliases(nil).Key("Bobby"))
+}
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 )
 
@@ -37,13 +39,22 @@ func ValidateNotEmpty[T any](slice []T, fieldName string) error {
 	return nil
 }
 
+// AllowNegativeItemPrices permits negative unit prices for refund or credit lines
+// such as coupons, voided items and bottle deposits
+var AllowNegativeItemPrices = true
+
 // ValidateItemData validates basic item data
-func ValidateItemData(unitPrice float64, quantity int, description string) error {
+func ValidateItemData(unitPrice, quantity float64, description string) error {
 	if err := ValidateRequired(description, "item description"); err != nil {
 		return err
 	}
-	if err := ValidatePositive(unitPrice, "item price"); err != nil {
-		return err
+	if unitPrice == 0 {
+		return NewValidationError("item price cannot be zero")
+	}
+	if !AllowNegativeItemPrices {
+		if err := ValidatePositive(unitPrice, "item price"); err != nil {
+			return err
+		}
 	}
 	if quantity <= 0 {
 		return NewValidationError("item quantity must be positive")
@@ -51,6 +62,131 @@ func ValidateItemData(unitPrice float64, quantity int, description string) error
 	return nil
 }
 
+// ValidateItemDiscount checks that an item's discount does not exceed its price times quantity
+func ValidateItemDiscount(itemDiscount, unitPrice, quantity float64) error {
+	itemTotal := unitPrice * quantity
+	if itemDiscount > 0 && Round(itemDiscount) > Round(itemTotal) {
+		return NewValidationError(fmt.Sprintf("item discount %s cannot exceed the item total %s",
+			formatValidationAmount(itemDiscount), formatValidationAmount(itemTotal)))
+	}
+	return nil
+}
+
+// ValidateTotalDiscount checks that a bill-level discount does not exceed the subtotal
+// plus tax and service charge. Included tax is already part of the subtotal.
+func ValidateTotalDiscount(totalDiscount, subtotal, tax, serviceCharge float64, taxInclusive bool) error {
+	limit := subtotal + serviceCharge
+	if !taxInclusive {
+		limit += tax
+	}
+	if Round(totalDiscount) > Round(limit) {
+		return NewValidationError(fmt.Sprintf("discount %s cannot exceed the subtotal plus tax and service charge (%s)",
+			formatValidationAmount(totalDiscount), formatValidationAmount(limit)))
+	}
+	return nil
+}
+
+// ValidateTaxOnServiceCharge rejects taxing the service charge on tax-inclusive bills,
+// whose tax is already part of the item prices and can't be compounded
+func ValidateTaxOnServiceCharge(taxOnServiceCharge, taxInclusive bool) error {
+	if taxOnServiceCharge && taxInclusive {
+		return NewValidationError("taxOnServiceCharge cannot be combined with taxInclusive")
+	}
+	return nil
+}
+
+// formatValidationAmount writes an amount for an error message without trailing zeros
+func formatValidationAmount(amount float64) string {
+	return strconv.FormatFloat(Round(amount), 'f', -1, 64)
+}
+
+// ValidateItemsSubtotal checks that items, including any negative lines, add up to a positive amount
+func ValidateItemsSubtotal(subtotal float64) error {
+	if subtotal <= 0 {
+		return NewValidationError("items must add up to a positive subtotal")
+	}
+	return nil
+}
+
+// ValidateConsumerWeights validates that weights are positive and belong to listed consumers
+func ValidateConsumerWeights(weights map[string]float64, consumers []string) error {
+	known := make(map[string]bool)
+	for _, consumer := range consumers {
+		known[NormalizeName(consumer)] = true
+	}
+	for consumer, weight := range weights {
+		if !known[NormalizeName(consumer)] {
+			return NewValidationError(fmt.Sprintf("weight given for %s who is not a consumer", consumer))
+		}
+		if weight <= 0 {
+			return NewValidationError(fmt.Sprintf("weight for %s must be positive", consumer))
+		}
+	}
+	return nil
+}
+
+// ValidatePayerShares validates that each payer is named, paid a positive amount,
+// and that the shares add up to the expense amount
+func ValidatePayerShares(shares map[string]float64, amount float64) error {
+	var total float64
+	for payer, share := range shares {
+		if strings.TrimSpace(payer) == "" {
+			return NewValidationError("payer name cannot be empty")
+		}
+		if share <= 0 {
+			return NewValidationError(fmt.Sprintf("amount paid by %s must be positive", payer))
+		}
+		total += share
+	}
+	if Round(total) != Round(amount) {
+		return NewValidationError(fmt.Sprintf("payer shares add up to %s but the expense total is %s",
+			formatValidationAmount(total), formatValidationAmount(amount)))
+	}
+	return nil
+}
+
+// ValidateConsumerQuantities validates optional per-consumer unit counts: every consumer
+// needs a positive count, and the counts must add up to the item quantity
+func ValidateConsumerQuantities(quantities map[string]float64, consumers []string, quantity float64) error {
+	if len(quantities) == 0 {
+		return nil
+	}
+
+	normalized := NormalizeNameMapKeys(quantities)
+	known := make(map[string]bool)
+	for _, consumer := range consumers {
+		name := NormalizeName(consumer)
+		known[name] = true
+		if _, exists := normalized[name]; !exists {
+			return NewValidationError(fmt.Sprintf("quantity missing for consumer %s", consumer))
+		}
+	}
+
+	total := 0.0
+	for consumer, count := range quantities {
+		if !known[NormalizeName(consumer)] {
+			return NewValidationError(fmt.Sprintf("quantity given for %s who is not a consumer", consumer))
+		}
+		if count <= 0 {
+			return NewValidationError(fmt.Sprintf("quantity for %s must be positive", consumer))
+		}
+		total += count
+	}
+	// Quantities are stored with three decimals, so compare them at that precision
+	if math.Round(total*1000) != math.Round(quantity*1000) {
+		return NewValidationError(fmt.Sprintf("consumer quantities add up to %g but the item quantity is %g", total, quantity))
+	}
+	return nil
+}
+
+// ValidateTaxRate validates that an optional item tax rate is a percentage between 0 and 100
+func ValidateTaxRate(rate *float64) error {
+	if rate != nil && (*rate < 0 || *rate > 100) {
+		return NewValidationError("tax rate must be between 0 and 100")
+	}
+	return nil
+}
+
 // ValidateParticipantNames validates that all participant names are not empty
 func ValidateParticipantNames(participants []string) error {
 	for i, participant := range participants {
@@ -59,4 +195,18 @@ func ValidateParticipantNames(participants []string) error {
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// IsValidTripCode reports whether code has the shape of a generated trip code:
+// CodeLength characters from CodeCharset. Codes are uppercase, so normalize first.
+func IsValidTripCode(code string) bool {
+	if len(code) != CodeLength {
+		return false
+	}
+	for _, ch := range code {
+		if !strings.ContainsRune(CodeCharset, ch) {
+			return false
+		}
+	}
+	return true
+}
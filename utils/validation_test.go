@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidTripCode(t *testing.T) {
+	tests := []struct {
+		code  string
+		valid bool
+	}{
+		{"ABC123", true},
+		{"ZZZZZZ", true},
+		{"abc123", false},
+		{"ABC12", false},
+		{"ABC1234", false},
+		{"", false},
+		{"ABC-12", false},
+		{"ABC 12", false},
+		{"ABÇ123", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.valid, IsValidTripCode(tt.code), tt.code)
+	}
+}
+
+func TestValidatePayerShares(t *testing.T) {
+	assert.NoError(t, ValidatePayerShares(map[string]float64{"alice": 33.33, "bob": 66.67}, 100))
+	assert.EqualError(t, ValidatePayerShares(map[string]float64{"alice": 50, "bob": 40}, 100),
+		"payer shares add up to 90 but the expense total is 100")
+	assert.EqualError(t, ValidatePayerShares(map[string]float64{"alice": 100, "bob": 0}, 100),
+		"amount paid by bob must be positive")
+	assert.EqualError(t, ValidatePayerShares(map[string]float64{" ": 100}, 100), "payer name cannot be empty")
+}